@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fluorescence/animation"
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/transform"
+	"fmt"
+)
+
+// Animation holds keyframes for the camera and objects of a scene, which is then rendered as a sequence of frames
+type Animation struct {
+	FrameCount    int                `json:"frame_count"`   // number of frames, numbered from 0
+	Interpolation string             `json:"interpolation"` // linear (the default) or catmull_rom
+	Camera        []*CameraKeyframe  `json:"camera"`        // optional keyframes for the selected camera
+	Objects       []*ObjectAnimation `json:"objects"`       // optional keyframes for objects in the scene
+
+	cameraTrack  *animation.Track
+	objectTracks map[string]*animation.Track
+	animated     []*animatedObject
+	frame        int  // frame the scene is currently set to
+	blur         bool // do objects move while the shutter is open?
+}
+
+// CameraKeyframe positions the camera at a frame
+type CameraKeyframe struct {
+	Frame          int            `json:"frame"`
+	EyeLocation    geometry.Point `json:"eye_location"`
+	TargetLocation geometry.Point `json:"target_location"`
+	VerticalFOV    float64        `json:"vertical_fov"` // the camera's own field of view if not set
+}
+
+// ObjectAnimation keyframes the transform of every placement of an object in the scene
+type ObjectAnimation struct {
+	ObjectName string            `json:"object_name"`
+	Keyframes  []*ObjectKeyframe `json:"keyframes"`
+}
+
+// ObjectKeyframe transforms an object at a frame by scaling, then rotating, then translating it
+type ObjectKeyframe struct {
+	Frame       int             `json:"frame"`
+	Translation geometry.Vector `json:"translation"`
+	Rotation    geometry.Vector `json:"rotation"` // degrees about the X, then Y, then Z axes
+	Scale       geometry.Vector `json:"scale"`    // defaults to (1, 1, 1)
+}
+
+// animatedObject is one placement of an animated object in the scene
+type animatedObject struct {
+	track     *animation.Track
+	transform *transform.Transform
+}
+
+// setup builds the keyframe tracks of an animation for the selected camera
+// objects move between a frame and the next while the camera's shutter is open, blurring them
+func (a *Animation) setup(camera *Camera) error {
+	if a.FrameCount < 1 {
+		return fmt.Errorf("animation frame count (%d) less than 1", a.FrameCount)
+	}
+	a.blur = camera.ShutterClose > camera.ShutterOpen
+	if len(a.Camera) > 0 {
+		keyframes := make([]animation.Keyframe, len(a.Camera))
+		for i, k := range a.Camera {
+			fov := k.VerticalFOV
+			if fov == 0.0 {
+				fov = camera.VerticalFOV
+			}
+			keyframes[i] = animation.Keyframe{
+				Frame: k.Frame,
+				Values: []float64{
+					k.EyeLocation.X, k.EyeLocation.Y, k.EyeLocation.Z,
+					k.TargetLocation.X, k.TargetLocation.Y, k.TargetLocation.Z,
+					fov,
+				},
+			}
+		}
+		track, err := animation.NewTrack(keyframes, a.Interpolation)
+		if err != nil {
+			return fmt.Errorf("camera animation: %s", err.Error())
+		}
+		a.cameraTrack = track
+	}
+	a.objectTracks = map[string]*animation.Track{}
+	for _, o := range a.Objects {
+		if _, exists := a.objectTracks[o.ObjectName]; exists {
+			return fmt.Errorf("object (%s) animated more than once", o.ObjectName)
+		}
+		keyframes := make([]animation.Keyframe, len(o.Keyframes))
+		for i, k := range o.Keyframes {
+			scale := k.Scale
+			if scale == (geometry.Vector{}) {
+				scale = geometry.Vector{X: 1.0, Y: 1.0, Z: 1.0}
+			}
+			keyframes[i] = animation.Keyframe{
+				Frame: k.Frame,
+				Values: []float64{
+					k.Translation.X, k.Translation.Y, k.Translation.Z,
+					k.Rotation.X, k.Rotation.Y, k.Rotation.Z,
+					scale.X, scale.Y, scale.Z,
+				},
+			}
+		}
+		track, err := animation.NewTrack(keyframes, a.Interpolation)
+		if err != nil {
+			return fmt.Errorf("animation of object (%s): %s", o.ObjectName, err.Error())
+		}
+		a.objectTracks[o.ObjectName] = track
+	}
+	return nil
+}
+
+// wrap returns a placement of an object in the scene, wrapped in a transform at the first frame if the object is animated
+func (a *Animation) wrap(objectName string, p primitive.Primitive) (primitive.Primitive, error) {
+	track, exists := a.objectTracks[objectName]
+	if !exists {
+		return p, nil
+	}
+	o := &animatedObject{
+		track:     track,
+		transform: &transform.Transform{Primitive: p},
+	}
+	err := o.setFrame(0, a.blur)
+	if err != nil {
+		return nil, fmt.Errorf("animation of object (%s): %s", objectName, err.Error())
+	}
+	a.animated = append(a.animated, o)
+	return o.transform, nil
+}
+
+// setFrame moves the object to where it is at a frame, and on toward the next frame over the shutter interval if blurred
+func (o *animatedObject) setFrame(frame int, blur bool) error {
+	o.transform.Operations = operations(o.track.At(float64(frame)))
+	o.transform.EndOperations = nil
+	if blur {
+		o.transform.EndOperations = operations(o.track.At(float64(frame + 1)))
+	}
+	_, err := o.transform.Setup()
+	return err
+}
+
+// operations returns the transform operations of interpolated object keyframe values
+func operations(values []float64) []transform.Operation {
+	return []transform.Operation{
+		{TypeName: "scale", Factors: geometry.Vector{X: values[6], Y: values[7], Z: values[8]}},
+		{TypeName: "rotate", Axis: geometry.Vector{X: 1.0}, AngleDegrees: values[3]},
+		{TypeName: "rotate", Axis: geometry.Vector{Y: 1.0}, AngleDegrees: values[4]},
+		{TypeName: "rotate", Axis: geometry.Vector{Z: 1.0}, AngleDegrees: values[5]},
+		{TypeName: "translate", Displacement: geometry.Vector{X: values[0], Y: values[1], Z: values[2]}},
+	}
+}
+
+// SetFrame moves the camera and objects of an animated scene to where they are at a frame
+// the scene's BVH is only rebuilt if an object has moved since the last frame
+func (s *Scene) SetFrame(p *Parameters, frame int) error {
+	a := s.Animation
+	if frame < 0 || frame >= a.FrameCount {
+		return fmt.Errorf("frame (%d) not within animation of %d frames", frame, a.FrameCount)
+	}
+	if a.cameraTrack != nil {
+		values := a.cameraTrack.At(float64(frame))
+		s.Camera.EyeLocation = geometry.Point{X: values[0], Y: values[1], Z: values[2]}
+		s.Camera.TargetLocation = geometry.Point{X: values[3], Y: values[4], Z: values[5]}
+		s.Camera.VerticalFOV = values[6]
+		err := s.Camera.Setup(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	moved := false
+	for _, o := range a.animated {
+		if o.track.Changes(float64(a.frame), float64(frame)) ||
+			(a.blur && o.track.Changes(float64(a.frame+1), float64(frame+1))) {
+			moved = true
+			break
+		}
+	}
+	a.frame = frame
+	if !moved {
+		return nil
+	}
+	for _, o := range a.animated {
+		err := o.setFrame(frame, a.blur)
+		if err != nil {
+			return err
+		}
+	}
+	return s.buildObjects(p)
+}
@@ -0,0 +1,113 @@
+package animation
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Linear and CatmullRom are the supported ways of interpolating between keyframes
+const (
+	Linear     = "linear"
+	CatmullRom = "catmull_rom"
+)
+
+// Keyframe is a set of values at a frame
+type Keyframe struct {
+	Frame  int
+	Values []float64
+}
+
+// Track interpolates a set of values between keyframes
+// frames before the first keyframe or after the last hold the values of that keyframe
+type Track struct {
+	keyframes     []Keyframe
+	interpolation string
+}
+
+// NewTrack returns a track through the given keyframes, which may be in any order
+// an empty interpolation is linear
+func NewTrack(keyframes []Keyframe, interpolation string) (*Track, error) {
+	if len(keyframes) == 0 {
+		return nil, fmt.Errorf("no keyframes for track")
+	}
+	if interpolation == "" {
+		interpolation = Linear
+	}
+	if interpolation != Linear && interpolation != CatmullRom {
+		return nil, fmt.Errorf("invalid interpolation (%s)", interpolation)
+	}
+	sorted := append([]Keyframe(nil), keyframes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Frame < sorted[j].Frame
+	})
+	for i, k := range sorted {
+		if len(k.Values) != len(sorted[0].Values) {
+			return nil, fmt.Errorf("keyframe at frame (%d) has %d values instead of %d", k.Frame, len(k.Values), len(sorted[0].Values))
+		}
+		if i > 0 && k.Frame == sorted[i-1].Frame {
+			return nil, fmt.Errorf("frame (%d) keyframed more than once", k.Frame)
+		}
+	}
+	return &Track{
+		keyframes:     sorted,
+		interpolation: interpolation,
+	}, nil
+}
+
+// At returns the values at a frame, which may fall between whole frames
+func (t *Track) At(frame float64) []float64 {
+	last := len(t.keyframes) - 1
+	if frame <= float64(t.keyframes[0].Frame) {
+		return append([]float64(nil), t.keyframes[0].Values...)
+	}
+	if frame >= float64(t.keyframes[last].Frame) {
+		return append([]float64(nil), t.keyframes[last].Values...)
+	}
+	// find the segment from keyframe i to i+1 holding the frame
+	i := sort.Search(len(t.keyframes), func(i int) bool {
+		return float64(t.keyframes[i].Frame) > frame
+	}) - 1
+	a, b := t.keyframes[i], t.keyframes[i+1]
+	s := (frame - float64(a.Frame)) / float64(b.Frame-a.Frame)
+
+	values := make([]float64, len(a.Values))
+	if t.interpolation == Linear {
+		for j := range values {
+			values[j] = a.Values[j] + s*(b.Values[j]-a.Values[j])
+		}
+		return values
+	}
+	// the neighbouring keyframes shape the curve, and the ends repeat themselves
+	before, after := a, b
+	if i > 0 {
+		before = t.keyframes[i-1]
+	}
+	if i+2 <= last {
+		after = t.keyframes[i+2]
+	}
+	for j := range values {
+		values[j] = catmullRom(before.Values[j], a.Values[j], b.Values[j], after.Values[j], s)
+	}
+	return values
+}
+
+// Changes reports whether any value differs between two frames
+func (t *Track) Changes(frame0, frame1 float64) bool {
+	v0, v1 := t.At(frame0), t.At(frame1)
+	for i := range v0 {
+		if v0[i] != v1[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// catmullRom evaluates the uniform Catmull-Rom spline through p1 and p2 at s, shaped by p0 and p3
+func catmullRom(p0, p1, p2, p3, s float64) float64 {
+	s2 := s * s
+	s3 := s2 * s
+	return 0.5 * (2.0*p1 +
+		(p2-p0)*s +
+		(2.0*p0-5.0*p1+4.0*p2-p3)*s2 +
+		(3.0*p1-p0-3.0*p2+p3)*s3)
+}
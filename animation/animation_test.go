@@ -0,0 +1,72 @@
+package animation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTrackLinear(t *testing.T) {
+	track, err := NewTrack([]Keyframe{
+		{Frame: 10, Values: []float64{10.0, 0.0}},
+		{Frame: 0, Values: []float64{0.0, 1.0}},
+	}, Linear)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	v := track.At(2.5)
+	if math.Abs(v[0]-2.5) > 1e-12 || math.Abs(v[1]-0.75) > 1e-12 {
+		t.Errorf("Expected [2.5 0.75] but got %v\n", v)
+	}
+}
+
+func TestTrackHoldsEnds(t *testing.T) {
+	track, _ := NewTrack([]Keyframe{
+		{Frame: 5, Values: []float64{1.0}},
+		{Frame: 10, Values: []float64{2.0}},
+	}, Linear)
+	if v := track.At(0.0); v[0] != 1.0 {
+		t.Errorf("Expected 1 before the first keyframe but got %f\n", v[0])
+	}
+	if v := track.At(20.0); v[0] != 2.0 {
+		t.Errorf("Expected 2 after the last keyframe but got %f\n", v[0])
+	}
+	if track.Changes(0.0, 5.0) {
+		t.Errorf("Expected no change before the first keyframe\n")
+	}
+	if !track.Changes(5.0, 6.0) {
+		t.Errorf("Expected a change between keyframes\n")
+	}
+}
+
+func TestTrackCatmullRomPassesThroughKeyframes(t *testing.T) {
+	keyframes := []Keyframe{
+		{Frame: 0, Values: []float64{0.0}},
+		{Frame: 10, Values: []float64{4.0}},
+		{Frame: 20, Values: []float64{-2.0}},
+		{Frame: 30, Values: []float64{3.0}},
+	}
+	track, _ := NewTrack(keyframes, CatmullRom)
+	for _, k := range keyframes {
+		if v := track.At(float64(k.Frame)); math.Abs(v[0]-k.Values[0]) > 1e-12 {
+			t.Errorf("Expected %f at frame %d but got %f\n", k.Values[0], k.Frame, v[0])
+		}
+	}
+	// shaped by the first keyframe, the curve leaves the second more gently than a straight line would
+	if v := track.At(12.0); v[0] <= 4.0*0.8-2.0*0.2 {
+		t.Errorf("Expected a smooth curve above the straight line but got %f\n", v[0])
+	}
+}
+
+func TestTrackInvalid(t *testing.T) {
+	_, err := NewTrack([]Keyframe{
+		{Frame: 0, Values: []float64{0.0}},
+		{Frame: 0, Values: []float64{1.0}},
+	}, Linear)
+	if err == nil {
+		t.Errorf("Expected error for repeated frame but got nil\n")
+	}
+	_, err = NewTrack([]Keyframe{{Frame: 0, Values: []float64{0.0}}}, "cubic")
+	if err == nil {
+		t.Errorf("Expected error for invalid interpolation but got nil\n")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/primitivelist"
+	"fluorescence/geometry/primitive/sphere"
+	"math"
+	"testing"
+)
+
+// animatedScene returns a scene of a single unit sphere named ball, set up with an animation at its first frame
+func animatedScene(t *testing.T, a *Animation, shutterClose float64) (*Scene, *Parameters) {
+	c, p := testCamera(t, &Camera{VerticalFOV: 60.0, ShutterClose: shutterClose}, 200, 100)
+	err := a.setup(c)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	ball, err := a.wrap("ball", sphere.Unit(0.0, 0.0, 0.0))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	s := &Scene{
+		Camera:           c,
+		Animation:        a,
+		boundedObjects:   &primitivelist.PrimitiveList{List: []primitive.Primitive{ball}},
+		unboundedObjects: &primitivelist.PrimitiveList{},
+	}
+	p.Scene = s
+	err = s.buildObjects(p)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	return s, p
+}
+
+func TestSetFrameCameraOnly(t *testing.T) {
+	s, p := animatedScene(t, &Animation{
+		FrameCount: 3,
+		Camera: []*CameraKeyframe{
+			{Frame: 0, TargetLocation: geometry.Point{Z: -1.0}},
+			{Frame: 2, EyeLocation: geometry.Point{X: 2.0}, TargetLocation: geometry.Point{X: 2.0, Z: -1.0}},
+		},
+	}, 0.0)
+	objects := s.Objects
+	for _, frame := range []int{1, 2, 0} {
+		err := s.SetFrame(p, frame)
+		if err != nil {
+			t.Fatalf("Expected no error but got %s\n", err)
+		}
+		if s.Objects != objects {
+			t.Errorf("Expected the objects kept at frame %d when only the camera moves but they were rebuilt\n", frame)
+		}
+	}
+	err := s.SetFrame(p, 1)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	if s.Camera.EyeLocation != (geometry.Point{X: 1.0}) {
+		t.Errorf("Expected the eye at (1, 0, 0) at frame 1 but got %v\n", s.Camera.EyeLocation)
+	}
+}
+
+func TestSetFrameObjectTrack(t *testing.T) {
+	s, p := animatedScene(t, &Animation{
+		FrameCount: 3,
+		Objects: []*ObjectAnimation{{
+			ObjectName: "ball",
+			Keyframes: []*ObjectKeyframe{
+				{Frame: 0},
+				{Frame: 2, Translation: geometry.Vector{X: 4.0}},
+			},
+		}},
+	}, 0.0)
+	objects := s.Objects
+	err := s.SetFrame(p, 1)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	if s.Objects == objects {
+		t.Errorf("Expected the objects rebuilt when an object moves but they were kept\n")
+	}
+	box, _ := s.Objects.BoundingBox(geometry.MotionStart, geometry.MotionEnd)
+	if math.Abs(box.A.X-1.5) > 1e-6 || math.Abs(box.B.X-2.5) > 1e-6 {
+		t.Errorf("Expected the ball from x 1.5 to 2.5 at frame 1 but got %v\n", box)
+	}
+	// setting the same frame again moves nothing
+	objects = s.Objects
+	err = s.SetFrame(p, 1)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	if s.Objects != objects {
+		t.Errorf("Expected the objects kept when setting the same frame but they were rebuilt\n")
+	}
+}
+
+func TestAnimationScaleThroughZero(t *testing.T) {
+	a := &Animation{
+		FrameCount: 2,
+		Objects: []*ObjectAnimation{{
+			ObjectName: "ball",
+			Keyframes: []*ObjectKeyframe{
+				{Frame: 0},
+				{Frame: 1, Scale: geometry.Vector{X: -1.0, Y: 1.0, Z: 1.0}},
+			},
+		}},
+	}
+	c, _ := testCamera(t, &Camera{VerticalFOV: 60.0, ShutterClose: 1.0}, 200, 100)
+	err := a.setup(c)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	// with the shutter open, the ball would be flattened to nothing halfway through the first frame
+	_, err = a.wrap("ball", sphere.Unit(0.0, 0.0, 0.0))
+	if err == nil {
+		t.Errorf("Expected an error for a scale passing through zero but got none\n")
+	}
+}
+
+func TestParseFrameRange(t *testing.T) {
+	for _, test := range []struct {
+		frames      string
+		first, last int
+	}{
+		{"", 0, 9},
+		{"4", 4, 4},
+		{"2-5", 2, 5},
+		{"0-9", 0, 9},
+	} {
+		first, last, err := parseFrameRange(test.frames, 10)
+		if err != nil || first != test.first || last != test.last {
+			t.Errorf("Expected frames (%s) to be %d to %d but got %d to %d (%v)\n",
+				test.frames, test.first, test.last, first, last, err)
+		}
+	}
+	for _, frames := range []string{"5-3", "-1", "3-", "0-10", "10", "a", "1-b"} {
+		_, _, err := parseFrameRange(frames, 10)
+		if err == nil {
+			t.Errorf("Expected an error for frames (%s) but got none\n", frames)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fluorescence/geometry"
+	"fmt"
 	"math"
 	"math/rand"
 )
@@ -16,6 +17,13 @@ type Camera struct {
 	AspectRatio    float64         `json:"aspect_ratio"`
 	Aperture       float64         `json:"aperture"`
 	FocusDistance  float64         `json:"focus_distance"`
+	ShutterOpen    float64         `json:"shutter_open"`    // ray time the shutter opens at, from 0 (start keyframe) to 1 (end keyframe)
+	ShutterClose   float64         `json:"shutter_close"`   // ray time the shutter closes at, no earlier than it opens
+	Projection     string          `json:"projection"`      // "perspective" (the default), "orthographic", "equirectangular", "fisheye" or "cubemap"
+	OrthoWidth     float64         `json:"ortho_width"`     // width of the view of an orthographic camera, in scene units
+	OrthoHeight    float64         `json:"ortho_height"`    // height of the view of an orthographic camera, from the width and image if unset
+	FisheyeMapping string          `json:"fisheye_mapping"` // "equidistant" (the default) or "equisolid"
+	FisheyeFOV     float64         `json:"fisheye_fov"`     // degrees across the image circle of a fisheye camera, defaults to 180
 
 	lensRadius float64
 	theta      float64
@@ -34,18 +42,37 @@ type Camera struct {
 // Setup is called after allocating the Camera struct and filling the exported fields
 // It fills the unexported fields, such as derived vectors and measures
 func (c *Camera) Setup(p *Parameters) error {
+	if c.ShutterOpen < geometry.MotionStart || c.ShutterClose > geometry.MotionEnd || c.ShutterOpen > c.ShutterClose {
+		return fmt.Errorf("camera shutter interval (%f to %f) not within %f to %f",
+			c.ShutterOpen, c.ShutterClose, geometry.MotionStart, geometry.MotionEnd)
+	}
 	c.UpVector = c.UpVector.Unit()
-	c.AspectRatio = float64(p.ImageWidth) / float64(p.ImageHeight)
+
+	c.w = c.TargetLocation.To(c.EyeLocation).Unit()
+	c.u = c.UpVector.Cross(c.w)
+	c.v = c.w.Cross(c.u)
+
+	switch c.Projection {
+	case "", "perspective", "orthographic":
+		// only panoramic projections can fit the image height to the width
+		if p.ImageHeight <= 0 {
+			return fmt.Errorf("image height (%d) less than 1 for %s projection", p.ImageHeight, c.Projection)
+		}
+		c.AspectRatio = float64(p.ImageWidth) / float64(p.ImageHeight)
+	case "equirectangular", "fisheye", "cubemap":
+		return c.setupPanoramic(p)
+	default:
+		return fmt.Errorf("camera projection (%s) not a valid projection", c.Projection)
+	}
+	if c.Projection == "orthographic" {
+		return c.setupOrthographic()
+	}
 
 	c.lensRadius = c.Aperture / 2.0
 	c.theta = c.VerticalFOV * math.Pi / 180.0
 	c.halfHeight = math.Tan(c.theta / 2.0)
 	c.halfWidth = c.AspectRatio * c.halfHeight
 
-	c.w = c.TargetLocation.To(c.EyeLocation).Unit()
-	c.u = c.UpVector.Cross(c.w)
-	c.v = c.w.Cross(c.u)
-
 	c.lowerLeftCorner = c.EyeLocation.SubVector(
 		c.u.MultScalar(c.halfWidth * c.FocusDistance)).SubVector(
 		c.v.MultScalar(c.halfHeight * c.FocusDistance)).SubVector(
@@ -57,8 +84,96 @@ func (c *Camera) Setup(p *Parameters) error {
 	return nil
 }
 
+// setupOrthographic fills the unexported fields of an orthographic camera, whose view is a rectangle
+// of OrthoWidth by OrthoHeight centered on the eye location and facing the target
+// either size is derived from the other and the image's aspect ratio if unset, so the view is not stretched
+func (c *Camera) setupOrthographic() error {
+	width, height := c.OrthoWidth, c.OrthoHeight
+	if width < 0.0 || height < 0.0 {
+		return fmt.Errorf("camera ortho width or height is negative")
+	}
+	if width == 0.0 && height == 0.0 {
+		return fmt.Errorf("orthographic camera has no ortho width or height")
+	}
+	if width == 0.0 {
+		width = height * c.AspectRatio
+	}
+	if height == 0.0 {
+		height = width / c.AspectRatio
+	}
+	c.halfWidth = width / 2.0
+	c.halfHeight = height / 2.0
+
+	c.lowerLeftCorner = c.EyeLocation.SubVector(
+		c.u.MultScalar(c.halfWidth)).SubVector(
+		c.v.MultScalar(c.halfHeight))
+	c.horizonal = c.u.MultScalar(width)
+	c.verical = c.v.MultScalar(height)
+	return nil
+}
+
+// setupPanoramic checks the settings of a panoramic camera and fits the image to its projection
+// each projection covers an image of a fixed shape, so the image's height follows from its width:
+// twice as wide as high for equirectangular, square for fisheye, and six square faces side by side for cubemap
+// an image height of 0 is set to match, while any other height must already match
+func (c *Camera) setupPanoramic(p *Parameters) error {
+	switch c.Projection {
+	case "equirectangular":
+		c.AspectRatio = 2.0
+	case "fisheye":
+		c.AspectRatio = 1.0
+		switch c.FisheyeMapping {
+		case "", "equidistant", "equisolid":
+		default:
+			return fmt.Errorf("camera fisheye mapping (%s) not a valid mapping", c.FisheyeMapping)
+		}
+		if c.FisheyeFOV == 0.0 {
+			c.FisheyeFOV = 180.0
+		}
+		if c.FisheyeFOV < 0.0 || c.FisheyeFOV > 360.0 {
+			return fmt.Errorf("camera fisheye fov (%f) not within 0 to 360", c.FisheyeFOV)
+		}
+	case "cubemap":
+		c.AspectRatio = 6.0
+	}
+	height := int(math.Round(float64(p.ImageWidth) / c.AspectRatio))
+	if height < 1 {
+		return fmt.Errorf("image width (%d) too small for %s projection", p.ImageWidth, c.Projection)
+	}
+	if p.ImageHeight == 0 {
+		fmt.Printf("\t\tImage height set to %d for %s projection\n", height, c.Projection)
+		p.ImageHeight = height
+	}
+	if height != p.ImageHeight {
+		return fmt.Errorf("image height (%d) not %d, as %s projection needs for image width (%d), or 0 to fit it",
+			p.ImageHeight, height, c.Projection, p.ImageWidth)
+	}
+	return nil
+}
+
 // GetRay returns a Ray from the eye location to a point on the view place u% across and v% up
-func (c *Camera) GetRay(u float64, v float64, rng *rand.Rand) geometry.Ray {
+// orthographic cameras instead start every ray on the view plane u% across and v% up, all heading toward the target,
+// and panoramic cameras send rays from the eye location in the direction their projection maps to u and v
+// it returns false where u and v are outside of the projection, such as the corners of a fisheye image
+func (c *Camera) GetRay(u float64, v float64, rng *rand.Rand) (geometry.Ray, bool) {
+	rayTime := c.ShutterOpen + rng.Float64()*(c.ShutterClose-c.ShutterOpen)
+	switch c.Projection {
+	case "orthographic":
+		return geometry.Ray{
+			Origin: c.lowerLeftCorner.AddVector(
+				c.horizonal.MultScalar(u)).AddVector(
+				c.verical.MultScalar(v)),
+			Direction: c.w.Negate(),
+			Time:      rayTime,
+		}, true
+	case "equirectangular", "fisheye", "cubemap":
+		direction, ok := c.panoramicDirection(u, v)
+		return geometry.Ray{
+			Origin:    c.EyeLocation,
+			Direction: direction,
+			Time:      rayTime,
+		}, ok
+	}
 	randomOnLens := geometry.RandomOnUnitDisk(rng).MultScalar(c.lensRadius)
 	offset := c.u.MultScalar(randomOnLens.X).Add(c.v.MultScalar(randomOnLens.Y))
 	return geometry.Ray{
@@ -68,5 +183,59 @@ func (c *Camera) GetRay(u float64, v float64, rng *rand.Rand) geometry.Ray {
 			c.verical.MultScalar(v)).From(
 			c.EyeLocation).Sub(
 			offset).Unit(),
+		Time: rayTime,
+	}, true
+}
+
+// panoramicDirection returns the direction a panoramic projection maps u% across and v% up the image to,
+// in terms of the camera's right (u), up (v) and backward (w) axes
+func (c *Camera) panoramicDirection(u, v float64) (geometry.Vector, bool) {
+	// local returns the direction x right, y up and z backward of the camera
+	local := func(x, y, z float64) geometry.Vector {
+		return c.u.MultScalar(x).Add(c.v.MultScalar(y)).Add(c.w.MultScalar(z)).Unit()
+	}
+	switch c.Projection {
+	case "equirectangular":
+		// longitude runs from behind the camera on the left, through the target, to behind it on the right,
+		// and latitude from straight down to straight up
+		phi := (u - 0.5) * 2.0 * math.Pi
+		theta := (v - 0.5) * math.Pi
+		return local(math.Cos(theta)*math.Sin(phi), math.Sin(theta), -math.Cos(theta)*math.Cos(phi)), true
+	case "fisheye":
+		// the image circle touches the edges of the image, with the target at its center
+		x, y := 2.0*u-1.0, 2.0*v-1.0
+		r := math.Sqrt(x*x + y*y)
+		if r > 1.0 {
+			return geometry.Vector{}, false
+		}
+		halfFOV := c.FisheyeFOV * math.Pi / 360.0
+		// the angle from the target grows with the distance from the center, evenly for an equidistant lens,
+		// or keeping the solid angle of each pixel the same for an equisolid one
+		theta := r * halfFOV
+		if c.FisheyeMapping == "equisolid" {
+			theta = 2.0 * math.Asin(math.Min(1.0, r*math.Sin(halfFOV/2.0)))
+		}
+		phi := math.Atan2(y, x)
+		return local(math.Sin(theta)*math.Cos(phi), math.Sin(theta)*math.Sin(phi), -math.Cos(theta)), true
+	default:
+		// the faces are +X, -X, +Y, -Y, +Z and -Z of the camera, with +X to its right, +Y up and +Z behind it,
+		// each facing the way an OpenGL cube map's face does
+		face := int(math.Min(5.0, math.Floor(u*6.0)))
+		a := 2.0*(u*6.0-float64(face)) - 1.0
+		b := 2.0*v - 1.0
+		switch face {
+		case 0:
+			return local(1.0, b, -a), true
+		case 1:
+			return local(-1.0, b, a), true
+		case 2:
+			return local(a, 1.0, -b), true
+		case 3:
+			return local(a, -1.0, b), true
+		case 4:
+			return local(a, b, 1.0), true
+		default:
+			return local(-a, b, -1.0), true
+		}
 	}
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fluorescence/geometry"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testCamera returns a camera at the origin looking down -Z with +Y up, so that its right, up and backward axes
+// are +X, +Y and +Z, set up for an image of the given size
+func testCamera(t *testing.T, c *Camera, width, height int) (*Camera, *Parameters) {
+	c.TargetLocation = geometry.Point{Z: -1.0}
+	c.UpVector = geometry.Vector{Y: 1.0}
+	c.FocusDistance = 1.0
+	p := &Parameters{
+		ImageWidth:  width,
+		ImageHeight: height,
+	}
+	err := c.Setup(p)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	return c, p
+}
+
+// closeTo returns whether two vectors are equal to within rounding
+func closeTo(a, b geometry.Vector) bool {
+	return a.Sub(b).Magnitude() < 1e-9
+}
+
+func TestOrthographicGetRay(t *testing.T) {
+	c, _ := testCamera(t, &Camera{Projection: "orthographic", OrthoWidth: 4.0}, 200, 100)
+	rng := rand.New(rand.NewSource(0))
+	for _, test := range []struct {
+		u, v   float64
+		origin geometry.Point
+	}{
+		{0.5, 0.5, geometry.Point{}},
+		{0.0, 0.0, geometry.Point{X: -2.0, Y: -1.0}},
+		{1.0, 1.0, geometry.Point{X: 2.0, Y: 1.0}},
+	} {
+		r, ok := c.GetRay(test.u, test.v, rng)
+		if !ok {
+			t.Fatalf("Expected a ray at (%f, %f) but got none\n", test.u, test.v)
+		}
+		// the height follows from the width and the image's aspect ratio
+		if !closeTo(r.Origin.From(test.origin), geometry.Vector{}) {
+			t.Errorf("Expected a ray at (%f, %f) to start at %v but got %v\n", test.u, test.v, test.origin, r.Origin)
+		}
+		if !closeTo(r.Direction, geometry.Vector{Z: -1.0}) {
+			t.Errorf("Expected every ray toward the target but got %v\n", r.Direction)
+		}
+	}
+}
+
+func TestOrthographicHeightOnly(t *testing.T) {
+	c, _ := testCamera(t, &Camera{Projection: "orthographic", OrthoHeight: 3.0}, 200, 100)
+	// the width follows from the height and the image's aspect ratio
+	for _, test := range []struct {
+		u, v   float64
+		origin geometry.Point
+	}{
+		{0.0, 0.0, geometry.Point{X: -3.0, Y: -1.5}},
+		{1.0, 1.0, geometry.Point{X: 3.0, Y: 1.5}},
+	} {
+		r, _ := c.GetRay(test.u, test.v, rand.New(rand.NewSource(0)))
+		if !closeTo(r.Origin.From(test.origin), geometry.Vector{}) {
+			t.Errorf("Expected a ray at (%f, %f) to start at %v but got %v\n", test.u, test.v, test.origin, r.Origin)
+		}
+	}
+}
+
+func TestOrthographicSizeErrors(t *testing.T) {
+	for _, test := range []struct {
+		width, height float64
+	}{
+		{0.0, 0.0},
+		{-1.0, 0.0},
+		{0.0, -1.0},
+		{4.0, -1.0},
+	} {
+		c := &Camera{
+			TargetLocation: geometry.Point{Z: -1.0},
+			UpVector:       geometry.Vector{Y: 1.0},
+			Projection:     "orthographic",
+			OrthoWidth:     test.width,
+			OrthoHeight:    test.height,
+		}
+		err := c.Setup(&Parameters{ImageWidth: 200, ImageHeight: 100})
+		if err == nil {
+			t.Errorf("Expected an error for an ortho width of %f and height of %f but got none\n", test.width, test.height)
+		}
+	}
+}
+
+func TestEquirectangularGetRay(t *testing.T) {
+	c, p := testCamera(t, &Camera{Projection: "equirectangular"}, 200, 0)
+	if p.ImageHeight != 100 {
+		t.Errorf("Expected the image height fit to 100 but got %d\n", p.ImageHeight)
+	}
+	rng := rand.New(rand.NewSource(0))
+	for _, test := range []struct {
+		u, v      float64
+		direction geometry.Vector
+	}{
+		{0.5, 0.5, geometry.Vector{Z: -1.0}}, // the center is the target
+		{0.75, 0.5, geometry.Vector{X: 1.0}},
+		{0.25, 0.5, geometry.Vector{X: -1.0}},
+		{0.5, 1.0, geometry.Vector{Y: 1.0}},
+	} {
+		r, ok := c.GetRay(test.u, test.v, rng)
+		if !ok || !closeTo(r.Direction, test.direction) {
+			t.Errorf("Expected a ray at (%f, %f) toward %v but got %v (%t)\n", test.u, test.v, test.direction, r.Direction, ok)
+		}
+		if !closeTo(r.Origin.From(c.EyeLocation), geometry.Vector{}) {
+			t.Errorf("Expected every ray from the eye but got %v\n", r.Origin)
+		}
+	}
+}
+
+func TestFisheyeDirection(t *testing.T) {
+	for _, mapping := range []string{"equidistant", "equisolid"} {
+		c, _ := testCamera(t, &Camera{Projection: "fisheye", FisheyeMapping: mapping, FisheyeFOV: 150.0}, 100, 100)
+		d, ok := c.panoramicDirection(0.5, 0.5)
+		if !ok || !closeTo(d, geometry.Vector{Z: -1.0}) {
+			t.Errorf("Expected the %s center toward the target but got %v (%t)\n", mapping, d, ok)
+		}
+		// the edge of the image circle is half the field of view from the target
+		for _, uv := range [][2]float64{{1.0, 0.5}, {0.5, 0.0}, {0.5 + 0.5*math.Sqrt(0.5), 0.5 + 0.5*math.Sqrt(0.5)}} {
+			d, ok := c.panoramicDirection(uv[0], uv[1])
+			angle := math.Acos(d.Dot(geometry.Vector{Z: -1.0})) * 180.0 / math.Pi
+			if !ok || math.Abs(angle-75.0) > 1e-6 {
+				t.Errorf("Expected the %s edge at (%f, %f) 75 degrees from the target but got %f (%t)\n",
+					mapping, uv[0], uv[1], angle, ok)
+			}
+		}
+		// the corners are outside of the image circle
+		if _, ok := c.panoramicDirection(0.95, 0.95); ok {
+			t.Errorf("Expected no %s direction outside of the image circle\n", mapping)
+		}
+		if _, ok := c.GetRay(0.0, 1.0, rand.New(rand.NewSource(0))); ok {
+			t.Errorf("Expected no %s ray outside of the image circle\n", mapping)
+		}
+	}
+}
+
+func TestCubemapFaces(t *testing.T) {
+	c, p := testCamera(t, &Camera{Projection: "cubemap"}, 600, 0)
+	if p.ImageHeight != 100 {
+		t.Errorf("Expected the image height fit to 100 but got %d\n", p.ImageHeight)
+	}
+	faces := []geometry.Vector{
+		{X: 1.0},
+		{X: -1.0},
+		{Y: 1.0},
+		{Y: -1.0},
+		{Z: 1.0},
+		{Z: -1.0},
+	}
+	for i, expected := range faces {
+		d, ok := c.panoramicDirection((float64(i)+0.5)/6.0, 0.5)
+		if !ok || !closeTo(d, expected) {
+			t.Errorf("Expected the center of face %d toward %v but got %v (%t)\n", i, expected, d, ok)
+		}
+	}
+}
+
+func TestImageHeightRequired(t *testing.T) {
+	for _, projection := range []string{"", "perspective", "orthographic"} {
+		for _, height := range []int{0, -100} {
+			c := &Camera{
+				TargetLocation: geometry.Point{Z: -1.0},
+				UpVector:       geometry.Vector{Y: 1.0},
+				VerticalFOV:    60.0,
+				Projection:     projection,
+				OrthoWidth:     4.0,
+			}
+			err := c.Setup(&Parameters{ImageWidth: 200, ImageHeight: height})
+			if err == nil {
+				t.Errorf("Expected an error for an image height of %d with projection (%s) but got none\n", height, projection)
+			}
+		}
+	}
+}
+
+func TestPanoramicImageHeightMismatch(t *testing.T) {
+	c := &Camera{
+		TargetLocation: geometry.Point{Z: -1.0},
+		UpVector:       geometry.Vector{Y: 1.0},
+		Projection:     "equirectangular",
+	}
+	err := c.Setup(&Parameters{ImageWidth: 200, ImageHeight: 200})
+	if err == nil {
+		t.Errorf("Expected an error for an image height not fitting the projection but got none\n")
+	}
+}
@@ -27,6 +27,50 @@ func SurroundingBox(aabb1, aabb2 *AABB) *AABB {
 	}
 }
 
+// sweptSteps is the number of intervals a moving box is sampled over
+const sweptSteps = 32
+
+// Swept returns a box surrounding a moving box between times t0 and t1, sampling it at regular steps
+// the result is padded by half the largest change of any coordinate between steps,
+// so that extremes of smoothly curving motion falling between samples are still covered
+func Swept(t0, t1 float64, boxAt func(float64) *AABB) *AABB {
+	first := boxAt(t0)
+	if t0 == t1 {
+		return first
+	}
+	swept := *first
+	previous := first
+	largestStep := 0.0
+	for i := 1; i <= sweptSteps; i++ {
+		box := boxAt(t0 + (t1-t0)*float64(i)/sweptSteps)
+		swept = *SurroundingBox(&swept, box)
+		for _, d := range [2]geometry.Vector{previous.A.To(box.A), previous.B.To(box.B)} {
+			largestStep = math.Max(largestStep, math.Max(math.Abs(d.X), math.Max(math.Abs(d.Y), math.Abs(d.Z))))
+		}
+		previous = box
+	}
+	padding := geometry.Vector{X: largestStep / 2.0, Y: largestStep / 2.0, Z: largestStep / 2.0}
+	return &AABB{
+		A: swept.A.SubVector(padding),
+		B: swept.B.AddVector(padding),
+	}
+}
+
+// SurfaceArea returns the surface area of the box
+func (aabb *AABB) SurfaceArea() float64 {
+	d := aabb.A.To(aabb.B)
+	return 2.0 * (d.X*d.Y + d.Y*d.Z + d.Z*d.X)
+}
+
+// Centroid returns the center point of the box
+func (aabb *AABB) Centroid() geometry.Point {
+	return geometry.Point{
+		X: (aabb.A.X + aabb.B.X) / 2.0,
+		Y: (aabb.A.Y + aabb.B.Y) / 2.0,
+		Z: (aabb.A.Z + aabb.B.Z) / 2.0,
+	}
+}
+
 // func (aabb *AABB) Intersection(ray geometry.Ray, t0, t1 float64) bool {
 // 	return aabb.IntersectionNew(ray, t0, t1)
 // 	// return aabb.IntersectionClassic(ray, t0, t1)
@@ -34,6 +78,13 @@ func SurroundingBox(aabb1, aabb2 *AABB) *AABB {
 
 // Intersection computer the intersection of this object and a given ray if it exists
 func (aabb *AABB) Intersection(ray geometry.Ray, t0, t1 float64) bool {
+	_, hit := aabb.IntersectionDistance(ray, t0, t1)
+	return hit
+}
+
+// IntersectionDistance computes the intersection of this object and a given ray,
+// returning the ray time at which the ray enters the box (or t0 if it starts inside) if it exists
+func (aabb *AABB) IntersectionDistance(ray geometry.Ray, t0, t1 float64) (float64, bool) {
 	var tx0, tx1, ty0, ty1, tz0, tz1 float64
 
 	tMin := t0
@@ -55,7 +106,7 @@ func (aabb *AABB) Intersection(ray geometry.Ray, t0, t1 float64) bool {
 		tMax = tx1
 	}
 	if tMax <= tMin {
-		return false
+		return 0.0, false
 	}
 
 	// compute Y
@@ -76,7 +127,7 @@ func (aabb *AABB) Intersection(ray geometry.Ray, t0, t1 float64) bool {
 		tMax = ty1
 	}
 	if tMax <= tMin {
-		return false
+		return 0.0, false
 	}
 
 	// compute Z
@@ -96,11 +147,11 @@ func (aabb *AABB) Intersection(ray geometry.Ray, t0, t1 float64) bool {
 		tMax = tz1
 	}
 	if tMax <= tMin {
-		return false
+		return 0.0, false
 	}
 
 	// must be a hit!
-	return true
+	return tMin, true
 }
 
 func (aabb *AABB) intersectionClassic(ray geometry.Ray, t0, t1 float64) bool {
@@ -273,3 +273,21 @@ func BenchmarkAABBIntersectionZAxisMiss(b *testing.B) {
 	}
 	aabbHit = h
 }
+
+func TestAABBSurfaceArea(t *testing.T) {
+	aabb := basicAABB(2.0, 3.0, 4.0)
+	area := aabb.SurfaceArea()
+	if area != 6.0 {
+		t.Errorf("Expected 6 but got %f\n", area)
+	}
+}
+
+func TestSweptCoversMotion(t *testing.T) {
+	box := Swept(0.0, 1.0, func(time float64) *AABB {
+		return basicAABB(10.0*time, 0.0, 0.0)
+	})
+	start, end := basicAABB(0.0, 0.0, 0.0), basicAABB(10.0, 0.0, 0.0)
+	if box.A.X > start.A.X || box.B.X < end.B.X {
+		t.Errorf("Expected box from x %f to %f but got %v\n", start.A.X, end.B.X, box)
+	}
+}
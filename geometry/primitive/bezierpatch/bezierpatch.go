@@ -0,0 +1,421 @@
+package bezierpatch
+
+import (
+	"bufio"
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/bvh"
+	"fluorescence/geometry/primitive/primitivelist"
+	"fluorescence/geometry/primitive/trianglemesh"
+	"fluorescence/shading/material"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+)
+
+// BezierPatch is a surface made of bicubic Bezier patches, such as the Utah teapot, loaded from a .bpt file
+// patches are either tessellated into triangles finely enough to stay within a tolerance of the surface,
+// or intersected directly by Newton iteration on the patch
+// texture coordinates and normals come from each patch's own parameterization
+type BezierPatch struct {
+	FileName  string               `json:"file_name"` // path to the .bpt file
+	Patches   [][16]geometry.Point `json:"patches"`   // control points of each patch, four rows of four, used if there is no file
+	Mode      string               `json:"mode"`      // "tessellate" (the default) or "direct"
+	Tolerance float64              `json:"tolerance"` // furthest the triangles or flat pieces may be from the surface, a thousandth of its size if unset
+	primitive primitive.Primitive  // the triangle mesh or the BVH of pieces of patches
+	mat       material.Material
+}
+
+// maxSegments is the most segments a patch is divided into along either direction when tessellating
+const maxSegments = 64
+
+// maxDepth is the most times a patch is halved into pieces for direct intersection
+const maxDepth = 8
+
+// Setup loads the patches if needed and prepares them for intersection
+func (bp *BezierPatch) Setup() (*BezierPatch, error) {
+	if bp.FileName != "" {
+		patchFile, err := os.Open(bp.FileName)
+		if err != nil {
+			return nil, err
+		}
+		defer patchFile.Close()
+		bp.Patches, err = parseBPT(patchFile)
+		if err != nil {
+			return nil, fmt.Errorf("bpt (%s): %s", bp.FileName, err.Error())
+		}
+	}
+	if len(bp.Patches) == 0 {
+		return nil, fmt.Errorf("bezier patch has no patches")
+	}
+	if bp.Tolerance < 0.0 {
+		return nil, fmt.Errorf("bezier patch tolerance is negative")
+	}
+	if bp.Tolerance == 0.0 {
+		min, max := bp.Patches[0][0], bp.Patches[0][0]
+		for _, cp := range bp.Patches {
+			for _, p := range cp {
+				min = geometry.MinComponents(min, p)
+				max = geometry.MaxComponents(max, p)
+			}
+		}
+		bp.Tolerance = 1e-3 * min.To(max).Magnitude()
+		if bp.Tolerance == 0.0 {
+			return nil, fmt.Errorf("bezier patch has no size")
+		}
+	}
+
+	switch bp.Mode {
+	case "", "tessellate":
+		tm := &trianglemesh.TriangleMesh{}
+		for i := range bp.Patches {
+			tessellate(&bp.Patches[i], bp.Tolerance, tm)
+		}
+		triangleMesh, err := tm.Setup()
+		if err != nil {
+			return nil, err
+		}
+		bp.primitive = triangleMesh
+	case "direct":
+		var pieces []primitive.Primitive
+		for i := range bp.Patches {
+			pieces = split(&bp.Patches[i], bp.Patches[i], 0.0, 1.0, 0.0, 1.0, bp.Tolerance, 0, pieces)
+		}
+		pl, err := primitivelist.FromElements(pieces...)
+		if err != nil {
+			return nil, err
+		}
+		bp.primitive, err = bvh.New(pl)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown bezier patch mode (%s)", bp.Mode)
+	}
+	return bp, nil
+}
+
+// parseBPT reads the .bpt format: the number of patches, then for each patch its degrees in u and v
+// followed by its control points, one row of v after another
+func parseBPT(r io.Reader) ([][16]geometry.Point, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	next := func() (float64, error) {
+		if !scanner.Scan() {
+			if scanner.Err() != nil {
+				return 0.0, scanner.Err()
+			}
+			return 0.0, fmt.Errorf("unexpected end of file")
+		}
+		return strconv.ParseFloat(scanner.Text(), 64)
+	}
+	count, err := next()
+	if err != nil {
+		return nil, err
+	}
+	if count < 1 || count != math.Trunc(count) {
+		return nil, fmt.Errorf("patch count (%g) is not a positive integer", count)
+	}
+	patches := make([][16]geometry.Point, int(count))
+	for i := range patches {
+		uDegree, err := next()
+		if err != nil {
+			return nil, err
+		}
+		vDegree, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if uDegree != 3 || vDegree != 3 {
+			return nil, fmt.Errorf("patch %d has degrees %g by %g, but only bicubic patches are supported", i, uDegree, vDegree)
+		}
+		for j := range patches[i] {
+			var xyz [3]float64
+			for k := range xyz {
+				xyz[k], err = next()
+				if err != nil {
+					return nil, err
+				}
+			}
+			patches[i][j] = geometry.Point{X: xyz[0], Y: xyz[1], Z: xyz[2]}
+		}
+	}
+	return patches, nil
+}
+
+// bernstein returns the cubic Bernstein polynomials at t and their derivatives
+func bernstein(t float64) ([4]float64, [4]float64) {
+	s := 1.0 - t
+	return [4]float64{s * s * s, 3.0 * t * s * s, 3.0 * t * t * s, t * t * t},
+		[4]float64{-3.0 * s * s, 3.0 * s * (s - 2.0*t), 3.0 * t * (2.0*s - t), 3.0 * t * t}
+}
+
+// evaluate returns the point on a patch at (u, v) along with its partial derivatives in u and v
+// u runs along each row of control points and v from one row to the next
+func evaluate(cp *[16]geometry.Point, u, v float64) (geometry.Point, geometry.Vector, geometry.Vector) {
+	bu, du := bernstein(u)
+	bv, dv := bernstein(v)
+	var p, pu, pv geometry.Vector
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			c := geometry.Vector(cp[4*i+j])
+			p = p.Add(c.MultScalar(bv[i] * bu[j]))
+			pu = pu.Add(c.MultScalar(bv[i] * du[j]))
+			pv = pv.Add(c.MultScalar(dv[i] * bu[j]))
+		}
+	}
+	return geometry.Point(p), pu, pv
+}
+
+// normal returns the unit normal of a patch at (u, v)
+// where the patch is degenerate, such as where a row of control points meets at a pole, it is taken from just inside
+func normal(cp *[16]geometry.Point, u, v float64) geometry.Vector {
+	for i := 0; i < 8; i++ {
+		_, pu, pv := evaluate(cp, u, v)
+		n := pu.Cross(pv)
+		if n.Magnitude() > 1e-12 {
+			return n.Unit()
+		}
+		u += (0.5 - u) * 1e-3 * math.Pow(10.0, float64(i)/2.0)
+		v += (0.5 - v) * 1e-3 * math.Pow(10.0, float64(i)/2.0)
+	}
+	return geometry.VectorZero
+}
+
+// segments returns how many straight segments a cubic Bezier curve with the given control points needs
+// for every segment to stay within tolerance of the curve
+// the second differences of the control points bound the curve's second derivative
+func segments(tolerance float64, a, b, c, d geometry.Point) int {
+	l0 := math.Max(a.To(b).Sub(b.To(c)).Magnitude(), b.To(c).Sub(c.To(d)).Magnitude())
+	n := int(math.Ceil(math.Sqrt(0.75 * l0 / tolerance)))
+	return minInt(maxSegments, maxInt(1, n))
+}
+
+// tessellate appends triangles covering a patch to the TriangleMesh buffers
+// each boundary is divided by its own curve alone, so patches sharing a boundary divide it the same way and leave
+// no cracks, and is joined to a regular grid covering the inside of the patch
+func tessellate(cp *[16]geometry.Point, tolerance float64, tm *trianglemesh.TriangleMesh) {
+	indices := map[[2]float64]int{}
+	vertex := func(u, v float64) int {
+		key := [2]float64{u, v}
+		if index, ok := indices[key]; ok {
+			return index
+		}
+		p, _, _ := evaluate(cp, u, v)
+		tm.Vertices = append(tm.Vertices, p)
+		tm.Normals = append(tm.Normals, normal(cp, u, v))
+		tm.UVs = append(tm.UVs, [2]float64{u, v})
+		indices[key] = len(tm.Vertices) - 1
+		return indices[key]
+	}
+	triangle := func(a, b, c int) {
+		// wind counterclockwise in (u, v), which faces the triangle along the patch's normal
+		ua, ub, uc := tm.UVs[a], tm.UVs[b], tm.UVs[c]
+		uvArea := (ub[0]-ua[0])*(uc[1]-ua[1]) - (ub[1]-ua[1])*(uc[0]-ua[0])
+		if uvArea == 0.0 {
+			return
+		}
+		if uvArea < 0.0 {
+			b, c = c, b
+		}
+		pa, pb, pc := tm.Vertices[a], tm.Vertices[b], tm.Vertices[c]
+		if pa.To(pb).Cross(pa.To(pc)).Magnitude() == 0.0 {
+			// skip triangles collapsed at a pole
+			return
+		}
+		tm.Indices = append(tm.Indices, a, b, c)
+	}
+
+	// the inner grid is divided finely enough for every row and column of control points
+	nu, nv := 2, 2
+	for i := 0; i < 4; i++ {
+		nu = maxInt(nu, segments(tolerance, cp[4*i], cp[4*i+1], cp[4*i+2], cp[4*i+3]))
+		nv = maxInt(nv, segments(tolerance, cp[i], cp[4+i], cp[8+i], cp[12+i]))
+	}
+	for i := 1; i < nu-1; i++ {
+		for j := 1; j < nv-1; j++ {
+			u0, u1 := float64(i)/float64(nu), float64(i+1)/float64(nu)
+			v0, v1 := float64(j)/float64(nv), float64(j+1)/float64(nv)
+			triangle(vertex(u0, v0), vertex(u1, v0), vertex(u1, v1))
+			triangle(vertex(u0, v0), vertex(u1, v1), vertex(u0, v1))
+		}
+	}
+
+	// each side runs counterclockwise around the patch, mapping a distance along it to (u, v)
+	sides := [4]struct {
+		n  int
+		at func(s float64) (float64, float64)
+	}{
+		{segments(tolerance, cp[0], cp[1], cp[2], cp[3]), func(s float64) (float64, float64) { return s, 0.0 }},
+		{segments(tolerance, cp[3], cp[7], cp[11], cp[15]), func(s float64) (float64, float64) { return 1.0, s }},
+		{segments(tolerance, cp[15], cp[14], cp[13], cp[12]), func(s float64) (float64, float64) { return 1.0 - s, 1.0 }},
+		{segments(tolerance, cp[12], cp[8], cp[4], cp[0]), func(s float64) (float64, float64) { return 0.0, 1.0 - s }},
+	}
+	// the matching side of the inner grid, from one inner corner to the next
+	inner := [4]func(k int) (float64, float64, float64){
+		func(k int) (float64, float64, float64) {
+			return float64(k) / float64(nu), float64(k) / float64(nu), 1.0 / float64(nv)
+		},
+		func(k int) (float64, float64, float64) {
+			return float64(k) / float64(nv), float64(nu-1) / float64(nu), float64(k) / float64(nv)
+		},
+		func(k int) (float64, float64, float64) {
+			return float64(k) / float64(nu), float64(nu-k) / float64(nu), float64(nv-1) / float64(nv)
+		},
+		func(k int) (float64, float64, float64) {
+			return float64(k) / float64(nv), 1.0 / float64(nu), float64(nv-k) / float64(nv)
+		},
+	}
+	for side, boundary := range sides {
+		innerCount := nu
+		if side%2 == 1 {
+			innerCount = nv
+		}
+		// zip the boundary and the inner side together, stepping along whichever is behind
+		b, k := 0, 1
+		for b < boundary.n || k < innerCount-1 {
+			u, v := boundary.at(float64(b) / float64(boundary.n))
+			current := vertex(u, v)
+			_, iu, iv := inner[side](k)
+			innerVertex := vertex(iu, iv)
+			nextBoundary := float64(b+1) / float64(boundary.n)
+			nextInner, _, _ := inner[side](k + 1)
+			if k == innerCount-1 || (b < boundary.n && nextBoundary <= nextInner) {
+				u, v = boundary.at(nextBoundary)
+				triangle(current, vertex(u, v), innerVertex)
+				b++
+			} else {
+				_, nextU, nextV := inner[side](k + 1)
+				triangle(current, vertex(nextU, nextV), innerVertex)
+				k++
+			}
+		}
+	}
+}
+
+// split divides a patch into pieces flat to within tolerance, appending them to pieces
+// cp holds the control points of the piece covering u0 to u1 and v0 to v1 of the whole patch
+func split(patch *[16]geometry.Point, cp [16]geometry.Point, u0, u1, v0, v1, tolerance float64, depth int, pieces []primitive.Primitive) []primitive.Primitive {
+	// measure how far the control points stray from the bilinear patch between the corners
+	deviation := 0.0
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			s, t := float64(j)/3.0, float64(i)/3.0
+			bottom := geometry.Vector(cp[0]).MultScalar(1.0 - s).Add(geometry.Vector(cp[3]).MultScalar(s))
+			top := geometry.Vector(cp[12]).MultScalar(1.0 - s).Add(geometry.Vector(cp[15]).MultScalar(s))
+			bilinear := geometry.Point(bottom.MultScalar(1.0 - t).Add(top.MultScalar(t)))
+			deviation = math.Max(deviation, bilinear.To(cp[4*i+j]).Magnitude())
+		}
+	}
+	if deviation <= tolerance || depth == maxDepth {
+		return append(pieces, newPiece(patch, cp, u0, u1, v0, v1, tolerance))
+	}
+
+	// halve the piece across whichever direction it bends more in
+	bendU, bendV := 0.0, 0.0
+	for i := 0; i < 4; i++ {
+		bendU = math.Max(bendU, float64(segments(tolerance, cp[4*i], cp[4*i+1], cp[4*i+2], cp[4*i+3])))
+		bendV = math.Max(bendV, float64(segments(tolerance, cp[i], cp[4+i], cp[8+i], cp[12+i])))
+	}
+	var first, second [16]geometry.Point
+	if bendU >= bendV {
+		for i := 0; i < 4; i++ {
+			halves := halve(cp[4*i], cp[4*i+1], cp[4*i+2], cp[4*i+3])
+			copy(first[4*i:4*i+4], halves[0:4])
+			copy(second[4*i:4*i+4], halves[3:7])
+		}
+		uMiddle := (u0 + u1) / 2.0
+		pieces = split(patch, first, u0, uMiddle, v0, v1, tolerance, depth+1, pieces)
+		return split(patch, second, uMiddle, u1, v0, v1, tolerance, depth+1, pieces)
+	}
+	for j := 0; j < 4; j++ {
+		halves := halve(cp[j], cp[4+j], cp[8+j], cp[12+j])
+		for i := 0; i < 4; i++ {
+			first[4*i+j] = halves[i]
+			second[4*i+j] = halves[i+3]
+		}
+	}
+	vMiddle := (v0 + v1) / 2.0
+	pieces = split(patch, first, u0, u1, v0, vMiddle, tolerance, depth+1, pieces)
+	return split(patch, second, u0, u1, vMiddle, v1, tolerance, depth+1, pieces)
+}
+
+// halve splits a cubic Bezier curve at its middle, returning the control points of both halves with the middle one shared
+func halve(a, b, c, d geometry.Point) [7]geometry.Point {
+	ab := lerp(a, b)
+	bc := lerp(b, c)
+	cd := lerp(c, d)
+	abc := lerp(ab, bc)
+	bcd := lerp(bc, cd)
+	return [7]geometry.Point{a, ab, abc, lerp(abc, bcd), bcd, cd, d}
+}
+
+// lerp returns the point halfway between a and b
+func lerp(a, b geometry.Point) geometry.Point {
+	return geometry.Point(geometry.Vector(a).Add(geometry.Vector(b)).MultScalar(0.5))
+}
+
+// minInt returns the smaller of two ints
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt returns the larger of two ints
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (bp *BezierPatch) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !bp.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (bp *BezierPatch) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	if !bp.primitive.(primitive.HitRecorder).IntersectionInto(ray, tMin, tMax, rayHit) {
+		return false
+	}
+	rayHit.Material = bp.mat
+	return true
+}
+
+// BoundingBox returns an AABB for this object
+func (bp *BezierPatch) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return bp.primitive.BoundingBox(t0, t1)
+}
+
+// SetMaterial sets this object's material
+func (bp *BezierPatch) SetMaterial(m material.Material) {
+	bp.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (bp *BezierPatch) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (bp *BezierPatch) IsClosed() bool {
+	return false
+}
+
+// Copy returns a shallow copy of this object
+// the copy shares its triangles or pieces with the original but may be given its own material
+func (bp *BezierPatch) Copy() primitive.Primitive {
+	newBP := *bp
+	return &newBP
+}
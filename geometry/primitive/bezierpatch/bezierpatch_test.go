@@ -0,0 +1,187 @@
+package bezierpatch
+
+import (
+	"fluorescence/geometry"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var bezierPatchHitSink bool
+
+// flatPatch returns the control points of a flat patch covering 0 to 3 in X and Y at Z 0
+func flatPatch() [16]geometry.Point {
+	var cp [16]geometry.Point
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			cp[4*i+j] = geometry.Point{X: float64(j), Y: float64(i), Z: 0.0}
+		}
+	}
+	return cp
+}
+
+// domePatch returns the control points of a patch over 0 to 3 in X and Y, raised in the middle
+func domePatch() [16]geometry.Point {
+	cp := flatPatch()
+	for _, i := range []int{5, 6, 9, 10} {
+		cp[i].Z = 2.0
+	}
+	return cp
+}
+
+func TestBezierPatchIntersectionHit(t *testing.T) {
+	for _, mode := range []string{"tessellate", "direct"} {
+		bp, err := (&BezierPatch{
+			Patches: [][16]geometry.Point{flatPatch()},
+			Mode:    mode,
+		}).Setup()
+		if err != nil {
+			t.Fatalf("Expected no error but got %s\n", err)
+		}
+		r := geometry.Ray{
+			Origin: geometry.Point{
+				X: 0.75,
+				Y: 1.5,
+				Z: 5.0,
+			},
+			Direction: geometry.Vector{
+				X: 0.0,
+				Y: 0.0,
+				Z: -1.0,
+			},
+		}
+		rh, h := bp.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if !h {
+			t.Fatalf("Expected true (hit) in %s mode but got %t\n", mode, h)
+		}
+		if math.Abs(rh.Time-5.0) > 1e-6 {
+			t.Errorf("Expected hit at time 5 in %s mode but got %f\n", mode, rh.Time)
+		}
+		if math.Abs(rh.U-0.25) > 1e-6 || math.Abs(rh.V-0.5) > 1e-6 {
+			t.Errorf("Expected UV (0.25, 0.5) in %s mode but got (%f, %f)\n", mode, rh.U, rh.V)
+		}
+		if math.Abs(rh.NormalAtHit.Z-1.0) > 1e-6 {
+			t.Errorf("Expected normal along +Z in %s mode but got %v\n", mode, rh.NormalAtHit)
+		}
+	}
+}
+
+func BenchmarkBezierPatchIntersectionHit(b *testing.B) {
+	bp, _ := (&BezierPatch{
+		Patches: [][16]geometry.Point{domePatch()},
+		Mode:    "direct",
+	}).Setup()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.2,
+			Y: 1.4,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	for n := 0; n < b.N; n++ {
+		_, h = bp.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	bezierPatchHitSink = h
+}
+
+func TestBezierPatchIntersectionMiss(t *testing.T) {
+	for _, mode := range []string{"tessellate", "direct"} {
+		bp, _ := (&BezierPatch{
+			Patches: [][16]geometry.Point{domePatch()},
+			Mode:    mode,
+		}).Setup()
+		r := geometry.Ray{
+			Origin: geometry.Point{
+				X: 3.5,
+				Y: 1.5,
+				Z: 5.0,
+			},
+			Direction: geometry.Vector{
+				X: 0.0,
+				Y: 0.0,
+				Z: -1.0,
+			},
+		}
+		_, h := bp.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if h {
+			t.Errorf("Expected false (miss) in %s mode but got %t\n", mode, h)
+		}
+	}
+}
+
+func TestBezierPatchModesAgree(t *testing.T) {
+	tessellated, _ := (&BezierPatch{
+		Patches: [][16]geometry.Point{domePatch()},
+	}).Setup()
+	direct, _ := (&BezierPatch{
+		Patches: [][16]geometry.Point{domePatch()},
+		Mode:    "direct",
+	}).Setup()
+	for _, origin := range []geometry.Point{{X: 1.5, Y: 1.5, Z: 5.0}, {X: 0.4, Y: 2.1, Z: 5.0}, {X: 2.3, Y: 0.3, Z: 5.0}} {
+		r := geometry.Ray{
+			Origin: origin,
+			Direction: geometry.Vector{
+				X: 0.1,
+				Y: 0.0,
+				Z: -1.0,
+			},
+		}
+		rhT, hT := tessellated.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		rhD, hD := direct.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if !hT || !hD {
+			t.Fatalf("Expected both modes to hit from %v but got %t and %t\n", origin, hT, hD)
+		}
+		// the tessellation stays within the default tolerance, a thousandth of the patch's size
+		if math.Abs(rhT.Time-rhD.Time) > 0.01 {
+			t.Errorf("Expected matching hit times from %v but got %f and %f\n", origin, rhT.Time, rhD.Time)
+		}
+		if rhD.NormalAtHit.Dot(rhT.NormalAtHit) < 0.99 {
+			t.Errorf("Expected matching normals from %v but got %v and %v\n", origin, rhD.NormalAtHit, rhT.NormalAtHit)
+		}
+		// the direct hit lies on the surface where its UV says
+		p, _, _ := evaluate(&direct.Patches[0], rhD.U, rhD.V)
+		if r.PointAt(rhD.Time).To(p).Magnitude() > 1e-6 {
+			t.Errorf("Expected direct hit on the surface at its UV but it is %f away\n", r.PointAt(rhD.Time).To(p).Magnitude())
+		}
+	}
+}
+
+func TestParseBPT(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("1\n3 3\n")
+	for _, p := range domePatch() {
+		for _, f := range []float64{p.X, p.Y, p.Z} {
+			b.WriteString(strconv.FormatFloat(f, 'f', -1, 64) + " ")
+		}
+		b.WriteString("\n")
+	}
+	patches, err := parseBPT(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	if len(patches) != 1 || patches[0] != domePatch() {
+		t.Errorf("Expected the dome patch but got %v\n", patches)
+	}
+}
+
+func TestParseBPTErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"0",
+		"1\n2 3\n",
+		"1\n3 3\n0 0 0\n",
+		"1\n3 3\nx 0 0\n",
+	} {
+		_, err := parseBPT(strings.NewReader(s))
+		if err == nil {
+			t.Errorf("Expected an error parsing %q but got none\n", s)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package bezierpatch
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"math"
+)
+
+// piece is a nearly flat part of a patch, covering u0 to u1 and v0 to v1 of it, intersected by Newton iteration
+type piece struct {
+	patch          *[16]geometry.Point
+	u0, u1, v0, v1 float64
+	corners        [4]geometry.Point // the surface at (u0, v0), (u1, v0), (u1, v1) and (u0, v1)
+	epsilon        float64           // distance from the ray at which Newton iteration has converged
+	box            *aabb.AABB
+}
+
+// newtonSteps is the most Newton iterations tried from each starting point
+const newtonSteps = 12
+
+// newPiece returns the piece of a patch with control points cp, bounded by the convex hull of the control points
+func newPiece(patch *[16]geometry.Point, cp [16]geometry.Point, u0, u1, v0, v1, tolerance float64) *piece {
+	min, max := cp[0], cp[0]
+	for _, p := range cp[1:] {
+		min = geometry.MinComponents(min, p)
+		max = geometry.MaxComponents(max, p)
+	}
+	padding := geometry.Vector{X: 1e-7, Y: 1e-7, Z: 1e-7}
+	return &piece{
+		patch:   patch,
+		u0:      u0,
+		u1:      u1,
+		v0:      v0,
+		v1:      v1,
+		corners: [4]geometry.Point{cp[0], cp[3], cp[15], cp[12]},
+		epsilon: 1e-5 * tolerance,
+		box: &aabb.AABB{
+			A: min.SubVector(padding),
+			B: max.AddVector(padding),
+		},
+	}
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (p *piece) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !p.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+// Newton iteration starts where the ray crosses the two triangles between the piece's corners, or from its middle
+func (p *piece) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	if !p.box.Intersection(ray, tMin, tMax) {
+		return false
+	}
+	// the ray is the line where two planes containing it meet
+	direction := ray.Direction.Unit()
+	n1, n2 := direction.Basis()
+
+	var starts [3][2]float64
+	count := 0
+	if a, b, ok := crossing(ray, p.corners[0], p.corners[1], p.corners[2]); ok {
+		starts[count] = [2]float64{p.u0 + (p.u1-p.u0)*(a+b), p.v0 + (p.v1-p.v0)*b}
+		count++
+	}
+	if a, b, ok := crossing(ray, p.corners[0], p.corners[2], p.corners[3]); ok {
+		starts[count] = [2]float64{p.u0 + (p.u1-p.u0)*a, p.v0 + (p.v1-p.v0)*(a+b)}
+		count++
+	}
+	starts[count] = [2]float64{(p.u0 + p.u1) / 2.0, (p.v0 + p.v1) / 2.0}
+	count++
+
+	for _, start := range starts[:count] {
+		u, v, ok := p.newton(ray.Origin, n1, n2, start[0], start[1])
+		if !ok {
+			continue
+		}
+		// each piece only reports hits on its own part of the patch, leaving the rest to its neighbors
+		slack := 1e-9
+		if u < p.u0-slack || u > p.u1+slack || v < p.v0-slack || v > p.v1+slack {
+			continue
+		}
+		point, _, _ := evaluate(p.patch, u, v)
+		t := ray.Origin.To(point).Dot(ray.Direction) / ray.Direction.Dot(ray.Direction)
+		if t < tMin || t > tMax {
+			continue
+		}
+		*rayHit = material.RayHit{
+			Ray:         ray,
+			NormalAtHit: normal(p.patch, u, v),
+			Time:        t,
+			U:           u,
+			V:           v,
+		}
+		return true
+	}
+	return false
+}
+
+// newton moves (u, v) until the patch there lies on the ray, given as the meeting of planes with normals n1 and n2
+// through origin, returning whether it converged
+func (p *piece) newton(origin geometry.Point, n1, n2 geometry.Vector, u, v float64) (float64, float64, bool) {
+	for i := 0; i < newtonSteps; i++ {
+		point, pu, pv := evaluate(p.patch, u, v)
+		d := origin.To(point)
+		r1, r2 := n1.Dot(d), n2.Dot(d)
+		if math.Abs(r1)+math.Abs(r2) < p.epsilon {
+			return u, v, true
+		}
+		j11, j12 := n1.Dot(pu), n1.Dot(pv)
+		j21, j22 := n2.Dot(pu), n2.Dot(pv)
+		determinant := j11*j22 - j12*j21
+		if determinant == 0.0 {
+			return u, v, false
+		}
+		u -= (j22*r1 - j12*r2) / determinant
+		v -= (j11*r2 - j21*r1) / determinant
+		if math.IsNaN(u) || math.IsNaN(v) || math.Abs(u) > 2.0 || math.Abs(v) > 2.0 {
+			// wandered off the patch
+			return u, v, false
+		}
+	}
+	return u, v, false
+}
+
+// crossing returns the barycentric coordinates of b and c where a ray crosses the plane of triangle abc,
+// if the crossing is within the triangle
+func crossing(ray geometry.Ray, a, b, c geometry.Point) (float64, float64, bool) {
+	ab := a.To(b)
+	ac := a.To(c)
+	pVector := ray.Direction.Cross(ac)
+	determinant := ab.Dot(pVector)
+	if determinant == 0.0 {
+		return 0.0, 0.0, false
+	}
+	tVector := a.To(ray.Origin)
+	s := tVector.Dot(pVector) / determinant
+	qVector := tVector.Cross(ab)
+	t := ray.Direction.Dot(qVector) / determinant
+	if s < 0.0 || t < 0.0 || s+t > 1.0 {
+		return 0.0, 0.0, false
+	}
+	return s, t, true
+}
+
+// BoundingBox returns an AABB for this object
+func (p *piece) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return p.box, true
+}
+
+// SetMaterial does nothing, as the BezierPatch holding the piece sets the material of its hits
+func (p *piece) SetMaterial(m material.Material) {
+}
+
+// IsInfinite returns whether this object is infinite
+func (p *piece) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (p *piece) IsClosed() bool {
+	return false
+}
+
+// Copy returns a shallow copy of this object
+func (p *piece) Copy() primitive.Primitive {
+	newP := *p
+	return &newP
+}
@@ -127,6 +127,14 @@ func (b *Box) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayH
 	return nil, false
 }
 
+// AllIntersections returns every intersection of this object and a given ray, sorted by time
+func (b *Box) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	if b.box.Intersection(ray, tMin, tMax) {
+		return b.list.AllIntersections(ray, tMin, tMax)
+	}
+	return nil
+}
+
 // BoundingBox returns an AABB for this object
 func (b *Box) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	return b.box, true
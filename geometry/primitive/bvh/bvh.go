@@ -4,30 +4,65 @@ import (
 	"fluorescence/geometry"
 	"fluorescence/geometry/primitive"
 	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/bvh/tree"
 	"fluorescence/geometry/primitive/primitivelist"
 	"fluorescence/shading/material"
 	"fmt"
 	"math"
 	"sort"
+	"time"
 )
 
 // BVH represents a bounding volume hierarchy
+// the tree is stored flattened in depth-first order, so a node's left child directly follows it
 type BVH struct {
-	left     primitive.Primitive
-	right    primitive.Primitive
-	isSingle bool
-	box      *aabb.AABB
+	nodes      []tree.Node
+	primitives []primitive.Primitive   // primitives ordered so that each leaf covers a contiguous range
+	recorders  []primitive.HitRecorder // the primitives that can record hits without allocating, or nil
+	box        *aabb.AABB
+	// buildDuration is how long construction took
+	buildDuration time.Duration
 }
 
-// New sets up and returns a new BVH
+// traversal is a node waiting to be visited, along with the time the ray enters its box
+type traversal struct {
+	node   int32
+	tEnter float64
+}
+
+// builder accumulates the flattened nodes and primitives of a BVH under construction
+type builder struct {
+	nodes      []tree.Node
+	primitives []primitive.Primitive
+}
+
+// New sets up and returns a new BVH built with the Surface Area Heuristic and the default leaf size
 func New(pl *primitivelist.PrimitiveList) (*BVH, error) {
-	newBVH := &BVH{}
+	return NewSAH(pl, DefaultLeafSize)
+}
 
+// NewMedianSplit sets up and returns a new BVH by sorting along an axis and splitting the list in half at every level
+// it is kept for comparison against NewSAH
+func NewMedianSplit(pl *primitivelist.PrimitiveList) (*BVH, error) {
+	start := time.Now()
 	// can we do the sort?
-	_, ok := pl.BoundingBox(0, 0)
+	_, ok := pl.BoundingBox(geometry.MotionStart, geometry.MotionEnd)
 	if !ok {
 		return nil, fmt.Errorf("no bounding box for input Primitive List")
 	}
+	b := &builder{}
+	_, err := b.medianSplit(pl)
+	if err != nil {
+		return nil, err
+	}
+	newBVH := b.finish()
+	newBVH.buildDuration = time.Since(start)
+	return newBVH, nil
+}
+
+// medianSplit appends the node covering a list and its descendants, returning the node's box
+func (b *builder) medianSplit(pl *primitivelist.PrimitiveList) (*aabb.AABB, error) {
+	index := b.addNode()
 
 	// pick the best axis
 	var axisNum int
@@ -46,7 +81,6 @@ func New(pl *primitivelist.PrimitiveList) (*BVH, error) {
 	}
 
 	// do the sort
-	// axisNum := rand.Intn(3)
 	if axisNum == 0 {
 		sort.Sort(primitivelist.ByXPos(*pl))
 	} else if axisNum == 1 {
@@ -57,62 +91,124 @@ func New(pl *primitivelist.PrimitiveList) (*BVH, error) {
 
 	// fill children
 	if len(pl.List) == 1 {
-		newBVH.left = pl.List[0]
-		newBVH.isSingle = true
-	} else {
-		left, err := New(pl.FirstHalfCopy())
-		if err != nil {
-			return nil, err
-		}
-		right, err := New(pl.LastHalfCopy())
-		if err != nil {
-			return nil, err
-		}
-		newBVH.left = left
-		newBVH.right = right
-	}
-	// est. box
-	leftBox, leftOk := newBVH.left.BoundingBox(0, 0)
-	if newBVH.isSingle {
-		if !leftOk {
+		box, ok := pl.List[0].BoundingBox(geometry.MotionStart, geometry.MotionEnd)
+		if !ok {
 			return nil, fmt.Errorf("no bounding box for some leaf of BVH")
 		}
-		newBVH.box = leftBox
-	} else {
-		rightBox, rightOk := newBVH.right.BoundingBox(0, 0)
-		if !leftOk || !rightOk {
-			return nil, fmt.Errorf("no bounding box for some leaf of BVH")
+		b.nodes[index] = tree.Node{
+			Box:    *box,
+			Offset: int32(len(b.primitives)),
+			Count:  1,
 		}
-		newBVH.box = aabb.SurroundingBox(leftBox, rightBox)
+		b.primitives = append(b.primitives, pl.List[0])
+		return box, nil
+	}
+	leftBox, err := b.medianSplit(pl.FirstHalfCopy())
+	if err != nil {
+		return nil, err
+	}
+	right := int32(len(b.nodes))
+	rightBox, err := b.medianSplit(pl.LastHalfCopy())
+	if err != nil {
+		return nil, err
+	}
+	box := aabb.SurroundingBox(leftBox, rightBox)
+	b.nodes[index] = tree.Node{
+		Box:    *box,
+		Offset: right,
+	}
+	return box, nil
+}
+
+// addNode reserves a node to be filled in once its children are built, returning its index
+func (b *builder) addNode() int32 {
+	b.nodes = append(b.nodes, tree.Node{})
+	return int32(len(b.nodes) - 1)
+}
+
+// finish returns the BVH of the built nodes and primitives
+func (b *builder) finish() *BVH {
+	recorders := make([]primitive.HitRecorder, len(b.primitives))
+	for i, p := range b.primitives {
+		recorders[i], _ = p.(primitive.HitRecorder)
+	}
+	return &BVH{
+		nodes:      b.nodes,
+		primitives: b.primitives,
+		recorders:  recorders,
+		box:        &aabb.AABB{A: b.nodes[0].Box.A, B: b.nodes[0].Box.B},
 	}
-	return newBVH, nil
 }
 
 // Intersection computer the intersection of this object and a given ray if it exists
 func (b *BVH) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
-	hitBox := b.box.Intersection(ray, tMin, tMax)
-	if hitBox {
-		leftRayHit, doesHitLeft := b.left.Intersection(ray, tMin, tMax)
-		if b.isSingle {
-			if doesHitLeft {
-				return leftRayHit, true
+	var rayHit material.RayHit
+	if !b.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+// nodes are visited nearest first, and nodes the ray enters beyond the closest hit so far are skipped
+func (b *BVH) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	tEnter, ok := b.nodes[0].Box.IntersectionDistance(ray, tMin, tMax)
+	if !ok {
+		return false
+	}
+	hitSomething := false
+	stack := make([]traversal, 1, 64)
+	stack[0] = traversal{node: 0, tEnter: tEnter}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if current.tEnter > tMax {
+			// a closer hit was found after this node was queued
+			continue
+		}
+		n := &b.nodes[current.node]
+		if n.Count > 0 {
+			for i := n.Offset; i < n.Offset+n.Count; i++ {
+				if b.intersectPrimitive(i, ray, tMin, tMax, rayHit) {
+					hitSomething = true
+					// only closer hits are accepted from here on
+					tMax = rayHit.Time
+				}
 			}
-			return nil, false
+			continue
 		}
-		rightRayHit, doesHitRight := b.right.Intersection(ray, tMin, tMax)
-		if doesHitLeft && doesHitRight {
-			if leftRayHit.Time < rightRayHit.Time {
-				return leftRayHit, true
+
+		left := current.node + 1
+		right := n.Offset
+		tLeft, hitLeft := b.nodes[left].Box.IntersectionDistance(ray, tMin, tMax)
+		tRight, hitRight := b.nodes[right].Box.IntersectionDistance(ray, tMin, tMax)
+		if hitLeft && hitRight {
+			// push the farther child first so that the nearer one is visited next
+			if tLeft <= tRight {
+				stack = append(stack, traversal{node: right, tEnter: tRight}, traversal{node: left, tEnter: tLeft})
+			} else {
+				stack = append(stack, traversal{node: left, tEnter: tLeft}, traversal{node: right, tEnter: tRight})
 			}
-			return rightRayHit, true
-		} else if doesHitLeft {
-			return leftRayHit, true
-		} else if doesHitRight {
-			return rightRayHit, true
+		} else if hitLeft {
+			stack = append(stack, traversal{node: left, tEnter: tLeft})
+		} else if hitRight {
+			stack = append(stack, traversal{node: right, tEnter: tRight})
 		}
-		return nil, false
 	}
-	return nil, false
+	return hitSomething
+}
+
+// intersectPrimitive intersects the primitive at index, writing a hit into rayHit if it exists
+func (b *BVH) intersectPrimitive(index int32, ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	if b.recorders[index] != nil {
+		return b.recorders[index].IntersectionInto(ray, tMin, tMax, rayHit)
+	}
+	hit, ok := b.primitives[index].Intersection(ray, tMin, tMax)
+	if ok {
+		*rayHit = *hit
+	}
+	return ok
 }
 
 // BoundingBox returns a new AABB for this object
@@ -122,26 +218,42 @@ func (b *BVH) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 
 // SetMaterial sets this object's material
 func (b *BVH) SetMaterial(m material.Material) {
-	b.left.SetMaterial(m)
-	if !b.isSingle {
-		b.right.SetMaterial(m)
+	for _, p := range b.primitives {
+		p.SetMaterial(m)
 	}
 }
 
 // IsInfinite returns whether this object is infinite
 func (b *BVH) IsInfinite() bool {
-	if b.isSingle {
-		return b.left.IsInfinite()
+	for _, p := range b.primitives {
+		if p.IsInfinite() {
+			return true
+		}
 	}
-	return b.left.IsInfinite() || b.right.IsInfinite()
+	return false
 }
 
 // IsClosed returns whether this object is closed
 func (b *BVH) IsClosed() bool {
-	if b.isSingle {
-		return b.left.IsClosed()
+	for _, p := range b.primitives {
+		if !p.IsClosed() {
+			return false
+		}
 	}
-	return b.left.IsClosed() && b.right.IsClosed()
+	return true
+}
+
+// Replaced returns a BVH with the same nodes over the primitive replace returns for each of this one's,
+// so that a copy of the primitives needs no new build, as long as each has the same bounds as the one it replaces
+func (b *BVH) Replaced(replace func(primitive.Primitive) primitive.Primitive) *BVH {
+	newB := *b
+	newB.primitives = make([]primitive.Primitive, len(b.primitives))
+	newB.recorders = make([]primitive.HitRecorder, len(b.primitives))
+	for i, p := range b.primitives {
+		newB.primitives[i] = replace(p)
+		newB.recorders[i], _ = newB.primitives[i].(primitive.HitRecorder)
+	}
+	return &newB
 }
 
 // Copy returns a shallow copy of this object
@@ -2,10 +2,12 @@ package bvh
 
 import (
 	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
 	"fluorescence/geometry/primitive/primitivelist"
 	"fluorescence/geometry/primitive/rectangle"
 	"fluorescence/geometry/primitive/sphere"
 	"fluorescence/geometry/primitive/triangle"
+	"fluorescence/shading/material"
 	"math/rand"
 	"testing"
 )
@@ -424,3 +426,37 @@ func TestBVHIntersectionMissTriangleOf1000(t *testing.T) {
 func BenchmarkBVHIntersectionMissTriangleOf1000(b *testing.B) {
 	ithTriangleOfNBVHBenchmark(1, 1000, false, b)
 }
+
+func TestBVHReplaced(t *testing.T) {
+	b := UnitBVHNSpheres(10, 0.0, 0.0, 0.0)
+	mat := &material.Lambertian{}
+	replaced := b.Replaced(func(p primitive.Primitive) primitive.Primitive {
+		c := p.Copy()
+		c.SetMaterial(mat)
+		return c
+	})
+	for i := range b.primitives {
+		if replaced.primitives[i] == b.primitives[i] {
+			t.Fatalf("Expected primitive %d to be replaced\n", i)
+		}
+	}
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 3.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := replaced.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h || rh.Material != mat {
+		t.Errorf("Expected a hit on a replacement but got %t\n", h)
+	}
+	if rh, _ := b.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308); rh.Material == mat {
+		t.Errorf("Expected the original primitives to keep their materials\n")
+	}
+}
@@ -0,0 +1,51 @@
+package bvh
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/bvh/tree"
+	"fluorescence/geometry/primitive/primitivelist"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// DefaultLeafSize is the most primitives a leaf holds when no leaf size is given
+const DefaultLeafSize = 4
+
+// NewSAH builds a BVH by splitting where the Surface Area Heuristic estimates the lowest intersection cost
+// split candidates are evaluated at the boundaries of centroid bins along every axis
+// leaves hold at most leafSize primitives, and fewer when splitting them further is estimated to be cheaper
+// large subtrees are built concurrently by up to one worker per CPU
+func NewSAH(pl *primitivelist.PrimitiveList, leafSize int) (*BVH, error) {
+	return newSAH(pl, leafSize, int64(runtime.GOMAXPROCS(0)))
+}
+
+// newSAH builds a BVH with the Surface Area Heuristic using at most workers concurrent builders
+func newSAH(pl *primitivelist.PrimitiveList, leafSize int, workers int64) (*BVH, error) {
+	start := time.Now()
+	boxes := make([]aabb.AABB, len(pl.List))
+	for i, p := range pl.List {
+		// bound the whole of any motion, since rays may be cast at any time
+		box, ok := p.BoundingBox(geometry.MotionStart, geometry.MotionEnd)
+		if !ok {
+			return nil, fmt.Errorf("no bounding box for some leaf of BVH")
+		}
+		boxes[i] = *box
+	}
+	nodes, indices, err := tree.Build(boxes, leafSize, workers)
+	if err != nil {
+		return nil, err
+	}
+	b := &builder{
+		nodes:      nodes,
+		primitives: make([]primitive.Primitive, len(indices)),
+	}
+	for i, index := range indices {
+		b.primitives[i] = pl.List[index]
+	}
+	newBVH := b.finish()
+	newBVH.buildDuration = time.Since(start)
+	return newBVH, nil
+}
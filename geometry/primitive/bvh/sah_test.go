@@ -0,0 +1,228 @@
+package bvh
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/primitivelist"
+	"fluorescence/geometry/primitive/sphere"
+	"fluorescence/geometry/primitive/triangle"
+	"math/rand"
+	"testing"
+)
+
+// randomSpheres returns a list of n small spheres scattered unevenly through a 100 unit cube,
+// with most of them crowded into one corner
+func randomSpheres(n int) *primitivelist.PrimitiveList {
+	rng := rand.New(rand.NewSource(0))
+	pl := &primitivelist.PrimitiveList{}
+	for i := 0; i < n; i++ {
+		scale := 100.0
+		if i%4 != 0 {
+			scale = 10.0
+		}
+		s, _ := (&sphere.Sphere{
+			Center: geometry.Point{
+				X: rng.Float64() * scale,
+				Y: rng.Float64() * scale,
+				Z: rng.Float64() * scale,
+			},
+			Radius: 0.05 + rng.Float64()*0.2,
+		}).Setup()
+		pl.List = append(pl.List, s)
+	}
+	return pl
+}
+
+// randomRays returns n rays from outside the random sphere scene aimed at random points inside it
+func randomRays(n int) []geometry.Ray {
+	rng := rand.New(rand.NewSource(1))
+	rays := make([]geometry.Ray, n)
+	for i := range rays {
+		origin := geometry.Point{X: -10.0, Y: rng.Float64() * 100.0, Z: rng.Float64() * 100.0}
+		target := geometry.Point{X: rng.Float64() * 100.0, Y: rng.Float64() * 20.0, Z: rng.Float64() * 20.0}
+		rays[i] = geometry.Ray{
+			Origin:    origin,
+			Direction: origin.To(target).Unit(),
+		}
+	}
+	return rays
+}
+
+// copyList returns a new list with the same elements so that builders do not see each other's reordering
+func copyList(pl *primitivelist.PrimitiveList) *primitivelist.PrimitiveList {
+	return &primitivelist.PrimitiveList{
+		List: append(pl.List[:0:0], pl.List...),
+	}
+}
+
+func TestSAHMatchesPrimitiveList(t *testing.T) {
+	pl := randomSpheres(2000)
+	for _, leafSize := range []int{1, 4, 8} {
+		bvh, err := NewSAH(copyList(pl), leafSize)
+		if err != nil {
+			t.Fatalf("Expected no error but got %s\n", err.Error())
+		}
+		for _, r := range randomRays(500) {
+			expected, expectedHit := pl.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+			rh, h := bvh.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+			if h != expectedHit {
+				t.Fatalf("Expected %t but got %t with leaf size %d\n", expectedHit, h, leafSize)
+			}
+			if h && rh.Time != expected.Time {
+				t.Fatalf("Expected time %f but got %f with leaf size %d\n", expected.Time, rh.Time, leafSize)
+			}
+		}
+	}
+}
+
+func TestSAHCoincidentCentroids(t *testing.T) {
+	pl := &primitivelist.PrimitiveList{}
+	for i := 0; i < 10; i++ {
+		pl.List = append(pl.List, triangle.Unit(0.0, 0.0, 0.0))
+	}
+	_, err := NewSAH(pl, 2)
+	if err != nil {
+		t.Errorf("Expected no error but got %s\n", err.Error())
+	}
+}
+
+func TestSAHInvalidLeafSize(t *testing.T) {
+	_, err := NewSAH(randomSpheres(10), 0)
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
+
+func benchmarkBuild(build func(*primitivelist.PrimitiveList) (*BVH, error), pl *primitivelist.PrimitiveList, b *testing.B) {
+	lists := make([]*primitivelist.PrimitiveList, b.N)
+	for i := range lists {
+		lists[i] = copyList(pl)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		build(lists[i])
+	}
+}
+
+func benchmarkRandomRays(bvh *BVH, b *testing.B) {
+	rays := randomRays(1024)
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = bvh.Intersection(rays[i%len(rays)], 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	bvhHit = h
+}
+
+func BenchmarkBuildSAHRandomSpheres(b *testing.B) {
+	benchmarkBuild(New, randomSpheres(100000), b)
+}
+
+func BenchmarkBuildMedianSplitRandomSpheres(b *testing.B) {
+	benchmarkBuild(NewMedianSplit, randomSpheres(100000), b)
+}
+
+func BenchmarkBuildSAHTriangleOf1000(b *testing.B) {
+	pl := &primitivelist.PrimitiveList{}
+	for i := 0; i < 1000; i++ {
+		pl.List = append(pl.List, triangle.Unit(float64(i), 0.0, 0.0))
+	}
+	benchmarkBuild(New, pl, b)
+}
+
+func BenchmarkBuildMedianSplitTriangleOf1000(b *testing.B) {
+	pl := &primitivelist.PrimitiveList{}
+	for i := 0; i < 1000; i++ {
+		pl.List = append(pl.List, triangle.Unit(float64(i), 0.0, 0.0))
+	}
+	benchmarkBuild(NewMedianSplit, pl, b)
+}
+
+func BenchmarkSAHIntersectionRandomSpheres(b *testing.B) {
+	bvh, _ := New(randomSpheres(100000))
+	benchmarkRandomRays(bvh, b)
+}
+
+func BenchmarkMedianSplitIntersectionRandomSpheres(b *testing.B) {
+	bvh, _ := NewMedianSplit(randomSpheres(100000))
+	benchmarkRandomRays(bvh, b)
+}
+
+func benchmarkMiddleTriangleOf1000(build func(*primitivelist.PrimitiveList) (*BVH, error), b *testing.B) {
+	pl := &primitivelist.PrimitiveList{}
+	for i := 0; i < 1000; i++ {
+		pl.List = append(pl.List, triangle.Unit(float64(i), 0.0, 0.0))
+	}
+	bvh, _ := build(pl)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 500.1,
+			Y: 0.1,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = bvh.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	bvhHit = h
+}
+
+func BenchmarkSAHIntersectionHitMiddleTriangleOf1000(b *testing.B) {
+	benchmarkMiddleTriangleOf1000(New, b)
+}
+
+func BenchmarkMedianSplitIntersectionHitMiddleTriangleOf1000(b *testing.B) {
+	benchmarkMiddleTriangleOf1000(NewMedianSplit, b)
+}
+
+func TestParallelBuildMatchesSerial(t *testing.T) {
+	pl := randomSpheres(50000)
+	serial, _ := newSAH(copyList(pl), DefaultLeafSize, 1)
+	parallel, _ := newSAH(copyList(pl), DefaultLeafSize, 8)
+	if len(serial.nodes) != len(parallel.nodes) {
+		t.Fatalf("Expected %d nodes but got %d\n", len(serial.nodes), len(parallel.nodes))
+	}
+	for i := range serial.nodes {
+		if serial.nodes[i] != parallel.nodes[i] {
+			t.Fatalf("Expected node %d to be %v but got %v\n", i, serial.nodes[i], parallel.nodes[i])
+		}
+	}
+	for i := range serial.primitives {
+		if serial.primitives[i] != parallel.primitives[i] {
+			t.Fatalf("Expected primitive %d to match\n", i)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	pl := &primitivelist.PrimitiveList{}
+	for i := 0; i < 8; i++ {
+		pl.List = append(pl.List, triangle.Unit(float64(i), 0.0, 0.0))
+	}
+	bvh, _ := NewSAH(pl, 1)
+	s := bvh.Stats()
+	if s.LeafCount != 8 || s.LeafSizes[1] != 8 {
+		t.Errorf("Expected 8 leaves of size 1 but got %d (%v)\n", s.LeafCount, s.LeafSizes)
+	}
+	if s.NodeCount != 15 {
+		t.Errorf("Expected 15 nodes but got %d\n", s.NodeCount)
+	}
+	if s.Depth != 4 {
+		t.Errorf("Expected depth 4 but got %d\n", s.Depth)
+	}
+	if s.SAHCost < 1.0 {
+		t.Errorf("Expected SAH cost of at least 1 but got %f\n", s.SAHCost)
+	}
+}
+
+func BenchmarkBuildSerialSAHRandomSpheres(b *testing.B) {
+	benchmarkBuild(func(pl *primitivelist.PrimitiveList) (*BVH, error) {
+		return newSAH(pl, DefaultLeafSize, 1)
+	}, randomSpheres(100000), b)
+}
@@ -0,0 +1,11 @@
+package bvh
+
+import "fluorescence/geometry/primitive/bvh/tree"
+
+// Stats describes the shape of a built BVH
+type Stats = tree.Stats
+
+// Stats returns the build time and tree statistics of this BVH
+func (b *BVH) Stats() Stats {
+	return tree.NewStats(b.nodes, len(b.primitives), b.buildDuration)
+}
@@ -0,0 +1,105 @@
+package bvh
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/shading/material"
+	"testing"
+)
+
+// recursiveIntersection traverses the flattened tree the way the original BVH did:
+// recursively, visiting both children, and allocating a RayHit for every candidate hit
+// it serves as a baseline for the iterative traversal
+func (b *BVH) recursiveIntersection(index int32, ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	n := &b.nodes[index]
+	if !n.Box.Intersection(ray, tMin, tMax) {
+		return nil, false
+	}
+	if n.Count > 0 {
+		var closest *material.RayHit
+		for i := n.Offset; i < n.Offset+n.Count; i++ {
+			rh, h := b.primitives[i].Intersection(ray, tMin, tMax)
+			if h && (closest == nil || rh.Time < closest.Time) {
+				closest = rh
+			}
+		}
+		return closest, closest != nil
+	}
+	leftRayHit, doesHitLeft := b.recursiveIntersection(index+1, ray, tMin, tMax)
+	rightRayHit, doesHitRight := b.recursiveIntersection(n.Offset, ray, tMin, tMax)
+	if doesHitLeft && doesHitRight {
+		if leftRayHit.Time < rightRayHit.Time {
+			return leftRayHit, true
+		}
+		return rightRayHit, true
+	} else if doesHitLeft {
+		return leftRayHit, true
+	} else if doesHitRight {
+		return rightRayHit, true
+	}
+	return nil, false
+}
+
+func TestIterativeMatchesRecursive(t *testing.T) {
+	bvh, _ := New(randomSpheres(5000))
+	for _, r := range randomRays(1000) {
+		expected, expectedHit := bvh.recursiveIntersection(0, r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		rh, h := bvh.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if h != expectedHit {
+			t.Fatalf("Expected %t but got %t\n", expectedHit, h)
+		}
+		if h && rh.Time != expected.Time {
+			t.Fatalf("Expected time %f but got %f\n", expected.Time, rh.Time)
+		}
+	}
+}
+
+func TestIntersectionIntoDoesNotAllocate(t *testing.T) {
+	bvh, _ := New(randomSpheres(5000))
+	rays := randomRays(64)
+	var rayHit material.RayHit
+	allocations := testing.AllocsPerRun(10, func() {
+		for _, r := range rays {
+			bvh.IntersectionInto(r, 1e-7, 1.797693134862315708145274237317043567981e+308, &rayHit)
+		}
+	})
+	if allocations != 0 {
+		t.Errorf("Expected 0 allocations but got %f\n", allocations)
+	}
+}
+
+func BenchmarkIterativeIntersectionRandomSpheres(b *testing.B) {
+	bvh, _ := New(randomSpheres(100000))
+	rays := randomRays(1024)
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = bvh.Intersection(rays[i%len(rays)], 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "rays/s")
+	bvhHit = h
+}
+
+func BenchmarkIterativeIntersectionIntoRandomSpheres(b *testing.B) {
+	bvh, _ := New(randomSpheres(100000))
+	rays := randomRays(1024)
+	var rayHit material.RayHit
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h = bvh.IntersectionInto(rays[i%len(rays)], 1e-7, 1.797693134862315708145274237317043567981e+308, &rayHit)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "rays/s")
+	bvhHit = h
+}
+
+func BenchmarkRecursiveIntersectionRandomSpheres(b *testing.B) {
+	bvh, _ := New(randomSpheres(100000))
+	rays := randomRays(1024)
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = bvh.recursiveIntersection(0, rays[i%len(rays)], 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "rays/s")
+	bvhHit = h
+}
@@ -0,0 +1,82 @@
+package tree
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stats describes the shape of a built tree
+type Stats struct {
+	BuildDuration  time.Duration
+	Depth          int
+	NodeCount      int
+	LeafCount      int
+	PrimitiveCount int
+	LeafSizes      map[int]int // number of leaves holding each primitive count
+	SAHCost        float64     // estimated cost of a ray through the root, relative to intersecting one primitive
+}
+
+// NewStats returns the statistics of a tree of nodes over primitiveCount primitives, built in buildDuration
+func NewStats(nodes []Node, primitiveCount int, buildDuration time.Duration) Stats {
+	s := Stats{
+		BuildDuration:  buildDuration,
+		NodeCount:      len(nodes),
+		PrimitiveCount: primitiveCount,
+		LeafSizes:      map[int]int{},
+	}
+	rootArea := nodes[0].Box.SurfaceArea()
+
+	// walk the tree iteratively, tracking the depth of each node
+	type entry struct {
+		node  int32
+		depth int
+	}
+	stack := []entry{{node: 0, depth: 1}}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		n := &nodes[current.node]
+		if current.depth > s.Depth {
+			s.Depth = current.depth
+		}
+		// a flat root, such as one around a single point, contributes the full cost of its contents
+		areaRatio := 1.0
+		if rootArea > 0.0 {
+			areaRatio = n.Box.SurfaceArea() / rootArea
+		}
+		if n.Count > 0 {
+			s.LeafCount++
+			s.LeafSizes[int(n.Count)]++
+			s.SAHCost += float64(n.Count) * areaRatio
+			continue
+		}
+		s.SAHCost += sahTraversalCost * areaRatio
+		stack = append(stack,
+			entry{node: current.node + 1, depth: current.depth + 1},
+			entry{node: n.Offset, depth: current.depth + 1})
+	}
+	return s
+}
+
+// String returns a multi-line summary of the statistics
+func (s Stats) String() string {
+	sizes := make([]int, 0, len(s.LeafSizes))
+	for size := range s.LeafSizes {
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+	histogram := make([]string, len(sizes))
+	for i, size := range sizes {
+		histogram[i] = fmt.Sprintf("%d:%d", size, s.LeafSizes[size])
+	}
+	return fmt.Sprintf("built in %v\n"+
+		"%d primitives, %d nodes, %d leaves, depth %d\n"+
+		"leaf sizes (size:leaves) %s\n"+
+		"SAH cost %.3f",
+		s.BuildDuration,
+		s.PrimitiveCount, s.NodeCount, s.LeafCount, s.Depth,
+		strings.Join(histogram, " "),
+		s.SAHCost)
+}
@@ -0,0 +1,264 @@
+package tree
+
+import (
+	"context"
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/aabb"
+	"fmt"
+	"math"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// sahBinCount is the number of buckets centroids are binned into when evaluating splits
+const sahBinCount = 16
+
+// sahTraversalCost is the cost of visiting a node relative to intersecting a primitive
+const sahTraversalCost = 0.125
+
+// parallelBuildThreshold is the fewest primitives a subtree needs for it to be handed to another worker
+// smaller subtrees are cheaper to build than to merge
+const parallelBuildThreshold = 4096
+
+// Node is a node of a flattened hierarchy, stored in depth-first order
+// interior nodes have their left child directly after them, their right child at Offset and a Count of 0,
+// while leaf nodes cover Count primitives starting at Offset
+type Node struct {
+	Box    aabb.AABB
+	Offset int32
+	Count  int32
+}
+
+// buildPrimitive caches the bounds of a primitive during construction
+type buildPrimitive struct {
+	index    int32 // position of the primitive's box among those the tree is built over
+	box      aabb.AABB
+	centroid geometry.Point
+}
+
+// sahBin accumulates the primitives whose centroids fall into one bucket
+type sahBin struct {
+	box   aabb.AABB
+	count int
+}
+
+// builder accumulates the flattened nodes and primitive indices of a tree under construction
+type builder struct {
+	nodes   []Node
+	indices []int32
+}
+
+// Build builds a tree over primitives with the given bounds by splitting where the Surface Area Heuristic
+// estimates the lowest intersection cost, using at most workers concurrent builders
+// split candidates are evaluated at the boundaries of centroid bins along every axis
+// leaves hold at most leafSize primitives, and fewer when splitting them further is estimated to be cheaper
+// it returns the nodes and the indices of the boxes in the order the leaves cover them
+func Build(boxes []aabb.AABB, leafSize int, workers int64) ([]Node, []int32, error) {
+	if len(boxes) == 0 {
+		return nil, nil, fmt.Errorf("no primitives for BVH")
+	}
+	if leafSize < 1 {
+		return nil, nil, fmt.Errorf("BVH leaf size (%d) less than 1", leafSize)
+	}
+	primitives := make([]buildPrimitive, len(boxes))
+	for i, box := range boxes {
+		primitives[i] = buildPrimitive{
+			index:    int32(i),
+			box:      box,
+			centroid: box.Centroid(),
+		}
+	}
+	b := &builder{
+		nodes:   make([]Node, 0, 2*len(primitives)/leafSize+1),
+		indices: make([]int32, 0, len(primitives)),
+	}
+	// this goroutine is the first worker
+	sem := semaphore.NewWeighted(workers)
+	sem.Acquire(context.Background(), 1)
+	b.sah(primitives, leafSize, sem)
+	sem.Release(1)
+	return b.nodes, b.indices, nil
+}
+
+// sah recursively appends the node covering primitives and its descendants, partitioning the slice in place
+// when a worker is free, the left half of a large split is built by it into a separate builder and merged afterwards
+func (b *builder) sah(primitives []buildPrimitive, leafSize int, sem *semaphore.Weighted) {
+	b.nodes = append(b.nodes, Node{})
+	index := int32(len(b.nodes) - 1)
+	box := primitives[0].box
+	centroidBox := aabb.AABB{A: primitives[0].centroid, B: primitives[0].centroid}
+	for _, p := range primitives[1:] {
+		box = union(box, p.box)
+		centroidBox.A = geometry.MinComponents(centroidBox.A, p.centroid)
+		centroidBox.B = geometry.MaxComponents(centroidBox.B, p.centroid)
+	}
+
+	b.nodes[index].Box = box
+	if len(primitives) == 1 {
+		b.leaf(index, primitives)
+		return
+	}
+
+	axis, split, cost := bestSAHSplit(primitives, &box, &centroidBox)
+	if axis < 0 {
+		// every centroid is in the same place, so only an arbitrary split is possible
+		if len(primitives) <= leafSize {
+			b.leaf(index, primitives)
+			return
+		}
+		b.split(index, primitives, len(primitives)/2, leafSize, sem)
+		return
+	}
+	if len(primitives) <= leafSize && cost >= float64(len(primitives)) {
+		b.leaf(index, primitives)
+		return
+	}
+
+	// partition around the chosen bin boundary
+	i, j := 0, len(primitives)-1
+	for i <= j {
+		if binIndex(primitives[i].centroid, &centroidBox, axis) < split {
+			i++
+		} else {
+			primitives[i], primitives[j] = primitives[j], primitives[i]
+			j--
+		}
+	}
+	b.split(index, primitives, i, leafSize, sem)
+}
+
+// split builds the children of the node at index from primitives[:middle] and primitives[middle:]
+func (b *builder) split(index int32, primitives []buildPrimitive, middle, leafSize int, sem *semaphore.Weighted) {
+	if middle < parallelBuildThreshold || !sem.TryAcquire(1) {
+		b.sah(primitives[:middle], leafSize, sem)
+		b.nodes[index].Offset = int32(len(b.nodes))
+		b.sah(primitives[middle:], leafSize, sem)
+		return
+	}
+	left := &builder{}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer sem.Release(1)
+		left.sah(primitives[:middle], leafSize, sem)
+	}()
+	right := &builder{}
+	right.sah(primitives[middle:], leafSize, sem)
+	wg.Wait()
+
+	b.merge(left)
+	b.nodes[index].Offset = int32(len(b.nodes))
+	b.merge(right)
+}
+
+// merge appends the nodes and primitive indices of a separately built subtree, rebasing their offsets
+func (b *builder) merge(subtree *builder) {
+	nodeBase := int32(len(b.nodes))
+	primitiveBase := int32(len(b.indices))
+	for _, n := range subtree.nodes {
+		if n.Count > 0 {
+			n.Offset += primitiveBase
+		} else {
+			n.Offset += nodeBase
+		}
+		b.nodes = append(b.nodes, n)
+	}
+	b.indices = append(b.indices, subtree.indices...)
+}
+
+// leaf makes the node at index a leaf holding the given primitives
+func (b *builder) leaf(index int32, primitives []buildPrimitive) {
+	b.nodes[index].Offset = int32(len(b.indices))
+	b.nodes[index].Count = int32(len(primitives))
+	for _, p := range primitives {
+		b.indices = append(b.indices, p.index)
+	}
+}
+
+// bestSAHSplit returns the axis and bin boundary with the lowest estimated cost, relative to intersecting one primitive
+// the axis is -1 if the centroids cannot be separated
+func bestSAHSplit(primitives []buildPrimitive, box, centroidBox *aabb.AABB) (int, int, float64) {
+	bestAxis, bestSplit, bestCost := -1, 0, math.Inf(1)
+	parentArea := box.SurfaceArea()
+	extent := centroidBox.A.To(centroidBox.B)
+	for axis, axisExtent := range [3]float64{extent.X, extent.Y, extent.Z} {
+		if axisExtent <= 0.0 {
+			continue
+		}
+		var bins [sahBinCount]sahBin
+		for _, p := range primitives {
+			b := &bins[binIndex(p.centroid, centroidBox, axis)]
+			if b.count == 0 {
+				b.box = p.box
+			} else {
+				b.box = union(b.box, p.box)
+			}
+			b.count++
+		}
+
+		// sweep from the right to find the area and count of everything right of each boundary
+		var rightAreas [sahBinCount]float64
+		var rightCounts [sahBinCount]int
+		var rightBox aabb.AABB
+		rightCount := 0
+		for i := sahBinCount - 1; i > 0; i-- {
+			rightBox, rightCount = accumulate(rightBox, rightCount, bins[i])
+			rightAreas[i] = rightBox.SurfaceArea()
+			rightCounts[i] = rightCount
+		}
+		// then sweep from the left, evaluating each boundary
+		var leftBox aabb.AABB
+		leftCount := 0
+		for i := 1; i < sahBinCount; i++ {
+			leftBox, leftCount = accumulate(leftBox, leftCount, bins[i-1])
+			if leftCount == 0 || rightCounts[i] == 0 {
+				continue
+			}
+			cost := sahTraversalCost +
+				(leftBox.SurfaceArea()*float64(leftCount)+rightAreas[i]*float64(rightCounts[i]))/parentArea
+			if cost < bestCost {
+				bestAxis, bestSplit, bestCost = axis, i, cost
+			}
+		}
+	}
+	return bestAxis, bestSplit, bestCost
+}
+
+// accumulate grows a running box and count by a bin
+func accumulate(box aabb.AABB, count int, b sahBin) (aabb.AABB, int) {
+	if b.count == 0 {
+		return box, count
+	}
+	if count == 0 {
+		return b.box, b.count
+	}
+	return union(box, b.box), count + b.count
+}
+
+// union returns the box surrounding two boxes without allocating
+func union(a, b aabb.AABB) aabb.AABB {
+	return aabb.AABB{
+		A: geometry.MinComponents(a.A, b.A),
+		B: geometry.MaxComponents(a.B, b.B),
+	}
+}
+
+// binIndex returns the bin a centroid falls into along an axis
+func binIndex(centroid geometry.Point, centroidBox *aabb.AABB, axis int) int {
+	var offset, extent float64
+	switch axis {
+	case 0:
+		offset, extent = centroid.X-centroidBox.A.X, centroidBox.B.X-centroidBox.A.X
+	case 1:
+		offset, extent = centroid.Y-centroidBox.A.Y, centroidBox.B.Y-centroidBox.A.Y
+	default:
+		offset, extent = centroid.Z-centroidBox.A.Z, centroidBox.B.Z-centroidBox.A.Z
+	}
+	b := int(sahBinCount * offset / extent)
+	if b >= sahBinCount {
+		b = sahBinCount - 1
+	}
+	return b
+}
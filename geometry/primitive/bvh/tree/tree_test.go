@@ -0,0 +1,83 @@
+package tree
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/aabb"
+	"math/rand"
+	"testing"
+)
+
+// randomBoxes returns n small boxes scattered within the unit cube
+func randomBoxes(n int) []aabb.AABB {
+	rng := rand.New(rand.NewSource(0))
+	boxes := make([]aabb.AABB, n)
+	for i := range boxes {
+		a := geometry.Point{X: rng.Float64(), Y: rng.Float64(), Z: rng.Float64()}
+		boxes[i] = aabb.AABB{A: a, B: a.AddVector(geometry.Vector{X: 0.01, Y: 0.02, Z: 0.03})}
+	}
+	return boxes
+}
+
+// contains returns whether box a surrounds box b
+func contains(a, b aabb.AABB) bool {
+	return a.A.X <= b.A.X && a.A.Y <= b.A.Y && a.A.Z <= b.A.Z &&
+		a.B.X >= b.B.X && a.B.Y >= b.B.Y && a.B.Z >= b.B.Z
+}
+
+func TestBuildCoversBoxes(t *testing.T) {
+	boxes := randomBoxes(10000)
+	nodes, indices, err := Build(boxes, 4, 8)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	if len(indices) != len(boxes) {
+		t.Fatalf("Expected %d indices but got %d\n", len(boxes), len(indices))
+	}
+	seen := make([]bool, len(boxes))
+	for _, index := range indices {
+		if seen[index] {
+			t.Fatalf("Expected each box in one leaf but got %d twice\n", index)
+		}
+		seen[index] = true
+	}
+	for i, n := range nodes {
+		if n.Count > 0 {
+			for _, index := range indices[n.Offset : n.Offset+n.Count] {
+				if !contains(n.Box, boxes[index]) {
+					t.Fatalf("Expected leaf %d to surround box %d\n", i, index)
+				}
+			}
+			continue
+		}
+		if !contains(n.Box, nodes[i+1].Box) || !contains(n.Box, nodes[n.Offset].Box) {
+			t.Fatalf("Expected node %d to surround its children\n", i)
+		}
+	}
+}
+
+func TestBuildParallelMatchesSerial(t *testing.T) {
+	serialNodes, serialIndices, _ := Build(randomBoxes(20000), 4, 1)
+	parallelNodes, parallelIndices, _ := Build(randomBoxes(20000), 4, 8)
+	if len(serialNodes) != len(parallelNodes) {
+		t.Fatalf("Expected %d nodes but got %d\n", len(serialNodes), len(parallelNodes))
+	}
+	for i := range serialNodes {
+		if serialNodes[i] != parallelNodes[i] {
+			t.Fatalf("Expected node %d to be %v but got %v\n", i, serialNodes[i], parallelNodes[i])
+		}
+	}
+	for i := range serialIndices {
+		if serialIndices[i] != parallelIndices[i] {
+			t.Fatalf("Expected index %d to be %d but got %d\n", i, serialIndices[i], parallelIndices[i])
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	if _, _, err := Build(nil, 4, 1); err == nil {
+		t.Errorf("Expected an error with no boxes but got none\n")
+	}
+	if _, _, err := Build(randomBoxes(4), 0, 1); err == nil {
+		t.Errorf("Expected an error with a leaf size of 0 but got none\n")
+	}
+}
@@ -0,0 +1,200 @@
+package capsule
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Capsule represents a pill shape, the set of points within a radius of the segment from A to B
+// it is a cylinder capped with a hemisphere at each end
+type Capsule struct {
+	A                  geometry.Point  `json:"a"`
+	B                  geometry.Point  `json:"b"`
+	Radius             float64         `json:"radius"`
+	HasInvertedNormals bool            `json:"has_inverted_normals"`
+	axis, u, w         geometry.Vector // orthonormal basis with the axis from A to B
+	height             float64
+	mat                material.Material
+}
+
+// Setup sets up a capsule's internal fields
+func (c *Capsule) Setup() (*Capsule, error) {
+	if c.A.To(c.B).Magnitude() == 0.0 {
+		return nil, fmt.Errorf("capsule length is zero vector")
+	}
+	if c.Radius <= 0.0 {
+		return nil, fmt.Errorf("capsule radius is 0 or negative")
+	}
+	c.height = c.A.To(c.B).Magnitude()
+	c.axis = c.A.To(c.B).Unit()
+	c.u, c.w = c.axis.Basis()
+	return c, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (c *Capsule) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !c.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (c *Capsule) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	for _, t := range c.times(ray) {
+		if t >= tMin && t <= tMax {
+			c.fillRayHit(ray, t, rayHit)
+			return true
+		}
+	}
+	return false
+}
+
+// AllIntersections returns every intersection of this capsule and a given ray that is within range, sorted by time
+func (c *Capsule) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	var hits []material.RayHit
+	for _, t := range c.times(ray) {
+		if t >= tMin && t <= tMax {
+			var rayHit material.RayHit
+			c.fillRayHit(ray, t, &rayHit)
+			hits = append(hits, rayHit)
+		}
+	}
+	return hits
+}
+
+// times returns the sorted ray times at which a ray crosses the capsule
+// these are the crossings of the cylinder between the ends and of each end's sphere beyond its end
+func (c *Capsule) times(ray geometry.Ray) []float64 {
+	o := c.local(c.A.To(ray.Origin))
+	d := c.local(ray.Direction)
+	var times []float64
+
+	// the cylinder x^2 + z^2 = r^2 around the Y axis
+	a := d.X*d.X + d.Z*d.Z
+	b := o.X*d.X + o.Z*d.Z
+	cc := o.X*o.X + o.Z*o.Z - c.Radius*c.Radius
+	for _, t := range solve(a, b, cc) {
+		if y := o.Y + t*d.Y; y >= 0.0 && y <= c.height {
+			times = append(times, t)
+		}
+	}
+
+	// the spheres around each end, only beyond the end
+	for _, end := range [2]float64{0.0, c.height} {
+		toOrigin := geometry.Vector{X: o.X, Y: o.Y - end, Z: o.Z}
+		a = d.Dot(d)
+		b = d.Dot(toOrigin)
+		cc = toOrigin.Dot(toOrigin) - c.Radius*c.Radius
+		for _, t := range solve(a, b, cc) {
+			y := o.Y + t*d.Y
+			if (end == 0.0 && y < 0.0) || (end != 0.0 && y > c.height) {
+				times = append(times, t)
+			}
+		}
+	}
+	sort.Float64s(times)
+	return times
+}
+
+// solve returns the solutions of at^2 + 2bt + c = 0, if it has two
+func solve(a, b, c float64) []float64 {
+	preDiscriminant := b*b - a*c
+	if a == 0.0 || preDiscriminant <= 0.0 {
+		return nil
+	}
+	root := math.Sqrt(preDiscriminant)
+	return []float64{(-b - root) / a, (-b + root) / a}
+}
+
+// fillRayHit writes the hit at time t into rayHit
+func (c *Capsule) fillRayHit(ray geometry.Ray, t float64, rayHit *material.RayHit) {
+	p := c.local(c.A.To(ray.PointAt(t)))
+	// the normal points away from the nearest point on the segment
+	n := geometry.Vector{
+		X: p.X,
+		Y: p.Y - math.Max(0.0, math.Min(c.height, p.Y)),
+		Z: p.Z,
+	}
+	normal := c.u.MultScalar(n.X).Add(c.axis.MultScalar(n.Y)).Add(c.w.MultScalar(n.Z)).Unit()
+	if c.HasInvertedNormals {
+		normal = normal.Negate()
+	}
+	*rayHit = material.RayHit{
+		Ray:         ray,
+		NormalAtHit: normal,
+		Time:        t,
+		U:           (math.Atan2(p.Z, p.X) + math.Pi) / (2 * math.Pi),
+		V:           (p.Y + c.Radius) / (c.height + 2.0*c.Radius),
+		Material:    c.mat,
+	}
+}
+
+// local returns a world space vector in the capsule's frame, with the axis as Y
+func (c *Capsule) local(v geometry.Vector) geometry.Vector {
+	return geometry.Vector{
+		X: v.Dot(c.u),
+		Y: v.Dot(c.axis),
+		Z: v.Dot(c.w),
+	}
+}
+
+// BoundingBox returns an AABB of this object
+func (c *Capsule) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	extent := geometry.Vector{
+		X: c.Radius + 1e-7,
+		Y: c.Radius + 1e-7,
+		Z: c.Radius + 1e-7,
+	}
+	return &aabb.AABB{
+		A: geometry.MinComponents(c.A, c.B).SubVector(extent),
+		B: geometry.MaxComponents(c.A, c.B).AddVector(extent),
+	}, true
+}
+
+// SetMaterial sets this object's material
+func (c *Capsule) SetMaterial(m material.Material) {
+	c.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (c *Capsule) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (c *Capsule) IsClosed() bool {
+	return true
+}
+
+// Copy returns a copy of this object
+// a capsule holds no inner primitives, so a shallow copy already has its own material
+func (c *Capsule) Copy() primitive.Primitive {
+	newC := *c
+	return &newC
+}
+
+// Unit returns a capsule of radius 0.5 from the origin to (0, 1, 0)
+func Unit(xOffset, yOffset, zOffset float64) *Capsule {
+	c, _ := (&Capsule{
+		A: geometry.Point{
+			X: 0.0 + xOffset,
+			Y: 0.0 + yOffset,
+			Z: 0.0 + zOffset,
+		},
+		B: geometry.Point{
+			X: 0.0 + xOffset,
+			Y: 1.0 + yOffset,
+			Z: 0.0 + zOffset,
+		},
+		Radius: 0.5,
+	}).Setup()
+	return c
+}
@@ -0,0 +1,123 @@
+package cone
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/disk"
+	"fluorescence/geometry/primitive/primitivelist"
+	"fluorescence/geometry/primitive/uncappedcone"
+	"fluorescence/shading/material"
+)
+
+// Cone represents a capped cone object from a base around A to an apex at B
+// a top radius greater than zero truncates the cone, which is then also capped at B
+type Cone struct {
+	A         geometry.Point `json:"a"`
+	B         geometry.Point `json:"b"`
+	Radius    float64        `json:"radius"`
+	TopRadius float64        `json:"top_radius"`
+	list      *primitivelist.PrimitiveList
+	box       *aabb.AABB
+}
+
+// Setup sets up a cone's internal fields
+func (c *Cone) Setup() (*Cone, error) {
+	uncappedCone, err := (&uncappedcone.UncappedCone{
+		A:                  c.A,
+		B:                  c.B,
+		Radius:             c.Radius,
+		TopRadius:          c.TopRadius,
+		HasInvertedNormals: false,
+	}).Setup()
+	if err != nil {
+		return nil, err
+	}
+	primitives := []primitive.Primitive{uncappedCone}
+	for _, end := range []struct {
+		center, other geometry.Point
+		radius        float64
+	}{{c.A, c.B, c.Radius}, {c.B, c.A, c.TopRadius}} {
+		if end.radius == 0.0 {
+			continue
+		}
+		endCap, err := (&disk.Disk{
+			Center:   end.center,
+			Normal:   end.other.To(end.center).Unit(),
+			Radius:   end.radius,
+			IsCulled: false,
+		}).Setup()
+		if err != nil {
+			return nil, err
+		}
+		primitives = append(primitives, endCap)
+	}
+	primitiveList, err := primitivelist.FromElements(primitives...)
+	if err != nil {
+		return nil, err
+	}
+	c.list = primitiveList
+	c.box, _ = primitiveList.BoundingBox(0, 0)
+	return c, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (c *Cone) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	if c.box.Intersection(ray, tMin, tMax) {
+		return c.list.Intersection(ray, tMin, tMax)
+	}
+	return nil, false
+}
+
+// AllIntersections returns every intersection of this object and a given ray, sorted by time
+func (c *Cone) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	if c.box.Intersection(ray, tMin, tMax) {
+		return c.list.AllIntersections(ray, tMin, tMax)
+	}
+	return nil
+}
+
+// BoundingBox returns an AABB of this object
+func (c *Cone) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return c.box, true
+}
+
+// SetMaterial sets this object's material
+func (c *Cone) SetMaterial(m material.Material) {
+	c.list.SetMaterial(m)
+}
+
+// IsInfinite returns whether this object is infinite
+func (c *Cone) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (c *Cone) IsClosed() bool {
+	return true
+}
+
+// Copy returns a copy of this object with its own side and base, so that copies can be given their own materials
+func (c *Cone) Copy() primitive.Primitive {
+	newC := *c
+	newC.list = c.list.Copy().(*primitivelist.PrimitiveList)
+	return &newC
+}
+
+// Unit returns a cone with a base of radius 1 at the origin and its apex at (0, 1, 0)
+func Unit(xOffset, yOffset, zOffset float64) *Cone {
+	c, _ := (&Cone{
+		A: geometry.Point{
+			X: 0.0 + xOffset,
+			Y: 0.0 + yOffset,
+			Z: 0.0 + zOffset,
+		},
+		B: geometry.Point{
+			X: 0.0 + xOffset,
+			Y: 1.0 + yOffset,
+			Z: 0.0 + zOffset,
+		},
+		Radius: 1.0,
+	}).Setup()
+	return c
+}
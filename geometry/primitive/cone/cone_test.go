@@ -0,0 +1,202 @@
+package cone
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/shading/material"
+	"math"
+	"testing"
+)
+
+var cHit bool
+
+func TestConeIntersectionSideHit(t *testing.T) {
+	c := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.5,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.5) > 1e-9 {
+		t.Errorf("Expected time 4.5 but got %f\n", rh.Time)
+	}
+}
+
+func BenchmarkConeIntersectionSideHit(b *testing.B) {
+	c := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.5,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	cHit = h
+}
+
+func TestConeCopyMaterials(t *testing.T) {
+	c := Unit(0.0, 0.0, 0.0)
+	// each use of an object in a scene is a copy given its own material
+	a, b := c.Copy(), c.Copy()
+	matA, matB := &material.Lambertian{}, &material.Metal{}
+	a.SetMaterial(matA)
+	b.SetMaterial(matB)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.5,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	rhA, _ := a.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	rhB, _ := b.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if rhA.Material != matA || rhB.Material != matB {
+		t.Errorf("Expected each copy to keep its own material but got %v and %v\n", rhA.Material, rhB.Material)
+	}
+}
+
+func TestConeIntersectionBaseHit(t *testing.T) {
+	c := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: -5.0,
+			Z: 0.2,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 1.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-5.0) > 1e-9 {
+		t.Errorf("Expected time 5.0 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Y: -1.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal (0, -1, 0) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func BenchmarkConeIntersectionBaseHit(b *testing.B) {
+	c := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: -5.0,
+			Z: 0.2,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 1.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	cHit = h
+}
+
+func TestConeIntersectionSideMiss(t *testing.T) {
+	c := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.9,
+			Z: 0.5,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	_, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func BenchmarkConeIntersectionSideMiss(b *testing.B) {
+	c := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.9,
+			Z: 0.5,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	cHit = h
+}
+
+func TestConeIntersectionTruncatedTopHit(t *testing.T) {
+	c, _ := (&Cone{
+		A:         geometry.Point{},
+		B:         geometry.Point{Y: 1.0},
+		Radius:    1.0,
+		TopRadius: 0.5,
+	}).Setup()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 5.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.0) > 1e-9 {
+		t.Errorf("Expected time 4 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Y: 1.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal (0, 1, 0) but got %v\n", rh.NormalAtHit)
+	}
+}
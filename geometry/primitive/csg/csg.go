@@ -0,0 +1,193 @@
+package csg
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+)
+
+// Union, Intersection and Difference are the supported ways of combining two primitives
+const (
+	Union        = "union"
+	Intersection = "intersection"
+	Difference   = "difference"
+)
+
+// CSG combines two closed primitives into a single solid
+// a difference is the first operand with the second one cut out of it
+type CSG struct {
+	Operation string  `json:"operation"`
+	A         Operand `json:"a"`
+	B         Operand `json:"b"`
+	a, b      primitive.AllIntersecter
+	box       *aabb.AABB
+}
+
+// Operand is one of the two primitives combined by a CSG
+type Operand struct {
+	TypeName  string              `json:"type"`
+	Data      interface{}         `json:"data"`
+	Primitive primitive.Primitive `json:"-"`
+}
+
+// Setup sets up a CSG's internal fields
+func (c *CSG) Setup() (*CSG, error) {
+	if c.Operation != Union && c.Operation != Intersection && c.Operation != Difference {
+		return nil, fmt.Errorf("invalid csg operation (%s)", c.Operation)
+	}
+	var err error
+	c.a, err = operand(c.A.Primitive)
+	if err != nil {
+		return nil, err
+	}
+	c.b, err = operand(c.B.Primitive)
+	if err != nil {
+		return nil, err
+	}
+	boxA, okA := c.A.Primitive.BoundingBox(geometry.MotionStart, geometry.MotionEnd)
+	boxB, okB := c.B.Primitive.BoundingBox(geometry.MotionStart, geometry.MotionEnd)
+	if !okA || !okB {
+		return nil, fmt.Errorf("no bounding box for csg operand")
+	}
+	switch c.Operation {
+	case Union:
+		c.box = aabb.SurroundingBox(boxA, boxB)
+	case Intersection:
+		c.box = &aabb.AABB{
+			A: geometry.MaxComponents(boxA.A, boxB.A),
+			B: geometry.MinComponents(boxA.B, boxB.B),
+		}
+		if c.box.A.X > c.box.B.X || c.box.A.Y > c.box.B.Y || c.box.A.Z > c.box.B.Z {
+			return nil, fmt.Errorf("csg intersection operands do not overlap")
+		}
+	case Difference:
+		c.box = boxA
+	}
+	return c, nil
+}
+
+// operand checks that a primitive can be combined by a CSG
+func operand(p primitive.Primitive) (primitive.AllIntersecter, error) {
+	if p == nil {
+		return nil, fmt.Errorf("csg operand has no primitive")
+	}
+	if p.IsInfinite() || !p.IsClosed() {
+		return nil, fmt.Errorf("csg operand is not a closed, finite primitive")
+	}
+	intersecter, ok := p.(primitive.AllIntersecter)
+	if !ok {
+		return nil, fmt.Errorf("csg operand cannot report all of its intersections")
+	}
+	return intersecter, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (c *CSG) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !c.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (c *CSG) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	hits := c.AllIntersections(ray, tMin, tMax)
+	if len(hits) == 0 {
+		return false
+	}
+	*rayHit = hits[0]
+	return true
+}
+
+// AllIntersections returns every intersection of this object and a given ray, sorted by time
+// the operands are intersected along the whole line of the ray, so every hit on them toggles
+// between being inside and outside of it, and a hit is kept where it changes whether the ray is inside the combination
+func (c *CSG) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	if !c.box.Intersection(ray, tMin, tMax) {
+		return nil
+	}
+	hitsA := c.a.AllIntersections(ray, -math.MaxFloat64, math.MaxFloat64)
+	if len(hitsA) == 0 && c.Operation != Union {
+		return nil
+	}
+	hitsB := c.b.AllIntersections(ray, -math.MaxFloat64, math.MaxFloat64)
+
+	var hits []material.RayHit
+	insideA, insideB, inside := false, false, false
+	i, j := 0, 0
+	for i < len(hitsA) || j < len(hitsB) {
+		var hit material.RayHit
+		fromB := i == len(hitsA) || (j < len(hitsB) && hitsB[j].Time < hitsA[i].Time)
+		if fromB {
+			hit = hitsB[j]
+			insideB = !insideB
+			j++
+		} else {
+			hit = hitsA[i]
+			insideA = !insideA
+			i++
+		}
+		nowInside := c.contains(insideA, insideB)
+		if nowInside == inside {
+			continue
+		}
+		inside = nowInside
+		if hit.Time < tMin || hit.Time > tMax {
+			continue
+		}
+		if fromB && c.Operation == Difference {
+			// the surface of the cut out operand faces into it, and so out of the difference
+			hit.NormalAtHit = hit.NormalAtHit.Negate()
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
+
+// contains returns whether a point inside or outside of each operand is inside the combination
+func (c *CSG) contains(insideA, insideB bool) bool {
+	switch c.Operation {
+	case Union:
+		return insideA || insideB
+	case Intersection:
+		return insideA && insideB
+	default:
+		return insideA && !insideB
+	}
+}
+
+// BoundingBox returns an AABB for this object
+func (c *CSG) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return c.box, true
+}
+
+// SetMaterial sets the material of both operands
+func (c *CSG) SetMaterial(m material.Material) {
+	c.A.Primitive.SetMaterial(m)
+	c.B.Primitive.SetMaterial(m)
+}
+
+// IsInfinite returns whether this object is infinite
+func (c *CSG) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (c *CSG) IsClosed() bool {
+	return true
+}
+
+// Copy returns a copy of this object with copies of its operands, so each copy can have its own material
+func (c *CSG) Copy() primitive.Primitive {
+	newC := *c
+	newC.A.Primitive = c.A.Primitive.Copy()
+	newC.B.Primitive = c.B.Primitive.Copy()
+	newC.a = newC.A.Primitive.(primitive.AllIntersecter)
+	newC.b = newC.B.Primitive.(primitive.AllIntersecter)
+	return &newC
+}
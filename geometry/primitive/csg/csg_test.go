@@ -0,0 +1,280 @@
+package csg
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/box"
+	"fluorescence/geometry/primitive/rectangle"
+	"fluorescence/geometry/primitive/sphere"
+	"math"
+	"testing"
+)
+
+var csgHit bool
+
+// lens returns the intersection of two unit spheres whose centers are 0.6 apart along X
+func lens() *CSG {
+	c, _ := (&CSG{
+		Operation: Intersection,
+		A:         Operand{Primitive: sphere.Unit(-0.3, 0.0, 0.0)},
+		B:         Operand{Primitive: sphere.Unit(0.3, 0.0, 0.0)},
+	}).Setup()
+	return c
+}
+
+// hollowBlock returns a unit box with a square hole cut through it along Y
+func hollowBlock() *CSG {
+	hole, _ := (&box.Box{
+		A: geometry.Point{X: 0.25, Y: -1.0, Z: 0.25},
+		B: geometry.Point{X: 0.75, Y: 2.0, Z: 0.75},
+	}).Setup()
+	c, _ := (&CSG{
+		Operation: Difference,
+		A:         Operand{Primitive: box.Unit(0.0, 0.0, 0.0)},
+		B:         Operand{Primitive: hole},
+	}).Setup()
+	return c
+}
+
+func TestCSGIntersectionHit(t *testing.T) {
+	c := lens()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.6) > 1e-9 {
+		t.Errorf("Expected time 4.6 but got %f\n", rh.Time)
+	}
+}
+
+func BenchmarkCSGIntersectionHit(b *testing.B) {
+	c := lens()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	csgHit = h
+}
+
+func TestCSGIntersectionMiss(t *testing.T) {
+	c := lens()
+	// inside the second sphere only
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.3,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	_, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func TestCSGUnionAllIntersections(t *testing.T) {
+	c, _ := (&CSG{
+		Operation: Union,
+		A:         Operand{Primitive: sphere.Unit(-0.3, 0.0, 0.0)},
+		B:         Operand{Primitive: sphere.Unit(0.3, 0.0, 0.0)},
+	}).Setup()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	// the surfaces inside the other sphere are not part of the union
+	hits := c.AllIntersections(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if len(hits) != 2 {
+		t.Fatalf("Expected 2 hits but got %d\n", len(hits))
+	}
+	if math.Abs(hits[0].Time-4.2) > 1e-9 || math.Abs(hits[1].Time-5.8) > 1e-9 {
+		t.Errorf("Expected times 4.2 and 5.8 but got %f and %f\n", hits[0].Time, hits[1].Time)
+	}
+}
+
+func TestCSGDifferenceNormal(t *testing.T) {
+	cut, _ := (&sphere.Sphere{
+		Center: geometry.Point{X: 0.0, Y: 0.0, Z: 0.5},
+		Radius: 0.3,
+	}).Setup()
+	c, _ := (&CSG{
+		Operation: Difference,
+		A:         Operand{Primitive: sphere.Unit(0.0, 0.0, 0.0)},
+		B:         Operand{Primitive: cut},
+	}).Setup()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	// the ray passes through the bite taken out of the sphere and hits the bottom of it
+	rh, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.8) > 1e-9 {
+		t.Errorf("Expected time 4.8 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Z: 1.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal (0, 0, 1) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func TestCSGDifferenceHole(t *testing.T) {
+	c := hollowBlock()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.5,
+			Y: 5.0,
+			Z: 0.5,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	_, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) through the hole but got %t\n", h)
+	}
+	r.Direction = geometry.Vector{X: 1.0}
+	r.Origin = geometry.Point{X: -5.0, Y: 0.5, Z: 0.5}
+	hits := c.AllIntersections(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if len(hits) != 4 {
+		t.Fatalf("Expected 4 hits across the hole but got %d\n", len(hits))
+	}
+	for i, x := range []float64{0.0, 0.25, 0.75, 1.0} {
+		if math.Abs(hits[i].Time-(x+5.0)) > 1e-9 {
+			t.Errorf("Expected hit %d at x %f but got time %f\n", i, x, hits[i].Time)
+		}
+	}
+}
+
+func TestCSGAllIntersectionsRange(t *testing.T) {
+	c := hollowBlock()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.1,
+			Y: 0.5,
+			Z: 0.5,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	// starting inside the block, the ray leaves into the hole first
+	rh, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-0.15) > 1e-9 {
+		t.Errorf("Expected time 0.15 but got %f\n", rh.Time)
+	}
+}
+
+func TestCSGFarAllIntersections(t *testing.T) {
+	c := hollowBlock()
+	// far enough away that a fixed step past each hit is lost in rounding
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.5,
+			Y: 0.5,
+			Z: 1e10,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	hits := c.AllIntersections(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	expected := []float64{1e10 - 1.0, 1e10 - 0.75, 1e10 - 0.25, 1e10}
+	if len(hits) != len(expected) {
+		t.Fatalf("Expected %d hits but got %d\n", len(expected), len(hits))
+	}
+	for i, h := range hits {
+		if math.Abs(h.Time-expected[i]) > 1e-4 {
+			t.Errorf("Expected hit %d at time %f but got %f\n", i, expected[i], h.Time)
+		}
+	}
+}
+
+func TestCSGInvalidOperation(t *testing.T) {
+	_, err := (&CSG{
+		Operation: "xor",
+		A:         Operand{Primitive: sphere.Unit(0.0, 0.0, 0.0)},
+		B:         Operand{Primitive: sphere.Unit(0.0, 0.0, 0.0)},
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
+
+func TestCSGOpenOperand(t *testing.T) {
+	_, err := (&CSG{
+		Operation: Union,
+		A:         Operand{Primitive: sphere.Unit(0.0, 0.0, 0.0)},
+		B:         Operand{Primitive: rectangle.Unit(0.0, 0.0, 0.0)},
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
+
+func TestCSGDisjointIntersection(t *testing.T) {
+	_, err := (&CSG{
+		Operation: Intersection,
+		A:         Operand{Primitive: sphere.Unit(0.0, 0.0, 0.0)},
+		B:         Operand{Primitive: sphere.Unit(3.0, 0.0, 0.0)},
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
@@ -0,0 +1,275 @@
+package curve
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+)
+
+// Curve is a cubic Bezier curve swept with a width varying linearly from its start to its end, for hair, fur and grass
+// as a ribbon it is a flat strip always facing the ray, and as a tube it is shaded and hit as a round fiber
+// hits record the curve's direction in Tangent, with U running along the curve and V across its width
+type Curve struct {
+	ControlPoints [4]geometry.Point `json:"control_points"`
+	StartWidth    float64           `json:"start_width"`
+	EndWidth      float64           `json:"end_width"`
+	Mode          string            `json:"mode"` // "ribbon" (the default) or "tube"
+	uStart        float64           // U at the start of the curve, for curves that are segments of a longer strand
+	uEnd          float64
+	maxDepth      int // levels the curve is split into when intersecting it
+	box           *aabb.AABB
+	mat           material.Material
+}
+
+// curveHit is the closest hit found so far while recursively intersecting a curve in ray space
+type curveHit struct {
+	zMin, zMax float64 // range of distances along the ray hits are accepted in
+	u          float64
+	x, y       float64 // position of the curve relative to the ray, across the ray
+	width      float64
+}
+
+// maxCurveDepth limits how finely curves are split, as each level doubles the segments tested
+const maxCurveDepth = 10
+
+// Setup checks the curve's widths and mode and fills in its bounds
+func (c *Curve) Setup() (*Curve, error) {
+	if c.StartWidth < 0.0 || c.EndWidth < 0.0 {
+		return nil, fmt.Errorf("curve width is negative")
+	}
+	if c.StartWidth == 0.0 && c.EndWidth == 0.0 {
+		return nil, fmt.Errorf("curve start and end widths are both 0")
+	}
+	switch c.Mode {
+	case "", "ribbon", "tube":
+	default:
+		return nil, fmt.Errorf("unknown curve mode (%s)", c.Mode)
+	}
+	if c.uStart == 0.0 && c.uEnd == 0.0 {
+		c.uEnd = 1.0
+	}
+
+	halfWidth := math.Max(c.StartWidth, c.EndWidth) / 2.0
+	padding := geometry.Vector{X: halfWidth, Y: halfWidth, Z: halfWidth}
+	// a Bezier curve lies within the convex hull of its control points
+	min, max := c.ControlPoints[0], c.ControlPoints[0]
+	for _, p := range c.ControlPoints[1:] {
+		min = geometry.MinComponents(min, p)
+		max = geometry.MaxComponents(max, p)
+	}
+	c.box = &aabb.AABB{
+		A: min.SubVector(padding),
+		B: max.AddVector(padding),
+	}
+
+	// split the curve until its segments are within a twentieth of its width of straight lines
+	l0 := 0.0
+	for i := 0; i < 2; i++ {
+		d := c.ControlPoints[i].To(c.ControlPoints[i+1]).Sub(c.ControlPoints[i+1].To(c.ControlPoints[i+2]))
+		l0 = math.Max(l0, math.Max(math.Abs(d.X), math.Max(math.Abs(d.Y), math.Abs(d.Z))))
+	}
+	c.maxDepth = 0
+	if l0 > 0.0 {
+		epsilon := 2.0 * halfWidth * 0.05
+		depth := math.Round(math.Log2(math.Sqrt2*6.0*l0/(8.0*epsilon)) / 2.0)
+		c.maxDepth = int(math.Max(0.0, math.Min(maxCurveDepth, depth)))
+	}
+	return c, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (c *Curve) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !c.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+// the curve is moved into a space with the ray along +Z, where it is split until its pieces are nearly straight
+func (c *Curve) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	if !c.box.Intersection(ray, tMin, tMax) {
+		return false
+	}
+	length := ray.Direction.Magnitude()
+	z := ray.Direction.DivScalar(length)
+	x, y := z.Basis()
+	var cp [4]geometry.Point
+	for i, p := range c.ControlPoints {
+		d := ray.Origin.To(p)
+		cp[i] = geometry.Point{X: d.Dot(x), Y: d.Dot(y), Z: d.Dot(z)}
+	}
+	hit := curveHit{
+		zMin: tMin * length,
+		zMax: tMax * length,
+	}
+	if !c.intersectSegment(cp, 0.0, 1.0, c.maxDepth, &hit) {
+		return false
+	}
+
+	_, derivative := evaluate(c.ControlPoints, hit.u)
+	if derivative.Magnitude() == 0.0 {
+		derivative = c.ControlPoints[0].To(c.ControlPoints[3])
+	}
+	tangent := derivative.Unit()
+	// the ribbon faces back along the ray, turned about the curve
+	toRay := z.Negate()
+	facing := toRay.Sub(tangent.MultScalar(toRay.Dot(tangent)))
+	if facing.Magnitude() == 0.0 {
+		facing, _ = tangent.Basis()
+	}
+	facing = facing.Unit()
+	// offset from the curve to the hit, across the ray
+	offset := x.MultScalar(-hit.x).Add(y.MultScalar(-hit.y))
+	across := tangent.Cross(facing)
+
+	normal := facing
+	zHit := hit.zMax
+	if c.Mode == "tube" {
+		// move the hit onto the front of a round fiber around the curve
+		radius := hit.width / 2.0
+		depth := math.Sqrt(math.Max(0.0, radius*radius-offset.Dot(offset)))
+		zHit -= depth
+		if zHit < hit.zMin {
+			return false
+		}
+		normal = offset.Add(facing.MultScalar(depth))
+		normal = normal.Sub(tangent.MultScalar(normal.Dot(tangent)))
+		if normal.Magnitude() == 0.0 {
+			normal = facing
+		}
+		normal = normal.Unit()
+	}
+
+	*rayHit = material.RayHit{
+		Ray:         ray,
+		NormalAtHit: normal,
+		Tangent:     tangent,
+		Time:        zHit / length,
+		U:           c.uStart + hit.u*(c.uEnd-c.uStart),
+		V:           math.Max(0.0, math.Min(1.0, 0.5+offset.Dot(across)/hit.width)),
+		Material:    c.mat,
+	}
+	return true
+}
+
+// intersectSegment intersects the part of the curve between u0 and u1, given by its control points in ray space
+// it records the closest hit in hit, returning whether one was found
+func (c *Curve) intersectSegment(cp [4]geometry.Point, u0, u1 float64, depth int, hit *curveHit) bool {
+	halfWidth := math.Max(c.width(u0), c.width(u1)) / 2.0
+	min, max := cp[0], cp[0]
+	for _, p := range cp[1:] {
+		min = geometry.MinComponents(min, p)
+		max = geometry.MaxComponents(max, p)
+	}
+	// the ray runs along +Z from the origin, so it must pass through the padded bounds of the control points
+	if min.X-halfWidth > 0.0 || max.X+halfWidth < 0.0 || min.Y-halfWidth > 0.0 || max.Y+halfWidth < 0.0 {
+		return false
+	}
+	if max.Z+halfWidth < hit.zMin || min.Z-halfWidth > hit.zMax {
+		return false
+	}
+
+	if depth > 0 {
+		split := subdivide(cp)
+		uMiddle := (u0 + u1) / 2.0
+		hitFirst := c.intersectSegment([4]geometry.Point{split[0], split[1], split[2], split[3]}, u0, uMiddle, depth-1, hit)
+		hitSecond := c.intersectSegment([4]geometry.Point{split[3], split[4], split[5], split[6]}, uMiddle, u1, depth-1, hit)
+		return hitFirst || hitSecond
+	}
+
+	// reject hits past the lines perpendicular to the segment at its ends, which neighboring segments cover
+	edge := (cp[1].Y-cp[0].Y)*-cp[0].Y + cp[0].X*(cp[0].X-cp[1].X)
+	if edge < 0.0 {
+		return false
+	}
+	edge = (cp[2].Y-cp[3].Y)*-cp[3].Y + cp[3].X*(cp[3].X-cp[2].X)
+	if edge < 0.0 {
+		return false
+	}
+
+	// find the closest point to the ray on the segment, treating it as a straight line
+	segmentX, segmentY := cp[3].X-cp[0].X, cp[3].Y-cp[0].Y
+	denominator := segmentX*segmentX + segmentY*segmentY
+	if denominator == 0.0 {
+		return false
+	}
+	w := (-cp[0].X*segmentX - cp[0].Y*segmentY) / denominator
+	w = math.Max(0.0, math.Min(1.0, w))
+	u := u0 + w*(u1-u0)
+	width := c.width(u)
+	p, _ := evaluate(cp, w)
+	if p.X*p.X+p.Y*p.Y > width*width/4.0 {
+		return false
+	}
+	if p.Z < hit.zMin || p.Z > hit.zMax {
+		return false
+	}
+	hit.zMax = p.Z
+	hit.u = u
+	hit.x = p.X
+	hit.y = p.Y
+	hit.width = width
+	return true
+}
+
+// width returns the width of the curve at u
+func (c *Curve) width(u float64) float64 {
+	return c.StartWidth + u*(c.EndWidth-c.StartWidth)
+}
+
+// evaluate returns the point on a cubic Bezier curve at u along with the curve's derivative there
+func evaluate(cp [4]geometry.Point, u float64) (geometry.Point, geometry.Vector) {
+	a := lerp(cp[0], cp[1], u)
+	b := lerp(cp[1], cp[2], u)
+	c := lerp(cp[2], cp[3], u)
+	d := lerp(a, b, u)
+	e := lerp(b, c, u)
+	return lerp(d, e, u), d.To(e).MultScalar(3.0)
+}
+
+// subdivide splits a cubic Bezier curve in half, returning the control points of both halves with the middle one shared
+func subdivide(cp [4]geometry.Point) [7]geometry.Point {
+	a := lerp(cp[0], cp[1], 0.5)
+	b := lerp(cp[1], cp[2], 0.5)
+	c := lerp(cp[2], cp[3], 0.5)
+	d := lerp(a, b, 0.5)
+	e := lerp(b, c, 0.5)
+	return [7]geometry.Point{cp[0], a, d, lerp(d, e, 0.5), e, c, cp[3]}
+}
+
+// lerp returns the point a fraction s of the way from a to b
+func lerp(a, b geometry.Point, s float64) geometry.Point {
+	return a.AddVector(a.To(b).MultScalar(s))
+}
+
+// BoundingBox returns an AABB for this object
+func (c *Curve) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return c.box, true
+}
+
+// SetMaterial sets this object's material
+func (c *Curve) SetMaterial(m material.Material) {
+	c.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (c *Curve) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (c *Curve) IsClosed() bool {
+	return false
+}
+
+// Copy returns a shallow copy of this object
+func (c *Curve) Copy() primitive.Primitive {
+	newC := *c
+	return &newC
+}
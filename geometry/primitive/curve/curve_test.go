@@ -0,0 +1,246 @@
+package curve
+
+import (
+	"fluorescence/geometry"
+	"math"
+	"strings"
+	"testing"
+)
+
+var curveHitSink bool
+
+// straightCurve is a curve along the X axis from 0 to 3, 0.2 wide
+func straightCurve(mode string) *Curve {
+	c, _ := (&Curve{
+		ControlPoints: [4]geometry.Point{
+			{X: 0.0, Y: 0.0, Z: 0.0},
+			{X: 1.0, Y: 0.0, Z: 0.0},
+			{X: 2.0, Y: 0.0, Z: 0.0},
+			{X: 3.0, Y: 0.0, Z: 0.0},
+		},
+		StartWidth: 0.2,
+		EndWidth:   0.2,
+		Mode:       mode,
+	}).Setup()
+	return c
+}
+
+func TestCurveRibbonIntersectionHit(t *testing.T) {
+	c := straightCurve("ribbon")
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.5,
+			Y: 0.05,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-5.0) > 1e-9 {
+		t.Errorf("Expected hit at time 5 but got %f\n", rh.Time)
+	}
+	if math.Abs(rh.U-0.5) > 1e-9 {
+		t.Errorf("Expected U 0.5 but got %f\n", rh.U)
+	}
+	if math.Abs(rh.Tangent.X-1.0) > 1e-9 {
+		t.Errorf("Expected tangent along X but got %v\n", rh.Tangent)
+	}
+	if math.Abs(rh.NormalAtHit.Z-1.0) > 1e-9 {
+		t.Errorf("Expected normal facing the ray but got %v\n", rh.NormalAtHit)
+	}
+	// a quarter of the width from the middle
+	if math.Abs(math.Abs(rh.V-0.5)-0.25) > 1e-9 {
+		t.Errorf("Expected V a quarter from the middle but got %f\n", rh.V)
+	}
+}
+
+func BenchmarkCurveRibbonIntersectionHit(b *testing.B) {
+	c := straightCurve("ribbon")
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.5,
+			Y: 0.05,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	for n := 0; n < b.N; n++ {
+		_, h = c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	curveHitSink = h
+}
+
+func TestCurveTubeIntersectionHit(t *testing.T) {
+	c := straightCurve("tube")
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.5,
+			Y: 0.05,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	// the front of a round fiber of radius 0.1, 0.05 from its axis
+	expected := 5.0 - math.Sqrt(0.1*0.1-0.05*0.05)
+	if math.Abs(rh.Time-expected) > 1e-9 {
+		t.Errorf("Expected hit at time %f but got %f\n", expected, rh.Time)
+	}
+	normal := geometry.Vector{Y: 0.05, Z: math.Sqrt(0.1*0.1 - 0.05*0.05)}.Unit()
+	if rh.NormalAtHit.Sub(normal).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal %v but got %v\n", normal, rh.NormalAtHit)
+	}
+}
+
+func TestCurveIntersectionMiss(t *testing.T) {
+	c := straightCurve("ribbon")
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.5,
+			Y: 0.2,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	_, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func BenchmarkCurveIntersectionMiss(b *testing.B) {
+	c := straightCurve("ribbon")
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.5,
+			Y: 0.2,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	for n := 0; n < b.N; n++ {
+		_, h = c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	curveHitSink = h
+}
+
+func TestCurveCurvedIntersection(t *testing.T) {
+	cp := [4]geometry.Point{
+		{X: 0.0, Y: 0.0, Z: 0.0},
+		{X: 1.0, Y: 2.0, Z: 0.5},
+		{X: 2.0, Y: -2.0, Z: -0.5},
+		{X: 3.0, Y: 0.0, Z: 0.0},
+	}
+	c, err := (&Curve{ControlPoints: cp, StartWidth: 0.05, EndWidth: 0.01}).Setup()
+	if err != nil {
+		t.Fatalf("Expected curve to set up but got %s\n", err)
+	}
+	for _, u := range []float64{0.1, 0.3, 0.6, 0.9} {
+		p, _ := evaluate(cp, u)
+		r := geometry.Ray{
+			Origin:    p.AddVector(geometry.Vector{Z: 5.0}),
+			Direction: geometry.Vector{Z: -1.0},
+		}
+		rh, h := c.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if !h {
+			t.Errorf("Expected true (hit) at u %f but got %t\n", u, h)
+			continue
+		}
+		if math.Abs(rh.U-u) > 1e-2 || math.Abs(rh.Time-5.0) > 1e-2 {
+			t.Errorf("Expected hit at u %f and time 5 but got u %f and time %f\n", u, rh.U, rh.Time)
+		}
+	}
+}
+
+func TestCurveErrors(t *testing.T) {
+	for _, c := range []*Curve{
+		{StartWidth: -1.0, EndWidth: 1.0},
+		{},
+		{StartWidth: 1.0, Mode: "cylinder"},
+	} {
+		_, err := c.Setup()
+		if err == nil {
+			t.Errorf("Expected error for %v\n", c)
+		}
+	}
+}
+
+func TestCurveSetParse(t *testing.T) {
+	strands := `
+# two strands, the second made of two segments
+0.1 0.1  0 0 0  1 0 0  2 0 0  3 0 0
+0.2 0.0  0 1 0  1 1 0  2 1 0  3 1 0  4 1 0  5 1 0  6 1 0
+`
+	curves, err := parseCurves(strings.NewReader(strands), "ribbon")
+	if err != nil {
+		t.Fatalf("Expected curves but got error %s\n", err.Error())
+	}
+	if len(curves) != 3 {
+		t.Fatalf("Expected 3 curves but got %d\n", len(curves))
+	}
+	cs, err := (&CurveSet{Curves: curves}).Setup()
+	if err != nil {
+		t.Fatalf("Expected curve set but got error %s\n", err.Error())
+	}
+	r := geometry.Ray{
+		Origin:    geometry.Point{X: 4.5, Y: 1.0, Z: 5.0},
+		Direction: geometry.Vector{Z: -1.0},
+	}
+	rh, h := cs.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	// U runs along the whole strand
+	if math.Abs(rh.U-0.75) > 1e-9 {
+		t.Errorf("Expected U 0.75 but got %f\n", rh.U)
+	}
+	// past the tip's narrowing width
+	r.Origin.X = 5.9
+	r.Origin.Y = 1.01
+	_, h = cs.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func TestCurveSetParseErrors(t *testing.T) {
+	for _, strands := range []string{
+		"",
+		"0.1 0.1 0 0 0 1 0 0 2 0 0",
+		"0.1 0.1 0 0 0 1 0 0 2 0 0 3 0 0 4 0 0",
+		"0.1 a 0 0 0 1 0 0 2 0 0 3 0 0",
+	} {
+		_, err := parseCurves(strings.NewReader(strands), "")
+		if err == nil {
+			t.Errorf("Expected error for %q\n", strands)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package curve
+
+import (
+	"bufio"
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/bvh"
+	"fluorescence/geometry/primitive/primitivelist"
+	"fluorescence/shading/material"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CurveSet is a group of curves, such as the hairs of a head or the blades of a lawn, kept in its own BVH
+// strands are loaded from a text file with one strand per line, written as its root and tip widths followed by
+// the x, y and z coordinates of 3n+1 control points making n cubic Bezier segments joined end to end
+// lines that are empty or start with # are skipped
+type CurveSet struct {
+	FileName string   `json:"file_name"`
+	Mode     string   `json:"mode"` // "ribbon" (the default) or "tube", for every curve
+	Curves   []*Curve `json:"-"`    // loaded from the file if not set
+	bvh      *bvh.BVH
+	mat      material.Material
+}
+
+// Setup loads the strands if needed and builds the BVH over the curves
+func (cs *CurveSet) Setup() (*CurveSet, error) {
+	if len(cs.Curves) == 0 {
+		curveFile, err := os.Open(cs.FileName)
+		if err != nil {
+			return nil, err
+		}
+		defer curveFile.Close()
+		cs.Curves, err = parseCurves(curveFile, cs.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("curves (%s): %s", cs.FileName, err.Error())
+		}
+	}
+	primitives := make([]primitive.Primitive, len(cs.Curves))
+	for i, c := range cs.Curves {
+		primitives[i] = c
+	}
+	pl, err := primitivelist.FromElements(primitives...)
+	if err != nil {
+		return nil, err
+	}
+	cs.bvh, err = bvh.New(pl)
+	if err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// parseCurves reads strands from the curve text format, splitting each into its Bezier segments
+// the width is interpolated linearly from root to tip, and U runs from 0 to 1 along the whole strand
+func parseCurves(r io.Reader, mode string) ([]*Curve, error) {
+	var curves []*Curve
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		values := make([]float64, len(fields))
+		for i, f := range fields {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNumber, err.Error())
+			}
+			values[i] = v
+		}
+		if len(values) < 14 || (len(values)-2)%3 != 0 || ((len(values)-2)/3-1)%3 != 0 {
+			return nil, fmt.Errorf("line %d: expected two widths and 3n+1 control points", lineNumber)
+		}
+		rootWidth, tipWidth := values[0], values[1]
+		var points []geometry.Point
+		for i := 2; i < len(values); i += 3 {
+			points = append(points, geometry.Point{X: values[i], Y: values[i+1], Z: values[i+2]})
+		}
+		segments := (len(points) - 1) / 3
+		for i := 0; i < segments; i++ {
+			start := float64(i) / float64(segments)
+			end := float64(i+1) / float64(segments)
+			c, err := (&Curve{
+				ControlPoints: [4]geometry.Point{points[3*i], points[3*i+1], points[3*i+2], points[3*i+3]},
+				StartWidth:    rootWidth + start*(tipWidth-rootWidth),
+				EndWidth:      rootWidth + end*(tipWidth-rootWidth),
+				Mode:          mode,
+				uStart:        start,
+				uEnd:          end,
+			}).Setup()
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNumber, err.Error())
+			}
+			curves = append(curves, c)
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	if len(curves) == 0 {
+		return nil, fmt.Errorf("no curves")
+	}
+	return curves, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (cs *CurveSet) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !cs.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (cs *CurveSet) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	if !cs.bvh.IntersectionInto(ray, tMin, tMax, rayHit) {
+		return false
+	}
+	rayHit.Material = cs.mat
+	return true
+}
+
+// BoundingBox returns an AABB for this object
+func (cs *CurveSet) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return cs.bvh.BoundingBox(t0, t1)
+}
+
+// SetMaterial sets the material of every curve in the set
+// the material is kept by the set rather than its curves, so copies sharing the curves may have their own
+func (cs *CurveSet) SetMaterial(m material.Material) {
+	cs.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (cs *CurveSet) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (cs *CurveSet) IsClosed() bool {
+	return false
+}
+
+// Copy returns a shallow copy of this object
+// the copy shares its curves and BVH with the original
+func (cs *CurveSet) Copy() primitive.Primitive {
+	newCS := *cs
+	return &newCS
+}
@@ -72,6 +72,14 @@ func (c *Cylinder) Intersection(ray geometry.Ray, tMin, tMax float64) (*material
 	return nil, false
 }
 
+// AllIntersections returns every intersection of this object and a given ray, sorted by time
+func (c *Cylinder) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	if c.box.Intersection(ray, tMin, tMax) {
+		return c.list.AllIntersections(ray, tMin, tMax)
+	}
+	return nil
+}
+
 // BoundingBox returns an AABB of this object
 func (c *Cylinder) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	return c.list.BoundingBox(0, 0)
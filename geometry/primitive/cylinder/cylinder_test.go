@@ -2,6 +2,7 @@ package cylinder
 
 import (
 	"fluorescence/geometry"
+	"math"
 	"testing"
 )
 
@@ -387,3 +388,27 @@ func BenchmarkCylinderIntersectionAABBMiss(b *testing.B) {
 	}
 	cHit = h
 }
+
+func TestCylinderAllIntersections(t *testing.T) {
+	c := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.5,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	// both hits are on the curved side
+	hits := c.AllIntersections(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if len(hits) != 2 {
+		t.Fatalf("Expected 2 hits but got %d\n", len(hits))
+	}
+	if math.Abs(hits[0].Time-4.0) > 1e-9 || math.Abs(hits[1].Time-6.0) > 1e-9 {
+		t.Errorf("Expected times 4 and 6 but got %f and %f\n", hits[0].Time, hits[1].Time)
+	}
+}
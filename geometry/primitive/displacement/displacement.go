@@ -0,0 +1,280 @@
+package displacement
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/trianglemesh"
+	"fluorescence/shading/material"
+	"fluorescence/shading/texture"
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Displacement is a mesh or rectangle tessellated when it is loaded, with every vertex then moved along
+// the surface's smooth normal by the gray level of a displacement map at its texture coordinates
+// the result is an ordinary triangle mesh, so its bounding box covers the displaced surface
+type Displacement struct {
+	TypeName     string              `json:"type"` // the primitive to displace, a Mesh, TriangleMesh or Rectangle
+	Data         interface{}         `json:"data"`
+	FileName     string              `json:"file_name"`    // displacement map image
+	Scale        float64             `json:"scale"`        // distance moved by a white texel
+	Midlevel     float64             `json:"midlevel"`     // gray level left in place, such as 0.5 for maps displacing both ways
+	Subdivisions int                 `json:"subdivisions"` // number of times every triangle is split into four
+	Primitive    primitive.Primitive `json:"-"`
+	Map          texture.Texture     `json:"-"` // loaded from the file name if not set
+	triangleMesh *trianglemesh.TriangleMesh
+}
+
+// maxSubdivisions keeps tessellation from running out of memory, as each level has four times the triangles
+const maxSubdivisions = 10
+
+// tessellator is implemented by primitives that can be turned into a triangle mesh
+type tessellator interface {
+	TriangleMesh() *trianglemesh.TriangleMesh
+}
+
+// corner is a corner of a triangle, with separate indices for its position and texture coordinates
+// so positions on texture seams are shared, and displaced once, keeping the surface closed
+type corner struct {
+	position, uv int
+}
+
+// surface holds the tessellated triangles while they are being subdivided
+type surface struct {
+	positions  []geometry.Point
+	directions []geometry.Vector // smooth normal at each position, along which it is displaced
+	uvs        [][2]float64
+	triangles  [][3]corner
+	faces      []int // triangle of the original mesh each triangle came from
+	midpoints  map[[2]int]int
+	uvMids     map[[2]int]int
+}
+
+// Setup tessellates and displaces the primitive
+func (d *Displacement) Setup() (*Displacement, error) {
+	if d.Subdivisions < 0 || d.Subdivisions > maxSubdivisions {
+		return nil, fmt.Errorf("displacement subdivisions (%d) not between 0 and %d", d.Subdivisions, maxSubdivisions)
+	}
+	var source *trianglemesh.TriangleMesh
+	switch p := d.Primitive.(type) {
+	case *trianglemesh.TriangleMesh:
+		source = p
+	case tessellator:
+		source = p.TriangleMesh()
+	default:
+		return nil, fmt.Errorf("displacement primitive (%s) cannot be tessellated", d.TypeName)
+	}
+	if len(source.UVs) == 0 {
+		return nil, fmt.Errorf("displacement primitive has no texture coordinates")
+	}
+	if d.Map == nil {
+		image := &texture.Image{
+			FileName:  d.FileName,
+			Gamma:     1.0,
+			Magnitude: 1.0,
+		}
+		err := image.Load()
+		if err != nil {
+			return nil, err
+		}
+		d.Map = image
+	}
+
+	s := newSurface(source)
+	for i := 0; i < d.Subdivisions; i++ {
+		s.subdivide()
+	}
+	s.displace(d.Map, d.Scale, d.Midlevel)
+
+	indices := make([]int, 0, 3*len(s.triangles))
+	uvIndices := make([]int, 0, 3*len(s.triangles))
+	for _, t := range s.triangles {
+		for _, c := range t {
+			indices = append(indices, c.position)
+			uvIndices = append(uvIndices, c.uv)
+		}
+	}
+	var faceMaterials []int
+	if len(source.FaceMaterials) > 0 {
+		faceMaterials = make([]int, len(s.faces))
+		for i, f := range s.faces {
+			faceMaterials[i] = source.FaceMaterials[f]
+		}
+	}
+	triangleMesh, err := (&trianglemesh.TriangleMesh{
+		Vertices:       s.positions,
+		UVs:            s.uvs,
+		Indices:        indices,
+		UVIndices:      uvIndices,
+		ComputeNormals: true,
+		IsCulled:       source.IsCulled,
+		Closed:         source.Closed,
+		Materials:      source.Materials,
+		FaceMaterials:  faceMaterials,
+	}).Setup()
+	if err != nil {
+		return nil, err
+	}
+	d.triangleMesh = triangleMesh
+	return d, nil
+}
+
+// newSurface returns the triangles of a mesh, with smooth normals for displacing its positions
+func newSurface(tm *trianglemesh.TriangleMesh) *surface {
+	s := &surface{
+		positions:  append([]geometry.Point(nil), tm.Vertices...),
+		directions: make([]geometry.Vector, len(tm.Vertices)),
+		uvs:        append([][2]float64(nil), tm.UVs...),
+		midpoints:  map[[2]int]int{},
+		uvMids:     map[[2]int]int{},
+	}
+	for i := 0; i < len(tm.Indices); i += 3 {
+		var t [3]corner
+		for j := 0; j < 3; j++ {
+			t[j] = corner{position: tm.Indices[i+j], uv: tm.UVIndices[i+j]}
+		}
+		s.triangles = append(s.triangles, t)
+		s.faces = append(s.faces, i/3)
+		// the normals are averaged over all of a position's triangles, even across hard edges,
+		// so faces meeting at an edge are displaced the same way and stay joined
+		a, b, c := s.positions[t[0].position], s.positions[t[1].position], s.positions[t[2].position]
+		n := a.To(b).Cross(a.To(c))
+		for j := 0; j < 3; j++ {
+			s.directions[t[j].position] = s.directions[t[j].position].Add(n)
+		}
+	}
+	for i, n := range s.directions {
+		if n.Magnitude() > 0.0 {
+			s.directions[i] = n.Unit()
+		}
+	}
+	return s
+}
+
+// subdivide splits every triangle into four at the midpoints of its edges
+func (s *surface) subdivide() {
+	triangles := make([][3]corner, 0, 4*len(s.triangles))
+	faces := make([]int, 0, 4*len(s.faces))
+	for i, t := range s.triangles {
+		m01 := s.midpoint(t[0], t[1])
+		m12 := s.midpoint(t[1], t[2])
+		m20 := s.midpoint(t[2], t[0])
+		triangles = append(triangles,
+			[3]corner{t[0], m01, m20},
+			[3]corner{m01, t[1], m12},
+			[3]corner{m20, m12, t[2]},
+			[3]corner{m01, m12, m20},
+		)
+		faces = append(faces, s.faces[i], s.faces[i], s.faces[i], s.faces[i])
+	}
+	s.triangles = triangles
+	s.faces = faces
+}
+
+// midpoint returns the corner halfway along an edge, created the first time either triangle sharing the edge asks for it
+func (s *surface) midpoint(a, b corner) corner {
+	positionKey := [2]int{a.position, b.position}
+	if a.position > b.position {
+		positionKey = [2]int{b.position, a.position}
+	}
+	position, ok := s.midpoints[positionKey]
+	if !ok {
+		position = len(s.positions)
+		pa, pb := s.positions[a.position], s.positions[b.position]
+		s.positions = append(s.positions, pa.AddVector(pa.To(pb).MultScalar(0.5)))
+		direction := s.directions[a.position].Add(s.directions[b.position])
+		if direction.Magnitude() > 0.0 {
+			direction = direction.Unit()
+		}
+		s.directions = append(s.directions, direction)
+		s.midpoints[positionKey] = position
+	}
+	uvKey := [2]int{a.uv, b.uv}
+	if a.uv > b.uv {
+		uvKey = [2]int{b.uv, a.uv}
+	}
+	uv, ok := s.uvMids[uvKey]
+	if !ok {
+		uv = len(s.uvs)
+		ua, ub := s.uvs[a.uv], s.uvs[b.uv]
+		s.uvs = append(s.uvs, [2]float64{(ua[0] + ub[0]) / 2.0, (ua[1] + ub[1]) / 2.0})
+		s.uvMids[uvKey] = uv
+	}
+	return corner{position: position, uv: uv}
+}
+
+// displace moves every position along its direction by the displacement map at the first texture coordinates it is used with
+func (s *surface) displace(m texture.Texture, scale, midlevel float64) {
+	displaced := make([]bool, len(s.positions))
+	for _, t := range s.triangles {
+		for _, c := range t {
+			if displaced[c.position] {
+				continue
+			}
+			displaced[c.position] = true
+			uv := s.uvs[c.uv]
+			height := m.Value(wrap(uv[0]), wrap(uv[1])).Luminance() - midlevel
+			s.positions[c.position] = s.positions[c.position].AddVector(s.directions[c.position].MultScalar(scale * height))
+		}
+	}
+}
+
+// wrap maps a texture coordinate outside [0, 1] back into it so that displacement maps repeat
+// coordinates of exactly 1 are kept so the far edge of a map is not sampled from the near one
+func wrap(x float64) float64 {
+	if x < 0.0 || x > 1.0 {
+		return x - math.Floor(x)
+	}
+	return x
+}
+
+// TriangleMesh returns the tessellated and displaced triangle mesh
+func (d *Displacement) TriangleMesh() *trianglemesh.TriangleMesh {
+	return d.triangleMesh
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (d *Displacement) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	return d.triangleMesh.Intersection(ray, tMin, tMax)
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (d *Displacement) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	return d.triangleMesh.IntersectionInto(ray, tMin, tMax, rayHit)
+}
+
+// BoundingBox returns an AABB for this object
+func (d *Displacement) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return d.triangleMesh.BoundingBox(t0, t1)
+}
+
+// TransformedBoundingBox returns an AABB for this object under an affine transform
+func (d *Displacement) TransformedBoundingBox(m mgl64.Mat4, t0, t1 float64) (*aabb.AABB, bool) {
+	return d.triangleMesh.TransformedBoundingBox(m, t0, t1)
+}
+
+// SetMaterial sets the material of every face that did not receive one from a material library
+func (d *Displacement) SetMaterial(m material.Material) {
+	d.triangleMesh.SetMaterial(m)
+}
+
+// IsInfinite returns whether this object is infinite
+func (d *Displacement) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (d *Displacement) IsClosed() bool {
+	return d.triangleMesh.IsClosed()
+}
+
+// Copy returns a shallow copy of this object
+// the copy shares the displaced triangles with the original but may be given its own material
+func (d *Displacement) Copy() primitive.Primitive {
+	newD := *d
+	newD.triangleMesh = d.triangleMesh.Copy().(*trianglemesh.TriangleMesh)
+	return &newD
+}
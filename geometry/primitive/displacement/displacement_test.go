@@ -0,0 +1,136 @@
+package displacement
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/rectangle"
+	"fluorescence/shading"
+	"fluorescence/shading/texture"
+	"math"
+	"testing"
+)
+
+var displacementHit bool
+
+// ramp is a texture whose gray level increases along u
+type ramp struct{}
+
+func (ramp) Value(u, v float64) shading.Color {
+	return shading.Color{Red: u, Green: u, Blue: u}
+}
+
+func raisedRectangle(subdivisions int) *Displacement {
+	d, _ := (&Displacement{
+		Scale:        0.25,
+		Subdivisions: subdivisions,
+		Primitive:    rectangle.Unit(0.0, 0.0, 0.0),
+		Map: &texture.Color{
+			Color: shading.Color{Red: 1.0, Green: 1.0, Blue: 1.0},
+		},
+	}).Setup()
+	return d
+}
+
+func TestDisplacementIntersectionHit(t *testing.T) {
+	d := raisedRectangle(2)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.3,
+			Y: 0.6,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := d.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Errorf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-0.75) > 1e-9 {
+		t.Errorf("Expected hit at time 0.75 but got %f\n", rh.Time)
+	}
+}
+
+func BenchmarkDisplacementIntersectionHit(b *testing.B) {
+	d := raisedRectangle(2)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.3,
+			Y: 0.6,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	for n := 0; n < b.N; n++ {
+		_, h = d.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	displacementHit = h
+}
+
+func TestDisplacementSubdivisions(t *testing.T) {
+	d := raisedRectangle(3)
+	tm := d.TriangleMesh()
+	if tm.TriangleCount() != 2*64 {
+		t.Errorf("Expected 128 triangles but got %d\n", tm.TriangleCount())
+	}
+	// shared edges are split once, leaving a 9 by 9 grid of vertices
+	if len(tm.Vertices) != 81 {
+		t.Errorf("Expected 81 vertices but got %d\n", len(tm.Vertices))
+	}
+}
+
+func TestDisplacementBoundingBox(t *testing.T) {
+	d, err := (&Displacement{
+		Scale:        0.5,
+		Midlevel:     0.5,
+		Subdivisions: 2,
+		Primitive:    rectangle.Unit(0.0, 0.0, 0.0),
+		Map:          ramp{},
+	}).Setup()
+	if err != nil {
+		t.Fatalf("Expected displacement to set up but got %s\n", err)
+	}
+	box, _ := d.BoundingBox(0.0, 0.0)
+	if math.Abs(box.A.Z+0.25) > 1e-6 || math.Abs(box.B.Z-0.25) > 1e-6 {
+		t.Errorf("Expected box to span z from -0.25 to 0.25 but got %f to %f\n", box.A.Z, box.B.Z)
+	}
+
+	// a ray along the ramp's surface direction should hit where the slope reaches it
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.75,
+			Y: 0.5,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := d.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-0.875) > 1e-9 {
+		t.Errorf("Expected hit at time 0.875 but got %f\n", rh.Time)
+	}
+}
+
+func TestDisplacementErrors(t *testing.T) {
+	_, err := (&Displacement{
+		Subdivisions: maxSubdivisions + 1,
+		Primitive:    rectangle.Unit(0.0, 0.0, 0.0),
+		Map:          ramp{},
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error for too many subdivisions\n")
+	}
+}
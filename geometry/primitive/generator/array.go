@@ -0,0 +1,127 @@
+package generator
+
+import (
+	"fluorescence/geometry"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// LinearArray repeats a base object along a line, each copy moved by Offset from the one before
+// the first copy is where the base object is
+type LinearArray struct {
+	Count  int             `json:"count"`
+	Offset geometry.Vector `json:"offset"`
+	Generator
+}
+
+// Grid repeats a base object over a 3D grid, with Spacing between copies along each axis
+// the copy at the grid's first corner is where the base object is
+type Grid struct {
+	Counts  [3]int          `json:"counts"` // copies along X, Y and Z, each defaulting to 1
+	Spacing geometry.Vector `json:"spacing"`
+	Generator
+}
+
+// RadialArray repeats a base object around an axis through Center, turning each copy by the same angle from the one before
+// the copies are spread evenly around a full turn, or from the base object through Angle degrees if it is less
+type RadialArray struct {
+	Count  int             `json:"count"`
+	Center geometry.Point  `json:"center"`
+	Axis   geometry.Vector `json:"axis"`  // defaults to (0, 1, 0)
+	Angle  float64         `json:"angle"` // degrees, defaults to a full turn of 360
+	Generator
+}
+
+// Setup places the copies of a LinearArray
+func (la *LinearArray) Setup() (*LinearArray, error) {
+	if la.Count < 1 {
+		return nil, fmt.Errorf("linear array count is less than 1")
+	}
+	placements := make([]placement, la.Count)
+	for i := range placements {
+		placements[i] = placement{
+			translation: la.Offset.MultScalar(float64(i)),
+			rotation:    mgl64.QuatIdent(),
+			scale:       geometry.Vector{X: 1.0, Y: 1.0, Z: 1.0},
+		}
+	}
+	err := la.setup(placements, rand.New(rand.NewSource(la.Seed)))
+	if err != nil {
+		return nil, fmt.Errorf("linear array: %s", err.Error())
+	}
+	return la, nil
+}
+
+// Setup places the copies of a Grid
+func (g *Grid) Setup() (*Grid, error) {
+	for i := range g.Counts {
+		if g.Counts[i] == 0 {
+			g.Counts[i] = 1
+		}
+		if g.Counts[i] < 0 {
+			return nil, fmt.Errorf("grid count is negative")
+		}
+	}
+	var placements []placement
+	for i := 0; i < g.Counts[0]; i++ {
+		for j := 0; j < g.Counts[1]; j++ {
+			for k := 0; k < g.Counts[2]; k++ {
+				placements = append(placements, placement{
+					translation: geometry.Vector{
+						X: float64(i) * g.Spacing.X,
+						Y: float64(j) * g.Spacing.Y,
+						Z: float64(k) * g.Spacing.Z,
+					},
+					rotation: mgl64.QuatIdent(),
+					scale:    geometry.Vector{X: 1.0, Y: 1.0, Z: 1.0},
+				})
+			}
+		}
+	}
+	err := g.setup(placements, rand.New(rand.NewSource(g.Seed)))
+	if err != nil {
+		return nil, fmt.Errorf("grid: %s", err.Error())
+	}
+	return g, nil
+}
+
+// Setup places the copies of a RadialArray
+func (ra *RadialArray) Setup() (*RadialArray, error) {
+	if ra.Count < 1 {
+		return nil, fmt.Errorf("radial array count is less than 1")
+	}
+	if ra.Axis == geometry.VectorZero {
+		ra.Axis = geometry.Vector{Y: 1.0}
+	}
+	if ra.Angle == 0.0 {
+		ra.Angle = 360.0
+	}
+	// a full turn would put the last copy on the first, so it is split into Count steps rather than Count-1
+	step := 0.0
+	if math.Abs(ra.Angle) >= 360.0 {
+		step = ra.Angle / float64(ra.Count)
+	} else if ra.Count > 1 {
+		step = ra.Angle / float64(ra.Count-1)
+	}
+	axis := ra.Axis.Unit()
+	center := mgl64.Vec3{ra.Center.X, ra.Center.Y, ra.Center.Z}
+	placements := make([]placement, ra.Count)
+	for i := range placements {
+		q := mgl64.QuatRotate(mgl64.DegToRad(step*float64(i)), mgl64.Vec3{axis.X, axis.Y, axis.Z})
+		// turning about the center rather than the origin moves the copy by the center less its turned position
+		offset := center.Sub(q.Rotate(center))
+		placements[i] = placement{
+			translation: geometry.Vector{X: offset.X(), Y: offset.Y(), Z: offset.Z()},
+			rotation:    q,
+			scale:       geometry.Vector{X: 1.0, Y: 1.0, Z: 1.0},
+		}
+	}
+	err := ra.setup(placements, rand.New(rand.NewSource(ra.Seed)))
+	if err != nil {
+		return nil, fmt.Errorf("radial array: %s", err.Error())
+	}
+	return ra, nil
+}
@@ -0,0 +1,190 @@
+package generator
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/bvh"
+	"fluorescence/geometry/primitive/instance"
+	"fluorescence/geometry/primitive/primitivelist"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Generator repeats a base object, placing each copy with its own transform and, optionally, its own material
+// the copies are instances sharing the base object, which is never copied or modified, kept in their own BVH
+// LinearArray, Grid, RadialArray and Scatter each place the copies in their own pattern
+type Generator struct {
+	TypeName        string              `json:"type"`
+	Data            interface{}         `json:"data"`
+	Primitive       primitive.Primitive `json:"-"`
+	MaterialNames   []string            `json:"material_names"`   // materials given to the copies in turn, in place of the scene's material
+	RandomMaterials bool                `json:"random_materials"` // should each copy pick one of the materials at random instead?
+	Seed            int64               `json:"seed"`             // seeds every random choice, so the same seed gives the same copies
+	copies          []*instance.Instance
+	variants        []int // index into materials of each copy
+	materials       []material.Material
+	mat             material.Material
+	bvh             *bvh.BVH
+}
+
+// MaterialSetter is a primitive whose copies can be given materials of their own, such as any generator
+// generators are loaded with the objects, before the materials, so they keep only the names of their materials until then
+type MaterialSetter interface {
+	primitive.Primitive
+	NamedMaterials() []string
+	SetMaterials(materials []material.Material) error
+}
+
+// placement is the transform of a single copy, applied to the base object as a scale, a rotation, then a translation
+type placement struct {
+	translation geometry.Vector
+	rotation    mgl64.Quat
+	scale       geometry.Vector
+}
+
+// setup places a copy of the base object at every placement and builds the BVH over them
+func (g *Generator) setup(placements []placement, rng *rand.Rand) error {
+	if g.Primitive == nil {
+		return fmt.Errorf("generator has no primitive")
+	}
+	if g.Primitive.IsInfinite() {
+		return fmt.Errorf("generator primitive is infinite")
+	}
+	if len(placements) == 0 {
+		return fmt.Errorf("generator makes no copies")
+	}
+	g.copies = make([]*instance.Instance, len(placements))
+	for i, p := range placements {
+		c, err := (&instance.Instance{
+			Translation: p.translation,
+			Rotation:    eulerDegrees(p.rotation),
+			Scale:       p.scale,
+			Primitive:   g.Primitive,
+		}).Setup()
+		if err != nil {
+			return err
+		}
+		g.copies[i] = c
+	}
+	if len(g.MaterialNames) > 0 {
+		g.variants = make([]int, len(g.copies))
+		for i := range g.variants {
+			if g.RandomMaterials {
+				g.variants[i] = rng.Intn(len(g.MaterialNames))
+			} else {
+				g.variants[i] = i % len(g.MaterialNames)
+			}
+		}
+	}
+	return g.build()
+}
+
+// build builds the BVH over the copies
+func (g *Generator) build() error {
+	primitives := make([]primitive.Primitive, len(g.copies))
+	for i, c := range g.copies {
+		primitives[i] = c
+	}
+	pl, err := primitivelist.FromElements(primitives...)
+	if err != nil {
+		return err
+	}
+	g.bvh, err = bvh.New(pl)
+	return err
+}
+
+// eulerDegrees returns the angles in degrees about the X, then Y, then Z axes making up a rotation,
+// as an instance takes them
+func eulerDegrees(q mgl64.Quat) geometry.Vector {
+	m := q.Normalize().Mat4()
+	// the rotation is Rz * Ry * Rx, whose bottom left entry is -sin(y)
+	y := math.Asin(math.Max(-1.0, math.Min(1.0, -m.At(2, 0))))
+	var x, z float64
+	if math.Abs(math.Cos(y)) > 1e-9 {
+		x = math.Atan2(m.At(2, 1), m.At(2, 2))
+		z = math.Atan2(m.At(1, 0), m.At(0, 0))
+	} else {
+		// gimbal lock, where only the sum or difference of x and z matters
+		x = math.Atan2(-m.At(1, 2), m.At(1, 1))
+	}
+	return geometry.Vector{X: x, Y: y, Z: z}.MultScalar(180.0 / math.Pi)
+}
+
+// NamedMaterials returns the names of the materials the copies are given in place of the scene's material
+func (g *Generator) NamedMaterials() []string {
+	return g.MaterialNames
+}
+
+// SetMaterials gives each copy one of the materials named by MaterialNames, overriding the material from SetMaterial
+func (g *Generator) SetMaterials(materials []material.Material) error {
+	if len(materials) != len(g.MaterialNames) {
+		return fmt.Errorf("generator given %d materials for %d material names", len(materials), len(g.MaterialNames))
+	}
+	g.materials = materials
+	g.assignMaterials()
+	return nil
+}
+
+// assignMaterials sets the material of every copy
+func (g *Generator) assignMaterials() {
+	for i, c := range g.copies {
+		if len(g.materials) > 0 {
+			c.SetMaterial(g.materials[g.variants[i]])
+		} else {
+			c.SetMaterial(g.mat)
+		}
+	}
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (g *Generator) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	return g.bvh.Intersection(ray, tMin, tMax)
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (g *Generator) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	return g.bvh.IntersectionInto(ray, tMin, tMax, rayHit)
+}
+
+// BoundingBox returns an AABB for this object
+func (g *Generator) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return g.bvh.BoundingBox(t0, t1)
+}
+
+// SetMaterial sets the material of every copy not given one of the generator's own materials
+func (g *Generator) SetMaterial(m material.Material) {
+	g.mat = m
+	g.assignMaterials()
+}
+
+// IsInfinite returns whether this object is infinite
+func (g *Generator) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (g *Generator) IsClosed() bool {
+	return g.Primitive.IsClosed()
+}
+
+// Copy returns a copy of this object with copies of its own, so they can be given other materials
+// the copies still share the base object
+func (g *Generator) Copy() primitive.Primitive {
+	newG := *g
+	newG.copies = make([]*instance.Instance, len(g.copies))
+	replacements := make(map[primitive.Primitive]primitive.Primitive, len(g.copies))
+	for i, c := range g.copies {
+		newG.copies[i] = c.Copy().(*instance.Instance)
+		replacements[c] = newG.copies[i]
+	}
+	// the copies have the same bounds as the originals, so the new BVH keeps the structure of the old one
+	newG.bvh = g.bvh.Replaced(func(p primitive.Primitive) primitive.Primitive {
+		return replacements[p]
+	})
+	return &newG
+}
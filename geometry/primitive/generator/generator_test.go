@@ -0,0 +1,287 @@
+package generator
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/rectangle"
+	"fluorescence/geometry/primitive/sphere"
+	"fluorescence/shading/material"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+var generatorHit bool
+
+// downRay returns a ray pointing down -Y from above (x, z)
+func downRay(x, z float64) geometry.Ray {
+	return geometry.Ray{
+		Origin: geometry.Point{
+			X: x,
+			Y: 10.0,
+			Z: z,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+}
+
+func TestLinearArrayIntersectionHit(t *testing.T) {
+	la, err := (&LinearArray{
+		Count:     3,
+		Offset:    geometry.Vector{X: 2.0},
+		Generator: Generator{Primitive: sphere.Unit(0.0, 0.0, 0.0)},
+	}).Setup()
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	for _, x := range []float64{0.0, 2.0, 4.0} {
+		rh, h := la.Intersection(downRay(x, 0.0), 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if !h {
+			t.Fatalf("Expected true (hit) at x %f but got %t\n", x, h)
+		}
+		if math.Abs(rh.Time-9.5) > 1e-9 {
+			t.Errorf("Expected time 9.5 at x %f but got %f\n", x, rh.Time)
+		}
+	}
+	for _, x := range []float64{-2.0, 1.0, 6.0} {
+		_, h := la.Intersection(downRay(x, 0.0), 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if h {
+			t.Errorf("Expected false (miss) at x %f but got %t\n", x, h)
+		}
+	}
+}
+
+func BenchmarkLinearArrayIntersectionHit(b *testing.B) {
+	la, _ := (&LinearArray{
+		Count:     100,
+		Offset:    geometry.Vector{X: 2.0},
+		Generator: Generator{Primitive: sphere.Unit(0.0, 0.0, 0.0)},
+	}).Setup()
+	r := downRay(50.0, 0.0)
+	var h bool
+	for n := 0; n < b.N; n++ {
+		_, h = la.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	generatorHit = h
+}
+
+func TestGridIntersectionHit(t *testing.T) {
+	g, err := (&Grid{
+		Counts:    [3]int{3, 0, 2},
+		Spacing:   geometry.Vector{X: 2.0, Y: 5.0, Z: 3.0},
+		Generator: Generator{Primitive: sphere.Unit(0.0, 0.0, 0.0)},
+	}).Setup()
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	if len(g.copies) != 6 {
+		t.Errorf("Expected 6 copies but got %d\n", len(g.copies))
+	}
+	for _, x := range []float64{0.0, 2.0, 4.0} {
+		for _, z := range []float64{0.0, 3.0} {
+			_, h := g.Intersection(downRay(x, z), 1e-7, 1.797693134862315708145274237317043567981e+308)
+			if !h {
+				t.Errorf("Expected true (hit) at (%f, %f) but got %t\n", x, z, h)
+			}
+		}
+	}
+	_, h := g.Intersection(downRay(0.0, 6.0), 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) past the grid but got %t\n", h)
+	}
+}
+
+func TestRadialArrayIntersectionHit(t *testing.T) {
+	ra, err := (&RadialArray{
+		Count:     4,
+		Center:    geometry.Point{X: 1.0},
+		Generator: Generator{Primitive: sphere.Unit(3.0, 0.0, 0.0)},
+	}).Setup()
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	// the copies turn about the Y axis through (1, 0, 0), two units from it
+	for _, p := range [][2]float64{{3.0, 0.0}, {1.0, -2.0}, {-1.0, 0.0}, {1.0, 2.0}} {
+		rh, h := ra.Intersection(downRay(p[0], p[1]), 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if !h {
+			t.Fatalf("Expected true (hit) at (%f, %f) but got %t\n", p[0], p[1], h)
+		}
+		if math.Abs(rh.Time-9.5) > 1e-9 {
+			t.Errorf("Expected time 9.5 at (%f, %f) but got %f\n", p[0], p[1], rh.Time)
+		}
+	}
+}
+
+func TestRadialArrayPartialTurn(t *testing.T) {
+	ra, _ := (&RadialArray{
+		Count:     3,
+		Angle:     90.0,
+		Generator: Generator{Primitive: sphere.Unit(2.0, 0.0, 0.0)},
+	}).Setup()
+	// the last copy lands a quarter turn from the first, rather than short of it
+	for _, p := range [][2]float64{{2.0, 0.0}, {math.Sqrt2, -math.Sqrt2}, {0.0, -2.0}} {
+		_, h := ra.Intersection(downRay(p[0], p[1]), 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if !h {
+			t.Errorf("Expected true (hit) at (%f, %f) but got %t\n", p[0], p[1], h)
+		}
+	}
+}
+
+func TestScatterOnSurface(t *testing.T) {
+	for _, align := range []bool{false, true} {
+		// a sphere resting on the origin, scattered over a unit square facing +Z
+		s, err := (&Scatter{
+			Count:          50,
+			Surface:        rectangle.Unit(0.0, 0.0, 0.0),
+			AlignToNormal:  align,
+			RandomRotation: true,
+			MinScale:       0.5,
+			MaxScale:       1.0,
+			Generator:      Generator{Primitive: sphere.Unit(0.0, 0.5, 0.0), Seed: 3},
+		}).Setup()
+		if err != nil {
+			t.Fatalf("Expected no error but got %s\n", err)
+		}
+		if len(s.copies) != 50 {
+			t.Errorf("Expected 50 copies but got %d\n", len(s.copies))
+		}
+		for _, c := range s.copies {
+			box, _ := c.BoundingBox(0.0, 0.0)
+			center := box.Centroid()
+			if center.X < -0.5 || center.X > 1.5 || center.Y < -1.0 || center.Y > 2.0 {
+				t.Errorf("Expected a copy over the square but got one centered at %v\n", center)
+			}
+			// aligned copies rest on the square, the others stand up through it along +Y
+			if align && (box.A.Z < -1e-6 || box.A.Z > 1e-6) {
+				t.Errorf("Expected an aligned copy resting on the square but its box starts at %v\n", box.A)
+			}
+			if !align && math.Abs(center.Z) > 1e-6 {
+				t.Errorf("Expected an unaligned copy centered on the square but got %v\n", center)
+			}
+		}
+	}
+}
+
+func TestScatterSeed(t *testing.T) {
+	scatter := func(seed int64) *Scatter {
+		s, _ := (&Scatter{
+			Count:     10,
+			Surface:   rectangle.Unit(0.0, 0.0, 0.0),
+			Generator: Generator{Primitive: sphere.Unit(0.0, 0.0, 0.0), Seed: seed},
+		}).Setup()
+		return s
+	}
+	a, b, c := scatter(1), scatter(1), scatter(2)
+	if a.copies[0].Translation != b.copies[0].Translation {
+		t.Errorf("Expected the same seed to place copies the same but got %v and %v\n",
+			a.copies[0].Translation, b.copies[0].Translation)
+	}
+	if a.copies[0].Translation == c.copies[0].Translation {
+		t.Errorf("Expected different seeds to place copies differently but both got %v\n", a.copies[0].Translation)
+	}
+}
+
+func TestGeneratorMaterials(t *testing.T) {
+	la, _ := (&LinearArray{
+		Count:  4,
+		Offset: geometry.Vector{X: 2.0},
+		Generator: Generator{
+			Primitive:     sphere.Unit(0.0, 0.0, 0.0),
+			MaterialNames: []string{"a", "b"},
+		},
+	}).Setup()
+	// each use of the generator is a copy with its own materials
+	g := la.Copy().(*Generator)
+	sceneMaterial := &material.Lambertian{}
+	g.SetMaterial(sceneMaterial)
+	rh, _ := g.Intersection(downRay(2.0, 0.0), 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if rh.Material != sceneMaterial {
+		t.Errorf("Expected the scene material without generator materials but got %v\n", rh.Material)
+	}
+	a, b := &material.Lambertian{}, &material.Metal{}
+	err := g.SetMaterials([]material.Material{a, b})
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	for i, expected := range []material.Material{a, b, a, b} {
+		rh, _ := g.Intersection(downRay(2.0*float64(i), 0.0), 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if rh.Material != expected {
+			t.Errorf("Expected copy %d to cycle through the materials but got %v\n", i, rh.Material)
+		}
+	}
+	other := la.Copy().(*Generator)
+	other.SetMaterial(sceneMaterial)
+	rh, _ = other.Intersection(downRay(2.0, 0.0), 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if rh.Material != sceneMaterial {
+		t.Errorf("Expected another copy of the generator to keep its own material but got %v\n", rh.Material)
+	}
+	if g.SetMaterials([]material.Material{a}) == nil {
+		t.Errorf("Expected an error giving too few materials but got none\n")
+	}
+}
+
+func TestGeneratorMaterialSetters(t *testing.T) {
+	base := sphere.Unit(0.0, 0.0, 0.0)
+	la, _ := (&LinearArray{Count: 2, Offset: geometry.Vector{X: 2.0}, Generator: Generator{Primitive: base}}).Setup()
+	g, _ := (&Grid{Counts: [3]int{2, 1, 1}, Spacing: geometry.Vector{X: 2.0}, Generator: Generator{Primitive: base}}).Setup()
+	ra, _ := (&RadialArray{Count: 2, Center: geometry.Point{X: -2.0}, Generator: Generator{Primitive: base}}).Setup()
+	s, _ := (&Scatter{Surface: rectangle.Unit(0.0, 0.0, 0.0), Count: 2, Generator: Generator{Primitive: base}}).Setup()
+	// the scene gives generators their materials through the interface, both as loaded and as copied for each use
+	for _, p := range []primitive.Primitive{la, g, ra, s, la.Copy(), g.Copy(), ra.Copy(), s.Copy()} {
+		if _, ok := p.(MaterialSetter); !ok {
+			t.Errorf("Expected %T to be a MaterialSetter\n", p)
+		}
+	}
+}
+
+func TestEulerDegrees(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	quaternions := []mgl64.Quat{
+		mgl64.QuatIdent(),
+		mgl64.QuatRotate(math.Pi/2.0, mgl64.Vec3{0.0, 1.0, 0.0}),
+		mgl64.QuatRotate(-math.Pi/2.0, mgl64.Vec3{0.0, 1.0, 0.0}),
+	}
+	for i := 0; i < 20; i++ {
+		axis := mgl64.Vec3{rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()}.Normalize()
+		quaternions = append(quaternions, mgl64.QuatRotate(rng.Float64()*2.0*math.Pi, axis))
+	}
+	for _, q := range quaternions {
+		angles := eulerDegrees(q).MultScalar(math.Pi / 180.0)
+		// rotating about X, then Y, then Z matches the rotation
+		euler := mgl64.QuatRotate(angles.Z, mgl64.Vec3{0.0, 0.0, 1.0}).
+			Mul(mgl64.QuatRotate(angles.Y, mgl64.Vec3{0.0, 1.0, 0.0})).
+			Mul(mgl64.QuatRotate(angles.X, mgl64.Vec3{1.0, 0.0, 0.0}))
+		if !euler.OrientationEqualThreshold(q, 1e-9) {
+			t.Errorf("Expected angles %v to match rotation %v but got %v\n", angles, q, euler)
+		}
+	}
+}
+
+func TestGeneratorSetupErrors(t *testing.T) {
+	_, err := (&LinearArray{Count: 2}).Setup()
+	if err == nil {
+		t.Errorf("Expected an error without a primitive but got none\n")
+	}
+	_, err = (&LinearArray{Generator: Generator{Primitive: sphere.Unit(0.0, 0.0, 0.0)}}).Setup()
+	if err == nil {
+		t.Errorf("Expected an error without copies but got none\n")
+	}
+	_, err = (&Scatter{Count: 2, Generator: Generator{Primitive: sphere.Unit(0.0, 0.0, 0.0)}}).Setup()
+	if err == nil {
+		t.Errorf("Expected an error without a surface but got none\n")
+	}
+	_, err = (&Scatter{
+		Count:     2,
+		Surface:   sphere.Unit(0.0, 0.0, 0.0),
+		Generator: Generator{Primitive: sphere.Unit(0.0, 0.0, 0.0)},
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected an error with a surface that is not a mesh but got none\n")
+	}
+}
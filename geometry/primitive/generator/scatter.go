@@ -0,0 +1,134 @@
+package generator
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/trianglemesh"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Scatter repeats a base object at random points spread evenly over the area of a surface, such as rocks on terrain
+// the base object stands on its origin with +Y up, and copies aligned to the surface have +Y along its normal there
+// the surface must be a triangle mesh or be able to turn itself into one, like meshes and rectangles
+type Scatter struct {
+	Count           int                 `json:"count"`
+	SurfaceTypeName string              `json:"surface_type"`
+	SurfaceData     interface{}         `json:"surface_data"`
+	Surface         primitive.Primitive `json:"-"`
+	AlignToNormal   bool                `json:"align_to_normal"`
+	RandomRotation  bool                `json:"random_rotation"` // should each copy be turned about its up axis at random?
+	MinScale        float64             `json:"min_scale"`       // copies are scaled evenly by a random factor from MinScale to MaxScale,
+	MaxScale        float64             `json:"max_scale"`       // both defaulting to 1
+	Generator
+}
+
+// tessellator is implemented by primitives that can be turned into a triangle mesh
+type tessellator interface {
+	TriangleMesh() *trianglemesh.TriangleMesh
+}
+
+// Setup places the copies of a Scatter
+func (s *Scatter) Setup() (*Scatter, error) {
+	if s.Count < 1 {
+		return nil, fmt.Errorf("scatter count is less than 1")
+	}
+	if s.MinScale == 0.0 && s.MaxScale == 0.0 {
+		s.MinScale, s.MaxScale = 1.0, 1.0
+	}
+	if s.MinScale <= 0.0 || s.MaxScale < s.MinScale {
+		return nil, fmt.Errorf("scatter scale range (%g to %g) is invalid", s.MinScale, s.MaxScale)
+	}
+	var surface *trianglemesh.TriangleMesh
+	switch p := s.Surface.(type) {
+	case *trianglemesh.TriangleMesh:
+		surface = p
+	case tessellator:
+		surface = p.TriangleMesh()
+	default:
+		return nil, fmt.Errorf("scatter surface (%s) cannot be tessellated", s.SurfaceTypeName)
+	}
+
+	// pick triangles in proportion to their area from the running total of areas
+	triangleCount := len(surface.Indices) / 3
+	areas := make([]float64, triangleCount)
+	total := 0.0
+	for i := 0; i < triangleCount; i++ {
+		a, b, c := s.corners(surface, i)
+		total += a.To(b).Cross(a.To(c)).Magnitude() / 2.0
+		areas[i] = total
+	}
+	if total == 0.0 {
+		return nil, fmt.Errorf("scatter surface has no area")
+	}
+
+	rng := rand.New(rand.NewSource(s.Seed))
+	placements := make([]placement, s.Count)
+	for i := range placements {
+		triangle := sort.SearchFloat64s(areas, rng.Float64()*total)
+		if triangle == triangleCount {
+			triangle--
+		}
+		// uniform barycentric coordinates over the triangle
+		r := math.Sqrt(rng.Float64())
+		b0 := 1.0 - r
+		b1 := rng.Float64() * r
+		b2 := 1.0 - b0 - b1
+		a, b, c := s.corners(surface, triangle)
+		position := geometry.Vector(a).MultScalar(b0).
+			Add(geometry.Vector(b).MultScalar(b1)).
+			Add(geometry.Vector(c).MultScalar(b2))
+
+		rotation := mgl64.QuatIdent()
+		if s.RandomRotation {
+			rotation = mgl64.QuatRotate(2.0*math.Pi*rng.Float64(), mgl64.Vec3{0.0, 1.0, 0.0})
+		}
+		if s.AlignToNormal {
+			n := s.normal(surface, triangle, b0, b1, b2)
+			rotation = mgl64.QuatBetweenVectors(mgl64.Vec3{0.0, 1.0, 0.0}, mgl64.Vec3{n.X, n.Y, n.Z}).Mul(rotation)
+		}
+		scale := s.MinScale + rng.Float64()*(s.MaxScale-s.MinScale)
+		placements[i] = placement{
+			translation: position,
+			rotation:    rotation,
+			scale:       geometry.Vector{X: scale, Y: scale, Z: scale},
+		}
+	}
+	err := s.setup(placements, rng)
+	if err != nil {
+		return nil, fmt.Errorf("scatter: %s", err.Error())
+	}
+	return s, nil
+}
+
+// corners returns the corners of a triangle of the surface
+func (s *Scatter) corners(surface *trianglemesh.TriangleMesh, triangle int) (geometry.Point, geometry.Point, geometry.Point) {
+	return surface.Vertices[surface.Indices[3*triangle]],
+		surface.Vertices[surface.Indices[3*triangle+1]],
+		surface.Vertices[surface.Indices[3*triangle+2]]
+}
+
+// normal returns the surface's normal at a point on a triangle given by its barycentric coordinates,
+// interpolated from the surface's normals if it has them
+func (s *Scatter) normal(surface *trianglemesh.TriangleMesh, triangle int, b0, b1, b2 float64) geometry.Vector {
+	a, b, c := s.corners(surface, triangle)
+	face := a.To(b).Cross(a.To(c)).Unit()
+	if len(surface.Normals) == 0 {
+		return face
+	}
+	indices := surface.NormalIndices
+	if len(indices) == 0 {
+		indices = surface.Indices
+	}
+	n := surface.Normals[indices[3*triangle]].MultScalar(b0).
+		Add(surface.Normals[indices[3*triangle+1]].MultScalar(b1)).
+		Add(surface.Normals[indices[3*triangle+2]].MultScalar(b2))
+	if n.Magnitude() == 0.0 {
+		return face
+	}
+	return n.Unit()
+}
@@ -0,0 +1,377 @@
+package heightfield
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"strings"
+)
+
+// Heightfield represents terrain lifted from a grid of height samples, usually the pixels of a grayscale image
+// the grid spans the width along X and the depth along Z from the origin, and each square cell between
+// four samples is split into two triangles
+// cells are grouped into a pyramid of boxes around their lowest and highest samples,
+// a min/max mipmap, so rays only visit cells near their path
+type Heightfield struct {
+	FileName string         `json:"file_name"`
+	Origin   geometry.Point `json:"origin"` // the corner of the image's first pixel, at the height of black
+	Width    float64        `json:"width"`  // extent along X of the image's columns
+	Depth    float64        `json:"depth"`  // extent along Z of the image's rows
+	Height   float64        `json:"height"` // height of white above black
+	// Samples holds heights between 0 and 1 by row, then column, and is loaded from the image file if not set
+	Samples [][]float64 `json:"-"`
+	columns int
+	rows    int
+	normals []geometry.Vector // smooth normal at each sample
+	levels  []level           // mipmap of the cells, from single cells up to one box around all of them
+	box     *aabb.AABB
+	mat     material.Material
+}
+
+// level is one level of a min/max mipmap, holding the height range of blocks of cells
+type level struct {
+	columns, rows int
+	min, max      []float64
+}
+
+// Setup sets up a heightfield's internal fields, loading its image if it has no samples
+func (h *Heightfield) Setup() (*Heightfield, error) {
+	if h.Width <= 0.0 || h.Depth <= 0.0 {
+		return nil, fmt.Errorf("heightfield width or depth is 0 or negative")
+	}
+	if h.Height <= 0.0 {
+		return nil, fmt.Errorf("heightfield height is 0 or negative")
+	}
+	if h.Samples == nil {
+		samples, err := load(h.FileName)
+		if err != nil {
+			return nil, err
+		}
+		h.Samples = samples
+	}
+	h.rows = len(h.Samples)
+	if h.rows < 2 || len(h.Samples[0]) < 2 {
+		return nil, fmt.Errorf("heightfield has fewer than 2 rows or columns of samples")
+	}
+	h.columns = len(h.Samples[0])
+	for _, row := range h.Samples {
+		if len(row) != h.columns {
+			return nil, fmt.Errorf("heightfield rows have different numbers of samples")
+		}
+	}
+	h.buildNormals()
+	h.buildLevels()
+
+	top := h.levels[len(h.levels)-1]
+	h.box = &aabb.AABB{
+		A: geometry.Point{
+			X: h.Origin.X - 1e-7,
+			Y: h.Origin.Y + h.Height*top.min[0] - 1e-7,
+			Z: h.Origin.Z - 1e-7,
+		},
+		B: geometry.Point{
+			X: h.Origin.X + h.Width + 1e-7,
+			Y: h.Origin.Y + h.Height*top.max[0] + 1e-7,
+			Z: h.Origin.Z + h.Depth + 1e-7,
+		},
+	}
+	return h, nil
+}
+
+// load returns the gray levels of an image's pixels, between 0 and 1, by row then column
+func load(fileName string) ([][]float64, error) {
+	imageFile, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer imageFile.Close()
+	var img image.Image
+	if strings.HasSuffix(fileName, ".png") {
+		img, err = png.Decode(imageFile)
+	} else if strings.HasSuffix(fileName, ".jpg") || strings.HasSuffix(fileName, ".jpeg") {
+		img, err = jpeg.Decode(imageFile)
+	} else {
+		return nil, fmt.Errorf("unknown image filetype (%s)", fileName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	samples := make([][]float64, bounds.Dy())
+	for y := range samples {
+		samples[y] = make([]float64, bounds.Dx())
+		for x := range samples[y] {
+			// 16 bit gray keeps the precision of 16 bit elevation maps
+			gray := color.Gray16Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray16)
+			samples[y][x] = float64(gray.Y) / 65535.0
+		}
+	}
+	return samples, nil
+}
+
+// buildNormals finds the smooth normal at each sample from the slope of the heights around it
+func (h *Heightfield) buildNormals() {
+	h.normals = make([]geometry.Vector, h.rows*h.columns)
+	stepX := h.Width / float64(h.columns-1)
+	stepZ := h.Depth / float64(h.rows-1)
+	for j := 0; j < h.rows; j++ {
+		for i := 0; i < h.columns; i++ {
+			// central differences, falling back to one sided differences at the edges
+			i0, i1 := maxInt(i-1, 0), minInt(i+1, h.columns-1)
+			j0, j1 := maxInt(j-1, 0), minInt(j+1, h.rows-1)
+			slopeX := h.Height * (h.Samples[j][i1] - h.Samples[j][i0]) / (float64(i1-i0) * stepX)
+			slopeZ := h.Height * (h.Samples[j1][i] - h.Samples[j0][i]) / (float64(j1-j0) * stepZ)
+			h.normals[j*h.columns+i] = geometry.Vector{X: -slopeX, Y: 1.0, Z: -slopeZ}.Unit()
+		}
+	}
+}
+
+// buildLevels builds the min/max mipmap, halving the cells in each direction at every level
+func (h *Heightfield) buildLevels() {
+	cells := level{
+		columns: h.columns - 1,
+		rows:    h.rows - 1,
+	}
+	cells.min = make([]float64, cells.columns*cells.rows)
+	cells.max = make([]float64, cells.columns*cells.rows)
+	for j := 0; j < cells.rows; j++ {
+		for i := 0; i < cells.columns; i++ {
+			corners := [4]float64{h.Samples[j][i], h.Samples[j][i+1], h.Samples[j+1][i], h.Samples[j+1][i+1]}
+			cells.min[j*cells.columns+i] = math.Min(math.Min(corners[0], corners[1]), math.Min(corners[2], corners[3]))
+			cells.max[j*cells.columns+i] = math.Max(math.Max(corners[0], corners[1]), math.Max(corners[2], corners[3]))
+		}
+	}
+	h.levels = []level{cells}
+	for below := cells; below.columns > 1 || below.rows > 1; {
+		above := level{
+			columns: (below.columns + 1) / 2,
+			rows:    (below.rows + 1) / 2,
+		}
+		above.min = make([]float64, above.columns*above.rows)
+		above.max = make([]float64, above.columns*above.rows)
+		for j := 0; j < above.rows; j++ {
+			for i := 0; i < above.columns; i++ {
+				low, high := math.MaxFloat64, -math.MaxFloat64
+				for jj := 2 * j; jj < minInt(2*j+2, below.rows); jj++ {
+					for ii := 2 * i; ii < minInt(2*i+2, below.columns); ii++ {
+						low = math.Min(low, below.min[jj*below.columns+ii])
+						high = math.Max(high, below.max[jj*below.columns+ii])
+					}
+				}
+				above.min[j*above.columns+i] = low
+				above.max[j*above.columns+i] = high
+			}
+		}
+		h.levels = append(h.levels, above)
+		below = above
+	}
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (h *Heightfield) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !h.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// node is a block of cells in the mipmap waiting to be visited, with the time the ray enters its box
+type node struct {
+	level, i, j int
+	t           float64
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+// blocks are visited nearest first, and skipped once a nearer hit has been found
+func (h *Heightfield) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	t, ok := h.box.IntersectionDistance(ray, tMin, tMax)
+	if !ok {
+		return false
+	}
+	// each visited block leaves at most three siblings waiting on the stack
+	stack := make([]node, 1, 3*len(h.levels)+1)
+	stack[0] = node{level: len(h.levels) - 1, t: t}
+	best := tMax
+	hitSomething := false
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.t > best {
+			continue
+		}
+		if n.level == 0 {
+			if h.intersectCell(ray, n.i, n.j, tMin, best, rayHit) {
+				best = rayHit.Time
+				hitSomething = true
+			}
+			continue
+		}
+		below := h.levels[n.level-1]
+		var children [4]node
+		count := 0
+		for j := 2 * n.j; j < minInt(2*n.j+2, below.rows); j++ {
+			for i := 2 * n.i; i < minInt(2*n.i+2, below.columns); i++ {
+				box := h.blockBox(n.level-1, i, j)
+				if t, ok := box.IntersectionDistance(ray, tMin, best); ok {
+					children[count] = node{level: n.level - 1, i: i, j: j, t: t}
+					count++
+				}
+			}
+		}
+		// push the farthest first, so the nearest is visited next
+		for a := 1; a < count; a++ {
+			for b := a; b > 0 && children[b].t > children[b-1].t; b-- {
+				children[b], children[b-1] = children[b-1], children[b]
+			}
+		}
+		stack = append(stack, children[:count]...)
+	}
+	return hitSomething
+}
+
+// blockBox returns the box around a block of cells at a level of the mipmap
+func (h *Heightfield) blockBox(l, i, j int) aabb.AABB {
+	lv := h.levels[l]
+	size := 1 << uint(l)
+	i0, i1 := i*size, minInt((i+1)*size, h.columns-1)
+	j0, j1 := j*size, minInt((j+1)*size, h.rows-1)
+	stepX := h.Width / float64(h.columns-1)
+	stepZ := h.Depth / float64(h.rows-1)
+	// padded so that flat blocks still have some thickness
+	return aabb.AABB{
+		A: geometry.Point{
+			X: h.Origin.X + float64(i0)*stepX - 1e-7,
+			Y: h.Origin.Y + h.Height*lv.min[j*lv.columns+i] - 1e-7,
+			Z: h.Origin.Z + float64(j0)*stepZ - 1e-7,
+		},
+		B: geometry.Point{
+			X: h.Origin.X + float64(i1)*stepX + 1e-7,
+			Y: h.Origin.Y + h.Height*lv.max[j*lv.columns+i] + 1e-7,
+			Z: h.Origin.Z + float64(j1)*stepZ + 1e-7,
+		},
+	}
+}
+
+// intersectCell intersects the two triangles of a cell, writing the nearer hit into rayHit
+func (h *Heightfield) intersectCell(ray geometry.Ray, i, j int, tMin, tMax float64, rayHit *material.RayHit) bool {
+	// the corners of the cell, and the two triangles between them
+	samples := [4][2]int{{i, j}, {i + 1, j}, {i, j + 1}, {i + 1, j + 1}}
+	var corners [4]geometry.Point
+	for k, s := range samples {
+		corners[k] = h.point(s[0], s[1])
+	}
+	hitSomething := false
+	for _, tri := range [2][3]int{{0, 1, 3}, {0, 3, 2}} {
+		t, b1, b2, ok := triangle(ray, corners[tri[0]], corners[tri[1]], corners[tri[2]], tMin, tMax)
+		if !ok {
+			continue
+		}
+		tMax = t
+		hitSomething = true
+		n0 := h.normal(samples[tri[0]])
+		n1 := h.normal(samples[tri[1]])
+		n2 := h.normal(samples[tri[2]])
+		hitPoint := ray.PointAt(t)
+		*rayHit = material.RayHit{
+			Ray:         ray,
+			NormalAtHit: n0.MultScalar(1.0 - b1 - b2).Add(n1.MultScalar(b1)).Add(n2.MultScalar(b2)).Unit(),
+			Time:        t,
+			U:           (hitPoint.X - h.Origin.X) / h.Width,
+			V:           1.0 - (hitPoint.Z-h.Origin.Z)/h.Depth,
+			Material:    h.mat,
+		}
+	}
+	return hitSomething
+}
+
+// point returns the position of a sample
+func (h *Heightfield) point(i, j int) geometry.Point {
+	return geometry.Point{
+		X: h.Origin.X + h.Width*float64(i)/float64(h.columns-1),
+		Y: h.Origin.Y + h.Height*h.Samples[j][i],
+		Z: h.Origin.Z + h.Depth*float64(j)/float64(h.rows-1),
+	}
+}
+
+// normal returns the smooth normal at a sample
+func (h *Heightfield) normal(sample [2]int) geometry.Vector {
+	return h.normals[sample[1]*h.columns+sample[0]]
+}
+
+// triangle intersects a ray and a triangle by the Möller-Trumbore algorithm,
+// returning the hit time and the barycentric coordinates of the second and third corners
+func triangle(ray geometry.Ray, a, b, c geometry.Point, tMin, tMax float64) (float64, float64, float64, bool) {
+	ab := a.To(b)
+	ac := a.To(c)
+	pVector := ray.Direction.Cross(ac)
+	determinant := ab.Dot(pVector)
+	if determinant < 1e-12 && determinant > -1e-12 {
+		return 0.0, 0.0, 0.0, false
+	}
+	inverse := 1.0 / determinant
+	tVector := a.To(ray.Origin)
+	u := tVector.Dot(pVector) * inverse
+	if u < 0.0 || u > 1.0 {
+		return 0.0, 0.0, 0.0, false
+	}
+	qVector := tVector.Cross(ab)
+	v := ray.Direction.Dot(qVector) * inverse
+	if v < 0.0 || u+v > 1.0 {
+		return 0.0, 0.0, 0.0, false
+	}
+	t := ac.Dot(qVector) * inverse
+	if t < tMin || t > tMax {
+		return 0.0, 0.0, 0.0, false
+	}
+	return t, u, v, true
+}
+
+// BoundingBox returns an AABB of this object
+func (h *Heightfield) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return h.box, true
+}
+
+// SetMaterial sets this object's material
+func (h *Heightfield) SetMaterial(m material.Material) {
+	h.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (h *Heightfield) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (h *Heightfield) IsClosed() bool {
+	return false
+}
+
+// Copy returns a shallow copy of this object, sharing its samples
+func (h *Heightfield) Copy() primitive.Primitive {
+	newH := *h
+	return &newH
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
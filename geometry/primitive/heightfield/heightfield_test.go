@@ -0,0 +1,259 @@
+package heightfield
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/shading/material"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var hfHit bool
+
+// grid returns a heightfield from the origin to (4, 2, 4) over the given samples
+func grid(samples [][]float64) *Heightfield {
+	h, _ := (&Heightfield{
+		Width:   4.0,
+		Depth:   4.0,
+		Height:  2.0,
+		Samples: samples,
+	}).Setup()
+	return h
+}
+
+// peak returns a heightfield of 3 by 3 samples, rising to its full height in the middle
+func peak() *Heightfield {
+	return grid([][]float64{
+		{0.0, 0.0, 0.0},
+		{0.0, 1.0, 0.0},
+		{0.0, 0.0, 0.0},
+	})
+}
+
+// noise returns a heightfield of n by n random samples
+func noise(n int) *Heightfield {
+	rng := rand.New(rand.NewSource(7))
+	samples := make([][]float64, n)
+	for j := range samples {
+		samples[j] = make([]float64, n)
+		for i := range samples[j] {
+			samples[j][i] = rng.Float64()
+		}
+	}
+	return grid(samples)
+}
+
+func TestHeightfieldIntersectionPeakHit(t *testing.T) {
+	h := peak()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 2.0,
+			Y: 5.0,
+			Z: 2.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	rh, hit := h.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !hit {
+		t.Fatalf("Expected true (hit) but got %t\n", hit)
+	}
+	if math.Abs(rh.Time-3.0) > 1e-9 {
+		t.Errorf("Expected time 3 but got %f\n", rh.Time)
+	}
+	// the peak is symmetric, so its smooth normal points straight up
+	if rh.NormalAtHit.Sub(geometry.Vector{Y: 1.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal (0, 1, 0) but got %v\n", rh.NormalAtHit)
+	}
+	if math.Abs(rh.U-0.5) > 1e-9 || math.Abs(rh.V-0.5) > 1e-9 {
+		t.Errorf("Expected UV (0.5, 0.5) but got (%f, %f)\n", rh.U, rh.V)
+	}
+}
+
+func BenchmarkHeightfieldIntersectionHit(b *testing.B) {
+	h := noise(1025)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -1.0,
+			Y: 3.0,
+			Z: -1.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: -0.5,
+			Z: 1.0,
+		},
+	}
+	var hit bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, hit = h.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	hfHit = hit
+}
+
+func TestHeightfieldIntersectionSlopeHit(t *testing.T) {
+	h := peak()
+	// halfway up the slope toward the peak, the surface is at height 1
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.0,
+			Y: 5.0,
+			Z: 2.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	rh, hit := h.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !hit {
+		t.Fatalf("Expected true (hit) but got %t\n", hit)
+	}
+	if math.Abs(rh.Time-4.0) > 1e-9 {
+		t.Errorf("Expected time 4 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.X >= 0.0 {
+		t.Errorf("Expected normal leaning toward -X but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func TestHeightfieldIntersectionOutsideMiss(t *testing.T) {
+	h := peak()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 5.0,
+			Y: 5.0,
+			Z: 2.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	_, hit := h.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if hit {
+		t.Errorf("Expected false (miss) but got %t\n", hit)
+	}
+}
+
+func TestHeightfieldIntersectionFlatHit(t *testing.T) {
+	h := grid([][]float64{
+		{0.5, 0.5},
+		{0.5, 0.5},
+	})
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 3.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: -1.0,
+			Z: 1.0,
+		},
+	}
+	rh, hit := h.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !hit {
+		t.Fatalf("Expected true (hit) but got %t\n", hit)
+	}
+	if math.Abs(rh.Time-2.0) > 1e-9 {
+		t.Errorf("Expected time 2 but got %f\n", rh.Time)
+	}
+}
+
+func TestHeightfieldMatchesEveryCell(t *testing.T) {
+	h := noise(37)
+	rng := rand.New(rand.NewSource(11))
+	for k := 0; k < 500; k++ {
+		r := geometry.Ray{
+			Origin: geometry.Point{
+				X: rng.Float64()*6.0 - 1.0,
+				Y: rng.Float64() * 4.0,
+				Z: rng.Float64()*6.0 - 1.0,
+			},
+			Direction: geometry.Vector{
+				X: rng.Float64()*2.0 - 1.0,
+				Y: rng.Float64()*2.0 - 1.0,
+				Z: rng.Float64()*2.0 - 1.0,
+			},
+		}
+		// the nearest hit of all cells, one by one
+		var expected material.RayHit
+		expectedHit := false
+		best := 1.797693134862315708145274237317043567981e+308
+		for j := 0; j < h.rows-1; j++ {
+			for i := 0; i < h.columns-1; i++ {
+				if h.intersectCell(r, i, j, 1e-7, best, &expected) {
+					best = expected.Time
+					expectedHit = true
+				}
+			}
+		}
+		rh, hit := h.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if hit != expectedHit {
+			t.Fatalf("Expected %t (hit) for ray %v but got %t\n", expectedHit, r, hit)
+		}
+		if hit && math.Abs(rh.Time-expected.Time) > 1e-9 {
+			t.Errorf("Expected time %f for ray %v but got %f\n", expected.Time, r, rh.Time)
+		}
+	}
+}
+
+func TestHeightfieldLoadImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(x * 85)})
+		}
+	}
+	fileName := filepath.Join(t.TempDir(), "ramp.png")
+	f, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, img)
+	f.Close()
+
+	h, err := (&Heightfield{
+		FileName: fileName,
+		Width:    3.0,
+		Depth:    2.0,
+		Height:   1.0,
+	}).Setup()
+	if err != nil {
+		t.Fatalf("Expected nil but got %s\n", err.Error())
+	}
+	if h.columns != 4 || h.rows != 3 {
+		t.Fatalf("Expected 4 by 3 samples but got %d by %d\n", h.columns, h.rows)
+	}
+	if math.Abs(h.box.B.Y-1.0) > 1e-6 || math.Abs(h.box.A.Y) > 1e-6 {
+		t.Errorf("Expected box from height 0 to 1 but got %v\n", h.box)
+	}
+}
+
+func TestHeightfieldUnevenRows(t *testing.T) {
+	_, err := (&Heightfield{
+		Width:  1.0,
+		Depth:  1.0,
+		Height: 1.0,
+		Samples: [][]float64{
+			{0.0, 0.0},
+			{0.0},
+		},
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
@@ -0,0 +1,108 @@
+package instance
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/transform"
+	"fluorescence/shading/material"
+	"fmt"
+)
+
+// Instance places a shared primitive in the scene with its own transform and, optionally, its own material
+// the shared primitive, usually a mesh with its own BVH, is never copied or modified,
+// so any number of instances can refer to it
+type Instance struct {
+	Translation geometry.Vector     `json:"translation"`
+	Rotation    geometry.Vector     `json:"rotation"` // degrees about the X, then Y, then Z axes
+	Scale       geometry.Vector     `json:"scale"`    // defaults to (1, 1, 1)
+	Primitive   primitive.Primitive `json:"-"`
+	mat         material.Material   // replaces the shared primitive's material if set
+	transform   *transform.Transform
+}
+
+// Setup sets up an Instance's internal fields
+func (i *Instance) Setup() (*Instance, error) {
+	if i.Primitive == nil {
+		return nil, fmt.Errorf("instance has no primitive")
+	}
+	if i.Primitive.IsInfinite() {
+		return nil, fmt.Errorf("instance primitive is infinite")
+	}
+	if i.Scale == (geometry.Vector{}) {
+		i.Scale = geometry.Vector{X: 1.0, Y: 1.0, Z: 1.0}
+	}
+	t, err := (&transform.Transform{
+		Operations: []transform.Operation{
+			{TypeName: "scale", Factors: i.Scale},
+			{TypeName: "rotate", Axis: geometry.Vector{X: 1.0}, AngleDegrees: i.Rotation.X},
+			{TypeName: "rotate", Axis: geometry.Vector{Y: 1.0}, AngleDegrees: i.Rotation.Y},
+			{TypeName: "rotate", Axis: geometry.Vector{Z: 1.0}, AngleDegrees: i.Rotation.Z},
+			{TypeName: "translate", Displacement: i.Translation},
+		},
+		Primitive: i.Primitive,
+	}).Setup()
+	if err != nil {
+		return nil, fmt.Errorf("instance transform: %s", err.Error())
+	}
+	i.transform = t
+	return i, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (i *Instance) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !i.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (i *Instance) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	if !i.transform.IntersectionInto(ray, tMin, tMax, rayHit) {
+		return false
+	}
+	if i.mat != nil {
+		rayHit.Material = i.mat
+	}
+	return true
+}
+
+// AllIntersections returns every intersection of this object and a given ray, sorted by time
+func (i *Instance) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	hits := i.transform.AllIntersections(ray, tMin, tMax)
+	if i.mat != nil {
+		for j := range hits {
+			hits[j].Material = i.mat
+		}
+	}
+	return hits
+}
+
+// BoundingBox returns an AABB for this object
+func (i *Instance) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return i.transform.BoundingBox(t0, t1)
+}
+
+// SetMaterial sets the material of this instance, leaving the shared primitive untouched
+func (i *Instance) SetMaterial(m material.Material) {
+	i.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (i *Instance) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (i *Instance) IsClosed() bool {
+	return i.Primitive.IsClosed()
+}
+
+// Copy returns a shallow copy of this object, sharing the instanced primitive
+func (i *Instance) Copy() primitive.Primitive {
+	newI := *i
+	return &newI
+}
@@ -0,0 +1,170 @@
+package instance
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/sphere"
+	"fluorescence/shading/material"
+	"math"
+	"testing"
+)
+
+var instanceHit bool
+
+// scaledSphere returns an instance of a unit sphere stretched to twice its size along X and moved to (5, 0, 0)
+func scaledSphere() *Instance {
+	i, _ := (&Instance{
+		Translation: geometry.Vector{X: 5.0},
+		Scale:       geometry.Vector{X: 2.0, Y: 1.0, Z: 1.0},
+		Primitive:   sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	return i
+}
+
+func TestInstanceIntersectionHit(t *testing.T) {
+	i := scaledSphere()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := i.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.0) > 1e-9 {
+		t.Errorf("Expected time 4 but got %f\n", rh.Time)
+	}
+	if rh.Ray != r {
+		t.Errorf("Expected the world space ray but got %v\n", rh.Ray)
+	}
+}
+
+func BenchmarkInstanceIntersectionHit(b *testing.B) {
+	i := scaledSphere()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, h = i.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	instanceHit = h
+}
+
+func TestInstanceIntersectionMiss(t *testing.T) {
+	i := scaledSphere()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.6,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	_, h := i.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func TestInstanceNormalUsesInverseTranspose(t *testing.T) {
+	i := scaledSphere()
+	// aim at the object space point (0.18, 0.24, 0.4), which is (5.36, 0.24, 0.4) in world space
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 5.36,
+			Y: 0.24,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := i.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	// the object space normal (0.36, 0.48, 0.8) scaled by the inverse of (2, 1, 1)
+	expected := geometry.Vector{X: 0.18, Y: 0.48, Z: 0.8}.Unit()
+	if rh.NormalAtHit.Sub(expected).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal %v but got %v\n", expected, rh.NormalAtHit)
+	}
+}
+
+func TestInstanceMaterialOverride(t *testing.T) {
+	shared := sphere.Unit(0.0, 0.0, 0.0)
+	sharedMaterial := &material.Lambertian{}
+	shared.SetMaterial(sharedMaterial)
+	overridden, _ := (&Instance{Primitive: shared}).Setup()
+	overrideMaterial := &material.Metal{}
+	overridden.SetMaterial(overrideMaterial)
+	plain, _ := (&Instance{Primitive: shared, Translation: geometry.Vector{Y: 2.0}}).Setup()
+
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, _ := overridden.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if rh.Material != overrideMaterial {
+		t.Errorf("Expected the override material but got %v\n", rh.Material)
+	}
+	r.Origin.Y = 2.0
+	rh, _ = plain.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if rh.Material != sharedMaterial {
+		t.Errorf("Expected the shared material but got %v\n", rh.Material)
+	}
+}
+
+func TestInstanceBoundingBox(t *testing.T) {
+	i, _ := (&Instance{
+		Rotation:  geometry.Vector{Z: 90.0},
+		Scale:     geometry.Vector{X: 4.0, Y: 1.0, Z: 1.0},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	box, _ := i.BoundingBox(0, 0)
+	// the stretched X axis is rotated onto Y, allowing for the padding of the sphere's box
+	if math.Abs(box.B.Y-2.0) > 1e-6 || math.Abs(box.B.X-0.5) > 1e-6 {
+		t.Errorf("Expected max corner (0.5, 2, 0.5) but got %v\n", box.B)
+	}
+}
+
+func TestInstanceZeroScale(t *testing.T) {
+	_, err := (&Instance{
+		Scale:     geometry.Vector{X: 1.0, Y: 0.0, Z: 1.0},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
@@ -0,0 +1,275 @@
+package mesh
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/bvh/tree"
+	"fluorescence/geometry/primitive/trianglemesh"
+	"fluorescence/shading/material"
+	"fluorescence/shading/texture"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Mesh is a triangle mesh loaded from a model file
+type Mesh struct {
+	FileName          string  `json:"file_name"`          // path to the .obj, .ply or .stl file
+	UseMaterials      bool    `json:"use_materials"`      // should materials from the file's .mtl libraries be used?
+	TextureGamma      float64 `json:"texture_gamma"`      // counter-gamma correction for .mtl textures and vertex colors, the scene's if unset
+	ComputeNormals    bool    `json:"compute_normals"`    // should smooth normals be generated if the file has none?
+	IsCulled          bool    `json:"is_culled"`          // whether or not the Mesh's triangles are single-sided
+	Closed            bool    `json:"is_closed"`          // whether or not the Mesh is watertight
+	Subdivisions      int     `json:"subdivisions"`       // levels of subdivision applied when loading, replacing the file's normals
+	SubdivisionScheme string  `json:"subdivision_scheme"` // "catmull_clark" (the default) or "loop", which triangulates first
+	CreaseAngle       float64 `json:"crease_angle"`       // angle in degrees between faces above which their shared edge is kept sharp, or 0 for none
+	triangleMesh      *trianglemesh.TriangleMesh
+}
+
+// Setup loads the model file and builds the Mesh's internal fields
+func (m *Mesh) Setup() (*Mesh, error) {
+	if m.TextureGamma == 0.0 {
+		m.TextureGamma = 2.2
+	}
+	err := m.checkSubdivision()
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(m.FileName)) {
+	case ".obj":
+		objFile, err := os.Open(m.FileName)
+		if err != nil {
+			return nil, err
+		}
+		defer objFile.Close()
+		return m.setupOBJ(objFile, filepath.Dir(m.FileName))
+	case ".ply":
+		plyFile, err := os.Open(m.FileName)
+		if err != nil {
+			return nil, err
+		}
+		defer plyFile.Close()
+		triangleMesh, err := parsePLY(plyFile, m.TextureGamma)
+		if err != nil {
+			return nil, fmt.Errorf("ply (%s): %s", m.FileName, err.Error())
+		}
+		return m.setup(triangleMesh)
+	case ".stl":
+		stlFile, err := os.Open(m.FileName)
+		if err != nil {
+			return nil, err
+		}
+		defer stlFile.Close()
+		triangleMesh, err := parseSTL(stlFile)
+		if err != nil {
+			return nil, fmt.Errorf("stl (%s): %s", m.FileName, err.Error())
+		}
+		return m.setup(triangleMesh)
+	default:
+		return nil, fmt.Errorf("unknown mesh filetype (%s)", m.FileName)
+	}
+}
+
+// TriangleMesh returns the underlying TriangleMesh
+func (m *Mesh) TriangleMesh() *trianglemesh.TriangleMesh {
+	return m.triangleMesh
+}
+
+// Stats returns the build time and tree statistics of the mesh's internal BVH
+func (m *Mesh) Stats() tree.Stats {
+	return m.triangleMesh.Stats()
+}
+
+// VertexColors returns a texture interpolating the mesh's vertex colors, if the model file has any
+func (m *Mesh) VertexColors() (*texture.VertexColor, bool) {
+	return m.triangleMesh.VertexColors()
+}
+
+// setupOBJ builds the Mesh from OBJ data, resolving material libraries relative to directory
+func (m *Mesh) setupOBJ(r io.Reader, directory string) (*Mesh, error) {
+	data, err := parseOBJ(r)
+	if err != nil {
+		return nil, err
+	}
+
+	materials := map[string]material.Material{}
+	if m.UseMaterials {
+		for _, libraryName := range data.materialLibs {
+			libraryFile, err := os.Open(filepath.Join(directory, libraryName))
+			if err != nil {
+				return nil, err
+			}
+			mtlMaterials, err := parseMTL(libraryFile)
+			libraryFile.Close()
+			if err != nil {
+				return nil, err
+			}
+			for name, mtl := range mtlMaterials {
+				materials[name], err = mtl.toMaterial(directory, m.TextureGamma)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if m.Subdivisions > 0 {
+		// subdivide the polygons as written, so quads are not split before Catmull-Clark subdivision
+		polygonMesh, faceMaterials := data.toPolygonMesh(materials)
+		triangleMesh, err := m.subdivide(polygonMesh, faceMaterials)
+		if err != nil {
+			return nil, err
+		}
+		return m.finish(triangleMesh)
+	}
+	triangleMesh, err := data.toTriangleMesh(materials)
+	if err != nil {
+		return nil, err
+	}
+	return m.setup(triangleMesh)
+}
+
+// setup finishes setting up the Mesh around a TriangleMesh whose buffers have been filled
+// the triangles are subdivided first if the Mesh asks for it
+func (m *Mesh) setup(triangleMesh *trianglemesh.TriangleMesh) (*Mesh, error) {
+	if m.Subdivisions > 0 {
+		var err error
+		triangleMesh, err = m.subdivide(newPolygonMesh(triangleMesh), triangleMesh.Materials)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m.finish(triangleMesh)
+}
+
+// finish builds the TriangleMesh with the Mesh's options
+func (m *Mesh) finish(triangleMesh *trianglemesh.TriangleMesh) (*Mesh, error) {
+	triangleMesh.ComputeNormals = m.ComputeNormals
+	triangleMesh.IsCulled = m.IsCulled
+	triangleMesh.Closed = m.Closed
+	var err error
+	m.triangleMesh, err = triangleMesh.Setup()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// toTriangleMesh converts OBJ data into TriangleMesh buffers
+// faces missing normals or texture coordinates while others have them are given flat normals and zero coordinates
+func (data *objData) toTriangleMesh(materials map[string]material.Material) (*trianglemesh.TriangleMesh, error) {
+	tm := &trianglemesh.TriangleMesh{
+		Vertices: data.positions,
+	}
+	hasNormals, hasUVs, hasMaterials := false, false, false
+	for _, f := range data.faces {
+		hasNormals = hasNormals || f.normals[0] >= 0
+		hasUVs = hasUVs || f.uvs[0] >= 0
+		_, ok := materials[f.materialName]
+		hasMaterials = hasMaterials || ok
+	}
+	if hasNormals {
+		tm.Normals = data.normals
+	}
+	if hasUVs {
+		tm.UVs = data.uvs
+	}
+
+	materialSlots := map[string]int{}
+	for _, f := range data.faces {
+		a := data.positions[f.positions[0]]
+		b := data.positions[f.positions[1]]
+		c := data.positions[f.positions[2]]
+		faceNormal := a.To(b).Cross(a.To(c))
+		if faceNormal.Magnitude() == 0.0 {
+			// skip degenerate triangles
+			continue
+		}
+		tm.Indices = append(tm.Indices, f.positions[:]...)
+
+		if hasNormals {
+			if f.normals[0] >= 0 {
+				tm.NormalIndices = append(tm.NormalIndices, f.normals[:]...)
+			} else {
+				tm.Normals = append(tm.Normals, faceNormal.Unit())
+				n := len(tm.Normals) - 1
+				tm.NormalIndices = append(tm.NormalIndices, n, n, n)
+			}
+		}
+		if hasUVs {
+			if f.uvs[0] >= 0 {
+				tm.UVIndices = append(tm.UVIndices, f.uvs[:]...)
+			} else {
+				tm.UVs = append(tm.UVs, [2]float64{0.0, 0.0})
+				n := len(tm.UVs) - 1
+				tm.UVIndices = append(tm.UVIndices, n, n, n)
+			}
+		}
+		if hasMaterials {
+			mat, ok := materials[f.materialName]
+			if !ok {
+				tm.FaceMaterials = append(tm.FaceMaterials, -1)
+				continue
+			}
+			slot, ok := materialSlots[f.materialName]
+			if !ok {
+				slot = len(tm.Materials)
+				materialSlots[f.materialName] = slot
+				tm.Materials = append(tm.Materials, mat)
+			}
+			tm.FaceMaterials = append(tm.FaceMaterials, slot)
+		}
+	}
+	if len(tm.Indices) == 0 {
+		return nil, fmt.Errorf("mesh has no non-degenerate faces")
+	}
+	return tm, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (m *Mesh) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	return m.triangleMesh.Intersection(ray, tMin, tMax)
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (m *Mesh) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	return m.triangleMesh.IntersectionInto(ray, tMin, tMax, rayHit)
+}
+
+// BoundingBox returns an AABB for this object
+func (m *Mesh) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return m.triangleMesh.BoundingBox(t0, t1)
+}
+
+// TransformedBoundingBox returns an AABB for this object under an affine transform
+func (m *Mesh) TransformedBoundingBox(matrix mgl64.Mat4, t0, t1 float64) (*aabb.AABB, bool) {
+	return m.triangleMesh.TransformedBoundingBox(matrix, t0, t1)
+}
+
+// SetMaterial sets the material of every face that did not receive one from a material library
+func (m *Mesh) SetMaterial(mat material.Material) {
+	m.triangleMesh.SetMaterial(mat)
+}
+
+// IsInfinite returns whether this object is infinite
+func (m *Mesh) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (m *Mesh) IsClosed() bool {
+	return m.Closed
+}
+
+// Copy returns a shallow copy of this object
+// the copy shares vertex buffers with the original but may be given its own material
+func (m *Mesh) Copy() primitive.Primitive {
+	newM := *m
+	newM.triangleMesh = m.triangleMesh.Copy().(*trianglemesh.TriangleMesh)
+	return &newM
+}
@@ -0,0 +1,481 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fluorescence/geometry"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+var mHit bool
+
+// unitQuad is a unit square on the XY plane made of a single quad face
+const unitQuad = `
+# unit quad
+v 0.0 0.0 0.0
+v 1.0 0.0 0.0
+v 1.0 1.0 0.0
+v 0.0 1.0 0.0
+vt 0.0 0.0
+vt 1.0 0.0
+vt 1.0 1.0
+vt 0.0 1.0
+vn 0.0 0.0 1.0
+f 1/1/1 2/2/1 3/3/1 4/4/1
+`
+
+func unitMesh(t testing.TB) *Mesh {
+	m, err := (&Mesh{}).setupOBJ(strings.NewReader(unitQuad), "")
+	if err != nil {
+		t.Fatalf("Expected mesh but got error %s\n", err.Error())
+	}
+	return m
+}
+
+func TestParseOBJTriangulatesPolygons(t *testing.T) {
+	data, err := parseOBJ(strings.NewReader(unitQuad))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	if len(data.faces) != 2 {
+		t.Errorf("Expected 2 triangles but got %d\n", len(data.faces))
+	}
+}
+
+func TestParseOBJNegativeIndices(t *testing.T) {
+	data, err := parseOBJ(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\nf -3 -2 -1\n"))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	if data.faces[0].positions != [3]int{0, 1, 2} {
+		t.Errorf("Expected indices [0 1 2] but got %v\n", data.faces[0].positions)
+	}
+}
+
+func TestParseOBJIndexOutOfRange(t *testing.T) {
+	_, err := parseOBJ(strings.NewReader("v 0 0 0\nv 1 0 0\nf 1 2 3\n"))
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
+
+func TestParseMTLMaterialTypes(t *testing.T) {
+	mtl := `
+newmtl matte
+Kd 0.8 0.1 0.1
+newmtl mirror
+Kd 0 0 0
+Ks 0.9 0.9 0.9
+Ns 1000
+illum 3
+newmtl glass
+Ni 1.5
+d 0.1
+`
+	materials, err := parseMTL(strings.NewReader(mtl))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	for name, expected := range map[string]string{
+		"matte":  "*material.Lambertian",
+		"mirror": "*material.Metal",
+		"glass":  "*material.Dielectric",
+	} {
+		m, err := materials[name].toMaterial("", 2.2)
+		if err != nil {
+			t.Fatalf("Expected no error but got %s\n", err.Error())
+		}
+		if got := fmt.Sprintf("%T", m); got != expected {
+			t.Errorf("Expected %s to be %s but got %s\n", name, expected, got)
+		}
+	}
+}
+
+func TestMeshIntersectionHit(t *testing.T) {
+	m := unitMesh(t)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.75,
+			Y: 0.25,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.U-0.75) > 1e-9 || math.Abs(rh.V-0.25) > 1e-9 {
+		t.Errorf("Expected texture coordinates (0.75, 0.25) but got (%f, %f)\n", rh.U, rh.V)
+	}
+	if rh.NormalAtHit != (geometry.Vector{X: 0.0, Y: 0.0, Z: 1.0}) {
+		t.Errorf("Expected normal (0, 0, 1) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func BenchmarkMeshIntersectionHit(b *testing.B) {
+	m := unitMesh(b)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.75,
+			Y: 0.25,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	mHit = h
+}
+
+func TestMeshCopyMaterials(t *testing.T) {
+	m := unitMesh(t)
+	// each use of an object in a scene is a copy given its own material
+	a, b := m.Copy(), m.Copy()
+	matA, matB := &material.Lambertian{}, &material.Metal{}
+	a.SetMaterial(matA)
+	b.SetMaterial(matB)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.5,
+			Y: 0.5,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rhA, _ := a.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	rhB, _ := b.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if rhA.Material != matA || rhB.Material != matB {
+		t.Errorf("Expected each copy to keep its own material but got %v and %v\n", rhA.Material, rhB.Material)
+	}
+}
+
+func TestMeshIntersectionMiss(t *testing.T) {
+	m := unitMesh(t)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.5,
+			Y: 0.5,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	_, h := m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func BenchmarkMeshIntersectionMiss(b *testing.B) {
+	m := unitMesh(b)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.5,
+			Y: 0.5,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	mHit = h
+}
+
+// coloredQuad is a unit square on the XY plane with red, green, blue and white corners
+const coloredQuad = `ply
+format ascii 1.0
+comment unit quad
+element vertex 4
+property float x
+property float y
+property float z
+property uchar red
+property uchar green
+property uchar blue
+element face 1
+property list uchar int vertex_indices
+end_header
+0 0 0 255 0 0
+1 0 0 0 255 0
+1 1 0 0 0 255
+0 1 0 255 255 255
+4 0 1 2 3
+`
+
+// unitSTL is a unit square on the XY plane made of two facets
+const unitSTL = `solid quad
+facet normal 0 0 1
+outer loop
+vertex 0 0 0
+vertex 1 0 0
+vertex 1 1 0
+endloop
+endfacet
+facet normal 0 0 1
+outer loop
+vertex 0 0 0
+vertex 1 1 0
+vertex 0 1 0
+endloop
+endfacet
+endsolid quad
+`
+
+func TestParsePLYASCIIVertexColors(t *testing.T) {
+	tm, err := parsePLY(strings.NewReader(coloredQuad), 1.0)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	tm, err = tm.Setup()
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	if tm.TriangleCount() != 2 {
+		t.Errorf("Expected 2 triangles but got %d\n", tm.TriangleCount())
+	}
+	vertexColors, ok := tm.VertexColors()
+	if !ok {
+		t.Fatalf("Expected vertex colors but got none\n")
+	}
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.0 - 1e-9,
+			Y: 1e-9,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	c := vertexColors.VertexValue(rh.Triangle, rh.Barycentric[0], rh.Barycentric[1])
+	if math.Abs(c.Red) > 1e-6 || math.Abs(c.Green-1.0) > 1e-6 || math.Abs(c.Blue) > 1e-6 {
+		t.Errorf("Expected green at corner (1, 0) but got %v\n", c)
+	}
+}
+
+func TestParsePLYBinary(t *testing.T) {
+	header := "ply\nformat binary_little_endian 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\n" +
+		"element face 1\nproperty list uchar int vertex_indices\nend_header\n"
+	var body bytes.Buffer
+	body.WriteString(header)
+	for _, v := range []float32{0, 0, 0, 1, 0, 0, 0, 1, 0} {
+		binary.Write(&body, binary.LittleEndian, v)
+	}
+	body.WriteByte(3)
+	for _, i := range []int32{0, 1, 2} {
+		binary.Write(&body, binary.LittleEndian, i)
+	}
+	tm, err := parsePLY(&body, 1.0)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	if len(tm.Vertices) != 3 || tm.Vertices[1] != (geometry.Point{X: 1.0, Y: 0.0, Z: 0.0}) {
+		t.Errorf("Expected 3 vertices with (1, 0, 0) second but got %v\n", tm.Vertices)
+	}
+	if len(tm.Indices) != 3 {
+		t.Errorf("Expected 1 triangle but got %d indices\n", len(tm.Indices))
+	}
+}
+
+func TestParseSTLASCII(t *testing.T) {
+	tm, err := parseSTL(strings.NewReader(unitSTL))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	if len(tm.Vertices) != 4 {
+		t.Errorf("Expected 4 merged vertices but got %d\n", len(tm.Vertices))
+	}
+	if len(tm.Indices) != 6 {
+		t.Errorf("Expected 2 triangles but got %d indices\n", len(tm.Indices))
+	}
+}
+
+func TestParseSTLBinary(t *testing.T) {
+	var body bytes.Buffer
+	// binary files may begin with "solid" too
+	header := make([]byte, stlBinaryHeaderSize)
+	copy(header, "solid binary")
+	body.Write(header)
+	binary.Write(&body, binary.LittleEndian, uint32(2))
+	for _, triangle := range [][]float32{
+		{0, 0, 1, 0, 0, 0, 1, 0, 0, 1, 1, 0},
+		{0, 0, 1, 0, 0, 0, 1, 1, 0, 0, 1, 0},
+	} {
+		for _, v := range triangle {
+			binary.Write(&body, binary.LittleEndian, v)
+		}
+		binary.Write(&body, binary.LittleEndian, uint16(0))
+	}
+	tm, err := parseSTL(&body)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	if len(tm.Vertices) != 4 {
+		t.Errorf("Expected 4 merged vertices but got %d\n", len(tm.Vertices))
+	}
+	if len(tm.Indices) != 6 {
+		t.Errorf("Expected 2 triangles but got %d indices\n", len(tm.Indices))
+	}
+}
+
+func TestVertexColorsAbsentWithoutColors(t *testing.T) {
+	m := unitMesh(t)
+	_, ok := m.VertexColors()
+	if ok {
+		t.Errorf("Expected no vertex colors but got %t\n", ok)
+	}
+}
+
+// unitCube is a cube from the origin to (1, 1, 1) made of outward facing quads
+const unitCube = `
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 0 0 1
+v 1 0 1
+v 1 1 1
+v 0 1 1
+f 1 4 3 2
+f 5 6 7 8
+f 1 2 6 5
+f 3 4 8 7
+f 2 3 7 6
+f 1 5 8 4
+`
+
+func TestCatmullClarkSubdivision(t *testing.T) {
+	m, err := (&Mesh{Subdivisions: 2}).setupOBJ(strings.NewReader(unitCube), "")
+	if err != nil {
+		t.Fatalf("Expected mesh but got error %s\n", err.Error())
+	}
+	tm := m.TriangleMesh()
+	// 6 quads become 96 quads, each split into 2 triangles
+	if tm.TriangleCount() != 192 {
+		t.Errorf("Expected 192 triangles but got %d\n", tm.TriangleCount())
+	}
+	// the smooth surface shrinks inside the cube towards a sphere, and stays centered on it
+	center := geometry.Point{X: 0.5, Y: 0.5, Z: 0.5}
+	for _, v := range tm.Vertices {
+		d := center.To(v).Magnitude()
+		if d > math.Sqrt(0.75)+1e-9 || d < 0.25 {
+			t.Errorf("Expected vertex within cube but got %v\n", v)
+		}
+	}
+	box, _ := m.BoundingBox(0.0, 0.0)
+	if math.Abs(box.A.X-(1.0-box.B.X)) > 1e-6 || box.A.X <= 0.0 {
+		t.Errorf("Expected box symmetric and inside the cube but got %v\n", box)
+	}
+}
+
+func TestCatmullClarkCreases(t *testing.T) {
+	m, err := (&Mesh{Subdivisions: 2, CreaseAngle: 45.0}).setupOBJ(strings.NewReader(unitCube), "")
+	if err != nil {
+		t.Fatalf("Expected mesh but got error %s\n", err.Error())
+	}
+	// with every edge creased the cube keeps its shape
+	box, _ := m.BoundingBox(0.0, 0.0)
+	if math.Abs(box.A.X) > 1e-6 || math.Abs(box.B.Y-1.0) > 1e-6 {
+		t.Errorf("Expected creased cube to keep its bounds but got %v\n", box)
+	}
+	r := geometry.Ray{
+		Origin:    geometry.Point{X: 0.3, Y: 0.6, Z: 2.0},
+		Direction: geometry.Vector{X: 0.0, Y: 0.0, Z: -1.0},
+	}
+	rh, h := m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-1.0) > 1e-9 || math.Abs(rh.NormalAtHit.Z-1.0) > 1e-9 {
+		t.Errorf("Expected flat face hit at time 1 but got time %f normal %v\n", rh.Time, rh.NormalAtHit)
+	}
+}
+
+func TestCatmullClarkBoundary(t *testing.T) {
+	m, err := (&Mesh{Subdivisions: 3}).setupOBJ(strings.NewReader(unitQuad), "")
+	if err != nil {
+		t.Fatalf("Expected mesh but got error %s\n", err.Error())
+	}
+	// a single quad is all boundary, so it is subdivided into a grid with its texture coordinates interpolated
+	tm := m.TriangleMesh()
+	if len(tm.Vertices) != 81 {
+		t.Errorf("Expected 81 vertices but got %d\n", len(tm.Vertices))
+	}
+	r := geometry.Ray{
+		Origin:    geometry.Point{X: 0.3, Y: 0.6, Z: 1.0},
+		Direction: geometry.Vector{X: 0.0, Y: 0.0, Z: -1.0},
+	}
+	rh, h := m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.U-0.3) > 1e-9 || math.Abs(rh.V-0.6) > 1e-9 {
+		t.Errorf("Expected uv (0.3, 0.6) but got (%f, %f)\n", rh.U, rh.V)
+	}
+}
+
+func TestLoopSubdivision(t *testing.T) {
+	m, err := (&Mesh{Subdivisions: 2, SubdivisionScheme: "loop"}).setupOBJ(strings.NewReader(unitCube), "")
+	if err != nil {
+		t.Fatalf("Expected mesh but got error %s\n", err.Error())
+	}
+	// 12 triangles become 192
+	tm := m.TriangleMesh()
+	if tm.TriangleCount() != 192 {
+		t.Errorf("Expected 192 triangles but got %d\n", tm.TriangleCount())
+	}
+	// a closed mesh has V - E + F = 2, with E = 3F / 2
+	if len(tm.Vertices)-288+192 != 2 {
+		t.Errorf("Expected 98 vertices but got %d\n", len(tm.Vertices))
+	}
+}
+
+func TestSubdivisionErrors(t *testing.T) {
+	for _, m := range []*Mesh{
+		{Subdivisions: -1},
+		{Subdivisions: maxSubdivisions + 1},
+		{Subdivisions: 1, SubdivisionScheme: "butterfly"},
+		{Subdivisions: 1, CreaseAngle: 200.0},
+	} {
+		_, err := m.Setup()
+		if err == nil {
+			t.Errorf("Expected error for %v\n", m)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package mesh
+
+import (
+	"bufio"
+	"fluorescence/shading"
+	"fluorescence/shading/material"
+	"fluorescence/shading/texture"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mtlMaterial holds the subset of Wavefront MTL material statements that can be mapped onto our materials
+type mtlMaterial struct {
+	diffuse              shading.Color // Kd
+	specular             shading.Color // Ks
+	emission             shading.Color // Ke
+	transmission         shading.Color // Tf
+	hasTransmission      bool
+	specularExponent     float64 // Ns
+	refractiveIndex      float64 // Ni
+	dissolve             float64 // d, or 1 - Tr
+	illumination         int     // illum
+	diffuseTextureName   string  // map_Kd
+	emissionTextureName  string  // map_Ke
+	specularExponentSeen bool
+}
+
+// parseMTL reads the materials of an MTL file, keyed by name
+func parseMTL(r io.Reader) (map[string]*mtlMaterial, error) {
+	materials := map[string]*mtlMaterial{}
+	var current *mtlMaterial
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if fields[0] == "newmtl" {
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("mtl line %d: newmtl has no name", lineNumber)
+			}
+			current = &mtlMaterial{
+				dissolve:        1.0,
+				refractiveIndex: 1.0,
+				illumination:    2,
+			}
+			materials[strings.Join(fields[1:], " ")] = current
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "Kd":
+			current.diffuse, err = parseColor(fields[1:])
+		case "Ks":
+			current.specular, err = parseColor(fields[1:])
+		case "Ke":
+			current.emission, err = parseColor(fields[1:])
+		case "Tf":
+			current.transmission, err = parseColor(fields[1:])
+			current.hasTransmission = true
+		case "Ns":
+			current.specularExponent, err = parseFloat(fields[1:])
+			current.specularExponentSeen = true
+		case "Ni":
+			current.refractiveIndex, err = parseFloat(fields[1:])
+		case "d":
+			current.dissolve, err = parseFloat(fields[1:])
+		case "Tr":
+			var transparency float64
+			transparency, err = parseFloat(fields[1:])
+			current.dissolve = 1.0 - transparency
+		case "illum":
+			var illumination float64
+			illumination, err = parseFloat(fields[1:])
+			current.illumination = int(illumination)
+		case "map_Kd":
+			// options may precede the file name, which is always last
+			current.diffuseTextureName = fields[len(fields)-1]
+		case "map_Ke":
+			current.emissionTextureName = fields[len(fields)-1]
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mtl line %d: %s", lineNumber, err.Error())
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return materials, nil
+}
+
+// toMaterial maps an MTL material onto the closest of our material types
+// transparent or refractive materials become Dielectrics, mirror-like materials become Metals,
+// and everything else becomes Lambertian
+func (m *mtlMaterial) toMaterial(directory string, textureGamma float64) (material.Material, error) {
+	emittance, err := m.texture(m.emission, m.emissionTextureName, directory, textureGamma)
+	if err != nil {
+		return nil, err
+	}
+
+	isTransparent := m.dissolve < 1.0 || m.illumination == 4 || m.illumination == 6 || m.illumination == 7
+	isReflective := m.illumination == 3 || m.illumination == 5 ||
+		(m.diffuse == shading.ColorBlack && m.diffuseTextureName == "" && m.specular != shading.ColorBlack)
+
+	if isTransparent {
+		filter := shading.Color{Red: 1.0, Green: 1.0, Blue: 1.0}
+		if m.hasTransmission {
+			filter = m.transmission
+		}
+		refractiveIndex := m.refractiveIndex
+		if refractiveIndex <= 1.0 {
+			refractiveIndex = 1.5
+		}
+		return &material.Dielectric{
+			ReflectanceTexture: &texture.Color{Color: filter},
+			EmittanceTexture:   emittance,
+			RefractiveIndex:    refractiveIndex,
+		}, nil
+	}
+	if isReflective {
+		// convert the Phong exponent to an approximate roughness
+		fuzziness := 0.0
+		if m.specularExponentSeen {
+			fuzziness = math.Min(1.0, math.Sqrt(2.0/(m.specularExponent+2.0)))
+		}
+		return &material.Metal{
+			ReflectanceTexture: &texture.Color{Color: m.specular},
+			EmittanceTexture:   emittance,
+			Fuzziness:          fuzziness,
+		}, nil
+	}
+	reflectance, err := m.texture(m.diffuse, m.diffuseTextureName, directory, textureGamma)
+	if err != nil {
+		return nil, err
+	}
+	return &material.Lambertian{
+		ReflectanceTexture: reflectance,
+		EmittanceTexture:   emittance,
+	}, nil
+}
+
+// texture returns an image texture if a file name is given, or a solid color texture otherwise
+func (m *mtlMaterial) texture(c shading.Color, fileName, directory string, textureGamma float64) (texture.Texture, error) {
+	if fileName == "" {
+		return &texture.Color{Color: c}, nil
+	}
+	image := &texture.Image{
+		FileName:  filepath.Join(directory, fileName),
+		Gamma:     textureGamma,
+		Magnitude: 1.0,
+	}
+	err := image.Load()
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// parseColor parses an r g b color, where a single value applies to all channels
+func parseColor(fields []string) (shading.Color, error) {
+	values, err := parseFloats(fields, 1)
+	if err != nil {
+		return shading.ColorBlack, err
+	}
+	if len(values) < 3 {
+		return shading.Color{Red: values[0], Green: values[0], Blue: values[0]}, nil
+	}
+	return shading.Color{Red: values[0], Green: values[1], Blue: values[2]}, nil
+}
+
+// parseFloat parses a single float
+func parseFloat(fields []string) (float64, error) {
+	if len(fields) < 1 {
+		return 0.0, fmt.Errorf("expected a value")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,196 @@
+package mesh
+
+import (
+	"bufio"
+	"fluorescence/geometry"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// objData holds the raw contents of a Wavefront OBJ file with all faces triangulated
+// the untriangulated polygons are kept as well for subdivision
+type objData struct {
+	positions    []geometry.Point
+	normals      []geometry.Vector
+	uvs          [][2]float64
+	faces        []objFace
+	polygons     []objPolygon
+	materialLibs []string
+}
+
+// objFace is a single triangle referencing the vertex attributes of an objData
+// normal and uv indices are -1 when the face does not specify them
+type objFace struct {
+	positions    [3]int
+	normals      [3]int
+	uvs          [3]int
+	materialName string
+}
+
+// objPolygon is a face of an OBJ file as it was written, before triangulation
+type objPolygon struct {
+	vertices     []objVertex
+	materialName string
+}
+
+// objVertex is one corner of an OBJ face
+type objVertex struct {
+	position int
+	normal   int
+	uv       int
+}
+
+// parseOBJ reads the geometry statements of an OBJ file, ignoring groups, smoothing groups and other unsupported statements
+// polygons with more than three vertices are triangulated as fans
+func parseOBJ(r io.Reader) (*objData, error) {
+	data := &objData{}
+	currentMaterial := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "v":
+			values, err := parseFloats(fields[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: %s", lineNumber, err.Error())
+			}
+			data.positions = append(data.positions, geometry.Point{X: values[0], Y: values[1], Z: values[2]})
+		case "vn":
+			values, err := parseFloats(fields[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: %s", lineNumber, err.Error())
+			}
+			data.normals = append(data.normals, geometry.Vector{X: values[0], Y: values[1], Z: values[2]}.Unit())
+		case "vt":
+			values, err := parseFloats(fields[1:], 1)
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: %s", lineNumber, err.Error())
+			}
+			uv := [2]float64{values[0], 0.0}
+			if len(values) > 1 {
+				uv[1] = values[1]
+			}
+			data.uvs = append(data.uvs, uv)
+		case "f":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("obj line %d: face has fewer than 3 vertices", lineNumber)
+			}
+			vertices := make([]objVertex, 0, len(fields)-1)
+			for _, f := range fields[1:] {
+				vertex, err := data.parseVertex(f)
+				if err != nil {
+					return nil, fmt.Errorf("obj line %d: %s", lineNumber, err.Error())
+				}
+				vertices = append(vertices, vertex)
+			}
+			for i := 1; i < len(vertices)-1; i++ {
+				data.faces = append(data.faces, newOBJFace(vertices[0], vertices[i], vertices[i+1], currentMaterial))
+			}
+			data.polygons = append(data.polygons, objPolygon{vertices: vertices, materialName: currentMaterial})
+		case "usemtl":
+			if len(fields) > 1 {
+				currentMaterial = strings.Join(fields[1:], " ")
+			} else {
+				currentMaterial = ""
+			}
+		case "mtllib":
+			data.materialLibs = append(data.materialLibs, fields[1:]...)
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	if len(data.faces) == 0 {
+		return nil, fmt.Errorf("obj has no faces")
+	}
+	return data, nil
+}
+
+// parseVertex parses a face vertex of the form v, v/vt, v//vn, or v/vt/vn
+// indices are converted to be zero-based, resolving negative (relative) indices
+func (data *objData) parseVertex(s string) (objVertex, error) {
+	parts := strings.Split(s, "/")
+	vertex := objVertex{
+		normal: -1,
+		uv:     -1,
+	}
+	var err error
+	vertex.position, err = resolveIndex(parts[0], len(data.positions))
+	if err != nil {
+		return vertex, err
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		vertex.uv, err = resolveIndex(parts[1], len(data.uvs))
+		if err != nil {
+			return vertex, err
+		}
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		vertex.normal, err = resolveIndex(parts[2], len(data.normals))
+		if err != nil {
+			return vertex, err
+		}
+	}
+	return vertex, nil
+}
+
+// newOBJFace creates a triangle from three face vertices
+func newOBJFace(a, b, c objVertex, materialName string) objFace {
+	face := objFace{
+		positions:    [3]int{a.position, b.position, c.position},
+		normals:      [3]int{a.normal, b.normal, c.normal},
+		uvs:          [3]int{a.uv, b.uv, c.uv},
+		materialName: materialName,
+	}
+	// attributes are only used if all three corners have them
+	if a.normal < 0 || b.normal < 0 || c.normal < 0 {
+		face.normals = [3]int{-1, -1, -1}
+	}
+	if a.uv < 0 || b.uv < 0 || c.uv < 0 {
+		face.uvs = [3]int{-1, -1, -1}
+	}
+	return face
+}
+
+// resolveIndex converts a one-based or negative OBJ index into a zero-based index
+func resolveIndex(s string, count int) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		i = count + i
+	} else {
+		i--
+	}
+	if i < 0 || i >= count {
+		return 0, fmt.Errorf("index (%s) out of range", s)
+	}
+	return i, nil
+}
+
+// parseFloats parses at least min floats from a list of fields
+func parseFloats(fields []string, min int) ([]float64, error) {
+	if len(fields) < min {
+		return nil, fmt.Errorf("expected at least %d values but got %d", min, len(fields))
+	}
+	values := make([]float64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,370 @@
+package mesh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/trianglemesh"
+	"fluorescence/shading"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// plyElement is an element declared in a PLY header, such as vertex or face
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// plyProperty is a property of a PLY element
+// list properties have a countType giving the type of their length prefix
+type plyProperty struct {
+	name      string
+	valueType string
+	countType string
+}
+
+// plyReader reads values from the body of a PLY file
+type plyReader interface {
+	read(valueType string) (float64, error)
+}
+
+// plyASCIIReader reads whitespace-separated values
+type plyASCIIReader struct {
+	scanner *bufio.Scanner
+}
+
+// plyBinaryReader reads packed values in a given byte order
+type plyBinaryReader struct {
+	r      io.Reader
+	order  binary.ByteOrder
+	buffer [8]byte
+}
+
+// parsePLY reads the vertices and faces of a PLY file into TriangleMesh buffers
+// vertex colors are counter-gamma corrected by colorGamma; polygons are triangulated as fans
+func parsePLY(r io.Reader, colorGamma float64) (*trianglemesh.TriangleMesh, error) {
+	br := bufio.NewReader(r)
+	format, elements, err := parsePLYHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader plyReader
+	switch format {
+	case "ascii":
+		scanner := bufio.NewScanner(br)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		scanner.Split(bufio.ScanWords)
+		reader = &plyASCIIReader{scanner: scanner}
+	case "binary_little_endian":
+		reader = &plyBinaryReader{r: br, order: binary.LittleEndian}
+	case "binary_big_endian":
+		reader = &plyBinaryReader{r: br, order: binary.BigEndian}
+	default:
+		return nil, fmt.Errorf("ply format (%s) not supported", format)
+	}
+
+	tm := &trianglemesh.TriangleMesh{}
+	for _, element := range elements {
+		switch element.name {
+		case "vertex":
+			err = readPLYVertices(reader, element, tm, colorGamma)
+		case "face":
+			err = readPLYFaces(reader, element, tm)
+		default:
+			err = skipPLYElement(reader, element)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(tm.Indices) == 0 {
+		return nil, fmt.Errorf("ply has no faces")
+	}
+	return tm, nil
+}
+
+// parsePLYHeader reads the header up to and including end_header, returning the format and elements
+func parsePLYHeader(br *bufio.Reader) (string, []*plyElement, error) {
+	line, err := br.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "ply" {
+		return "", nil, fmt.Errorf("not a ply file")
+	}
+	format := ""
+	var elements []*plyElement
+	for {
+		line, err = br.ReadString('\n')
+		if err != nil {
+			return "", nil, fmt.Errorf("ply header has no end_header")
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "format":
+			if len(fields) < 2 {
+				return "", nil, fmt.Errorf("ply format has no type")
+			}
+			format = fields[1]
+		case "element":
+			if len(fields) < 3 {
+				return "", nil, fmt.Errorf("ply element (%s) is malformed", strings.TrimSpace(line))
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return "", nil, err
+			}
+			elements = append(elements, &plyElement{
+				name:  fields[1],
+				count: count,
+			})
+		case "property":
+			if len(elements) == 0 {
+				return "", nil, fmt.Errorf("ply property declared before any element")
+			}
+			element := elements[len(elements)-1]
+			if len(fields) >= 5 && fields[1] == "list" {
+				element.properties = append(element.properties, plyProperty{
+					name:      fields[4],
+					valueType: fields[3],
+					countType: fields[2],
+				})
+			} else if len(fields) >= 3 {
+				element.properties = append(element.properties, plyProperty{
+					name:      fields[2],
+					valueType: fields[1],
+				})
+			} else {
+				return "", nil, fmt.Errorf("ply property (%s) is malformed", strings.TrimSpace(line))
+			}
+		case "end_header":
+			return format, elements, nil
+		}
+	}
+}
+
+// readPLYVertices reads positions and any normals, texture coordinates and colors
+func readPLYVertices(reader plyReader, element *plyElement, tm *trianglemesh.TriangleMesh, colorGamma float64) error {
+	hasNormals, hasUVs, hasColors := false, false, false
+	for _, p := range element.properties {
+		switch p.name {
+		case "nx":
+			hasNormals = true
+		case "u", "s", "texture_u", "texture_s":
+			hasUVs = true
+		case "red":
+			hasColors = true
+		}
+	}
+
+	for i := 0; i < element.count; i++ {
+		var position geometry.Point
+		var normal geometry.Vector
+		var uv [2]float64
+		var color shading.Color
+		for _, p := range element.properties {
+			if p.countType != "" {
+				err := skipPLYList(reader, p)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			value, err := reader.read(p.valueType)
+			if err != nil {
+				return err
+			}
+			switch p.name {
+			case "x":
+				position.X = value
+			case "y":
+				position.Y = value
+			case "z":
+				position.Z = value
+			case "nx":
+				normal.X = value
+			case "ny":
+				normal.Y = value
+			case "nz":
+				normal.Z = value
+			case "u", "s", "texture_u", "texture_s":
+				uv[0] = value
+			case "v", "t", "texture_v", "texture_t":
+				uv[1] = value
+			case "red":
+				color.Red = plyColorChannel(value, p.valueType)
+			case "green":
+				color.Green = plyColorChannel(value, p.valueType)
+			case "blue":
+				color.Blue = plyColorChannel(value, p.valueType)
+			}
+		}
+		tm.Vertices = append(tm.Vertices, position)
+		if hasNormals {
+			if normal.Magnitude() > 0.0 {
+				normal = normal.Unit()
+			}
+			tm.Normals = append(tm.Normals, normal)
+		}
+		if hasUVs {
+			tm.UVs = append(tm.UVs, uv)
+		}
+		if hasColors {
+			tm.Colors = append(tm.Colors, color.Pow(colorGamma))
+		}
+	}
+	return nil
+}
+
+// readPLYFaces reads the vertex index lists of faces, skipping degenerate triangles
+func readPLYFaces(reader plyReader, element *plyElement, tm *trianglemesh.TriangleMesh) error {
+	for i := 0; i < element.count; i++ {
+		for _, p := range element.properties {
+			if p.countType == "" {
+				_, err := reader.read(p.valueType)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if p.name != "vertex_indices" && p.name != "vertex_index" {
+				err := skipPLYList(reader, p)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			count, err := reader.read(p.countType)
+			if err != nil {
+				return err
+			}
+			if count < 0 {
+				return fmt.Errorf("ply face %d has a negative vertex count", i)
+			}
+			indices := make([]int, int(count))
+			for j := range indices {
+				index, err := reader.read(p.valueType)
+				if err != nil {
+					return err
+				}
+				indices[j] = int(index)
+				if indices[j] < 0 || indices[j] >= len(tm.Vertices) {
+					return fmt.Errorf("ply face %d index (%d) out of range", i, indices[j])
+				}
+			}
+			for j := 1; j < len(indices)-1; j++ {
+				a := tm.Vertices[indices[0]]
+				b := tm.Vertices[indices[j]]
+				c := tm.Vertices[indices[j+1]]
+				if a.To(b).Cross(a.To(c)).Magnitude() == 0.0 {
+					continue
+				}
+				tm.Indices = append(tm.Indices, indices[0], indices[j], indices[j+1])
+			}
+		}
+	}
+	return nil
+}
+
+// skipPLYElement reads and discards every instance of an element
+func skipPLYElement(reader plyReader, element *plyElement) error {
+	for i := 0; i < element.count; i++ {
+		for _, p := range element.properties {
+			var err error
+			if p.countType != "" {
+				err = skipPLYList(reader, p)
+			} else {
+				_, err = reader.read(p.valueType)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// skipPLYList reads and discards a list property
+func skipPLYList(reader plyReader, p plyProperty) error {
+	count, err := reader.read(p.countType)
+	if err != nil {
+		return err
+	}
+	for j := 0; j < int(count); j++ {
+		_, err = reader.read(p.valueType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plyColorChannel normalizes a color channel to [0, 1] based on its type
+func plyColorChannel(value float64, valueType string) float64 {
+	switch valueType {
+	case "uchar", "uint8", "char", "int8":
+		return value / 255.0
+	case "ushort", "uint16", "short", "int16":
+		return value / 65535.0
+	default:
+		return value
+	}
+}
+
+// read parses the next whitespace-separated value
+func (r *plyASCIIReader) read(valueType string) (float64, error) {
+	if !r.scanner.Scan() {
+		err := r.scanner.Err()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0.0, err
+	}
+	return strconv.ParseFloat(r.scanner.Text(), 64)
+}
+
+// read decodes the next value of the given type
+func (r *plyBinaryReader) read(valueType string) (float64, error) {
+	size := 0
+	switch valueType {
+	case "char", "int8", "uchar", "uint8":
+		size = 1
+	case "short", "int16", "ushort", "uint16":
+		size = 2
+	case "int", "int32", "uint", "uint32", "float", "float32":
+		size = 4
+	case "double", "float64":
+		size = 8
+	default:
+		return 0.0, fmt.Errorf("ply type (%s) not supported", valueType)
+	}
+	_, err := io.ReadFull(r.r, r.buffer[:size])
+	if err != nil {
+		return 0.0, err
+	}
+	b := r.buffer[:size]
+	switch valueType {
+	case "char", "int8":
+		return float64(int8(b[0])), nil
+	case "uchar", "uint8":
+		return float64(b[0]), nil
+	case "short", "int16":
+		return float64(int16(r.order.Uint16(b))), nil
+	case "ushort", "uint16":
+		return float64(r.order.Uint16(b)), nil
+	case "int", "int32":
+		return float64(int32(r.order.Uint32(b))), nil
+	case "uint", "uint32":
+		return float64(r.order.Uint32(b)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(r.order.Uint32(b))), nil
+	default:
+		return math.Float64frombits(r.order.Uint64(b)), nil
+	}
+}
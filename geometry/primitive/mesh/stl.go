@@ -0,0 +1,139 @@
+package mesh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/trianglemesh"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+// stlBinaryHeaderSize is the size of the header preceding the triangle count of a binary STL
+const stlBinaryHeaderSize = 80
+
+// stlBinaryTriangleSize is the size of one binary STL triangle record:
+// a normal and three vertices of three float32s each, and a two byte attribute count
+const stlBinaryTriangleSize = 50
+
+// parseSTL reads an ASCII or binary STL file into TriangleMesh buffers
+// STL stores each triangle's vertices separately, so identical positions are merged to share vertices
+func parseSTL(r io.Reader) (*trianglemesh.TriangleMesh, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// binary files may also begin with "solid", so the size implied by the triangle count decides
+	if len(data) >= stlBinaryHeaderSize+4 {
+		count := int(binary.LittleEndian.Uint32(data[stlBinaryHeaderSize:]))
+		if len(data) == stlBinaryHeaderSize+4+count*stlBinaryTriangleSize {
+			return parseBinarySTL(data[stlBinaryHeaderSize+4:], count)
+		}
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		return nil, fmt.Errorf("not an stl file")
+	}
+	return parseASCIISTL(data)
+}
+
+// parseBinarySTL reads count packed triangle records
+func parseBinarySTL(data []byte, count int) (*trianglemesh.TriangleMesh, error) {
+	builder := newSTLBuilder()
+	for i := 0; i < count; i++ {
+		record := data[i*stlBinaryTriangleSize:]
+		var triangle [3]geometry.Point
+		for j := range triangle {
+			// skip the facet normal
+			offset := 12 + 12*j
+			triangle[j] = geometry.Point{
+				X: float64(math.Float32frombits(binary.LittleEndian.Uint32(record[offset:]))),
+				Y: float64(math.Float32frombits(binary.LittleEndian.Uint32(record[offset+4:]))),
+				Z: float64(math.Float32frombits(binary.LittleEndian.Uint32(record[offset+8:]))),
+			}
+		}
+		builder.addTriangle(triangle)
+	}
+	return builder.triangleMesh()
+}
+
+// parseASCIISTL reads the vertex statements of each facet
+func parseASCIISTL(data []byte) (*trianglemesh.TriangleMesh, error) {
+	builder := newSTLBuilder()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var triangle [3]geometry.Point
+	vertexCount := 0
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "facet":
+			vertexCount = 0
+		case "vertex":
+			values, err := parseFloats(fields[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("stl line %d: %s", lineNumber, err.Error())
+			}
+			if vertexCount >= 3 {
+				return nil, fmt.Errorf("stl line %d: facet has more than 3 vertices", lineNumber)
+			}
+			triangle[vertexCount] = geometry.Point{X: values[0], Y: values[1], Z: values[2]}
+			vertexCount++
+		case "endfacet":
+			if vertexCount != 3 {
+				return nil, fmt.Errorf("stl line %d: facet has %d vertices", lineNumber, vertexCount)
+			}
+			builder.addTriangle(triangle)
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return builder.triangleMesh()
+}
+
+// stlBuilder collects STL triangles, merging identical vertices
+type stlBuilder struct {
+	tm       *trianglemesh.TriangleMesh
+	vertices map[geometry.Point]int
+}
+
+// newSTLBuilder returns an empty stlBuilder
+func newSTLBuilder() *stlBuilder {
+	return &stlBuilder{
+		tm:       &trianglemesh.TriangleMesh{},
+		vertices: map[geometry.Point]int{},
+	}
+}
+
+// addTriangle adds a triangle, skipping it if it is degenerate
+func (b *stlBuilder) addTriangle(triangle [3]geometry.Point) {
+	if triangle[0].To(triangle[1]).Cross(triangle[0].To(triangle[2])).Magnitude() == 0.0 {
+		return
+	}
+	for _, p := range triangle {
+		index, ok := b.vertices[p]
+		if !ok {
+			index = len(b.tm.Vertices)
+			b.vertices[p] = index
+			b.tm.Vertices = append(b.tm.Vertices, p)
+		}
+		b.tm.Indices = append(b.tm.Indices, index)
+	}
+}
+
+// triangleMesh returns the collected buffers
+func (b *stlBuilder) triangleMesh() (*trianglemesh.TriangleMesh, error) {
+	if len(b.tm.Indices) == 0 {
+		return nil, fmt.Errorf("stl has no faces")
+	}
+	return b.tm, nil
+}
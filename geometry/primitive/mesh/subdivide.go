@@ -0,0 +1,575 @@
+package mesh
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/trianglemesh"
+	"fluorescence/shading"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+)
+
+// maxSubdivisions keeps subdivision from running out of memory, as each level has about four times the faces
+const maxSubdivisions = 6
+
+// polygonMesh is a mesh of polygons sharing positions, used while subdividing
+// texture coordinates are indexed separately from positions so that seams stay where they are
+type polygonMesh struct {
+	positions []geometry.Point
+	colors    []shading.Color // one per position, or empty
+	uvs       [][2]float64    // empty if the mesh has no texture coordinates
+	faces     []polygon
+	sharp     map[meshEdge]bool // crease edges, kept sharp as they are subdivided
+}
+
+// polygon is a face of a polygonMesh
+type polygon struct {
+	positions []int
+	uvs       []int // nil if the mesh has no texture coordinates
+	material  int   // index into the mesh's materials, or -1
+}
+
+// meshEdge is an edge between two positions, with the lower index first
+type meshEdge [2]int
+
+// newMeshEdge returns the edge between positions a and b
+func newMeshEdge(a, b int) meshEdge {
+	if a > b {
+		return meshEdge{b, a}
+	}
+	return meshEdge{a, b}
+}
+
+// adjacency holds the connectivity of a polygonMesh
+type adjacency struct {
+	edges      []meshEdge
+	edgeIndex  map[meshEdge]int
+	edgeFaces  [][]int // faces on each edge
+	neighbors  [][]int // positions sharing an edge with each position
+	facesAtPos [][]int // faces around each position
+}
+
+// subdivide applies the Mesh's subdivision scheme to a polygon mesh and converts the result to a TriangleMesh
+func (m *Mesh) subdivide(pm *polygonMesh, materials []material.Material) (*trianglemesh.TriangleMesh, error) {
+	pm.markCreases(m.CreaseAngle)
+	for i := 0; i < m.Subdivisions; i++ {
+		if m.SubdivisionScheme == "loop" {
+			pm = pm.loop()
+		} else {
+			pm = pm.catmullClark()
+		}
+	}
+	return pm.toTriangleMesh(materials, m.CreaseAngle)
+}
+
+// checkSubdivision validates the subdivision options of a Mesh
+func (m *Mesh) checkSubdivision() error {
+	if m.Subdivisions < 0 || m.Subdivisions > maxSubdivisions {
+		return fmt.Errorf("mesh subdivisions (%d) not between 0 and %d", m.Subdivisions, maxSubdivisions)
+	}
+	switch m.SubdivisionScheme {
+	case "", "catmull_clark", "loop":
+	default:
+		return fmt.Errorf("unknown mesh subdivision scheme (%s)", m.SubdivisionScheme)
+	}
+	if m.CreaseAngle < 0.0 || m.CreaseAngle > 180.0 {
+		return fmt.Errorf("mesh crease angle (%f) not between 0 and 180 degrees", m.CreaseAngle)
+	}
+	return nil
+}
+
+// newPolygonMesh converts TriangleMesh buffers, before Setup, into a polygon mesh
+func newPolygonMesh(tm *trianglemesh.TriangleMesh) *polygonMesh {
+	pm := &polygonMesh{
+		positions: tm.Vertices,
+		colors:    tm.Colors,
+		uvs:       tm.UVs,
+	}
+	uvIndices := tm.UVIndices
+	if len(uvIndices) == 0 {
+		uvIndices = tm.Indices
+	}
+	for i := 0; i < len(tm.Indices); i += 3 {
+		face := polygon{
+			positions: []int{tm.Indices[i], tm.Indices[i+1], tm.Indices[i+2]},
+			material:  -1,
+		}
+		if len(pm.uvs) > 0 {
+			face.uvs = []int{uvIndices[i], uvIndices[i+1], uvIndices[i+2]}
+		}
+		if len(tm.FaceMaterials) > 0 {
+			face.material = tm.FaceMaterials[i/3]
+		}
+		pm.faces = append(pm.faces, face)
+	}
+	return pm
+}
+
+// toPolygonMesh converts OBJ data into a polygon mesh, keeping its polygons whole
+// it returns the materials the polygons refer to
+func (data *objData) toPolygonMesh(materials map[string]material.Material) (*polygonMesh, []material.Material) {
+	pm := &polygonMesh{
+		positions: data.positions,
+	}
+	hasUVs := false
+	for _, p := range data.polygons {
+		for _, v := range p.vertices {
+			hasUVs = hasUVs || v.uv >= 0
+		}
+	}
+	if hasUVs {
+		pm.uvs = data.uvs
+	}
+	var faceMaterials []material.Material
+	materialSlots := map[string]int{}
+	for _, p := range data.polygons {
+		face := polygon{
+			positions: make([]int, len(p.vertices)),
+			material:  -1,
+		}
+		for i, v := range p.vertices {
+			face.positions[i] = v.position
+		}
+		if hasUVs {
+			face.uvs = make([]int, len(p.vertices))
+			for i, v := range p.vertices {
+				if v.uv < 0 {
+					pm.uvs = append(pm.uvs, [2]float64{0.0, 0.0})
+					face.uvs[i] = len(pm.uvs) - 1
+				} else {
+					face.uvs[i] = v.uv
+				}
+			}
+		}
+		if mat, ok := materials[p.materialName]; ok {
+			slot, ok := materialSlots[p.materialName]
+			if !ok {
+				slot = len(faceMaterials)
+				materialSlots[p.materialName] = slot
+				faceMaterials = append(faceMaterials, mat)
+			}
+			face.material = slot
+		}
+		pm.faces = append(pm.faces, face)
+	}
+	return pm, faceMaterials
+}
+
+// adjacency returns the connectivity of the mesh
+func (pm *polygonMesh) adjacency() *adjacency {
+	a := &adjacency{
+		edgeIndex:  map[meshEdge]int{},
+		neighbors:  make([][]int, len(pm.positions)),
+		facesAtPos: make([][]int, len(pm.positions)),
+	}
+	for f, face := range pm.faces {
+		n := len(face.positions)
+		for i, p := range face.positions {
+			a.facesAtPos[p] = append(a.facesAtPos[p], f)
+			q := face.positions[(i+1)%n]
+			e := newMeshEdge(p, q)
+			index, ok := a.edgeIndex[e]
+			if !ok {
+				index = len(a.edges)
+				a.edgeIndex[e] = index
+				a.edges = append(a.edges, e)
+				a.edgeFaces = append(a.edgeFaces, nil)
+				a.neighbors[p] = append(a.neighbors[p], q)
+				a.neighbors[q] = append(a.neighbors[q], p)
+			}
+			a.edgeFaces[index] = append(a.edgeFaces[index], f)
+		}
+	}
+	return a
+}
+
+// isSharp returns whether an edge is subdivided as a crease, which boundary and non-manifold edges always are
+func (pm *polygonMesh) isSharp(a *adjacency, index int) bool {
+	return len(a.edgeFaces[index]) != 2 || pm.sharp[a.edges[index]]
+}
+
+// sharpNeighbors returns the positions joined to a position by sharp edges
+func (pm *polygonMesh) sharpNeighbors(a *adjacency, p int) []int {
+	var sharp []int
+	for _, q := range a.neighbors[p] {
+		if pm.isSharp(a, a.edgeIndex[newMeshEdge(p, q)]) {
+			sharp = append(sharp, q)
+		}
+	}
+	return sharp
+}
+
+// markCreases marks the edges between faces meeting at more than creaseAngle degrees as sharp
+// a crease angle of 0 leaves only boundaries sharp
+func (pm *polygonMesh) markCreases(creaseAngle float64) {
+	pm.sharp = map[meshEdge]bool{}
+	if creaseAngle <= 0.0 {
+		return
+	}
+	cosCrease := math.Cos(creaseAngle * math.Pi / 180.0)
+	normals := pm.faceNormals()
+	a := pm.adjacency()
+	for i, faces := range a.edgeFaces {
+		if len(faces) != 2 {
+			continue
+		}
+		n0, n1 := normals[faces[0]], normals[faces[1]]
+		if n0.Magnitude() == 0.0 || n1.Magnitude() == 0.0 {
+			continue
+		}
+		if n0.Unit().Dot(n1.Unit()) < cosCrease {
+			pm.sharp[a.edges[i]] = true
+		}
+	}
+}
+
+// faceNormals returns the Newell normal of every face, whose length is twice the face's area
+func (pm *polygonMesh) faceNormals() []geometry.Vector {
+	normals := make([]geometry.Vector, len(pm.faces))
+	for f, face := range pm.faces {
+		var n geometry.Vector
+		for i, p := range face.positions {
+			a := pm.positions[p]
+			b := pm.positions[face.positions[(i+1)%len(face.positions)]]
+			n.X += (a.Y - b.Y) * (a.Z + b.Z)
+			n.Y += (a.Z - b.Z) * (a.X + b.X)
+			n.Z += (a.X - b.X) * (a.Y + b.Y)
+		}
+		normals[f] = n
+	}
+	return normals
+}
+
+// average returns the mean of a set of positions
+func (pm *polygonMesh) average(positions []int) geometry.Point {
+	var sum geometry.Vector
+	for _, p := range positions {
+		sum = sum.Add(geometry.Vector(pm.positions[p]))
+	}
+	return geometry.Point(sum.DivScalar(float64(len(positions))))
+}
+
+// averageColor returns the mean of the colors of a set of positions
+func (pm *polygonMesh) averageColor(positions []int) shading.Color {
+	var sum shading.Color
+	for _, p := range positions {
+		sum = sum.Add(pm.colors[p])
+	}
+	return sum.MultScalar(1.0 / float64(len(positions)))
+}
+
+// averageUV returns the mean of a set of texture coordinates
+func (pm *polygonMesh) averageUV(uvs []int) [2]float64 {
+	var sum [2]float64
+	for _, uv := range uvs {
+		sum[0] += pm.uvs[uv][0]
+		sum[1] += pm.uvs[uv][1]
+	}
+	return [2]float64{sum[0] / float64(len(uvs)), sum[1] / float64(len(uvs))}
+}
+
+// weighted returns the sum of positions scaled by weights
+func (pm *polygonMesh) weighted(positions []int, weights []float64) geometry.Point {
+	var sum geometry.Vector
+	for i, p := range positions {
+		sum = sum.Add(geometry.Vector(pm.positions[p]).MultScalar(weights[i]))
+	}
+	return geometry.Point(sum)
+}
+
+// subdivided starts the next level of a mesh, keeping its original positions and texture coordinates in place
+// to be moved by the scheme, and returns a function giving the shared midpoint of a pair of texture coordinates
+func (pm *polygonMesh) subdivided() (*polygonMesh, func(a, b int) int) {
+	next := &polygonMesh{
+		positions: append([]geometry.Point(nil), pm.positions...),
+		colors:    append([]shading.Color(nil), pm.colors...),
+		uvs:       append([][2]float64(nil), pm.uvs...),
+		sharp:     map[meshEdge]bool{},
+	}
+	// texture coordinates are interpolated linearly so they do not shrink away from seams and borders
+	uvMidpoints := map[meshEdge]int{}
+	uvMidpoint := func(a, b int) int {
+		e := newMeshEdge(a, b)
+		index, ok := uvMidpoints[e]
+		if !ok {
+			index = len(next.uvs)
+			next.uvs = append(next.uvs, pm.averageUV([]int{a, b}))
+			uvMidpoints[e] = index
+		}
+		return index
+	}
+	return next, uvMidpoint
+}
+
+// addEdgePoints appends a point for every edge of the mesh to the next level, returning their indices
+// edges that are sharp are split at their midpoints and their halves stay sharp
+func (pm *polygonMesh) addEdgePoints(a *adjacency, next *polygonMesh, smooth func(edge int) geometry.Point) []int {
+	edgePoints := make([]int, len(a.edges))
+	for i, e := range a.edges {
+		edgePoints[i] = len(next.positions)
+		if pm.isSharp(a, i) {
+			next.positions = append(next.positions, pm.average(e[:]))
+			if pm.sharp[e] {
+				next.sharp[newMeshEdge(e[0], edgePoints[i])] = true
+				next.sharp[newMeshEdge(edgePoints[i], e[1])] = true
+			}
+		} else {
+			next.positions = append(next.positions, smooth(i))
+		}
+		if len(pm.colors) > 0 {
+			next.colors = append(next.colors, pm.averageColor(e[:]))
+		}
+	}
+	return edgePoints
+}
+
+// moveVertex applies the crease rules to an original position, returning false if the smooth rule should be used
+// positions on two sharp edges slide along them, while positions on more, or on the border of only one face,
+// are corners that stay fixed
+func (pm *polygonMesh) moveVertex(a *adjacency, next *polygonMesh, p int) bool {
+	sharp := pm.sharpNeighbors(a, p)
+	switch {
+	case len(sharp) > 2 || (len(sharp) == 2 && len(a.facesAtPos[p]) == 1):
+		next.positions[p] = pm.positions[p]
+	case len(sharp) == 2:
+		next.positions[p] = pm.weighted([]int{p, sharp[0], sharp[1]}, []float64{0.75, 0.125, 0.125})
+	default:
+		return false
+	}
+	return true
+}
+
+// catmullClark applies one level of Catmull-Clark subdivision, splitting every face into quads
+func (pm *polygonMesh) catmullClark() *polygonMesh {
+	a := pm.adjacency()
+	next, uvMidpoint := pm.subdivided()
+
+	facePoints := make([]int, len(pm.faces))
+	faceUVs := make([]int, len(pm.faces))
+	for f, face := range pm.faces {
+		facePoints[f] = len(next.positions)
+		next.positions = append(next.positions, pm.average(face.positions))
+		if len(pm.colors) > 0 {
+			next.colors = append(next.colors, pm.averageColor(face.positions))
+		}
+		if face.uvs != nil {
+			faceUVs[f] = len(next.uvs)
+			next.uvs = append(next.uvs, pm.averageUV(face.uvs))
+		}
+	}
+
+	edgePoints := pm.addEdgePoints(a, next, func(i int) geometry.Point {
+		e := a.edges[i]
+		faces := a.edgeFaces[i]
+		var sum geometry.Vector
+		for _, p := range []int{e[0], e[1], facePoints[faces[0]], facePoints[faces[1]]} {
+			sum = sum.Add(geometry.Vector(next.positions[p]))
+		}
+		return geometry.Point(sum.DivScalar(4.0))
+	})
+
+	for p := range pm.positions {
+		if len(a.neighbors[p]) == 0 || pm.moveVertex(a, next, p) {
+			continue
+		}
+		// (F + 2R + (n - 3)P) / n, with F the average face point and R the average edge midpoint
+		n := float64(len(a.neighbors[p]))
+		var f, r geometry.Vector
+		for _, face := range a.facesAtPos[p] {
+			f = f.Add(geometry.Vector(next.positions[facePoints[face]]))
+		}
+		f = f.DivScalar(float64(len(a.facesAtPos[p])))
+		for _, q := range a.neighbors[p] {
+			r = r.Add(geometry.Vector(pm.average([]int{p, q})))
+		}
+		r = r.DivScalar(n)
+		position := f.Add(r.MultScalar(2.0)).Add(geometry.Vector(pm.positions[p]).MultScalar(n - 3.0)).DivScalar(n)
+		next.positions[p] = geometry.Point(position)
+	}
+
+	next.faces = make([]polygon, 0, 4*len(pm.faces))
+	for f, face := range pm.faces {
+		n := len(face.positions)
+		for i, p := range face.positions {
+			following := face.positions[(i+1)%n]
+			previous := face.positions[(i+n-1)%n]
+			child := polygon{
+				positions: []int{
+					p,
+					edgePoints[a.edgeIndex[newMeshEdge(p, following)]],
+					facePoints[f],
+					edgePoints[a.edgeIndex[newMeshEdge(previous, p)]],
+				},
+				material: face.material,
+			}
+			if face.uvs != nil {
+				child.uvs = []int{
+					face.uvs[i],
+					uvMidpoint(face.uvs[i], face.uvs[(i+1)%n]),
+					faceUVs[f],
+					uvMidpoint(face.uvs[(i+n-1)%n], face.uvs[i]),
+				}
+			}
+			next.faces = append(next.faces, child)
+		}
+	}
+	return next
+}
+
+// triangulate splits every polygon with more than three sides into a fan of triangles
+func (pm *polygonMesh) triangulate() {
+	triangles := make([]polygon, 0, len(pm.faces))
+	for _, face := range pm.faces {
+		for i := 1; i < len(face.positions)-1; i++ {
+			triangle := polygon{
+				positions: []int{face.positions[0], face.positions[i], face.positions[i+1]},
+				material:  face.material,
+			}
+			if face.uvs != nil {
+				triangle.uvs = []int{face.uvs[0], face.uvs[i], face.uvs[i+1]}
+			}
+			triangles = append(triangles, triangle)
+		}
+	}
+	pm.faces = triangles
+}
+
+// loop applies one level of Loop subdivision, splitting every triangle into four
+// polygons with more sides are triangulated first
+func (pm *polygonMesh) loop() *polygonMesh {
+	pm.triangulate()
+	a := pm.adjacency()
+	next, uvMidpoint := pm.subdivided()
+
+	// opposite returns the corner of a triangle that is not on an edge
+	opposite := func(face int, e meshEdge) int {
+		for _, p := range pm.faces[face].positions {
+			if p != e[0] && p != e[1] {
+				return p
+			}
+		}
+		return e[0]
+	}
+	edgePoints := pm.addEdgePoints(a, next, func(i int) geometry.Point {
+		e := a.edges[i]
+		faces := a.edgeFaces[i]
+		return pm.weighted(
+			[]int{e[0], e[1], opposite(faces[0], e), opposite(faces[1], e)},
+			[]float64{0.375, 0.375, 0.125, 0.125},
+		)
+	})
+
+	for p := range pm.positions {
+		if len(a.neighbors[p]) == 0 || pm.moveVertex(a, next, p) {
+			continue
+		}
+		// Warren's weights for the neighbors of a vertex of valence n
+		n := len(a.neighbors[p])
+		beta := 3.0 / (8.0 * float64(n))
+		if n == 3 {
+			beta = 3.0 / 16.0
+		}
+		positions := append([]int{p}, a.neighbors[p]...)
+		weights := make([]float64, len(positions))
+		weights[0] = 1.0 - float64(n)*beta
+		for i := 1; i < len(weights); i++ {
+			weights[i] = beta
+		}
+		next.positions[p] = pm.weighted(positions, weights)
+	}
+
+	next.faces = make([]polygon, 0, 4*len(pm.faces))
+	for _, face := range pm.faces {
+		v := face.positions
+		e01 := edgePoints[a.edgeIndex[newMeshEdge(v[0], v[1])]]
+		e12 := edgePoints[a.edgeIndex[newMeshEdge(v[1], v[2])]]
+		e20 := edgePoints[a.edgeIndex[newMeshEdge(v[2], v[0])]]
+		children := [4]polygon{
+			{positions: []int{v[0], e01, e20}},
+			{positions: []int{e01, v[1], e12}},
+			{positions: []int{e20, e12, v[2]}},
+			{positions: []int{e01, e12, e20}},
+		}
+		if face.uvs != nil {
+			t := face.uvs
+			t01, t12, t20 := uvMidpoint(t[0], t[1]), uvMidpoint(t[1], t[2]), uvMidpoint(t[2], t[0])
+			children[0].uvs = []int{t[0], t01, t20}
+			children[1].uvs = []int{t01, t[1], t12}
+			children[2].uvs = []int{t20, t12, t[2]}
+			children[3].uvs = []int{t01, t12, t20}
+		}
+		for _, child := range children {
+			child.material = face.material
+			next.faces = append(next.faces, child)
+		}
+	}
+	return next
+}
+
+// toTriangleMesh converts the polygon mesh into TriangleMesh buffers with normals
+// the normal at each corner averages the faces around its position, leaving out those meeting its own face
+// at more than the crease angle so creases stay sharp
+func (pm *polygonMesh) toTriangleMesh(materials []material.Material, creaseAngle float64) (*trianglemesh.TriangleMesh, error) {
+	tm := &trianglemesh.TriangleMesh{
+		Vertices:  pm.positions,
+		Colors:    pm.colors,
+		UVs:       pm.uvs,
+		Materials: materials,
+	}
+	faceNormals := pm.faceNormals()
+	facesAtPos := make([][]int, len(pm.positions))
+	for f, face := range pm.faces {
+		for _, p := range face.positions {
+			facesAtPos[p] = append(facesAtPos[p], f)
+		}
+	}
+	cosCrease := -1.0
+	if creaseAngle > 0.0 {
+		cosCrease = math.Cos(creaseAngle * math.Pi / 180.0)
+	}
+	hasMaterials := false
+	for _, face := range pm.faces {
+		hasMaterials = hasMaterials || face.material >= 0
+	}
+
+	for f, face := range pm.faces {
+		own := faceNormals[f]
+		if own.Magnitude() == 0.0 {
+			// skip degenerate faces
+			continue
+		}
+		own = own.Unit()
+		cornerNormals := make([]int, len(face.positions))
+		for i, p := range face.positions {
+			var n geometry.Vector
+			for _, g := range facesAtPos[p] {
+				other := faceNormals[g]
+				if other.Magnitude() > 0.0 && other.Unit().Dot(own) >= cosCrease {
+					n = n.Add(other)
+				}
+			}
+			tm.Normals = append(tm.Normals, n.Unit())
+			cornerNormals[i] = len(tm.Normals) - 1
+		}
+		for i := 1; i < len(face.positions)-1; i++ {
+			a := pm.positions[face.positions[0]]
+			b := pm.positions[face.positions[i]]
+			c := pm.positions[face.positions[i+1]]
+			if a.To(b).Cross(a.To(c)).Magnitude() == 0.0 {
+				continue
+			}
+			tm.Indices = append(tm.Indices, face.positions[0], face.positions[i], face.positions[i+1])
+			tm.NormalIndices = append(tm.NormalIndices, cornerNormals[0], cornerNormals[i], cornerNormals[i+1])
+			if face.uvs != nil {
+				tm.UVIndices = append(tm.UVIndices, face.uvs[0], face.uvs[i], face.uvs[i+1])
+			}
+			if hasMaterials {
+				tm.FaceMaterials = append(tm.FaceMaterials, face.material)
+			}
+		}
+	}
+	if len(tm.Indices) == 0 {
+		return nil, fmt.Errorf("mesh has no non-degenerate faces")
+	}
+	return tm, nil
+}
@@ -0,0 +1,303 @@
+package metaball
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Ball is a single metaball, adding its weight times a falloff (1 - r²/R²)³ to the field within its radius
+// a negative weight carves into the balls around it
+type Ball struct {
+	Center geometry.Point `json:"center"`
+	Radius float64        `json:"radius"`
+	Weight float64        `json:"weight"` // defaults to 1
+}
+
+// Metaballs represents the blobby surface where the summed field of a set of balls reaches a threshold
+// the field is continuous and smooth, so nearby balls melt into each other
+type Metaballs struct {
+	Balls     []Ball  `json:"balls"`
+	Threshold float64 `json:"threshold"` // field value at the surface, defaults to 0.5
+	MaxSteps  int     `json:"max_steps"` // defaults to 512
+	Epsilon   float64 `json:"epsilon"`   // smallest step taken, defaults to 1e-4
+	box       *aabb.AABB
+	mat       material.Material
+}
+
+// span is a stretch of a ray passing through the same set of balls
+type span struct {
+	t0, t1    float64
+	balls     []int
+	lipschitz float64 // the most the field can change per unit of distance within the span
+}
+
+// kernelSlope is the steepest slope of the falloff times the ball's radius, 96 / (25√5) rounded up
+const kernelSlope = 1.7174
+
+// Setup sets up a Metaballs' internal fields
+func (m *Metaballs) Setup() (*Metaballs, error) {
+	if len(m.Balls) == 0 {
+		return nil, fmt.Errorf("metaballs has no balls")
+	}
+	if m.Threshold == 0.0 {
+		m.Threshold = 0.5
+	}
+	if m.Threshold < 0.0 {
+		return nil, fmt.Errorf("metaballs threshold is negative")
+	}
+	if m.MaxSteps == 0 {
+		m.MaxSteps = 512
+	}
+	if m.MaxSteps < 0 {
+		return nil, fmt.Errorf("metaballs max steps is negative")
+	}
+	if m.Epsilon == 0.0 {
+		m.Epsilon = 1e-4
+	}
+	if m.Epsilon < 0.0 {
+		return nil, fmt.Errorf("metaballs epsilon is negative")
+	}
+	// the surface can only be where balls with positive weights are, so only they are bounded
+	for i := range m.Balls {
+		if m.Balls[i].Radius <= 0.0 {
+			return nil, fmt.Errorf("metaball %d radius is 0 or negative", i)
+		}
+		if m.Balls[i].Weight == 0.0 {
+			m.Balls[i].Weight = 1.0
+		}
+		if m.Balls[i].Weight < 0.0 {
+			continue
+		}
+		radius := geometry.Vector{X: m.Balls[i].Radius, Y: m.Balls[i].Radius, Z: m.Balls[i].Radius}
+		box := &aabb.AABB{
+			A: m.Balls[i].Center.SubVector(radius),
+			B: m.Balls[i].Center.AddVector(radius),
+		}
+		if m.box == nil {
+			m.box = box
+		} else {
+			m.box = aabb.SurroundingBox(m.box, box)
+		}
+	}
+	if m.box == nil {
+		return nil, fmt.Errorf("metaballs has no balls with positive weight")
+	}
+	return m, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (m *Metaballs) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !m.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+// within each span of the ray the field can change no faster than the sum of its balls' slopes, so stepping by how far
+// the field is from the threshold over that bound can never cross the surface; once a step of at least epsilon does
+// cross it, the crossing is found by bisection
+func (m *Metaballs) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	if !m.box.Intersection(ray, tMin, tMax) {
+		return false
+	}
+	spans := m.spans(ray, tMin, tMax)
+	if len(spans) == 0 {
+		return false
+	}
+	length := ray.Direction.Magnitude()
+	minStep := m.Epsilon / length
+
+	// a ray scattered from the surface starts on it, and is inside if it heads up the field
+	t := spans[0].t0
+	g := m.field(ray.PointAt(t), spans[0].balls) - m.Threshold
+	inside := g > 0.0
+	if math.Abs(g) < spans[0].lipschitz*m.Epsilon {
+		inside = ray.Direction.Dot(m.gradient(ray.PointAt(t))) > 0.0
+		t += minStep
+	}
+
+	steps := 0
+	for _, s := range spans {
+		// the field cannot reach the threshold from the balls of this span
+		total := 0.0
+		for _, i := range s.balls {
+			total += math.Max(0.0, m.Balls[i].Weight)
+		}
+		if total < m.Threshold {
+			inside = false
+			continue
+		}
+		previous := math.Max(t, s.t0)
+		t = previous
+		slope := s.lipschitz * length
+		for ; steps < m.MaxSteps; steps++ {
+			g := m.field(ray.PointAt(t), s.balls) - m.Threshold
+			if (g > 0.0) != inside {
+				m.fillRayHit(ray, m.bisect(ray, s.balls, previous, t, inside), rayHit)
+				return true
+			}
+			if t >= s.t1 {
+				break
+			}
+			previous = t
+			t = math.Min(s.t1, t+math.Max(math.Abs(g)/slope, minStep))
+		}
+		if steps == m.MaxSteps {
+			return false
+		}
+	}
+	return false
+}
+
+// spans splits the part of the ray from tMin to tMax into the stretches passing through each set of balls
+func (m *Metaballs) spans(ray geometry.Ray, tMin, tMax float64) []span {
+	type event struct {
+		t     float64
+		ball  int
+		enter bool
+	}
+	var events []event
+	a := ray.Direction.Dot(ray.Direction)
+	for i, ball := range m.Balls {
+		centerToRayOrigin := ball.Center.To(ray.Origin)
+		b := ray.Direction.Dot(centerToRayOrigin)
+		c := centerToRayOrigin.Dot(centerToRayOrigin) - ball.Radius*ball.Radius
+		discriminant := b*b - a*c
+		if discriminant <= 0.0 {
+			continue
+		}
+		root := math.Sqrt(discriminant)
+		enter := math.Max(tMin, (-b-root)/a)
+		exit := math.Min(tMax, (-b+root)/a)
+		if enter >= exit {
+			continue
+		}
+		events = append(events, event{enter, i, true}, event{exit, i, false})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].t < events[j].t
+	})
+
+	var spans []span
+	var active []int
+	for i, e := range events {
+		if e.enter {
+			active = append(active, e.ball)
+		} else {
+			for j, ball := range active {
+				if ball == e.ball {
+					active = append(active[:j], active[j+1:]...)
+					break
+				}
+			}
+		}
+		if len(active) == 0 || i == len(events)-1 || events[i+1].t == e.t {
+			continue
+		}
+		s := span{
+			t0:    e.t,
+			t1:    events[i+1].t,
+			balls: append([]int(nil), active...),
+		}
+		for _, ball := range active {
+			s.lipschitz += math.Abs(m.Balls[ball].Weight) * kernelSlope / m.Balls[ball].Radius
+		}
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+// field returns the summed field of the given balls at p
+func (m *Metaballs) field(p geometry.Point, balls []int) float64 {
+	f := 0.0
+	for _, i := range balls {
+		d := m.Balls[i].Center.To(p)
+		s := 1.0 - d.Dot(d)/(m.Balls[i].Radius*m.Balls[i].Radius)
+		if s > 0.0 {
+			f += m.Balls[i].Weight * s * s * s
+		}
+	}
+	return f
+}
+
+// gradient returns the gradient of the field of every ball at p
+func (m *Metaballs) gradient(p geometry.Point) geometry.Vector {
+	var g geometry.Vector
+	for _, ball := range m.Balls {
+		d := ball.Center.To(p)
+		r2 := ball.Radius * ball.Radius
+		s := 1.0 - d.Dot(d)/r2
+		if s > 0.0 {
+			g = g.Add(d.MultScalar(-6.0 * ball.Weight * s * s / r2))
+		}
+	}
+	return g
+}
+
+// bisect narrows the crossing of the surface between times a and b, where the ray went from inside to outside
+// or the other way, until it is well within epsilon
+func (m *Metaballs) bisect(ray geometry.Ray, balls []int, a, b float64, inside bool) float64 {
+	length := ray.Direction.Magnitude()
+	for i := 0; i < 64 && (b-a)*length > m.Epsilon*1e-3; i++ {
+		middle := (a + b) / 2.0
+		if (m.field(ray.PointAt(middle), balls) > m.Threshold) == inside {
+			a = middle
+		} else {
+			b = middle
+		}
+	}
+	return (a + b) / 2.0
+}
+
+// fillRayHit writes the hit at time t into rayHit
+// the normal points down the field's gradient, out of the surface
+func (m *Metaballs) fillRayHit(ray geometry.Ray, t float64, rayHit *material.RayHit) {
+	p := ray.PointAt(t)
+	normal := m.gradient(p).Negate()
+	if normal.Magnitude() == 0.0 {
+		normal = m.box.Centroid().To(p)
+	}
+	direction := m.box.Centroid().To(p).Unit()
+	*rayHit = material.RayHit{
+		Ray:         ray,
+		NormalAtHit: normal.Unit(),
+		Time:        t,
+		U:           (math.Atan2(direction.Z, direction.X) + math.Pi) / (2 * math.Pi),
+		V:           (math.Asin(math.Max(-1.0, math.Min(1.0, direction.Y))) + math.Pi/2) / math.Pi,
+		Material:    m.mat,
+	}
+}
+
+// BoundingBox returns an AABB of this object
+func (m *Metaballs) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return m.box, true
+}
+
+// SetMaterial sets this object's material
+func (m *Metaballs) SetMaterial(mat material.Material) {
+	m.mat = mat
+}
+
+// IsInfinite returns whether this object is infinite
+func (m *Metaballs) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (m *Metaballs) IsClosed() bool {
+	return true
+}
+
+// Copy returns a shallow copy of this object, sharing its balls
+func (m *Metaballs) Copy() primitive.Primitive {
+	newM := *m
+	return &newM
+}
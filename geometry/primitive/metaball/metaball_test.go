@@ -0,0 +1,204 @@
+package metaball
+
+import (
+	"fluorescence/geometry"
+	"math"
+	"testing"
+)
+
+var metaballsHit bool
+
+// singleRadius is where the field of a lone ball of radius 1 and weight 1 falls to 0.5, sqrt(1 - 0.5^(1/3))
+var singleRadius = math.Sqrt(1.0 - math.Cbrt(0.5))
+
+func TestMetaballsIntersectionHit(t *testing.T) {
+	m, err := (&Metaballs{
+		Balls: []Ball{{Radius: 1.0}},
+	}).Setup()
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-(5.0-singleRadius)) > 1e-4 {
+		t.Errorf("Expected time %f but got %f\n", 5.0-singleRadius, rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Z: 1.0}).Magnitude() > 1e-6 {
+		t.Errorf("Expected normal (0, 0, 1) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func BenchmarkMetaballsIntersectionHit(b *testing.B) {
+	m, _ := (&Metaballs{
+		Balls: []Ball{
+			{Center: geometry.Point{X: -0.6}, Radius: 1.0},
+			{Center: geometry.Point{X: 0.6}, Radius: 1.0},
+		},
+	}).Setup()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.3,
+			Y: 0.1,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	for n := 0; n < b.N; n++ {
+		_, h = m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	metaballsHit = h
+}
+
+func TestMetaballsIntersectionBlend(t *testing.T) {
+	// alone, neither ball reaches the midpoint between them, but together their fields do
+	m, _ := (&Metaballs{
+		Balls: []Ball{
+			{Center: geometry.Point{X: -0.6}, Radius: 1.0},
+			{Center: geometry.Point{X: 0.6}, Radius: 1.0},
+		},
+	}).Setup()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	p := r.PointAt(rh.Time)
+	if f := m.field(p, []int{0, 1}); math.Abs(f-0.5) > 1e-4 {
+		t.Errorf("Expected field 0.5 at the hit but got %f\n", f)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Z: 1.0}).Magnitude() > 1e-6 {
+		t.Errorf("Expected normal (0, 0, 1) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func TestMetaballsIntersectionNegativeWeight(t *testing.T) {
+	// a negative ball in the middle carves a tunnel through the positive one
+	m, _ := (&Metaballs{
+		Balls: []Ball{
+			{Radius: 1.0},
+			{Radius: 0.3, Weight: -2.0},
+		},
+	}).Setup()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	// the ray enters the positive ball as usual, and leaves it again at the tunnel
+	rh, h = m.Intersection(r, rh.Time+1e-3, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if rh.Time > 5.0-0.1 || rh.NormalAtHit.Z > 0.0 {
+		t.Errorf("Expected to leave into the tunnel facing it but got time %f and normal %v\n", rh.Time, rh.NormalAtHit)
+	}
+}
+
+func TestMetaballsIntersectionInside(t *testing.T) {
+	m, _ := (&Metaballs{
+		Balls: []Ball{{Radius: 1.0}},
+	}).Setup()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-singleRadius) > 1e-4 {
+		t.Errorf("Expected time %f but got %f\n", singleRadius, rh.Time)
+	}
+	// a ray leaving from that hit continues out without hitting again
+	r.Origin = r.PointAt(rh.Time)
+	_, h = m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) leaving the surface but got %t\n", h)
+	}
+}
+
+func TestMetaballsIntersectionMiss(t *testing.T) {
+	m, _ := (&Metaballs{
+		Balls: []Ball{{Radius: 1.0}},
+	}).Setup()
+	// within the ball's radius, but outside the surface
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.6,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	_, h := m.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func TestMetaballsSetupErrors(t *testing.T) {
+	for _, m := range []*Metaballs{
+		{},
+		{Balls: []Ball{{Radius: 0.0}}},
+		{Balls: []Ball{{Radius: 1.0, Weight: -1.0}}},
+		{Balls: []Ball{{Radius: 1.0}}, Threshold: -1.0},
+	} {
+		_, err := m.Setup()
+		if err == nil {
+			t.Errorf("Expected an error setting up %v but got none\n", m.Balls)
+		}
+	}
+}
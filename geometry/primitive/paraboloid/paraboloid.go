@@ -0,0 +1,174 @@
+package paraboloid
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+)
+
+// Paraboloid represents an open bowl shaped paraboloid of revolution
+// from its vertex at A to a rim circle of the radius around B
+type Paraboloid struct {
+	A                  geometry.Point  `json:"a"`
+	B                  geometry.Point  `json:"b"`
+	Radius             float64         `json:"radius"`
+	HasInvertedNormals bool            `json:"has_inverted_normals"`
+	axis, u, w         geometry.Vector // orthonormal basis with the axis from A to B
+	height             float64
+	curvature          float64 // the paraboloid is x^2 + z^2 = curvature * y in its frame
+	mat                material.Material
+}
+
+// Setup sets up a paraboloid's internal fields
+func (p *Paraboloid) Setup() (*Paraboloid, error) {
+	if p.A.To(p.B).Magnitude() == 0.0 {
+		return nil, fmt.Errorf("paraboloid length is zero vector")
+	}
+	if p.Radius <= 0.0 {
+		return nil, fmt.Errorf("paraboloid radius is 0 or negative")
+	}
+	p.height = p.A.To(p.B).Magnitude()
+	p.axis = p.A.To(p.B).Unit()
+	p.u, p.w = p.axis.Basis()
+	p.curvature = p.Radius * p.Radius / p.height
+	return p, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (p *Paraboloid) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !p.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (p *Paraboloid) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	o := p.local(p.A.To(ray.Origin))
+	d := p.local(ray.Direction)
+
+	// terms of the quadratic equation we are solving, with b halved
+	a := d.X*d.X + d.Z*d.Z
+	b := o.X*d.X + o.Z*d.Z - p.curvature*d.Y/2.0
+	c := o.X*o.X + o.Z*o.Z - p.curvature*o.Y
+
+	var times [2]float64
+	if a < 1e-12 {
+		// the ray is parallel to the axis, and crosses the paraboloid once
+		if b == 0.0 {
+			return false
+		}
+		times[0] = -c / (2.0 * b)
+		times[1] = times[0]
+	} else {
+		preDiscriminant := b*b - a*c
+		if preDiscriminant <= 0.0 {
+			return false
+		}
+		root := math.Sqrt(preDiscriminant)
+		times[0] = (-b - root) / a
+		times[1] = (-b + root) / a
+	}
+	for _, t := range times {
+		if t < tMin || t > tMax {
+			continue
+		}
+		// only up to the rim
+		if y := o.Y + t*d.Y; y > p.height {
+			continue
+		}
+		p.fillRayHit(ray, t, rayHit)
+		return true
+	}
+	return false
+}
+
+// fillRayHit writes the hit at time t into rayHit
+func (p *Paraboloid) fillRayHit(ray geometry.Ray, t float64, rayHit *material.RayHit) {
+	h := p.local(p.A.To(ray.PointAt(t)))
+	// the gradient of the implicit surface, pointing out of the bowl
+	n := geometry.Vector{
+		X: 2.0 * h.X,
+		Y: -p.curvature,
+		Z: 2.0 * h.Z,
+	}
+	normal := p.u.MultScalar(n.X).Add(p.axis.MultScalar(n.Y)).Add(p.w.MultScalar(n.Z)).Unit()
+	if p.HasInvertedNormals {
+		normal = normal.Negate()
+	}
+	*rayHit = material.RayHit{
+		Ray:         ray,
+		NormalAtHit: normal,
+		Time:        t,
+		U:           (math.Atan2(h.Z, h.X) + math.Pi) / (2 * math.Pi),
+		V:           h.Y / p.height,
+		Material:    p.mat,
+	}
+}
+
+// local returns a world space vector in the paraboloid's frame, with the axis as Y
+func (p *Paraboloid) local(v geometry.Vector) geometry.Vector {
+	return geometry.Vector{
+		X: v.Dot(p.u),
+		Y: v.Dot(p.axis),
+		Z: v.Dot(p.w),
+	}
+}
+
+// BoundingBox returns an AABB of this object
+func (p *Paraboloid) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	// the bowl bulges out past the cone from the vertex to the rim, so bound the cylinder around the rim instead
+	extent := geometry.Vector{
+		X: p.Radius*math.Sqrt(1.0-p.axis.X*p.axis.X) + 1e-7,
+		Y: p.Radius*math.Sqrt(1.0-p.axis.Y*p.axis.Y) + 1e-7,
+		Z: p.Radius*math.Sqrt(1.0-p.axis.Z*p.axis.Z) + 1e-7,
+	}
+	return &aabb.AABB{
+		A: geometry.MinComponents(p.A, p.B).SubVector(extent),
+		B: geometry.MaxComponents(p.A, p.B).AddVector(extent),
+	}, true
+}
+
+// SetMaterial sets this object's material
+func (p *Paraboloid) SetMaterial(m material.Material) {
+	p.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (p *Paraboloid) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (p *Paraboloid) IsClosed() bool {
+	return false
+}
+
+// Copy returns a shallow copy of this object
+func (p *Paraboloid) Copy() primitive.Primitive {
+	newP := *p
+	return &newP
+}
+
+// Unit returns a paraboloid with its vertex at the origin and a rim of radius 1 around (0, 1, 0)
+func Unit(xOffset, yOffset, zOffset float64) *Paraboloid {
+	p, _ := (&Paraboloid{
+		A: geometry.Point{
+			X: 0.0 + xOffset,
+			Y: 0.0 + yOffset,
+			Z: 0.0 + zOffset,
+		},
+		B: geometry.Point{
+			X: 0.0 + xOffset,
+			Y: 1.0 + yOffset,
+			Z: 0.0 + zOffset,
+		},
+		Radius: 1.0,
+	}).Setup()
+	return p
+}
@@ -0,0 +1,176 @@
+package paraboloid
+
+import (
+	"fluorescence/geometry"
+	"math"
+	"testing"
+)
+
+var pHit bool
+
+func TestParaboloidIntersectionVertexHit(t *testing.T) {
+	p := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 5.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := p.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-5.0) > 1e-9 {
+		t.Errorf("Expected time 5.0 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Y: -1.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal (0, -1, 0) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func BenchmarkParaboloidIntersectionVertexHit(b *testing.B) {
+	p := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 5.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = p.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	pHit = h
+}
+
+func TestParaboloidIntersectionSideHit(t *testing.T) {
+	p := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.25,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := p.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.5) > 1e-9 {
+		t.Errorf("Expected time 4.5 but got %f\n", rh.Time)
+	}
+}
+
+func BenchmarkParaboloidIntersectionSideHit(b *testing.B) {
+	p := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.25,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = p.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	pHit = h
+}
+
+func TestParaboloidIntersectionInsideHit(t *testing.T) {
+	p := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.25,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := p.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-0.5) > 1e-9 {
+		t.Errorf("Expected time 0.5 but got %f\n", rh.Time)
+	}
+}
+
+func TestParaboloidIntersectionAboveRimMiss(t *testing.T) {
+	p := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 1.5,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	_, h := p.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func BenchmarkParaboloidIntersectionAboveRimMiss(b *testing.B) {
+	p := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 1.5,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = p.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	pHit = h
+}
+
+func TestParaboloidBoundingBox(t *testing.T) {
+	p := Unit(0.0, 0.0, 0.0)
+	box, _ := p.BoundingBox(0, 0)
+	// the bowl is already 0.5 wide halfway up
+	if box.A.X > -1.0 || box.B.X < 1.0 || box.A.Y > 0.0 || box.B.Y < 1.0 {
+		t.Errorf("Expected box from (-1, 0, -1) to (1, 1, 1) but got %v\n", box)
+	}
+}
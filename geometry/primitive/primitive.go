@@ -4,6 +4,8 @@ import (
 	"fluorescence/geometry"
 	"fluorescence/geometry/primitive/aabb"
 	"fluorescence/shading/material"
+
+	"github.com/go-gl/mathgl/mgl64"
 )
 
 // Primitive represents a geometry object with a material in 3D space in the scene
@@ -15,3 +17,21 @@ type Primitive interface {
 	IsClosed() bool
 	Copy() Primitive
 }
+
+// HitRecorder is implemented by primitives that can write an intersection into a caller-owned RayHit
+// acceleration structures use it to avoid allocating a RayHit for every candidate hit
+type HitRecorder interface {
+	IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool
+}
+
+// TransformBounder is implemented by primitives that can bound themselves under an affine transform
+// more tightly than the transformed corners of their own box
+type TransformBounder interface {
+	TransformedBoundingBox(m mgl64.Mat4, t0, t1 float64) (*aabb.AABB, bool)
+}
+
+// AllIntersecter is implemented by closed primitives that can report every intersection with a ray, not just the nearest
+// hits are returned sorted by time, and constructive solid geometry uses them to find where a ray is inside the primitive
+type AllIntersecter interface {
+	AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit
+}
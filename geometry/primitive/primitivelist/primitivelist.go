@@ -6,6 +6,7 @@ import (
 	"fluorescence/geometry/primitive/aabb"
 	"fluorescence/shading/material"
 	"math"
+	"sort"
 )
 
 // PrimitiveList holds a list of Primitives to process
@@ -92,6 +93,35 @@ func (pl *PrimitiveList) Intersection(ray geometry.Ray, tMin, tMax float64) (*ma
 	return nil, false
 }
 
+// AllIntersections returns every intersection of the primitives in this list and a given ray, sorted by time
+// each primitive is intersected again past its last hit, so curved surfaces report both of their hits
+// the step past a hit is at least one float, so that it still moves the time on far away where floats are spaced widely
+// hits at the same time on neighbouring primitives, as on the edge of a box, are only reported once
+func (pl *PrimitiveList) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	var hits []material.RayHit
+	for _, p := range pl.List {
+		for t := tMin; ; {
+			rh, wasHit := p.Intersection(ray, t, tMax)
+			if !wasHit {
+				break
+			}
+			hits = append(hits, *rh)
+			t = math.Max(rh.Time+1e-7, math.Nextafter(rh.Time, math.Inf(1)))
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Time < hits[j].Time
+	})
+	unique := hits[:0]
+	for _, h := range hits {
+		if len(unique) > 0 && h.Time-unique[len(unique)-1].Time < math.Max(1e-9, 1e-12*math.Abs(h.Time)) {
+			continue
+		}
+		unique = append(unique, h)
+	}
+	return unique
+}
+
 // BoundingBox returns an AABB of this object
 func (pl *PrimitiveList) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	box, ok := pl.List[0].BoundingBox(t0, t1)
@@ -116,6 +116,14 @@ func (p *Pyramid) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.
 	return nil, false
 }
 
+// AllIntersections returns every intersection of this object and a given ray, sorted by time
+func (p *Pyramid) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	if p.box.Intersection(ray, tMin, tMax) {
+		return p.list.AllIntersections(ray, tMin, tMax)
+	}
+	return nil
+}
+
 // BoundingBox returns an AABB of this object
 func (p *Pyramid) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	return p.box, true
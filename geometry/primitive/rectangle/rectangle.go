@@ -4,6 +4,7 @@ import (
 	"fluorescence/geometry"
 	"fluorescence/geometry/primitive"
 	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/trianglemesh"
 	"fluorescence/shading/material"
 	"fmt"
 )
@@ -75,6 +76,59 @@ func (r *Rectangle) Copy() primitive.Primitive {
 	return &newR
 }
 
+// TriangleMesh returns this rectangle as two triangles, with the same normal and texture coordinates
+func (r *Rectangle) TriangleMesh() *trianglemesh.TriangleMesh {
+	c1 := geometry.MinComponents(r.A, r.B)
+	c8 := geometry.MaxComponents(r.A, r.B)
+	// corner returns the point at texture coordinates u and v, which run along the same axes as the rectangle's hits
+	var corner func(u, v float64) geometry.Point
+	var normal geometry.Vector
+	switch {
+	case r.A.X == r.B.X:
+		corner = func(u, v float64) geometry.Point {
+			return geometry.Point{X: c1.X, Y: lerp(c1.Y, c8.Y, v), Z: lerp(c1.Z, c8.Z, u)}
+		}
+		normal = geometry.Vector{X: 1.0}
+	case r.A.Y == r.B.Y:
+		corner = func(u, v float64) geometry.Point {
+			return geometry.Point{X: lerp(c1.X, c8.X, u), Y: c1.Y, Z: lerp(c1.Z, c8.Z, v)}
+		}
+		normal = geometry.Vector{Y: 1.0}
+	default:
+		corner = func(u, v float64) geometry.Point {
+			return geometry.Point{X: lerp(c1.X, c8.X, u), Y: lerp(c1.Y, c8.Y, v), Z: c1.Z}
+		}
+		normal = geometry.Vector{Z: 1.0}
+	}
+	if r.HasNegativeNormal {
+		normal = normal.Negate()
+	}
+	uvs := [][2]float64{{0.0, 0.0}, {1.0, 0.0}, {1.0, 1.0}, {0.0, 1.0}}
+	vertices := make([]geometry.Point, len(uvs))
+	for i, uv := range uvs {
+		vertices[i] = corner(uv[0], uv[1])
+	}
+	indices := []int{0, 1, 2, 0, 2, 3}
+	// wind the triangles so that their faces point along the normal
+	if vertices[0].To(vertices[1]).Cross(vertices[0].To(vertices[2])).Dot(normal) < 0.0 {
+		indices = []int{0, 2, 1, 0, 3, 2}
+	}
+	tm, _ := (&trianglemesh.TriangleMesh{
+		Vertices:      vertices,
+		Normals:       []geometry.Vector{normal},
+		NormalIndices: []int{0, 0, 0, 0, 0, 0},
+		UVs:           uvs,
+		Indices:       indices,
+		IsCulled:      r.IsCulled,
+	}).Setup()
+	return tm
+}
+
+// lerp returns the value a fraction s of the way from a to b
+func lerp(a, b, s float64) float64 {
+	return a + s*(b-a)
+}
+
 // Unit return a unit rectangle
 func Unit(xOffset, yOffset, zOffset float64) *Rectangle {
 	r, _ := (&Rectangle{
@@ -90,3 +90,35 @@ func BenchmarkRectangleIntersectionMiss(b *testing.B) {
 	}
 	rectHit = h
 }
+
+func TestRectangleTriangleMesh(t *testing.T) {
+	rect, _ := (&Rectangle{
+		A:                 geometry.Point{X: 0.0, Y: 0.0, Z: 0.0},
+		B:                 geometry.Point{X: 1.0, Y: 2.0, Z: 0.0},
+		HasNegativeNormal: true,
+	}).Setup()
+	tm := rect.TriangleMesh()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.25,
+			Y: 0.75,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	expected, _ := rect.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	rh, h := tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if rh.NormalAtHit != expected.NormalAtHit {
+		t.Errorf("Expected normal %v but got %v\n", expected.NormalAtHit, rh.NormalAtHit)
+	}
+	if rh.U != expected.U || rh.V != expected.V {
+		t.Errorf("Expected uv (%f, %f) but got (%f, %f)\n", expected.U, expected.V, rh.U, rh.V)
+	}
+}
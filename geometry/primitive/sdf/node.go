@@ -0,0 +1,124 @@
+package sdf
+
+import (
+	"fluorescence/geometry"
+	"fmt"
+	"math"
+)
+
+// Node is a shape or an operation combining shapes in a tree of distance functions
+// shapes are sphere, box, rounded_box and torus, and operations are smooth_union,
+// smooth_subtraction, which cuts every other child out of the first, and smooth_intersection
+type Node struct {
+	TypeName    string          `json:"type"`
+	Center      geometry.Point  `json:"center"`       // all shapes
+	Radius      float64         `json:"radius"`       // sphere
+	Size        geometry.Vector `json:"size"`         // box and rounded_box, as half of each side
+	Rounding    float64         `json:"rounding"`     // rounded_box
+	MajorRadius float64         `json:"major_radius"` // torus, lying flat in the XZ plane
+	MinorRadius float64         `json:"minor_radius"` // torus
+	Smoothness  float64         `json:"smoothness"`   // operations, blending sharp joins over this distance
+	Children    []*Node         `json:"children"`     // operations
+}
+
+// setup checks a tree of distance functions for invalid nodes
+func (n *Node) setup() error {
+	switch n.TypeName {
+	case "sphere":
+		if n.Radius <= 0.0 {
+			return fmt.Errorf("sdf sphere radius is 0 or negative")
+		}
+	case "box", "rounded_box":
+		if n.Size.X <= 0.0 || n.Size.Y <= 0.0 || n.Size.Z <= 0.0 {
+			return fmt.Errorf("sdf %s size (%v) has a 0 or negative component", n.TypeName, n.Size)
+		}
+		if n.TypeName == "rounded_box" &&
+			(n.Rounding <= 0.0 || n.Rounding > math.Min(n.Size.X, math.Min(n.Size.Y, n.Size.Z))) {
+			return fmt.Errorf("sdf rounded_box rounding (%f) is 0 or negative, or larger than the box", n.Rounding)
+		}
+	case "torus":
+		if n.MinorRadius <= 0.0 || n.MajorRadius <= 0.0 {
+			return fmt.Errorf("sdf torus radius is 0 or negative")
+		}
+	case "smooth_union", "smooth_subtraction", "smooth_intersection":
+		if len(n.Children) < 2 {
+			return fmt.Errorf("sdf %s has fewer than 2 children", n.TypeName)
+		}
+		if n.Smoothness < 0.0 {
+			return fmt.Errorf("sdf %s smoothness is negative", n.TypeName)
+		}
+		for _, c := range n.Children {
+			if c == nil {
+				return fmt.Errorf("sdf %s has an empty child", n.TypeName)
+			}
+			if err := c.setup(); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid sdf node type (%s)", n.TypeName)
+	}
+	return nil
+}
+
+// Distance returns the signed distance from a point to the surface of this node, negative inside of it
+// distances from smooth operations are bounds rather than exact, which is all sphere tracing needs
+func (n *Node) Distance(p geometry.Point) float64 {
+	switch n.TypeName {
+	case "sphere":
+		return n.Center.To(p).Magnitude() - n.Radius
+	case "box":
+		return boxDistance(n.Center.To(p), n.Size)
+	case "rounded_box":
+		rounding := geometry.Vector{X: n.Rounding, Y: n.Rounding, Z: n.Rounding}
+		return boxDistance(n.Center.To(p), n.Size.Sub(rounding)) - n.Rounding
+	case "torus":
+		q := n.Center.To(p)
+		ring := math.Sqrt(q.X*q.X+q.Z*q.Z) - n.MajorRadius
+		return math.Sqrt(ring*ring+q.Y*q.Y) - n.MinorRadius
+	case "smooth_union":
+		d := n.Children[0].Distance(p)
+		for _, c := range n.Children[1:] {
+			d = smoothMin(d, c.Distance(p), n.Smoothness)
+		}
+		return d
+	case "smooth_subtraction":
+		d := n.Children[0].Distance(p)
+		for _, c := range n.Children[1:] {
+			d = -smoothMin(-d, c.Distance(p), n.Smoothness)
+		}
+		return d
+	case "smooth_intersection":
+		d := n.Children[0].Distance(p)
+		for _, c := range n.Children[1:] {
+			d = -smoothMin(-d, -c.Distance(p), n.Smoothness)
+		}
+		return d
+	}
+	return math.MaxFloat64
+}
+
+// boxDistance returns the signed distance from a point, relative to the center of a box, to the box's surface
+func boxDistance(v, size geometry.Vector) float64 {
+	q := geometry.Vector{
+		X: math.Abs(v.X) - size.X,
+		Y: math.Abs(v.Y) - size.Y,
+		Z: math.Abs(v.Z) - size.Z,
+	}
+	outside := geometry.Vector{
+		X: math.Max(q.X, 0.0),
+		Y: math.Max(q.Y, 0.0),
+		Z: math.Max(q.Z, 0.0),
+	}
+	inside := math.Min(math.Max(q.X, math.Max(q.Y, q.Z)), 0.0)
+	return outside.Magnitude() + inside
+}
+
+// smoothMin returns the minimum of two distances, blended by a polynomial where they are within k of each other
+func smoothMin(a, b, k float64) float64 {
+	if k == 0.0 {
+		return math.Min(a, b)
+	}
+	h := math.Max(0.0, math.Min(1.0, 0.5+0.5*(b-a)/k))
+	return b + (a-b)*h - k*h*(1.0-h)
+}
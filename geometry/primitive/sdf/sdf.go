@@ -0,0 +1,180 @@
+package sdf
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+)
+
+// SDF represents a surface described by a tree of signed distance functions, found by sphere tracing
+// the distance functions are only evaluated within the user supplied bounds from A to B,
+// which must contain the whole surface
+type SDF struct {
+	A        geometry.Point `json:"a"`
+	B        geometry.Point `json:"b"`
+	Root     *Node          `json:"root"`
+	MaxSteps int            `json:"max_steps"` // defaults to 256
+	Epsilon  float64        `json:"epsilon"`   // distance counted as a hit, defaults to 1e-4
+	box      *aabb.AABB
+	mat      material.Material
+}
+
+// Setup sets up an SDF's internal fields
+func (s *SDF) Setup() (*SDF, error) {
+	if s.Root == nil {
+		return nil, fmt.Errorf("sdf has no root node")
+	}
+	if err := s.Root.setup(); err != nil {
+		return nil, err
+	}
+	c1 := geometry.MinComponents(s.A, s.B)
+	c8 := geometry.MaxComponents(s.A, s.B)
+	if c1.X == c8.X || c1.Y == c8.Y || c1.Z == c8.Z {
+		return nil, fmt.Errorf("sdf bounds resolve to point, line, or plane")
+	}
+	if s.MaxSteps == 0 {
+		s.MaxSteps = 256
+	}
+	if s.MaxSteps < 0 {
+		return nil, fmt.Errorf("sdf max steps is negative")
+	}
+	if s.Epsilon == 0.0 {
+		s.Epsilon = 1e-4
+	}
+	if s.Epsilon < 0.0 {
+		return nil, fmt.Errorf("sdf epsilon is negative")
+	}
+	s.box = &aabb.AABB{
+		A: c1,
+		B: c8,
+	}
+	return s, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (s *SDF) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !s.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+// the ray steps forward by the distance to the surface, which can never overshoot it,
+// until it is within epsilon of the surface or leaves the bounds
+func (s *SDF) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	t0, t1, ok := s.clip(ray, tMin, tMax)
+	if !ok {
+		return false
+	}
+	length := ray.Direction.Magnitude()
+	// a ray starting inside the surface marches out of it instead
+	start := s.Root.Distance(ray.PointAt(t0))
+	sign := 1.0
+	if start < 0.0 {
+		sign = -1.0
+	}
+	// a ray scattered from the surface starts on it, and must leave it before a hit counts,
+	// heading inside if it was refracted into the surface
+	leaving := math.Abs(start) < s.Epsilon
+	if leaving && ray.Direction.Dot(s.normalAt(ray.PointAt(t0))) < 0.0 {
+		sign = -1.0
+	}
+	t := t0
+	for step := 0; step < s.MaxSteps && t <= t1; step++ {
+		d := sign * s.Root.Distance(ray.PointAt(t))
+		if leaving {
+			if d < s.Epsilon {
+				t += s.Epsilon / length
+				continue
+			}
+			leaving = false
+		}
+		if d < s.Epsilon {
+			s.fillRayHit(ray, t, rayHit)
+			return true
+		}
+		t += d / length
+	}
+	return false
+}
+
+// clip returns the part of the ray's time range within the bounds
+func (s *SDF) clip(ray geometry.Ray, tMin, tMax float64) (float64, float64, bool) {
+	origin := [3]float64{ray.Origin.X, ray.Origin.Y, ray.Origin.Z}
+	direction := [3]float64{ray.Direction.X, ray.Direction.Y, ray.Direction.Z}
+	a := [3]float64{s.box.A.X, s.box.A.Y, s.box.A.Z}
+	b := [3]float64{s.box.B.X, s.box.B.Y, s.box.B.Z}
+	for i := 0; i < 3; i++ {
+		inverse := 1.0 / direction[i]
+		near := (a[i] - origin[i]) * inverse
+		far := (b[i] - origin[i]) * inverse
+		if inverse < 0.0 {
+			near, far = far, near
+		}
+		tMin = math.Max(tMin, near)
+		tMax = math.Min(tMax, far)
+		if tMax < tMin {
+			return 0.0, 0.0, false
+		}
+	}
+	return tMin, tMax, true
+}
+
+// fillRayHit writes the hit at time t into rayHit
+func (s *SDF) fillRayHit(ray geometry.Ray, t float64, rayHit *material.RayHit) {
+	p := ray.PointAt(t)
+	direction := s.box.Centroid().To(p).Unit()
+	*rayHit = material.RayHit{
+		Ray:         ray,
+		NormalAtHit: s.normalAt(p),
+		Time:        t,
+		U:           (math.Atan2(direction.Z, direction.X) + math.Pi) / (2 * math.Pi),
+		V:           (math.Asin(math.Max(-1.0, math.Min(1.0, direction.Y))) + math.Pi/2) / math.Pi,
+		Material:    s.mat,
+	}
+}
+
+// normalAt estimates the normal at a point on the surface from the gradient of the distance, by central differences
+func (s *SDF) normalAt(p geometry.Point) geometry.Vector {
+	h := s.Epsilon
+	dx := geometry.Vector{X: h}
+	dy := geometry.Vector{Y: h}
+	dz := geometry.Vector{Z: h}
+	return geometry.Vector{
+		X: s.Root.Distance(p.AddVector(dx)) - s.Root.Distance(p.SubVector(dx)),
+		Y: s.Root.Distance(p.AddVector(dy)) - s.Root.Distance(p.SubVector(dy)),
+		Z: s.Root.Distance(p.AddVector(dz)) - s.Root.Distance(p.SubVector(dz)),
+	}.Unit()
+}
+
+// BoundingBox returns an AABB of this object
+func (s *SDF) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return s.box, true
+}
+
+// SetMaterial sets this object's material
+func (s *SDF) SetMaterial(m material.Material) {
+	s.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (s *SDF) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (s *SDF) IsClosed() bool {
+	return true
+}
+
+// Copy returns a shallow copy of this object, sharing its tree of distance functions
+func (s *SDF) Copy() primitive.Primitive {
+	newS := *s
+	return &newS
+}
@@ -0,0 +1,295 @@
+package sdf
+
+import (
+	"fluorescence/geometry"
+	"math"
+	"testing"
+)
+
+var sdfHit bool
+
+// newSDF returns an SDF of a tree of distance functions within bounds from (-2, -2, -2) to (2, 2, 2)
+func newSDF(root *Node) *SDF {
+	s, _ := (&SDF{
+		A:    geometry.Point{X: -2.0, Y: -2.0, Z: -2.0},
+		B:    geometry.Point{X: 2.0, Y: 2.0, Z: 2.0},
+		Root: root,
+	}).Setup()
+	return s
+}
+
+// twoSpheres returns an operation on spheres of radius 0.5 at (-0.6, 0, 0) and (0.6, 0, 0)
+func twoSpheres(typeName string, smoothness float64) *Node {
+	return &Node{
+		TypeName:   typeName,
+		Smoothness: smoothness,
+		Children: []*Node{
+			{TypeName: "sphere", Center: geometry.Point{X: -0.6}, Radius: 0.5},
+			{TypeName: "sphere", Center: geometry.Point{X: 0.6}, Radius: 0.5},
+		},
+	}
+}
+
+func TestSDFIntersectionSphereHit(t *testing.T) {
+	s := newSDF(&Node{TypeName: "sphere", Radius: 0.5})
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := s.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.5) > 1e-3 {
+		t.Errorf("Expected time 4.5 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Z: 1.0}).Magnitude() > 1e-3 {
+		t.Errorf("Expected normal (0, 0, 1) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func BenchmarkSDFIntersectionSphereHit(b *testing.B) {
+	s := newSDF(&Node{TypeName: "sphere", Radius: 0.5})
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = s.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	sdfHit = h
+}
+
+func TestSDFIntersectionBoundsMiss(t *testing.T) {
+	s := newSDF(&Node{TypeName: "sphere", Radius: 0.5})
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 3.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	_, h := s.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func TestSDFIntersectionRoundedBoxCorner(t *testing.T) {
+	size := geometry.Vector{X: 0.5, Y: 0.5, Z: 0.5}
+	// a ray just inside the corner of a box, along the Z axis
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.45,
+			Y: 0.45,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	_, h := newSDF(&Node{TypeName: "box", Size: size}).Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Errorf("Expected true (hit) on the box but got %t\n", h)
+	}
+	_, h = newSDF(&Node{TypeName: "rounded_box", Size: size, Rounding: 0.2}).Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) on the rounded box but got %t\n", h)
+	}
+}
+
+func TestSDFIntersectionTorusHole(t *testing.T) {
+	s := newSDF(&Node{TypeName: "torus", MajorRadius: 1.0, MinorRadius: 0.25})
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 5.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	_, h := s.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) through the hole but got %t\n", h)
+	}
+	r.Origin.X = 1.0
+	rh, h := s.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) on the ring but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.75) > 1e-3 {
+		t.Errorf("Expected time 4.75 but got %f\n", rh.Time)
+	}
+}
+
+func TestSDFIntersectionSmoothUnion(t *testing.T) {
+	// a ray passing through the gap between the spheres
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	_, h := newSDF(twoSpheres("smooth_union", 0.0)).Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) through the gap but got %t\n", h)
+	}
+	_, h = newSDF(twoSpheres("smooth_union", 0.5)).Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Errorf("Expected true (hit) on the blended bridge but got %t\n", h)
+	}
+}
+
+func TestSDFIntersectionSmoothIntersection(t *testing.T) {
+	s := newSDF(&Node{
+		TypeName: "smooth_intersection",
+		Children: []*Node{
+			{TypeName: "sphere", Center: geometry.Point{X: -0.3}, Radius: 0.5},
+			{TypeName: "sphere", Center: geometry.Point{X: 0.3}, Radius: 0.5},
+		},
+	})
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := s.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.6) > 1e-3 {
+		t.Errorf("Expected time 4.6 but got %f\n", rh.Time)
+	}
+}
+
+func TestSDFIntersectionSmoothSubtraction(t *testing.T) {
+	s := newSDF(&Node{
+		TypeName: "smooth_subtraction",
+		Children: []*Node{
+			{TypeName: "sphere", Radius: 0.5},
+			{TypeName: "sphere", Center: geometry.Point{Z: 0.5}, Radius: 0.3},
+		},
+	})
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := s.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.8) > 1e-3 {
+		t.Errorf("Expected time 4.8 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Z: 1.0}).Magnitude() > 1e-3 {
+		t.Errorf("Expected normal (0, 0, 1) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func TestSDFIntersectionScatteredRay(t *testing.T) {
+	s := newSDF(&Node{TypeName: "sphere", Radius: 0.5})
+	// a ray reflected away from the surface does not hit it again
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 0.50005,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.6,
+			Z: 0.8,
+		},
+	}
+	_, h := s.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) for the reflected ray but got %t\n", h)
+	}
+	// a ray refracted into the surface leaves through the far side
+	r.Direction = geometry.Vector{Z: -1.0}
+	rh, h := s.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) for the refracted ray but got %t\n", h)
+	}
+	if math.Abs(rh.Time-1.0) > 1e-3 {
+		t.Errorf("Expected time 1 but got %f\n", rh.Time)
+	}
+}
+
+func TestSDFInvalidNode(t *testing.T) {
+	_, err := (&SDF{
+		A: geometry.Point{X: -1.0, Y: -1.0, Z: -1.0},
+		B: geometry.Point{X: 1.0, Y: 1.0, Z: 1.0},
+		Root: &Node{
+			TypeName: "smooth_union",
+			Children: []*Node{
+				{TypeName: "sphere", Radius: 0.5},
+				{TypeName: "cone"},
+			},
+		},
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
+
+func TestSDFFlatBounds(t *testing.T) {
+	_, err := (&SDF{
+		A:    geometry.Point{X: -1.0, Y: 0.0, Z: -1.0},
+		B:    geometry.Point{X: 1.0, Y: 0.0, Z: 1.0},
+		Root: &Node{TypeName: "sphere", Radius: 0.5},
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
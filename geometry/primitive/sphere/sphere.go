@@ -7,6 +7,8 @@ import (
 	"fluorescence/shading/material"
 	"fmt"
 	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
 )
 
 // Sphere represents a sphere geometry object
@@ -39,10 +41,16 @@ func (s *Sphere) Setup() (*Sphere, error) {
 
 // Intersection computer the intersection of this object and a given ray if it exists
 func (s *Sphere) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
-	// if !s.box.Intersection(ray, tMin, tMax) {
-	// 	return nil, false
-	// }
+	var rayHit material.RayHit
+	if !s.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
 
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (s *Sphere) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
 	centerToRayOrigin := s.Center.To(ray.Origin)
 
 	// terms of the quadratic equation we are solving
@@ -58,48 +66,60 @@ func (s *Sphere) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.R
 		t1 := (-b - root) / a
 		// return if within range
 		if t1 >= tMin && t1 <= tMax {
-			hitPoint := ray.PointAt(t1)
-			unitHitPoint := s.Center.To(hitPoint).DivScalar(s.Radius)
-
-			phi := math.Atan2(unitHitPoint.Z, unitHitPoint.X)
-			theta := math.Asin(unitHitPoint.Y)
-
-			u := 1 - (phi+math.Pi)/(2*math.Pi)
-			v := (theta + math.Pi/2) / math.Pi
-
-			return &material.RayHit{
-				Ray:         ray,
-				NormalAtHit: s.normalAt(hitPoint),
-				Time:        t1,
-				U:           u,
-				V:           v,
-				Material:    s.mat,
-			}, true
+			s.fillRayHit(ray, t1, rayHit)
+			return true
 		}
 		// evaluate and return second solution if in range
 		t2 := (-b + root) / a
 		if t2 >= tMin && t2 <= tMax {
-			hitPoint := ray.PointAt(t1)
-			unitHitPoint := s.Center.To(hitPoint).DivScalar(s.Radius)
-
-			phi := math.Atan2(unitHitPoint.Z, unitHitPoint.X)
-			theta := math.Asin(unitHitPoint.Y)
-
-			u := 1.0 - (phi+math.Pi)/(2*math.Pi)
-			v := (theta + math.Pi/2) / math.Pi
-
-			return &material.RayHit{
-				Ray:         ray,
-				NormalAtHit: s.normalAt(ray.PointAt(t2)),
-				Time:        t2,
-				U:           u,
-				V:           v,
-				Material:    s.mat,
-			}, true
+			s.fillRayHit(ray, t2, rayHit)
+			return true
 		}
 	}
 
-	return nil, false
+	return false
+}
+
+// AllIntersections returns both intersections of this sphere and a given ray that are within range, sorted by time
+func (s *Sphere) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	centerToRayOrigin := s.Center.To(ray.Origin)
+
+	a := ray.Direction.Dot(ray.Direction)
+	b := ray.Direction.Dot(centerToRayOrigin)
+	c := centerToRayOrigin.Dot(centerToRayOrigin) - (s.Radius * s.Radius)
+
+	preDiscriminant := b*b - a*c
+	if preDiscriminant <= 0 {
+		return nil
+	}
+	root := math.Sqrt(preDiscriminant)
+	var hits []material.RayHit
+	for _, t := range [2]float64{(-b - root) / a, (-b + root) / a} {
+		if t >= tMin && t <= tMax {
+			var rayHit material.RayHit
+			s.fillRayHit(ray, t, &rayHit)
+			hits = append(hits, rayHit)
+		}
+	}
+	return hits
+}
+
+// fillRayHit writes the hit at time t into rayHit
+func (s *Sphere) fillRayHit(ray geometry.Ray, t float64, rayHit *material.RayHit) {
+	hitPoint := ray.PointAt(t)
+	unitHitPoint := s.Center.To(hitPoint).DivScalar(s.Radius)
+
+	phi := math.Atan2(unitHitPoint.Z, unitHitPoint.X)
+	theta := math.Asin(unitHitPoint.Y)
+
+	*rayHit = material.RayHit{
+		Ray:         ray,
+		NormalAtHit: s.normalAt(hitPoint),
+		Time:        t,
+		U:           1.0 - (phi+math.Pi)/(2*math.Pi),
+		V:           (theta + math.Pi/2) / math.Pi,
+		Material:    s.mat,
+	}
 }
 
 // BoundingBox returns the AABB of this object
@@ -118,6 +138,22 @@ func (s *Sphere) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	}, true
 }
 
+// TransformedBoundingBox returns the AABB of the ellipsoid this sphere becomes under an affine transform
+func (s *Sphere) TransformedBoundingBox(m mgl64.Mat4, t0, t1 float64) (*aabb.AABB, bool) {
+	center := m.Mul4x1(mgl64.Vec4{s.Center.X, s.Center.Y, s.Center.Z, 1.0})
+	// the extent along each axis is the radius scaled by the length of that row of the linear part
+	extent := geometry.Vector{
+		X: s.Radius*math.Sqrt(m[0]*m[0]+m[4]*m[4]+m[8]*m[8]) + 1e-7,
+		Y: s.Radius*math.Sqrt(m[1]*m[1]+m[5]*m[5]+m[9]*m[9]) + 1e-7,
+		Z: s.Radius*math.Sqrt(m[2]*m[2]+m[6]*m[6]+m[10]*m[10]) + 1e-7,
+	}
+	c := geometry.Point{X: center.X(), Y: center.Y(), Z: center.Z()}
+	return &aabb.AABB{
+		A: c.SubVector(extent),
+		B: c.AddVector(extent),
+	}, true
+}
+
 // SetMaterial sets this object's material
 func (s *Sphere) SetMaterial(m material.Material) {
 	s.mat = m
@@ -90,3 +90,26 @@ func BenchmarkSphereIntersectionMiss(b *testing.B) {
 	}
 	sphereHit = h
 }
+
+func TestSphereAllIntersections(t *testing.T) {
+	sphere := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	hits := sphere.AllIntersections(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if len(hits) != 2 {
+		t.Fatalf("Expected 2 hits but got %d\n", len(hits))
+	}
+	if hits[0].Time != 0.5 || hits[1].Time != 1.5 {
+		t.Errorf("Expected times 0.5 and 1.5 but got %f and %f\n", hits[0].Time, hits[1].Time)
+	}
+}
@@ -0,0 +1,122 @@
+package torus
+
+import "math"
+
+// isZero reports whether a coefficient is close enough to zero to be treated as zero by the solvers
+func isZero(x float64) bool {
+	return x > -1e-9 && x < 1e-9
+}
+
+// solveQuadratic returns the real roots of c[0] + c[1]x + c[2]x^2
+func solveQuadratic(c [3]float64) []float64 {
+	// normal form x^2 + px + q
+	p := c[1] / (2.0 * c[2])
+	q := c[0] / c[2]
+	d := p*p - q
+	if isZero(d) {
+		return []float64{-p}
+	}
+	if d < 0.0 {
+		return nil
+	}
+	root := math.Sqrt(d)
+	return []float64{root - p, -root - p}
+}
+
+// solveCubic returns the real roots of c[0] + c[1]x + c[2]x^2 + c[3]x^3 by Cardano's formula
+func solveCubic(c [4]float64) []float64 {
+	// normal form x^3 + ax^2 + bx + c, then substitute x = y - a/3 to get y^3 + py + q
+	a := c[2] / c[3]
+	b := c[1] / c[3]
+	cc := c[0] / c[3]
+	aa := a * a
+	p := (-aa/3.0 + b) / 3.0
+	q := (2.0/27.0*a*aa - a*b/3.0 + cc) / 2.0
+	ppp := p * p * p
+	d := q*q + ppp
+
+	var roots []float64
+	switch {
+	case isZero(d):
+		if isZero(q) {
+			roots = []float64{0.0}
+		} else {
+			u := math.Cbrt(-q)
+			roots = []float64{2.0 * u, -u}
+		}
+	case d < 0.0:
+		// three real roots
+		phi := math.Acos(-q/math.Sqrt(-ppp)) / 3.0
+		t := 2.0 * math.Sqrt(-p)
+		roots = []float64{
+			t * math.Cos(phi),
+			-t * math.Cos(phi+math.Pi/3.0),
+			-t * math.Cos(phi-math.Pi/3.0),
+		}
+	default:
+		root := math.Sqrt(d)
+		roots = []float64{math.Cbrt(root-q) - math.Cbrt(root+q)}
+	}
+	for i := range roots {
+		roots[i] -= a / 3.0
+	}
+	return roots
+}
+
+// solveQuartic returns the real roots of c[0] + c[1]x + c[2]x^2 + c[3]x^3 + c[4]x^4 by Ferrari's method
+// each root is polished with a few Newton steps, as the closed form loses precision
+func solveQuartic(c [5]float64) []float64 {
+	// normal form x^4 + ax^3 + bx^2 + cx + d, then substitute x = y - a/4 to get y^4 + py^2 + qy + r
+	a := c[3] / c[4]
+	b := c[2] / c[4]
+	cc := c[1] / c[4]
+	d := c[0] / c[4]
+	aa := a * a
+	p := -3.0/8.0*aa + b
+	q := aa*a/8.0 - a*b/2.0 + cc
+	r := -3.0/256.0*aa*aa + aa*b/16.0 - a*cc/4.0 + d
+
+	var roots []float64
+	if isZero(r) {
+		// y(y^3 + py + q) = 0
+		roots = append(solveCubic([4]float64{q, p, 0.0, 1.0}), 0.0)
+	} else {
+		// one real root of the resolvent cubic splits the quartic into two quadratics
+		z := solveCubic([4]float64{r*p/2.0 - q*q/8.0, -r, -p / 2.0, 1.0})[0]
+		u := z*z - r
+		v := 2.0*z - p
+		switch {
+		case isZero(u):
+			u = 0.0
+		case u > 0.0:
+			u = math.Sqrt(u)
+		default:
+			return nil
+		}
+		switch {
+		case isZero(v):
+			v = 0.0
+		case v > 0.0:
+			v = math.Sqrt(v)
+		default:
+			return nil
+		}
+		if q < 0.0 {
+			v = -v
+		}
+		roots = append(solveQuadratic([3]float64{z - u, v, 1.0}), solveQuadratic([3]float64{z + u, -v, 1.0})...)
+	}
+	for i := range roots {
+		x := roots[i] - a/4.0
+		for step := 0; step < 2; step++ {
+			f := (((c[4]*x+c[3])*x+c[2])*x+c[1])*x + c[0]
+			df := ((4.0*c[4]*x+3.0*c[3])*x+2.0*c[2])*x + c[1]
+			if df == 0.0 {
+				break
+			}
+			x -= f / df
+		}
+		roots[i] = x
+	}
+	return roots
+}
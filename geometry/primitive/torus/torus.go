@@ -0,0 +1,199 @@
+package torus
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Torus represents a ring shaped torus, swept by a circle of the minor radius
+// around a circle of the major radius in the plane perpendicular to the normal
+type Torus struct {
+	Center             geometry.Point  `json:"center"`
+	Normal             geometry.Vector `json:"normal"`
+	MajorRadius        float64         `json:"major_radius"`
+	MinorRadius        float64         `json:"minor_radius"`
+	HasInvertedNormals bool            `json:"has_inverted_normals"`
+	u, w               geometry.Vector // complete the normal to an orthonormal basis
+	mat                material.Material
+}
+
+// Setup sets up a torus's internal fields
+func (t *Torus) Setup() (*Torus, error) {
+	if t.Normal.Magnitude() == 0.0 {
+		return nil, fmt.Errorf("torus normal is zero vector")
+	}
+	if t.MinorRadius <= 0.0 {
+		return nil, fmt.Errorf("torus minor radius is 0 or negative")
+	}
+	if t.MajorRadius <= t.MinorRadius {
+		return nil, fmt.Errorf("torus major radius (%f) is not greater than its minor radius (%f)", t.MajorRadius, t.MinorRadius)
+	}
+	t.Normal = t.Normal.Unit()
+	t.u, t.w = t.Normal.Basis()
+	return t, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (t *Torus) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !t.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (t *Torus) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	for _, time := range t.roots(ray) {
+		if time >= tMin && time <= tMax {
+			t.fillRayHit(ray, time, rayHit)
+			return true
+		}
+	}
+	return false
+}
+
+// AllIntersections returns every intersection of this torus and a given ray that is within range, sorted by time
+func (t *Torus) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	var hits []material.RayHit
+	for _, time := range t.roots(ray) {
+		if time >= tMin && time <= tMax {
+			var rayHit material.RayHit
+			t.fillRayHit(ray, time, &rayHit)
+			hits = append(hits, rayHit)
+		}
+	}
+	return hits
+}
+
+// roots returns the sorted ray times at which a ray crosses the torus
+func (t *Torus) roots(ray geometry.Ray) []float64 {
+	// work in the torus's frame with a unit direction, where the torus is
+	// (x^2 + y^2 + z^2 + R^2 - r^2)^2 = 4R^2(x^2 + z^2) around the Y axis
+	length := ray.Direction.Magnitude()
+	o := t.local(t.Center.To(ray.Origin))
+	d := t.local(ray.Direction.DivScalar(length))
+
+	// skip rays missing the bounding sphere, and start the rest at their closest approach to the center,
+	// keeping the coefficients small for far away rays
+	shift := -o.Dot(d)
+	o = o.Add(d.MultScalar(shift))
+	outer := t.MajorRadius + t.MinorRadius
+	if o.Dot(o) > outer*outer {
+		return nil
+	}
+
+	rr := t.MajorRadius * t.MajorRadius
+	n := o.Dot(d)
+	k := o.Dot(o) + rr - t.MinorRadius*t.MinorRadius
+	roots := solveQuartic([5]float64{
+		k*k - 4.0*rr*(o.X*o.X+o.Z*o.Z),
+		4.0*n*k - 8.0*rr*(o.X*d.X+o.Z*d.Z),
+		4.0*n*n + 2.0*k - 4.0*rr*(d.X*d.X+d.Z*d.Z),
+		4.0 * n,
+		1.0,
+	})
+	for i := range roots {
+		roots[i] = (roots[i] + shift) / length
+	}
+	sort.Float64s(roots)
+	return roots
+}
+
+// fillRayHit writes the hit at time t into rayHit
+func (t *Torus) fillRayHit(ray geometry.Ray, time float64, rayHit *material.RayHit) {
+	p := t.local(t.Center.To(ray.PointAt(time)))
+	// the normal points away from the nearest point on the circle of the major radius
+	ring := math.Sqrt(p.X*p.X + p.Z*p.Z)
+	n := geometry.Vector{
+		X: p.X - t.MajorRadius*p.X/ring,
+		Y: p.Y,
+		Z: p.Z - t.MajorRadius*p.Z/ring,
+	}
+	normal := t.world(n).Unit()
+	if t.HasInvertedNormals {
+		normal = normal.Negate()
+	}
+	*rayHit = material.RayHit{
+		Ray:         ray,
+		NormalAtHit: normal,
+		Time:        time,
+		U:           (math.Atan2(p.Z, p.X) + math.Pi) / (2 * math.Pi),
+		V:           (math.Atan2(p.Y, ring-t.MajorRadius) + math.Pi) / (2 * math.Pi),
+		Material:    t.mat,
+	}
+}
+
+// local returns a world space vector in the torus's frame, with the normal as Y
+func (t *Torus) local(v geometry.Vector) geometry.Vector {
+	return geometry.Vector{
+		X: v.Dot(t.u),
+		Y: v.Dot(t.Normal),
+		Z: v.Dot(t.w),
+	}
+}
+
+// world returns a vector in the torus's frame in world space
+func (t *Torus) world(v geometry.Vector) geometry.Vector {
+	return t.u.MultScalar(v.X).Add(t.Normal.MultScalar(v.Y)).Add(t.w.MultScalar(v.Z))
+}
+
+// BoundingBox returns an AABB of this object
+func (t *Torus) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	// the circle of the major radius, grown by the minor radius in every direction
+	extent := geometry.Vector{
+		X: t.MajorRadius*math.Sqrt(1.0-t.Normal.X*t.Normal.X) + t.MinorRadius + 1e-7,
+		Y: t.MajorRadius*math.Sqrt(1.0-t.Normal.Y*t.Normal.Y) + t.MinorRadius + 1e-7,
+		Z: t.MajorRadius*math.Sqrt(1.0-t.Normal.Z*t.Normal.Z) + t.MinorRadius + 1e-7,
+	}
+	return &aabb.AABB{
+		A: t.Center.SubVector(extent),
+		B: t.Center.AddVector(extent),
+	}, true
+}
+
+// SetMaterial sets this object's material
+func (t *Torus) SetMaterial(m material.Material) {
+	t.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (t *Torus) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (t *Torus) IsClosed() bool {
+	return true
+}
+
+// Copy returns a shallow copy of this object
+func (t *Torus) Copy() primitive.Primitive {
+	newT := *t
+	return &newT
+}
+
+// Unit returns a torus lying flat in the XZ plane, with a major radius of 1 and a minor radius of 0.25
+func Unit(xOffset, yOffset, zOffset float64) *Torus {
+	t, _ := (&Torus{
+		Center: geometry.Point{
+			X: 0.0 + xOffset,
+			Y: 0.0 + yOffset,
+			Z: 0.0 + zOffset,
+		},
+		Normal: geometry.Vector{
+			X: 0.0,
+			Y: 1.0,
+			Z: 0.0,
+		},
+		MajorRadius: 1.0,
+		MinorRadius: 0.25,
+	}).Setup()
+	return t
+}
@@ -0,0 +1,267 @@
+package torus
+
+import (
+	"fluorescence/geometry"
+	"math"
+	"testing"
+)
+
+var torusHit bool
+
+func TestTorusIntersectionTopHit(t *testing.T) {
+	tr := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.0,
+			Y: 5.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.75) > 1e-9 {
+		t.Errorf("Expected time 4.75 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Y: 1.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal (0, 1, 0) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func BenchmarkTorusIntersectionTopHit(b *testing.B) {
+	tr := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.0,
+			Y: 5.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	torusHit = h
+}
+
+func TestTorusIntersectionOuterHit(t *testing.T) {
+	tr := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-3.75) > 1e-9 {
+		t.Errorf("Expected time 3.75 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{X: -1.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal (-1, 0, 0) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func BenchmarkTorusIntersectionOuterHit(b *testing.B) {
+	tr := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	torusHit = h
+}
+
+func TestTorusIntersectionHoleMiss(t *testing.T) {
+	tr := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 5.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	_, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func BenchmarkTorusIntersectionHoleMiss(b *testing.B) {
+	tr := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 5.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	torusHit = h
+}
+
+func TestTorusIntersectionAboveMiss(t *testing.T) {
+	tr := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.3,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	_, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func TestTorusIntersectionFarAway(t *testing.T) {
+	tr := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -1e4,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-(1e4-1.25)) > 1e-7 {
+		t.Errorf("Expected time %f but got %f\n", 1e4-1.25, rh.Time)
+	}
+}
+
+func TestTorusIntersectionTilted(t *testing.T) {
+	tr, _ := (&Torus{
+		Normal:      geometry.Vector{X: 1.0},
+		MajorRadius: 1.0,
+		MinorRadius: 0.25,
+	}).Setup()
+	// the torus stands upright in the YZ plane
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 5.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: -1.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-3.75) > 1e-9 {
+		t.Errorf("Expected time 3.75 but got %f\n", rh.Time)
+	}
+}
+
+func TestTorusAllIntersections(t *testing.T) {
+	tr := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	hits := tr.AllIntersections(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if len(hits) != 4 {
+		t.Fatalf("Expected 4 hits but got %d\n", len(hits))
+	}
+	for i, expected := range []float64{3.75, 4.25, 5.75, 6.25} {
+		if math.Abs(hits[i].Time-expected) > 1e-9 {
+			t.Errorf("Expected hit %d at time %f but got %f\n", i, expected, hits[i].Time)
+		}
+	}
+}
+
+func TestTorusSolveQuartic(t *testing.T) {
+	// (x - 1)(x - 2)(x - 3)(x - 4)
+	roots := solveQuartic([5]float64{24.0, -50.0, 35.0, -10.0, 1.0})
+	if len(roots) != 4 {
+		t.Fatalf("Expected 4 roots but got %d\n", len(roots))
+	}
+	for _, root := range roots {
+		if math.Abs(root-math.Round(root)) > 1e-9 || root < 1.0 || root > 4.0 {
+			t.Errorf("Expected roots 1, 2, 3 and 4 but got %v\n", roots)
+		}
+	}
+}
+
+func TestTorusInvalidRadii(t *testing.T) {
+	_, err := (&Torus{
+		Normal:      geometry.Vector{Y: 1.0},
+		MajorRadius: 0.5,
+		MinorRadius: 0.5,
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
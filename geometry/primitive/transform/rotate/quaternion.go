@@ -13,13 +13,15 @@ import (
 
 // Quaternion is a quaternion rotation
 type Quaternion struct {
-	AxisAngles [3]float64  `json:"axis_angles"`
-	Order      string      `json:"order"`
-	TypeName   string      `json:"type"`
-	Data       interface{} `json:"data"`
-	Primitive  primitive.Primitive
-	quaternion mgl64.Quat
-	inverse    mgl64.Quat
+	AxisAngles    [3]float64  `json:"axis_angles"`
+	EndAxisAngles *[3]float64 `json:"end_axis_angles"` // angles at the end keyframe, if the rotation is animated
+	Order         string      `json:"order"`
+	TypeName      string      `json:"type"`
+	Data          interface{} `json:"data"`
+	Primitive     primitive.Primitive
+	quaternion    mgl64.Quat
+	inverse       mgl64.Quat
+	end           mgl64.Quat
 }
 
 // Setup sets up some internal fields of a rotation
@@ -63,19 +65,28 @@ func (q *Quaternion) Setup() (*Quaternion, error) {
 		rotationOrder,
 	)
 	q.inverse = q.quaternion.Inverse()
+	if q.EndAxisAngles != nil {
+		q.end = mgl64.AnglesToQuat(
+			mgl64.DegToRad(q.EndAxisAngles[0]),
+			mgl64.DegToRad(q.EndAxisAngles[1]),
+			mgl64.DegToRad(q.EndAxisAngles[2]),
+			rotationOrder,
+		)
+	}
 	return q, nil
 }
 
 // Intersection computer the intersection of this object and a given ray if it exists
 func (q *Quaternion) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
 
+	quaternion, inverse := q.at(ray.Time)
 	rotatedRay := ray
 
 	originMGL := mgl64.Vec3{rotatedRay.Origin.X, rotatedRay.Origin.Y, rotatedRay.Origin.Z}
 	directionMGL := mgl64.Vec3{rotatedRay.Direction.X, rotatedRay.Direction.Y, rotatedRay.Direction.Z}
 
-	rotatedOriginMGL := q.inverse.Rotate(originMGL)
-	rotatedDirectionMGL := q.inverse.Rotate(directionMGL)
+	rotatedOriginMGL := inverse.Rotate(originMGL)
+	rotatedDirectionMGL := inverse.Rotate(directionMGL)
 
 	rotatedRay.Origin = geometry.Point{
 		X: rotatedOriginMGL.X(),
@@ -92,31 +103,49 @@ func (q *Quaternion) Intersection(ray geometry.Ray, tMin, tMax float64) (*materi
 	rayHit, wasHit := q.Primitive.Intersection(rotatedRay, tMin, tMax)
 	if wasHit {
 		rotatedNormalMGL := mgl64.Vec3{rayHit.NormalAtHit.X, rayHit.NormalAtHit.Y, rayHit.NormalAtHit.Z}
-		unrotatedNormalMGL := q.quaternion.Rotate(rotatedNormalMGL)
+		unrotatedNormalMGL := quaternion.Rotate(rotatedNormalMGL)
 		unrotatedNormal := geometry.Vector{
 			X: unrotatedNormalMGL.X(),
 			Y: unrotatedNormalMGL.Y(),
 			Z: unrotatedNormalMGL.Z(),
 		}
-		return &material.RayHit{
-			Ray:         ray,
-			NormalAtHit: unrotatedNormal,
-			Time:        rayHit.Time,
-			U:           rayHit.U,
-			V:           rayHit.V,
-			Material:    rayHit.Material,
-		}, true
+		unrotatedTangentMGL := quaternion.Rotate(mgl64.Vec3{rayHit.Tangent.X, rayHit.Tangent.Y, rayHit.Tangent.Z})
+		// copy the whole hit, so that fields added to RayHit are kept, then rotate what depends on the frame
+		hit := *rayHit
+		hit.Ray = ray
+		hit.NormalAtHit = unrotatedNormal
+		hit.Tangent = geometry.Vector{X: unrotatedTangentMGL.X(), Y: unrotatedTangentMGL.Y(), Z: unrotatedTangentMGL.Z()}
+		return &hit, true
 	}
 	return nil, false
 }
 
-// BoundingBox returns an AABB for this object
+// BoundingBox returns an AABB for this object, covering its rotation between times t0 and t1
 func (q *Quaternion) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
-
 	box, ok := q.Primitive.BoundingBox(t0, t1)
 	if !ok {
 		return nil, false
 	}
+	if q.EndAxisAngles == nil {
+		return rotatedBox(box, q.quaternion), true
+	}
+	return aabb.Swept(t0, t1, func(time float64) *aabb.AABB {
+		quaternion, _ := q.at(time)
+		return rotatedBox(box, quaternion)
+	}), true
+}
+
+// at returns the rotation and its inverse at a ray time
+func (q *Quaternion) at(time float64) (mgl64.Quat, mgl64.Quat) {
+	if q.EndAxisAngles == nil {
+		return q.quaternion, q.inverse
+	}
+	quaternion := mgl64.QuatSlerp(q.quaternion, q.end, geometry.MotionFraction(time))
+	return quaternion, quaternion.Inverse()
+}
+
+// rotatedBox returns the box around the corners of a box rotated by a quaternion
+func rotatedBox(box *aabb.AABB, quaternion mgl64.Quat) *aabb.AABB {
 	minPoint := geometry.PointMax
 	maxPoint := geometry.PointMax.Negate()
 	for i := 0.0; i < 2; i++ {
@@ -127,7 +156,7 @@ func (q *Quaternion) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 				z := k*box.B.Z + (1-k)*box.A.Z
 
 				unrotatedCornerMGL := mgl64.Vec3{x, y, z}
-				rotatedCornerMGL := q.quaternion.Rotate(unrotatedCornerMGL)
+				rotatedCornerMGL := quaternion.Rotate(unrotatedCornerMGL)
 
 				rotatedCorner := geometry.Point{
 					X: rotatedCornerMGL.X(),
@@ -143,7 +172,7 @@ func (q *Quaternion) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	return &aabb.AABB{
 		A: minPoint,
 		B: maxPoint,
-	}, true
+	}
 }
 
 // SetMaterial sets the material of this object
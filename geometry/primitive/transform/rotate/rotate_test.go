@@ -0,0 +1,47 @@
+package rotate
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/trianglemesh"
+	"math"
+	"testing"
+)
+
+func TestRotationKeepsHitFields(t *testing.T) {
+	// a full turn leaves the mesh where it was, so the hit on it should be unchanged apart from rounding
+	newMesh := func() primitive.Primitive { return trianglemesh.Unit(0.0, 0.0, 0.0) }
+	rx, _ := (&RotationX{AngleDegrees: 360.0, Primitive: newMesh()}).Setup()
+	ry, _ := (&RotationY{AngleDegrees: 360.0, Primitive: newMesh()}).Setup()
+	rz, _ := (&RotationZ{AngleDegrees: 360.0, Primitive: newMesh()}).Setup()
+	q, _ := (&Quaternion{AxisAngles: [3]float64{360.0, 0.0, 0.0}, Order: "XYZ", Primitive: newMesh()}).Setup()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.75,
+			Y: 0.25,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	expected, _ := newMesh().Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	for _, p := range []primitive.Primitive{rx, ry, rz, q} {
+		rh, h := p.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if !h {
+			t.Fatalf("Expected true (hit) on %T but got %t\n", p, h)
+		}
+		if rh.Triangle != expected.Triangle ||
+			math.Abs(rh.Barycentric[0]-expected.Barycentric[0]) > 1e-9 ||
+			math.Abs(rh.Barycentric[1]-expected.Barycentric[1]) > 1e-9 ||
+			math.Abs(rh.U-expected.U) > 1e-9 || math.Abs(rh.V-expected.V) > 1e-9 {
+			t.Errorf("Expected %T to keep the hit's triangle %d %v at (%f, %f) but got %d %v at (%f, %f)\n", p,
+				expected.Triangle, expected.Barycentric, expected.U, expected.V, rh.Triangle, rh.Barycentric, rh.U, rh.V)
+		}
+		if rh.Ray != r {
+			t.Errorf("Expected %T to return the unrotated ray but got %v\n", p, rh.Ray)
+		}
+	}
+}
@@ -10,13 +10,14 @@ import (
 
 // RotationX is a primitive with a rotations around the y axis attached
 type RotationX struct {
-	AngleDegrees float64     `json:"angle"`
-	TypeName     string      `json:"type"`
-	Data         interface{} `json:"data"`
-	Primitive    primitive.Primitive
-	theta        float64
-	sinTheta     float64
-	cosTheta     float64
+	AngleDegrees    float64     `json:"angle"`
+	EndAngleDegrees *float64    `json:"end_angle"` // angle at the end keyframe, if the rotation is animated
+	TypeName        string      `json:"type"`
+	Data            interface{} `json:"data"`
+	Primitive       primitive.Primitive
+	theta           float64
+	sinTheta        float64
+	cosTheta        float64
 }
 
 // Setup sets up some internal fields of a rotation
@@ -33,38 +34,50 @@ func (rx *RotationX) Setup() (*RotationX, error) {
 // Intersection computer the intersection of this object and a given ray if it exists
 func (rx *RotationX) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
 
+	sinTheta, cosTheta := rx.sinCos(ray.Time)
 	rotatedRay := ray
 
-	rotatedRay.Origin.Y = rx.cosTheta*ray.Origin.Y + rx.sinTheta*ray.Origin.Z
-	rotatedRay.Origin.Z = -rx.sinTheta*ray.Origin.Y + rx.cosTheta*ray.Origin.Z
+	rotatedRay.Origin.Y = cosTheta*ray.Origin.Y + sinTheta*ray.Origin.Z
+	rotatedRay.Origin.Z = -sinTheta*ray.Origin.Y + cosTheta*ray.Origin.Z
 
-	rotatedRay.Direction.Y = rx.cosTheta*ray.Direction.Y + rx.sinTheta*ray.Direction.Z
-	rotatedRay.Direction.Z = -rx.sinTheta*ray.Direction.Y + rx.cosTheta*ray.Direction.Z
+	rotatedRay.Direction.Y = cosTheta*ray.Direction.Y + sinTheta*ray.Direction.Z
+	rotatedRay.Direction.Z = -sinTheta*ray.Direction.Y + cosTheta*ray.Direction.Z
 
 	rayHit, wasHit := rx.Primitive.Intersection(rotatedRay, tMin, tMax)
 	if wasHit {
 		unrotatedNormal := rayHit.NormalAtHit
-		unrotatedNormal.Y = rx.cosTheta*rayHit.NormalAtHit.Y - rx.sinTheta*rayHit.NormalAtHit.Z
-		unrotatedNormal.Z = rx.sinTheta*rayHit.NormalAtHit.Y + rx.cosTheta*rayHit.NormalAtHit.Z
-		return &material.RayHit{
-			Ray:         ray,
-			NormalAtHit: unrotatedNormal,
-			Time:        rayHit.Time,
-			U:           rayHit.U,
-			V:           rayHit.V,
-			Material:    rayHit.Material,
-		}, true
+		unrotatedNormal.Y = cosTheta*rayHit.NormalAtHit.Y - sinTheta*rayHit.NormalAtHit.Z
+		unrotatedNormal.Z = sinTheta*rayHit.NormalAtHit.Y + cosTheta*rayHit.NormalAtHit.Z
+		unrotatedTangent := rayHit.Tangent
+		unrotatedTangent.Y = cosTheta*rayHit.Tangent.Y - sinTheta*rayHit.Tangent.Z
+		unrotatedTangent.Z = sinTheta*rayHit.Tangent.Y + cosTheta*rayHit.Tangent.Z
+		// copy the whole hit, so that fields added to RayHit are kept, then rotate what depends on the frame
+		hit := *rayHit
+		hit.Ray = ray
+		hit.NormalAtHit = unrotatedNormal
+		hit.Tangent = unrotatedTangent
+		return &hit, true
 	}
 	return nil, false
 }
 
-// BoundingBox returns an AABB for this object
+// BoundingBox returns an AABB for this object, covering its rotation between times t0 and t1
 func (rx *RotationX) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
-
 	box, ok := rx.Primitive.BoundingBox(t0, t1)
 	if !ok {
 		return nil, false
 	}
+	if rx.EndAngleDegrees == nil {
+		return rx.rotatedBox(box, rx.sinTheta, rx.cosTheta), true
+	}
+	return aabb.Swept(t0, t1, func(time float64) *aabb.AABB {
+		sinTheta, cosTheta := rx.sinCos(time)
+		return rx.rotatedBox(box, sinTheta, cosTheta)
+	}), true
+}
+
+// rotatedBox returns the box around the corners of a box rotated by the angle with the given sine and cosine
+func (rx *RotationX) rotatedBox(box *aabb.AABB, sinTheta, cosTheta float64) *aabb.AABB {
 	minPoint := geometry.PointMax
 	maxPoint := geometry.PointMax.Negate()
 	for i := 0.0; i < 2; i++ {
@@ -74,8 +87,8 @@ func (rx *RotationX) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 				y := j*box.B.Y + (1-j)*box.A.Y
 				z := k*box.B.Z + (1-k)*box.A.Z
 
-				newY := rx.cosTheta*y - rx.sinTheta*z
-				newZ := rx.sinTheta*y + rx.cosTheta*z
+				newY := cosTheta*y - sinTheta*z
+				newZ := sinTheta*y + cosTheta*z
 
 				rotatedCorner := geometry.Point{
 					X: x,
@@ -91,7 +104,17 @@ func (rx *RotationX) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	return &aabb.AABB{
 		A: minPoint,
 		B: maxPoint,
-	}, true
+	}
+}
+
+// sinCos returns the sine and cosine of the rotation angle at a ray time
+func (rx *RotationX) sinCos(time float64) (float64, float64) {
+	if rx.EndAngleDegrees == nil {
+		return rx.sinTheta, rx.cosTheta
+	}
+	s := geometry.MotionFraction(time)
+	theta := (math.Pi / 180.0) * (rx.AngleDegrees + s*(*rx.EndAngleDegrees-rx.AngleDegrees))
+	return math.Sin(theta), math.Cos(theta)
 }
 
 // SetMaterial sets the material of this object
@@ -10,13 +10,14 @@ import (
 
 // RotationY is a primitive with a rotations around the y axis attached
 type RotationY struct {
-	AngleDegrees float64     `json:"angle"`
-	TypeName     string      `json:"type"`
-	Data         interface{} `json:"data"`
-	Primitive    primitive.Primitive
-	theta        float64
-	sinTheta     float64
-	cosTheta     float64
+	AngleDegrees    float64     `json:"angle"`
+	EndAngleDegrees *float64    `json:"end_angle"` // angle at the end keyframe, if the rotation is animated
+	TypeName        string      `json:"type"`
+	Data            interface{} `json:"data"`
+	Primitive       primitive.Primitive
+	theta           float64
+	sinTheta        float64
+	cosTheta        float64
 }
 
 // Setup sets up some internal fields of a rotation
@@ -33,38 +34,50 @@ func (ry *RotationY) Setup() (*RotationY, error) {
 // Intersection computer the intersection of this object and a given ray if it exists
 func (ry *RotationY) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
 
+	sinTheta, cosTheta := ry.sinCos(ray.Time)
 	rotatedRay := ray
 
-	rotatedRay.Origin.X = ry.cosTheta*ray.Origin.X - ry.sinTheta*ray.Origin.Z
-	rotatedRay.Origin.Z = ry.sinTheta*ray.Origin.X + ry.cosTheta*ray.Origin.Z
+	rotatedRay.Origin.X = cosTheta*ray.Origin.X - sinTheta*ray.Origin.Z
+	rotatedRay.Origin.Z = sinTheta*ray.Origin.X + cosTheta*ray.Origin.Z
 
-	rotatedRay.Direction.X = ry.cosTheta*ray.Direction.X - ry.sinTheta*ray.Direction.Z
-	rotatedRay.Direction.Z = ry.sinTheta*ray.Direction.X + ry.cosTheta*ray.Direction.Z
+	rotatedRay.Direction.X = cosTheta*ray.Direction.X - sinTheta*ray.Direction.Z
+	rotatedRay.Direction.Z = sinTheta*ray.Direction.X + cosTheta*ray.Direction.Z
 
 	rayHit, wasHit := ry.Primitive.Intersection(rotatedRay, tMin, tMax)
 	if wasHit {
 		unrotatedNormal := rayHit.NormalAtHit
-		unrotatedNormal.X = ry.cosTheta*rayHit.NormalAtHit.X + ry.sinTheta*rayHit.NormalAtHit.Z
-		unrotatedNormal.Z = -ry.sinTheta*rayHit.NormalAtHit.X + ry.cosTheta*rayHit.NormalAtHit.Z
-		return &material.RayHit{
-			Ray:         ray,
-			NormalAtHit: unrotatedNormal,
-			Time:        rayHit.Time,
-			U:           rayHit.U,
-			V:           rayHit.V,
-			Material:    rayHit.Material,
-		}, true
+		unrotatedNormal.X = cosTheta*rayHit.NormalAtHit.X + sinTheta*rayHit.NormalAtHit.Z
+		unrotatedNormal.Z = -sinTheta*rayHit.NormalAtHit.X + cosTheta*rayHit.NormalAtHit.Z
+		unrotatedTangent := rayHit.Tangent
+		unrotatedTangent.X = cosTheta*rayHit.Tangent.X + sinTheta*rayHit.Tangent.Z
+		unrotatedTangent.Z = -sinTheta*rayHit.Tangent.X + cosTheta*rayHit.Tangent.Z
+		// copy the whole hit, so that fields added to RayHit are kept, then rotate what depends on the frame
+		hit := *rayHit
+		hit.Ray = ray
+		hit.NormalAtHit = unrotatedNormal
+		hit.Tangent = unrotatedTangent
+		return &hit, true
 	}
 	return nil, false
 }
 
-// BoundingBox returns an AABB for this object
+// BoundingBox returns an AABB for this object, covering its rotation between times t0 and t1
 func (ry *RotationY) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
-
 	box, ok := ry.Primitive.BoundingBox(t0, t1)
 	if !ok {
 		return nil, false
 	}
+	if ry.EndAngleDegrees == nil {
+		return ry.rotatedBox(box, ry.sinTheta, ry.cosTheta), true
+	}
+	return aabb.Swept(t0, t1, func(time float64) *aabb.AABB {
+		sinTheta, cosTheta := ry.sinCos(time)
+		return ry.rotatedBox(box, sinTheta, cosTheta)
+	}), true
+}
+
+// rotatedBox returns the box around the corners of a box rotated by the angle with the given sine and cosine
+func (ry *RotationY) rotatedBox(box *aabb.AABB, sinTheta, cosTheta float64) *aabb.AABB {
 	minPoint := geometry.PointMax
 	maxPoint := geometry.PointMax.Negate()
 	for i := 0.0; i < 2; i++ {
@@ -74,8 +87,8 @@ func (ry *RotationY) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 				y := j*box.B.Y + (1-j)*box.A.Y
 				z := k*box.B.Z + (1-k)*box.A.Z
 
-				newX := ry.cosTheta*x + ry.sinTheta*z
-				newZ := -ry.sinTheta*x + ry.cosTheta*z
+				newX := cosTheta*x + sinTheta*z
+				newZ := -sinTheta*x + cosTheta*z
 
 				rotatedCorner := geometry.Point{
 					X: newX,
@@ -91,7 +104,17 @@ func (ry *RotationY) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	return &aabb.AABB{
 		A: minPoint,
 		B: maxPoint,
-	}, true
+	}
+}
+
+// sinCos returns the sine and cosine of the rotation angle at a ray time
+func (ry *RotationY) sinCos(time float64) (float64, float64) {
+	if ry.EndAngleDegrees == nil {
+		return ry.sinTheta, ry.cosTheta
+	}
+	s := geometry.MotionFraction(time)
+	theta := (math.Pi / 180.0) * (ry.AngleDegrees + s*(*ry.EndAngleDegrees-ry.AngleDegrees))
+	return math.Sin(theta), math.Cos(theta)
 }
 
 // SetMaterial sets the material of this object
@@ -10,13 +10,14 @@ import (
 
 // RotationZ is a primitive with a rotations around the y axis attached
 type RotationZ struct {
-	AngleDegrees float64     `json:"angle"`
-	TypeName     string      `json:"type"`
-	Data         interface{} `json:"data"`
-	Primitive    primitive.Primitive
-	theta        float64
-	sinTheta     float64
-	cosTheta     float64
+	AngleDegrees    float64     `json:"angle"`
+	EndAngleDegrees *float64    `json:"end_angle"` // angle at the end keyframe, if the rotation is animated
+	TypeName        string      `json:"type"`
+	Data            interface{} `json:"data"`
+	Primitive       primitive.Primitive
+	theta           float64
+	sinTheta        float64
+	cosTheta        float64
 }
 
 // Setup sets up some internal fields of a rotation
@@ -33,38 +34,50 @@ func (rz *RotationZ) Setup() (*RotationZ, error) {
 // Intersection computer the intersection of this object and a given ray if it exists
 func (rz *RotationZ) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
 
+	sinTheta, cosTheta := rz.sinCos(ray.Time)
 	rotatedRay := ray
 
-	rotatedRay.Origin.X = rz.cosTheta*ray.Origin.X + rz.sinTheta*ray.Origin.Y
-	rotatedRay.Origin.Y = -rz.sinTheta*ray.Origin.X + rz.cosTheta*ray.Origin.Y
+	rotatedRay.Origin.X = cosTheta*ray.Origin.X + sinTheta*ray.Origin.Y
+	rotatedRay.Origin.Y = -sinTheta*ray.Origin.X + cosTheta*ray.Origin.Y
 
-	rotatedRay.Direction.X = rz.cosTheta*ray.Direction.X + rz.sinTheta*ray.Direction.Y
-	rotatedRay.Direction.Y = -rz.sinTheta*ray.Direction.X + rz.cosTheta*ray.Direction.Y
+	rotatedRay.Direction.X = cosTheta*ray.Direction.X + sinTheta*ray.Direction.Y
+	rotatedRay.Direction.Y = -sinTheta*ray.Direction.X + cosTheta*ray.Direction.Y
 
 	rayHit, wasHit := rz.Primitive.Intersection(rotatedRay, tMin, tMax)
 	if wasHit {
 		unrotatedNormal := rayHit.NormalAtHit
-		unrotatedNormal.X = rz.cosTheta*rayHit.NormalAtHit.X - rz.sinTheta*rayHit.NormalAtHit.Y
-		unrotatedNormal.Y = rz.sinTheta*rayHit.NormalAtHit.X + rz.cosTheta*rayHit.NormalAtHit.Y
-		return &material.RayHit{
-			Ray:         ray,
-			NormalAtHit: unrotatedNormal,
-			Time:        rayHit.Time,
-			U:           rayHit.U,
-			V:           rayHit.V,
-			Material:    rayHit.Material,
-		}, true
+		unrotatedNormal.X = cosTheta*rayHit.NormalAtHit.X - sinTheta*rayHit.NormalAtHit.Y
+		unrotatedNormal.Y = sinTheta*rayHit.NormalAtHit.X + cosTheta*rayHit.NormalAtHit.Y
+		unrotatedTangent := rayHit.Tangent
+		unrotatedTangent.X = cosTheta*rayHit.Tangent.X - sinTheta*rayHit.Tangent.Y
+		unrotatedTangent.Y = sinTheta*rayHit.Tangent.X + cosTheta*rayHit.Tangent.Y
+		// copy the whole hit, so that fields added to RayHit are kept, then rotate what depends on the frame
+		hit := *rayHit
+		hit.Ray = ray
+		hit.NormalAtHit = unrotatedNormal
+		hit.Tangent = unrotatedTangent
+		return &hit, true
 	}
 	return nil, false
 }
 
-// BoundingBox returns an AABB for this object
+// BoundingBox returns an AABB for this object, covering its rotation between times t0 and t1
 func (rz *RotationZ) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
-
 	box, ok := rz.Primitive.BoundingBox(t0, t1)
 	if !ok {
 		return nil, false
 	}
+	if rz.EndAngleDegrees == nil {
+		return rz.rotatedBox(box, rz.sinTheta, rz.cosTheta), true
+	}
+	return aabb.Swept(t0, t1, func(time float64) *aabb.AABB {
+		sinTheta, cosTheta := rz.sinCos(time)
+		return rz.rotatedBox(box, sinTheta, cosTheta)
+	}), true
+}
+
+// rotatedBox returns the box around the corners of a box rotated by the angle with the given sine and cosine
+func (rz *RotationZ) rotatedBox(box *aabb.AABB, sinTheta, cosTheta float64) *aabb.AABB {
 	minPoint := geometry.PointMax
 	maxPoint := geometry.PointMax.Negate()
 	for i := 0.0; i < 2; i++ {
@@ -74,8 +87,8 @@ func (rz *RotationZ) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 				y := j*box.B.Y + (1-j)*box.A.Y
 				z := k*box.B.Z + (1-k)*box.A.Z
 
-				newX := rz.cosTheta*x - rz.sinTheta*y
-				newY := rz.sinTheta*x + rz.cosTheta*y
+				newX := cosTheta*x - sinTheta*y
+				newY := sinTheta*x + cosTheta*y
 
 				rotatedCorner := geometry.Point{
 					X: newX,
@@ -91,7 +104,17 @@ func (rz *RotationZ) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	return &aabb.AABB{
 		A: minPoint,
 		B: maxPoint,
-	}, true
+	}
+}
+
+// sinCos returns the sine and cosine of the rotation angle at a ray time
+func (rz *RotationZ) sinCos(time float64) (float64, float64) {
+	if rz.EndAngleDegrees == nil {
+		return rz.sinTheta, rz.cosTheta
+	}
+	s := geometry.MotionFraction(time)
+	theta := (math.Pi / 180.0) * (rz.AngleDegrees + s*(*rz.EndAngleDegrees-rz.AngleDegrees))
+	return math.Sin(theta), math.Cos(theta)
 }
 
 // SetMaterial sets the material of this object
@@ -0,0 +1,461 @@
+package transform
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Transform is a primitive with a general affine transform attached
+// the transform is built from a list of operations, applied to the primitive in order
+// an animated transform also has a list of end operations, matching the operations one to one,
+// and moves between the two as ray time goes from the start to the end keyframe
+type Transform struct {
+	Operations    []Operation `json:"operations"`
+	EndOperations []Operation `json:"end_operations"`
+	TypeName      string      `json:"type"`
+	Data          interface{} `json:"data"`
+	Primitive     primitive.Primitive
+	matrix        mgl64.Mat4 // object to world
+	inverse       mgl64.Mat4 // world to object
+	normal        mgl64.Mat3 // inverse transpose of the linear part, for normals
+	steps         []step     // what an animated transform composes at each ray time
+	box           *aabb.AABB
+}
+
+// step is either a run of operations that do not move, composed into one matrix and its inverse,
+// or a single operation moving from its start to its end
+type step struct {
+	matrix  mgl64.Mat4
+	inverse mgl64.Mat4
+	moving  bool
+	start   Operation
+	end     Operation
+}
+
+// Operation is a single translate, rotate, scale or look_at step of a Transform
+type Operation struct {
+	TypeName     string          `json:"type"`
+	Displacement geometry.Vector `json:"displacement"` // translate
+	Axis         geometry.Vector `json:"axis"`         // rotate
+	AngleDegrees float64         `json:"angle"`        // rotate
+	Factors      geometry.Vector `json:"factors"`      // scale
+	Eye          geometry.Point  `json:"eye"`          // look_at
+	Target       geometry.Point  `json:"target"`       // look_at
+	Up           geometry.Vector `json:"up"`           // look_at
+}
+
+// Setup sets up a Transform's internal fields
+func (t *Transform) Setup() (*Transform, error) {
+	if t.Primitive == nil {
+		return nil, fmt.Errorf("transform has no primitive")
+	}
+	var err error
+	t.matrix, err = compose(t.Operations)
+	if err != nil {
+		return nil, err
+	}
+	t.steps = nil
+	if t.EndOperations != nil {
+		if len(t.EndOperations) != len(t.Operations) {
+			return nil, fmt.Errorf("transform has %d end operations for %d operations", len(t.EndOperations), len(t.Operations))
+		}
+		for i, o := range t.Operations {
+			if t.EndOperations[i].TypeName != o.TypeName {
+				return nil, fmt.Errorf("transform end operation (%s) does not match operation (%s)",
+					t.EndOperations[i].TypeName, o.TypeName)
+			}
+		}
+		_, err = compose(t.EndOperations)
+		if err != nil {
+			return nil, err
+		}
+		t.steps, err = steps(t.Operations, t.EndOperations)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.inverse = t.matrix.Inv()
+	t.normal = t.inverse.Mat3().Transpose()
+	if !t.Primitive.IsInfinite() {
+		box, ok := t.TransformedBoundingBox(mgl64.Ident4(), geometry.MotionStart, geometry.MotionEnd)
+		if !ok {
+			return nil, fmt.Errorf("no bounding box for transform primitive")
+		}
+		t.box = box
+	}
+	return t, nil
+}
+
+// compose returns the matrix applying a list of operations in order
+func compose(operations []Operation) (mgl64.Mat4, error) {
+	matrix := mgl64.Ident4()
+	for _, o := range operations {
+		m, err := o.Matrix()
+		if err != nil {
+			return mgl64.Mat4{}, err
+		}
+		// later operations apply after earlier ones
+		matrix = m.Mul4(matrix)
+	}
+	if math.Abs(matrix.Det()) < 1e-12 {
+		return mgl64.Mat4{}, fmt.Errorf("transform matrix is singular")
+	}
+	return matrix, nil
+}
+
+// steps returns the steps of an animated transform, checking that no operation becomes singular as it moves
+// operations that are the same at both ends are composed ahead of time with their neighbours
+func steps(operations, endOperations []Operation) ([]step, error) {
+	var result []step
+	fixed := false
+	for i, o := range operations {
+		end := endOperations[i]
+		if o != end {
+			err := o.checkInterpolation(end)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, step{moving: true, start: o, end: end})
+			fixed = false
+			continue
+		}
+		m, inverse := o.matrices()
+		if !fixed {
+			result = append(result, step{matrix: mgl64.Ident4(), inverse: mgl64.Ident4()})
+			fixed = true
+		}
+		last := &result[len(result)-1]
+		last.matrix = m.Mul4(last.matrix)
+		last.inverse = last.inverse.Mul4(inverse)
+	}
+	return result, nil
+}
+
+// at returns the matrix, inverse and normal matrix at a ray time
+func (t *Transform) at(time float64) (mgl64.Mat4, mgl64.Mat4, mgl64.Mat3) {
+	if t.EndOperations == nil {
+		return t.matrix, t.inverse, t.normal
+	}
+	s := geometry.MotionFraction(time)
+	matrix := mgl64.Ident4()
+	inverse := mgl64.Ident4()
+	for _, st := range t.steps {
+		m, inv := st.matrix, st.inverse
+		if st.moving {
+			m, inv = st.start.lerp(st.end, s).matrices()
+		}
+		matrix = m.Mul4(matrix)
+		inverse = inverse.Mul4(inv)
+	}
+	return matrix, inverse, inverse.Mat3().Transpose()
+}
+
+// checkInterpolation returns an error if this operation becomes singular on its way to an end operation
+// the endpoints are already known to be valid, so only scale factors changing sign,
+// or axes and directions turning through zero, are left to catch
+func (o Operation) checkInterpolation(end Operation) error {
+	switch o.TypeName {
+	case "scale":
+		if o.Factors.X*end.Factors.X < 0.0 || o.Factors.Y*end.Factors.Y < 0.0 || o.Factors.Z*end.Factors.Z < 0.0 {
+			return fmt.Errorf("scale operation factors (%v to %v) pass through zero", o.Factors, end.Factors)
+		}
+	case "rotate":
+		if passesThroughZero(o.Axis, end.Axis.Sub(o.Axis), geometry.VectorZero) {
+			return fmt.Errorf("rotate operation axis (%v to %v) passes through zero", o.Axis, end.Axis)
+		}
+	case "look_at":
+		forward := o.Eye.To(o.Target)
+		dForward := end.Eye.To(end.Target).Sub(forward)
+		dUp := end.Up.Sub(o.Up)
+		// the cross product of the moving forward and up directions is quadratic in the fraction of the motion
+		if passesThroughZero(forward, dForward, geometry.VectorZero) ||
+			passesThroughZero(forward.Cross(o.Up), forward.Cross(dUp).Add(dForward.Cross(o.Up)), dForward.Cross(dUp)) {
+			return fmt.Errorf("look_at operation loses its orientation between its start and end")
+		}
+	}
+	return nil
+}
+
+// passesThroughZero returns whether c0 + c1 s + c2 s² is zero, to within rounding, for some s from 0 to 1
+func passesThroughZero(c0, c1, c2 geometry.Vector) bool {
+	scale := c0.Magnitude() + c1.Magnitude() + c2.Magnitude()
+	if scale == 0.0 {
+		return true
+	}
+	epsilon := 1e-9 * scale
+	// a zero of the vector is a zero of its first component that is not always zero
+	for _, c := range [3][3]float64{{c0.X, c1.X, c2.X}, {c0.Y, c1.Y, c2.Y}, {c0.Z, c1.Z, c2.Z}} {
+		candidates, always := quadraticZeros(c[0], c[1], c[2], epsilon)
+		if always {
+			continue
+		}
+		for _, s := range candidates {
+			if s >= 0.0 && s <= 1.0 && c0.Add(c1.MultScalar(s)).Add(c2.MultScalar(s*s)).Magnitude() <= epsilon {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// quadraticZeros returns where a + b s + c s² may be zero, and whether it is zero everywhere
+// a quadratic without real roots gives its vertex, where it comes closest to zero
+func quadraticZeros(a, b, c, epsilon float64) ([]float64, bool) {
+	if math.Abs(c) <= epsilon {
+		if math.Abs(b) <= epsilon {
+			return nil, math.Abs(a) <= epsilon
+		}
+		return []float64{-a / b}, false
+	}
+	discriminant := b*b - 4.0*a*c
+	if discriminant <= 0.0 {
+		return []float64{-b / (2.0 * c)}, false
+	}
+	root := math.Sqrt(discriminant)
+	return []float64{(-b - root) / (2.0 * c), (-b + root) / (2.0 * c)}, false
+}
+
+// lerp returns the operation a fraction s of the way from this operation to another of the same type
+func (o Operation) lerp(end Operation, s float64) Operation {
+	vector := func(a, b geometry.Vector) geometry.Vector {
+		return a.MultScalar(1.0 - s).Add(b.MultScalar(s))
+	}
+	point := func(a, b geometry.Point) geometry.Point {
+		return a.AddVector(a.To(b).MultScalar(s))
+	}
+	return Operation{
+		TypeName:     o.TypeName,
+		Displacement: vector(o.Displacement, end.Displacement),
+		Axis:         vector(o.Axis, end.Axis),
+		AngleDegrees: o.AngleDegrees*(1.0-s) + end.AngleDegrees*s,
+		Factors:      vector(o.Factors, end.Factors),
+		Eye:          point(o.Eye, end.Eye),
+		Target:       point(o.Target, end.Target),
+		Up:           vector(o.Up, end.Up),
+	}
+}
+
+// Matrix returns the matrix of this operation
+func (o Operation) Matrix() (mgl64.Mat4, error) {
+	switch o.TypeName {
+	case "translate":
+	case "rotate":
+		if o.Axis.Magnitude() == 0.0 {
+			return mgl64.Mat4{}, fmt.Errorf("rotate operation has no axis")
+		}
+	case "scale":
+		if o.Factors.X == 0.0 || o.Factors.Y == 0.0 || o.Factors.Z == 0.0 {
+			return mgl64.Mat4{}, fmt.Errorf("scale operation factors (%v) have a zero component", o.Factors)
+		}
+	case "look_at":
+		forward := o.Eye.To(o.Target)
+		if forward.Magnitude() == 0.0 || forward.Cross(o.Up).Magnitude() == 0.0 {
+			return mgl64.Mat4{}, fmt.Errorf("look_at operation has no well defined orientation")
+		}
+	default:
+		return mgl64.Mat4{}, fmt.Errorf("invalid transform operation (%s)", o.TypeName)
+	}
+	matrix, _ := o.matrices()
+	return matrix, nil
+}
+
+// matrices returns the matrix of a valid operation and its inverse, which every operation has in closed form
+func (o Operation) matrices() (mgl64.Mat4, mgl64.Mat4) {
+	switch o.TypeName {
+	case "translate":
+		d := o.Displacement
+		return mgl64.Translate3D(d.X, d.Y, d.Z), mgl64.Translate3D(-d.X, -d.Y, -d.Z)
+	case "rotate":
+		axis := o.Axis.Unit()
+		rotation := mgl64.HomogRotate3D(mgl64.DegToRad(o.AngleDegrees), mgl64.Vec3{axis.X, axis.Y, axis.Z})
+		return rotation, rotation.Transpose()
+	case "scale":
+		f := o.Factors
+		return mgl64.Scale3D(f.X, f.Y, f.Z), mgl64.Scale3D(1.0/f.X, 1.0/f.Y, 1.0/f.Z)
+	default:
+		// place the object at the eye, facing down its -Z axis toward the target, like a camera
+		// the view matrix takes the world to the object, and is rigid, so the other way is its rotation transposed
+		view := mgl64.LookAt(
+			o.Eye.X, o.Eye.Y, o.Eye.Z,
+			o.Target.X, o.Target.Y, o.Target.Z,
+			o.Up.X, o.Up.Y, o.Up.Z,
+		)
+		matrix := view.Mat3().Transpose().Mat4()
+		matrix[12], matrix[13], matrix[14] = o.Eye.X, o.Eye.Y, o.Eye.Z
+		return matrix, view
+	}
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (t *Transform) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !t.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+// the ray direction is transformed without normalizing, so hit times are the same in both spaces
+func (t *Transform) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	matrix, inverse, normal := t.at(ray.Time)
+	objectRay := geometry.Ray{
+		Origin:    Point(inverse, ray.Origin),
+		Direction: Vector(inverse, ray.Direction),
+		Time:      ray.Time,
+	}
+	if recorder, ok := t.Primitive.(primitive.HitRecorder); ok {
+		if !recorder.IntersectionInto(objectRay, tMin, tMax, rayHit) {
+			return false
+		}
+	} else {
+		hit, ok := t.Primitive.Intersection(objectRay, tMin, tMax)
+		if !ok {
+			return false
+		}
+		*rayHit = *hit
+	}
+	n := normal.Mul3x1(mgl64.Vec3{rayHit.NormalAtHit.X, rayHit.NormalAtHit.Y, rayHit.NormalAtHit.Z})
+	rayHit.Ray = ray
+	rayHit.NormalAtHit = geometry.Vector{X: n.X(), Y: n.Y(), Z: n.Z()}.Unit()
+	rayHit.Tangent = transformTangent(matrix, rayHit.Tangent)
+	return true
+}
+
+// AllIntersections returns every intersection of this object and a given ray, sorted by time
+// it is empty if the transformed primitive cannot report all of its intersections
+func (t *Transform) AllIntersections(ray geometry.Ray, tMin, tMax float64) []material.RayHit {
+	intersecter, ok := t.Primitive.(primitive.AllIntersecter)
+	if !ok {
+		return nil
+	}
+	matrix, inverse, normal := t.at(ray.Time)
+	objectRay := geometry.Ray{
+		Origin:    Point(inverse, ray.Origin),
+		Direction: Vector(inverse, ray.Direction),
+		Time:      ray.Time,
+	}
+	hits := intersecter.AllIntersections(objectRay, tMin, tMax)
+	for i := range hits {
+		n := normal.Mul3x1(mgl64.Vec3{hits[i].NormalAtHit.X, hits[i].NormalAtHit.Y, hits[i].NormalAtHit.Z})
+		hits[i].Ray = ray
+		hits[i].NormalAtHit = geometry.Vector{X: n.X(), Y: n.Y(), Z: n.Z()}.Unit()
+		hits[i].Tangent = transformTangent(matrix, hits[i].Tangent)
+	}
+	return hits
+}
+
+// transformTangent maps a hit's tangent from object space to world space, leaving a zero tangent as it is
+func transformTangent(matrix mgl64.Mat4, objectTangent geometry.Vector) geometry.Vector {
+	if objectTangent == geometry.VectorZero {
+		return objectTangent
+	}
+	return Vector(matrix, objectTangent).Unit()
+}
+
+// BoundingBox returns an AABB for this object
+// the box covers all of the object's motion, so it holds for any interval of time
+func (t *Transform) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	if t.box == nil {
+		return nil, false
+	}
+	return t.box, true
+}
+
+// TransformedBoundingBox returns an AABB for this object under a further transform between times t0 and t1
+// the transforms are combined so nested transforms bound as tightly as a single one
+func (t *Transform) TransformedBoundingBox(m mgl64.Mat4, t0, t1 float64) (*aabb.AABB, bool) {
+	if t.EndOperations == nil {
+		return boundingBox(t.Primitive, m.Mul4(t.matrix), t0, t1)
+	}
+	ok := true
+	box := aabb.Swept(t0, t1, func(time float64) *aabb.AABB {
+		matrix, _, _ := t.at(time)
+		box, boxOk := boundingBox(t.Primitive, m.Mul4(matrix), time, time)
+		if !boxOk {
+			ok = false
+			return &aabb.AABB{}
+		}
+		return box
+	})
+	return box, ok
+}
+
+// SetMaterial sets the material of this object
+func (t *Transform) SetMaterial(m material.Material) {
+	t.Primitive.SetMaterial(m)
+}
+
+// IsInfinite returns whether this object is infinite
+func (t *Transform) IsInfinite() bool {
+	return t.Primitive.IsInfinite()
+}
+
+// IsClosed returns whether this object is closed
+func (t *Transform) IsClosed() bool {
+	return t.Primitive.IsClosed()
+}
+
+// Copy returns a shallow copy of this object
+func (t *Transform) Copy() primitive.Primitive {
+	newT := *t
+	return &newT
+}
+
+// boundingBox returns the box around a primitive under a transform
+// primitives that can bound themselves under the transform do so, and the rest have the corners of their box transformed
+func boundingBox(p primitive.Primitive, m mgl64.Mat4, t0, t1 float64) (*aabb.AABB, bool) {
+	if bounder, ok := p.(primitive.TransformBounder); ok {
+		return bounder.TransformedBoundingBox(m, t0, t1)
+	}
+	box, ok := p.BoundingBox(t0, t1)
+	if !ok {
+		return nil, false
+	}
+	return Box(m, box), true
+}
+
+// Box returns the box surrounding the eight corners of a box under an affine transform
+func Box(m mgl64.Mat4, box *aabb.AABB) *aabb.AABB {
+	minPoint := geometry.PointMax
+	maxPoint := geometry.PointMax.Negate()
+	for _, x := range [2]float64{box.A.X, box.B.X} {
+		for _, y := range [2]float64{box.A.Y, box.B.Y} {
+			for _, z := range [2]float64{box.A.Z, box.B.Z} {
+				corner := Point(m, geometry.Point{X: x, Y: y, Z: z})
+				minPoint = geometry.MinComponents(minPoint, corner)
+				maxPoint = geometry.MaxComponents(maxPoint, corner)
+			}
+		}
+	}
+	return &aabb.AABB{
+		A: minPoint,
+		B: maxPoint,
+	}
+}
+
+// Point applies an affine transform to a point
+func Point(m mgl64.Mat4, p geometry.Point) geometry.Point {
+	return geometry.Point{
+		X: m[0]*p.X + m[4]*p.Y + m[8]*p.Z + m[12],
+		Y: m[1]*p.X + m[5]*p.Y + m[9]*p.Z + m[13],
+		Z: m[2]*p.X + m[6]*p.Y + m[10]*p.Z + m[14],
+	}
+}
+
+// Vector applies the linear part of an affine transform to a vector
+func Vector(m mgl64.Mat4, v geometry.Vector) geometry.Vector {
+	return geometry.Vector{
+		X: m[0]*v.X + m[4]*v.Y + m[8]*v.Z,
+		Y: m[1]*v.X + m[5]*v.Y + m[9]*v.Z,
+		Z: m[2]*v.X + m[6]*v.Y + m[10]*v.Z,
+	}
+}
@@ -0,0 +1,395 @@
+package transform
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/sphere"
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+var transformHit bool
+
+// stretchedSphere returns a unit sphere scaled by (2, 1, 1), rotated 90 degrees about Z, and moved to (0, 5, 0)
+// making it an ellipsoid two units tall along Y
+func stretchedSphere() *Transform {
+	t, _ := (&Transform{
+		Operations: []Operation{
+			{TypeName: "scale", Factors: geometry.Vector{X: 2.0, Y: 1.0, Z: 1.0}},
+			{TypeName: "rotate", Axis: geometry.Vector{Z: 1.0}, AngleDegrees: 90.0},
+			{TypeName: "translate", Displacement: geometry.Vector{Y: 5.0}},
+		},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	return t
+}
+
+func TestTransformIntersectionHit(t *testing.T) {
+	tr := stretchedSphere()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 1.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.0) > 1e-9 {
+		t.Errorf("Expected time 4 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Y: -1.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal (0, -1, 0) but got %v\n", rh.NormalAtHit)
+	}
+	if rh.Ray != r {
+		t.Errorf("Expected the world space ray but got %v\n", rh.Ray)
+	}
+}
+
+func BenchmarkTransformIntersectionHit(b *testing.B) {
+	tr := stretchedSphere()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 1.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	transformHit = h
+}
+
+func TestTransformIntersectionMiss(t *testing.T) {
+	tr := stretchedSphere()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.6,
+			Y: 0.0,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 1.0,
+			Z: 0.0,
+		},
+	}
+	_, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func TestTransformNormalUsesInverseTranspose(t *testing.T) {
+	tr, _ := (&Transform{
+		Operations: []Operation{
+			{TypeName: "scale", Factors: geometry.Vector{X: 2.0, Y: 1.0, Z: 1.0}},
+		},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	// aim at the object space point (0.18, 0.24, 0.4), which is (0.36, 0.24, 0.4) in world space
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.36,
+			Y: 0.24,
+			Z: 5.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	// the object space normal (0.36, 0.48, 0.8) scaled by the inverse of (2, 1, 1)
+	expected := geometry.Vector{X: 0.18, Y: 0.48, Z: 0.8}.Unit()
+	if rh.NormalAtHit.Sub(expected).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal %v but got %v\n", expected, rh.NormalAtHit)
+	}
+}
+
+func TestTransformBoundingBoxIsTight(t *testing.T) {
+	tr, _ := (&Transform{
+		Operations: []Operation{
+			{TypeName: "rotate", Axis: geometry.Vector{X: 1.0, Y: 1.0, Z: 1.0}, AngleDegrees: 30.0},
+		},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	box, _ := tr.BoundingBox(0, 0)
+	// a rotated sphere is the same sphere, so the box should not grow the way rotated corners would
+	if math.Abs(box.B.X-0.5) > 1e-6 || math.Abs(box.A.Y+0.5) > 1e-6 {
+		t.Errorf("Expected box from (-0.5, -0.5, -0.5) to (0.5, 0.5, 0.5) but got %v\n", box)
+	}
+}
+
+func TestTransformNestedBoundingBox(t *testing.T) {
+	inner, _ := (&Transform{
+		Operations: []Operation{
+			{TypeName: "rotate", Axis: geometry.Vector{Z: 1.0}, AngleDegrees: 45.0},
+		},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	outer, _ := (&Transform{
+		Operations: []Operation{
+			{TypeName: "rotate", Axis: geometry.Vector{Z: 1.0}, AngleDegrees: -45.0},
+			{TypeName: "translate", Displacement: geometry.Vector{X: 3.0}},
+		},
+		Primitive: inner,
+	}).Setup()
+	box, _ := outer.BoundingBox(0, 0)
+	if math.Abs(box.A.X-2.5) > 1e-6 || math.Abs(box.B.X-3.5) > 1e-6 {
+		t.Errorf("Expected box from x 2.5 to 3.5 but got %v\n", box)
+	}
+}
+
+func TestTransformLookAt(t *testing.T) {
+	tr, _ := (&Transform{
+		Operations: []Operation{
+			{TypeName: "translate", Displacement: geometry.Vector{Z: -3.0}},
+			{
+				TypeName: "look_at",
+				Eye:      geometry.Point{X: 10.0, Y: 0.0, Z: 0.0},
+				Target:   geometry.Point{X: 0.0, Y: 0.0, Z: 0.0},
+				Up:       geometry.Vector{Y: 1.0},
+			},
+		},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	// the sphere sat three units down -Z, which now points from the eye toward the target
+	center := Point(tr.matrix, geometry.Point{})
+	if center.To(geometry.Point{X: 7.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected center at (7, 0, 0) but got %v\n", center)
+	}
+	up := Vector(tr.matrix, geometry.Vector{Y: 1.0})
+	if up.Sub(geometry.Vector{Y: 1.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected +Y to stay up but got %v\n", up)
+	}
+}
+
+func TestTransformSingularScale(t *testing.T) {
+	_, err := (&Transform{
+		Operations: []Operation{
+			{TypeName: "scale", Factors: geometry.Vector{X: 1.0, Y: 0.0, Z: 1.0}},
+		},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
+
+func TestTransformInvalidOperation(t *testing.T) {
+	_, err := (&Transform{
+		Operations: []Operation{
+			{TypeName: "shear"},
+		},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
+
+// movingSphere returns a unit sphere moving from the origin at the start keyframe to (4, 0, 0) at the end keyframe
+func movingSphere() *Transform {
+	t, _ := (&Transform{
+		Operations: []Operation{
+			{TypeName: "translate", Displacement: geometry.Vector{X: 0.0}},
+		},
+		EndOperations: []Operation{
+			{TypeName: "translate", Displacement: geometry.Vector{X: 4.0}},
+		},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	return t
+}
+
+func TestTransformMotion(t *testing.T) {
+	tr := movingSphere()
+	for _, c := range []struct {
+		time float64
+		x    float64
+	}{{0.0, 0.0}, {0.5, 2.0}, {1.0, 4.0}, {2.0, 4.0}} {
+		r := geometry.Ray{
+			Origin: geometry.Point{
+				X: c.x,
+				Y: 0.0,
+				Z: 5.0,
+			},
+			Direction: geometry.Vector{
+				X: 0.0,
+				Y: 0.0,
+				Z: -1.0,
+			},
+			Time: c.time,
+		}
+		rh, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if !h {
+			t.Fatalf("Expected true (hit) at time %f but got %t\n", c.time, h)
+		}
+		if math.Abs(rh.Time-4.5) > 1e-9 {
+			t.Errorf("Expected hit time 4.5 at time %f but got %f\n", c.time, rh.Time)
+		}
+	}
+}
+
+func TestTransformMotionBoundingBox(t *testing.T) {
+	tr := movingSphere()
+	box, _ := tr.BoundingBox(geometry.MotionStart, geometry.MotionEnd)
+	if box.A.X > -0.5 || box.B.X < 4.5 {
+		t.Errorf("Expected box to cover x -0.5 to 4.5 but got %v\n", box)
+	}
+}
+
+func TestTransformMotionRotationBoundingBox(t *testing.T) {
+	// a sphere four units off the axis sweeps from -40 to 50 degrees, passing its farthest x between samples
+	tr, _ := (&Transform{
+		Operations: []Operation{
+			{TypeName: "rotate", Axis: geometry.Vector{Z: 1.0}, AngleDegrees: -40.0},
+		},
+		EndOperations: []Operation{
+			{TypeName: "rotate", Axis: geometry.Vector{Z: 1.0}, AngleDegrees: 50.0},
+		},
+		Primitive: sphere.Unit(4.0, 0.0, 0.0),
+	}).Setup()
+	box, _ := tr.BoundingBox(geometry.MotionStart, geometry.MotionEnd)
+	if box.B.X < 4.5 {
+		t.Errorf("Expected box to reach x 4.5 but got %v\n", box)
+	}
+}
+
+func TestTransformMismatchedEndOperations(t *testing.T) {
+	_, err := (&Transform{
+		Operations: []Operation{
+			{TypeName: "translate"},
+		},
+		EndOperations: []Operation{
+			{TypeName: "scale", Factors: geometry.Vector{X: 1.0, Y: 1.0, Z: 1.0}},
+		},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
+
+func TestTransformInterpolationThroughZero(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		start, end Operation
+	}{
+		{
+			"flipping scale",
+			Operation{TypeName: "scale", Factors: geometry.Vector{X: 1.0, Y: 1.0, Z: 1.0}},
+			Operation{TypeName: "scale", Factors: geometry.Vector{X: -1.0, Y: 1.0, Z: 1.0}},
+		},
+		{
+			"flipping rotate axis",
+			Operation{TypeName: "rotate", Axis: geometry.Vector{Z: 1.0}, AngleDegrees: 30.0},
+			Operation{TypeName: "rotate", Axis: geometry.Vector{Z: -1.0}, AngleDegrees: 30.0},
+		},
+		{
+			"look_at passing through its target",
+			Operation{TypeName: "look_at", Eye: geometry.Point{X: 1.0}, Up: geometry.Vector{Y: 1.0}},
+			Operation{TypeName: "look_at", Eye: geometry.Point{X: -1.0}, Up: geometry.Vector{Y: 1.0}},
+		},
+		{
+			"look_at sweeping past its up vector",
+			Operation{TypeName: "look_at", Target: geometry.Point{X: 1.0, Y: 1.0}, Up: geometry.Vector{Y: 1.0}},
+			Operation{TypeName: "look_at", Target: geometry.Point{X: -1.0, Y: 1.0}, Up: geometry.Vector{Y: 1.0}},
+		},
+	} {
+		_, err := (&Transform{
+			Operations:    []Operation{c.start},
+			EndOperations: []Operation{c.end},
+			Primitive:     sphere.Unit(0.0, 0.0, 0.0),
+		}).Setup()
+		if err == nil {
+			t.Errorf("Expected error for %s but got nil\n", c.name)
+		}
+	}
+}
+
+func TestTransformMotionMidShutter(t *testing.T) {
+	// the scale and the rotation both move while the translation stays put, and nothing is singular on the way
+	tr, err := (&Transform{
+		Operations: []Operation{
+			{TypeName: "scale", Factors: geometry.Vector{X: 1.0, Y: 1.0, Z: 1.0}},
+			{TypeName: "rotate", Axis: geometry.Vector{Z: 1.0}, AngleDegrees: 0.0},
+			{TypeName: "translate", Displacement: geometry.Vector{Y: 5.0}},
+		},
+		EndOperations: []Operation{
+			{TypeName: "scale", Factors: geometry.Vector{X: 3.0, Y: 1.0, Z: 1.0}},
+			{TypeName: "rotate", Axis: geometry.Vector{Z: 1.0}, AngleDegrees: 180.0},
+			{TypeName: "translate", Displacement: geometry.Vector{Y: 5.0}},
+		},
+		Primitive: sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	// halfway, the sphere is stretched to 2 along X and turned 90 degrees, so it reaches from y 4 to 6
+	r := geometry.Ray{
+		Origin:    geometry.Point{},
+		Direction: geometry.Vector{Y: 1.0},
+		Time:      0.5,
+	}
+	rh, h := tr.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.0) > 1e-9 {
+		t.Errorf("Expected time 4 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{Y: -1.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal (0, -1, 0) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func TestTransformLookAtMotion(t *testing.T) {
+	lookAt := func(eye geometry.Point) Operation {
+		return Operation{TypeName: "look_at", Eye: eye, Up: geometry.Vector{Y: 1.0}}
+	}
+	tr, err := (&Transform{
+		Operations:    []Operation{{TypeName: "translate", Displacement: geometry.Vector{Z: -3.0}}, lookAt(geometry.Point{X: 10.0})},
+		EndOperations: []Operation{{TypeName: "translate", Displacement: geometry.Vector{Z: -3.0}}, lookAt(geometry.Point{Z: 10.0})},
+		Primitive:     sphere.Unit(0.0, 0.0, 0.0),
+	}).Setup()
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err)
+	}
+	// every moving step's closed form inverse should undo its matrix
+	for _, time := range []float64{0.0, 0.3, 1.0} {
+		matrix, inverse, _ := tr.at(time)
+		product := matrix.Mul4(inverse)
+		for i := range product {
+			if math.Abs(product[i]-mgl64.Ident4()[i]) > 1e-9 {
+				t.Errorf("Expected the inverse at time %f to undo the matrix but got %v\n", time, product)
+				break
+			}
+		}
+	}
+	center, _, _ := tr.at(1.0)
+	if c := Point(center, geometry.Point{}); c.To(geometry.Point{Z: 7.0}).Magnitude() > 1e-9 {
+		t.Errorf("Expected center at (0, 0, 7) at the end but got %v\n", c)
+	}
+}
@@ -9,10 +9,11 @@ import (
 
 // Translation is a primitive with a translation attached
 type Translation struct {
-	Displacement geometry.Vector `json:"displacement"`
-	TypeName     string          `json:"type"`
-	Data         interface{}     `json:"data"`
-	Primitive    primitive.Primitive
+	Displacement    geometry.Vector  `json:"displacement"`
+	EndDisplacement *geometry.Vector `json:"end_displacement"` // displacement at the end keyframe, if the translation is animated
+	TypeName        string           `json:"type"`
+	Data            interface{}      `json:"data"`
+	Primitive       primitive.Primitive
 }
 
 // Setup sets up a Translation's internal fields
@@ -24,25 +25,44 @@ func (t *Translation) Setup() (*Translation, error) {
 func (t *Translation) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
 
 	// translate the ray to the object
-	ray.Origin = ray.Origin.SubVector(t.Displacement)
+	translatedRay := ray
+	translatedRay.Origin = ray.Origin.SubVector(t.displacementAt(ray.Time))
 
-	rh, ok := t.Primitive.Intersection(ray, tMin, tMax)
+	rh, ok := t.Primitive.Intersection(translatedRay, tMin, tMax)
 	if ok {
-		rh.Ray.Origin = rh.Ray.Origin.AddVector(t.Displacement)
+		// hand back the original ray, like the rotations do, rather than translating the object's ray back
+		// and accumulating rounding error in the hit point
+		rh.Ray = ray
 	}
 	return rh, ok
 }
 
-// BoundingBox returns an AABB for this object
+// BoundingBox returns an AABB for this object, covering its movement between times t0 and t1
 func (t *Translation) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	box, ok := t.Primitive.BoundingBox(t0, t1)
-	if ok {
-		box = &aabb.AABB{
-			A: box.A.AddVector(t.Displacement),
-			B: box.B.AddVector(t.Displacement),
-		}
+	if !ok {
+		return nil, false
+	}
+	// the movement is linear, so the boxes at either end surround it
+	start, end := t.displacementAt(t0), t.displacementAt(t1)
+	return aabb.SurroundingBox(
+		&aabb.AABB{
+			A: box.A.AddVector(start),
+			B: box.B.AddVector(start),
+		},
+		&aabb.AABB{
+			A: box.A.AddVector(end),
+			B: box.B.AddVector(end),
+		}), true
+}
+
+// displacementAt returns the displacement at a ray time
+func (t *Translation) displacementAt(time float64) geometry.Vector {
+	if t.EndDisplacement == nil {
+		return t.Displacement
 	}
-	return box, ok
+	s := geometry.MotionFraction(time)
+	return t.Displacement.MultScalar(1.0 - s).Add(t.EndDisplacement.MultScalar(s))
 }
 
 // SetMaterial sets the material of this object
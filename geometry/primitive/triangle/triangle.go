@@ -38,15 +38,25 @@ func (t *Triangle) Setup() (*Triangle, error) {
 
 // Intersection computer the intersection of this object and a given ray if it exists
 func (t *Triangle) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !t.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (t *Triangle) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
 	ab := t.A.To(t.B)
 	ac := t.A.To(t.C)
 	pVector := ray.Direction.Cross(ac)
 	determinant := ab.Dot(pVector)
 	if t.IsCulled && determinant < 1e-7 {
 		// This ray is parallel to this Triangle or back-facing.
-		return nil, false
+		return false
 	} else if determinant > -1e-7 && determinant < 1e-7 {
-		return nil, false
+		return false
 	}
 
 	inverseDeterminant := 1.0 / determinant
@@ -54,38 +64,39 @@ func (t *Triangle) Intersection(ray geometry.Ray, tMin, tMax float64) (*material
 	tVector := t.A.To(ray.Origin)
 	u := inverseDeterminant * (tVector.Dot(pVector))
 	if u < 0.0 || u > 1.0 {
-		return nil, false
+		return false
 	}
 
 	qVector := tVector.Cross(ab)
 	v := inverseDeterminant * (ray.Direction.Dot(qVector))
 	if v < 0.0 || u+v > 1.0 {
-		return nil, false
+		return false
 	}
 
 	// At this stage we can compute time to find out where the intersection point is on the line.
 	time := inverseDeterminant * (ac.Dot(qVector))
 	if time >= tMin && time <= tMax {
 		// ray intersection
-		return &material.RayHit{
+		*rayHit = material.RayHit{
 			Ray:         ray,
 			NormalAtHit: t.normal,
 			Time:        time,
 			U:           0,
 			V:           0,
 			Material:    t.mat,
-		}, true
+		}
+		return true
 	}
-	return nil, false
+	return false
 }
 
 // BoundingBox returns an AABB for this object
 func (t *Triangle) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
 	return &aabb.AABB{
 		A: geometry.Point{
-			X: math.Min(math.Min(t.A.X, t.A.X), t.C.X) - 1e-7,
-			Y: math.Min(math.Min(t.A.Y, t.A.Y), t.C.Y) - 1e-7,
-			Z: math.Min(math.Min(t.A.Z, t.A.Z), t.C.Z) - 1e-7,
+			X: math.Min(math.Min(t.A.X, t.B.X), t.C.X) - 1e-7,
+			Y: math.Min(math.Min(t.A.Y, t.B.Y), t.C.Y) - 1e-7,
+			Z: math.Min(math.Min(t.A.Z, t.B.Z), t.C.Z) - 1e-7,
 		},
 		B: geometry.Point{
 			X: math.Max(math.Max(t.A.X, t.B.X), t.C.X) + 1e-7,
@@ -0,0 +1,39 @@
+package trianglemesh
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/bvh/tree"
+	"runtime"
+	"time"
+)
+
+// build constructs the internal BVH with the Surface Area Heuristic builder scene BVHs use,
+// building large meshes concurrently by up to one worker per CPU
+func (tm *TriangleMesh) build() error {
+	start := time.Now()
+	count := tm.TriangleCount()
+	boxes := make([]aabb.AABB, count)
+	for i := 0; i < count; i++ {
+		boxes[i] = tm.triangleBox(int32(i))
+	}
+	nodes, triangles, err := tree.Build(boxes, maxLeafSize, int64(runtime.GOMAXPROCS(0)))
+	if err != nil {
+		return err
+	}
+	tm.nodes = nodes
+	tm.triangles = triangles
+	tm.stats = tree.NewStats(nodes, count, time.Since(start))
+	return nil
+}
+
+// triangleBox returns the bounds of a single triangle, padded slightly so flat triangles have volume
+func (tm *TriangleMesh) triangleBox(triangle int32) aabb.AABB {
+	a := tm.Vertices[tm.Indices[3*triangle]]
+	b := tm.Vertices[tm.Indices[3*triangle+1]]
+	c := tm.Vertices[tm.Indices[3*triangle+2]]
+	return aabb.AABB{
+		A: geometry.MinComponents(a, geometry.MinComponents(b, c)).SubVector(geometry.Vector{X: 1e-7, Y: 1e-7, Z: 1e-7}),
+		B: geometry.MaxComponents(a, geometry.MaxComponents(b, c)).AddVector(geometry.Vector{X: 1e-7, Y: 1e-7, Z: 1e-7}),
+	}
+}
@@ -0,0 +1,376 @@
+package trianglemesh
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/geometry/primitive/bvh/tree"
+	"fluorescence/shading"
+	"fluorescence/shading/material"
+	"fluorescence/shading/texture"
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// TriangleMesh is a triangle mesh with shared vertex attribute buffers indexed by each triangle
+// it keeps its own bounding volume hierarchy over its triangles
+type TriangleMesh struct {
+	Vertices       []geometry.Point    `json:"vertices"`
+	Normals        []geometry.Vector   `json:"normals"`
+	UVs            [][2]float64        `json:"uvs"`
+	Colors         []shading.Color     `json:"colors"`          // per-vertex colors, exposed through VertexColors
+	Indices        []int               `json:"indices"`         // three vertex indices per triangle
+	NormalIndices  []int               `json:"normal_indices"`  // three normal indices per triangle, or empty to reuse Indices
+	UVIndices      []int               `json:"uv_indices"`      // three uv indices per triangle, or empty to reuse Indices
+	ComputeNormals bool                `json:"compute_normals"` // should smooth normals be generated when none are given?
+	IsCulled       bool                `json:"is_culled"`       // whether or not the triangles are single-sided
+	Closed         bool                `json:"is_closed"`       // whether or not the mesh is watertight
+	Materials      []material.Material `json:"-"`               // materials the mesh brings with it, such as from a material library
+	FaceMaterials  []int               `json:"-"`               // index into Materials per triangle, or -1 to use the material set by SetMaterial
+	mat            material.Material
+	nodes          []tree.Node // the internal BVH, whose leaves cover ranges of triangles
+	triangles      []int32     // triangle indices ordered so that each leaf covers a contiguous range
+	stats          tree.Stats
+	box            *aabb.AABB
+}
+
+// traversal is a node of the internal BVH waiting to be visited, along with the time the ray enters its box
+type traversal struct {
+	node   int32
+	tEnter float64
+}
+
+// maxLeafSize is the most triangles a leaf node of the internal BVH may hold
+const maxLeafSize = 4
+
+// Setup validates the buffers and builds the internal BVH
+func (tm *TriangleMesh) Setup() (*TriangleMesh, error) {
+	if len(tm.Indices) == 0 || len(tm.Indices)%3 != 0 {
+		return nil, fmt.Errorf("triangle mesh indices are empty or not a multiple of 3")
+	}
+	err := checkIndices(tm.Indices, len(tm.Vertices), "vertex")
+	if err != nil {
+		return nil, err
+	}
+	if len(tm.Normals) > 0 {
+		if len(tm.NormalIndices) == 0 {
+			tm.NormalIndices = tm.Indices
+		}
+		if len(tm.NormalIndices) != len(tm.Indices) {
+			return nil, fmt.Errorf("triangle mesh normal indices do not match vertex indices")
+		}
+		err = checkIndices(tm.NormalIndices, len(tm.Normals), "normal")
+		if err != nil {
+			return nil, err
+		}
+	} else if tm.ComputeNormals {
+		tm.computeVertexNormals()
+	}
+	if len(tm.UVs) > 0 {
+		if len(tm.UVIndices) == 0 {
+			tm.UVIndices = tm.Indices
+		}
+		if len(tm.UVIndices) != len(tm.Indices) {
+			return nil, fmt.Errorf("triangle mesh uv indices do not match vertex indices")
+		}
+		err = checkIndices(tm.UVIndices, len(tm.UVs), "uv")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(tm.Colors) > 0 && len(tm.Colors) != len(tm.Vertices) {
+		return nil, fmt.Errorf("triangle mesh colors do not match vertex count")
+	}
+	if len(tm.FaceMaterials) > 0 && len(tm.FaceMaterials) != tm.TriangleCount() {
+		return nil, fmt.Errorf("triangle mesh face materials do not match triangle count")
+	}
+
+	err = tm.build()
+	if err != nil {
+		return nil, err
+	}
+	tm.box = &aabb.AABB{
+		A: tm.nodes[0].Box.A,
+		B: tm.nodes[0].Box.B,
+	}
+	return tm, nil
+}
+
+// Stats returns the build time and tree statistics of the internal BVH
+func (tm *TriangleMesh) Stats() tree.Stats {
+	return tm.stats
+}
+
+// TriangleCount returns the amount of triangles in the mesh
+func (tm *TriangleMesh) TriangleCount() int {
+	return len(tm.Indices) / 3
+}
+
+// VertexColors returns a texture interpolating the mesh's vertex colors, if it has any
+func (tm *TriangleMesh) VertexColors() (*texture.VertexColor, bool) {
+	if len(tm.Colors) == 0 {
+		return nil, false
+	}
+	return &texture.VertexColor{
+		Colors:  tm.Colors,
+		Indices: tm.Indices,
+	}, true
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (tm *TriangleMesh) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !tm.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+// nodes are visited nearest first, and nodes the ray enters beyond the closest hit so far are skipped
+func (tm *TriangleMesh) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	tEnter, ok := tm.nodes[0].Box.IntersectionDistance(ray, tMin, tMax)
+	if !ok {
+		return false
+	}
+	closestTriangle := int32(-1)
+	var closestU, closestV float64
+
+	// SAH trees are not balanced, so the stack grows past its initial capacity for deep ones
+	stack := make([]traversal, 1, 64)
+	stack[0] = traversal{node: 0, tEnter: tEnter}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if current.tEnter > tMax {
+			// a closer hit was found after this node was queued
+			continue
+		}
+		n := &tm.nodes[current.node]
+		if n.Count > 0 {
+			for i := n.Offset; i < n.Offset+n.Count; i++ {
+				triangle := tm.triangles[i]
+				t, u, v, ok := tm.intersectTriangle(triangle, ray, tMin, tMax)
+				if ok {
+					// only closer hits are accepted from here on
+					tMax = t
+					closestTriangle = triangle
+					closestU = u
+					closestV = v
+				}
+			}
+			continue
+		}
+
+		left := current.node + 1
+		right := n.Offset
+		tLeft, hitLeft := tm.nodes[left].Box.IntersectionDistance(ray, tMin, tMax)
+		tRight, hitRight := tm.nodes[right].Box.IntersectionDistance(ray, tMin, tMax)
+		if hitLeft && hitRight {
+			// push the farther child first so that the nearer one is visited next
+			if tLeft <= tRight {
+				stack = append(stack, traversal{node: right, tEnter: tRight}, traversal{node: left, tEnter: tLeft})
+			} else {
+				stack = append(stack, traversal{node: left, tEnter: tLeft}, traversal{node: right, tEnter: tRight})
+			}
+		} else if hitLeft {
+			stack = append(stack, traversal{node: left, tEnter: tLeft})
+		} else if hitRight {
+			stack = append(stack, traversal{node: right, tEnter: tRight})
+		}
+	}
+
+	if closestTriangle < 0 {
+		return false
+	}
+	tm.fillRayHit(ray, closestTriangle, tMax, closestU, closestV, rayHit)
+	return true
+}
+
+// BoundingBox returns an AABB for this object
+func (tm *TriangleMesh) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return tm.box, true
+}
+
+// TransformedBoundingBox returns the AABB of this mesh's vertices under an affine transform
+func (tm *TriangleMesh) TransformedBoundingBox(m mgl64.Mat4, t0, t1 float64) (*aabb.AABB, bool) {
+	minPoint := geometry.PointMax
+	maxPoint := geometry.PointMax.Negate()
+	for _, v := range tm.Vertices {
+		t := m.Mul4x1(mgl64.Vec4{v.X, v.Y, v.Z, 1.0})
+		p := geometry.Point{X: t.X(), Y: t.Y(), Z: t.Z()}
+		minPoint = geometry.MinComponents(minPoint, p)
+		maxPoint = geometry.MaxComponents(maxPoint, p)
+	}
+	return &aabb.AABB{
+		A: minPoint.SubVector(geometry.Vector{X: 1e-7, Y: 1e-7, Z: 1e-7}),
+		B: maxPoint.AddVector(geometry.Vector{X: 1e-7, Y: 1e-7, Z: 1e-7}),
+	}, true
+}
+
+// SetMaterial sets the material of every triangle without a material of its own
+func (tm *TriangleMesh) SetMaterial(m material.Material) {
+	tm.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (tm *TriangleMesh) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (tm *TriangleMesh) IsClosed() bool {
+	return tm.Closed
+}
+
+// Copy returns a shallow copy of this object
+// the vertex buffers and BVH are shared with the original
+func (tm *TriangleMesh) Copy() primitive.Primitive {
+	newTM := *tm
+	return &newTM
+}
+
+// intersectTriangle intersects a single triangle, returning the ray time and barycentric coordinates of the hit
+func (tm *TriangleMesh) intersectTriangle(triangle int32, ray geometry.Ray, tMin, tMax float64) (float64, float64, float64, bool) {
+	a := tm.Vertices[tm.Indices[3*triangle]]
+	b := tm.Vertices[tm.Indices[3*triangle+1]]
+	c := tm.Vertices[tm.Indices[3*triangle+2]]
+
+	ab := a.To(b)
+	ac := a.To(c)
+	pVector := ray.Direction.Cross(ac)
+	determinant := ab.Dot(pVector)
+	if tm.IsCulled && determinant < 1e-7 {
+		// This ray is parallel to this triangle or back-facing.
+		return 0, 0, 0, false
+	} else if determinant > -1e-7 && determinant < 1e-7 {
+		return 0, 0, 0, false
+	}
+
+	inverseDeterminant := 1.0 / determinant
+
+	tVector := a.To(ray.Origin)
+	u := inverseDeterminant * (tVector.Dot(pVector))
+	if u < 0.0 || u > 1.0 {
+		return 0, 0, 0, false
+	}
+
+	qVector := tVector.Cross(ab)
+	v := inverseDeterminant * (ray.Direction.Dot(qVector))
+	if v < 0.0 || u+v > 1.0 {
+		return 0, 0, 0, false
+	}
+
+	t := inverseDeterminant * (ac.Dot(qVector))
+	if t < tMin || t > tMax {
+		return 0, 0, 0, false
+	}
+	return t, u, v, true
+}
+
+// fillRayHit writes the RayHit for a hit on a triangle into rayHit, interpolating its vertex attributes
+func (tm *TriangleMesh) fillRayHit(ray geometry.Ray, triangle int32, t, u, v float64, rayHit *material.RayHit) {
+	w := 1.0 - u - v
+	i := 3 * triangle
+
+	var normal geometry.Vector
+	if len(tm.Normals) > 0 {
+		normal = tm.Normals[tm.NormalIndices[i]].MultScalar(w).Add(
+			tm.Normals[tm.NormalIndices[i+1]].MultScalar(u)).Add(
+			tm.Normals[tm.NormalIndices[i+2]].MultScalar(v)).Unit()
+	} else {
+		normal = tm.faceNormal(triangle)
+	}
+
+	textureU, textureV := 0.0, 0.0
+	if len(tm.UVs) > 0 {
+		uvA := tm.UVs[tm.UVIndices[i]]
+		uvB := tm.UVs[tm.UVIndices[i+1]]
+		uvC := tm.UVs[tm.UVIndices[i+2]]
+		textureU = wrap(w*uvA[0] + u*uvB[0] + v*uvC[0])
+		textureV = wrap(w*uvA[1] + u*uvB[1] + v*uvC[1])
+	}
+
+	mat := tm.mat
+	if len(tm.FaceMaterials) > 0 && tm.FaceMaterials[triangle] >= 0 {
+		mat = tm.Materials[tm.FaceMaterials[triangle]]
+	}
+
+	*rayHit = material.RayHit{
+		Ray:         ray,
+		NormalAtHit: normal,
+		Time:        t,
+		U:           textureU,
+		V:           textureV,
+		Triangle:    int(triangle),
+		Barycentric: [2]float64{u, v},
+		Material:    mat,
+	}
+}
+
+// faceNormal returns the unit geometric normal of a triangle
+func (tm *TriangleMesh) faceNormal(triangle int32) geometry.Vector {
+	a := tm.Vertices[tm.Indices[3*triangle]]
+	b := tm.Vertices[tm.Indices[3*triangle+1]]
+	c := tm.Vertices[tm.Indices[3*triangle+2]]
+	return a.To(b).Cross(a.To(c)).Unit()
+}
+
+// computeVertexNormals fills Normals with area-weighted averages of the normals of the triangles around each vertex
+func (tm *TriangleMesh) computeVertexNormals() {
+	tm.Normals = make([]geometry.Vector, len(tm.Vertices))
+	for i := 0; i < len(tm.Indices); i += 3 {
+		a := tm.Vertices[tm.Indices[i]]
+		b := tm.Vertices[tm.Indices[i+1]]
+		c := tm.Vertices[tm.Indices[i+2]]
+		// the cross product's length is twice the triangle's area
+		n := a.To(b).Cross(a.To(c))
+		for j := 0; j < 3; j++ {
+			tm.Normals[tm.Indices[i+j]] = tm.Normals[tm.Indices[i+j]].Add(n)
+		}
+	}
+	for i, n := range tm.Normals {
+		if n.Magnitude() > 0.0 {
+			tm.Normals[i] = n.Unit()
+		}
+	}
+	tm.NormalIndices = tm.Indices
+}
+
+// checkIndices ensures every index is within the bounds of a buffer of a given size
+func checkIndices(indices []int, size int, name string) error {
+	for _, index := range indices {
+		if index < 0 || index >= size {
+			return fmt.Errorf("triangle mesh %s index (%d) out of range", name, index)
+		}
+	}
+	return nil
+}
+
+// wrap maps a texture coordinate into [0, 1) so that textures repeat
+func wrap(x float64) float64 {
+	return x - math.Floor(x)
+}
+
+// Unit returns a unit square on the XY plane made of two triangles, facing positive Z
+func Unit(xOffset, yOffset, zOffset float64) *TriangleMesh {
+	tm, _ := (&TriangleMesh{
+		Vertices: []geometry.Point{
+			{X: 0.0 + xOffset, Y: 0.0 + yOffset, Z: 0.0 + zOffset},
+			{X: 1.0 + xOffset, Y: 0.0 + yOffset, Z: 0.0 + zOffset},
+			{X: 1.0 + xOffset, Y: 1.0 + yOffset, Z: 0.0 + zOffset},
+			{X: 0.0 + xOffset, Y: 1.0 + yOffset, Z: 0.0 + zOffset},
+		},
+		UVs: [][2]float64{
+			{0.0, 0.0},
+			{1.0, 0.0},
+			{1.0, 1.0},
+			{0.0, 1.0},
+		},
+		Indices: []int{0, 1, 2, 0, 2, 3},
+	}).Setup()
+	return tm
+}
@@ -0,0 +1,308 @@
+package trianglemesh
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/shading"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+var tmHit bool
+
+// randomSoup returns a mesh of n small random triangles within the unit cube
+func randomSoup(n int) *TriangleMesh {
+	rng := rand.New(rand.NewSource(0))
+	tm := &TriangleMesh{}
+	for i := 0; i < n; i++ {
+		center := geometry.Point{X: rng.Float64(), Y: rng.Float64(), Z: rng.Float64()}
+		for j := 0; j < 3; j++ {
+			tm.Vertices = append(tm.Vertices, center.AddVector(geometry.Vector{
+				X: (rng.Float64() - 0.5) * 0.05,
+				Y: (rng.Float64() - 0.5) * 0.05,
+				Z: (rng.Float64() - 0.5) * 0.05,
+			}))
+			tm.Indices = append(tm.Indices, 3*i+j)
+		}
+	}
+	tm, _ = tm.Setup()
+	return tm
+}
+
+func TestTriangleMeshIntersectionHit(t *testing.T) {
+	tm := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.75,
+			Y: 0.25,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-1.0) > 1e-9 {
+		t.Errorf("Expected time 1 but got %f\n", rh.Time)
+	}
+	if math.Abs(rh.U-0.75) > 1e-9 || math.Abs(rh.V-0.25) > 1e-9 {
+		t.Errorf("Expected texture coordinates (0.75, 0.25) but got (%f, %f)\n", rh.U, rh.V)
+	}
+	if rh.NormalAtHit != (geometry.Vector{X: 0.0, Y: 0.0, Z: 1.0}) {
+		t.Errorf("Expected normal (0, 0, 1) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func BenchmarkTriangleMeshIntersectionHit(b *testing.B) {
+	tm := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.75,
+			Y: 0.25,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	tmHit = h
+}
+
+func TestTriangleMeshVertexColorsKeepUVs(t *testing.T) {
+	tm := Unit(0.0, 0.0, 0.0)
+	tm.Colors = []shading.Color{
+		{Red: 1.0},
+		{Green: 1.0},
+		{Blue: 1.0},
+		{Red: 1.0, Green: 1.0, Blue: 1.0},
+	}
+	vertexColors, _ := tm.VertexColors()
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.75,
+			Y: 0.25,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.U-0.75) > 1e-9 || math.Abs(rh.V-0.25) > 1e-9 {
+		t.Errorf("Expected texture coordinates (0.75, 0.25) but got (%f, %f)\n", rh.U, rh.V)
+	}
+	// the hit is on the first triangle, weighing its corners by a quarter, a half and a quarter
+	c := vertexColors.VertexValue(rh.Triangle, rh.Barycentric[0], rh.Barycentric[1])
+	expected := shading.Color{Red: 0.25, Green: 0.5, Blue: 0.25}
+	if math.Abs(c.Red-expected.Red) > 1e-9 || math.Abs(c.Green-expected.Green) > 1e-9 || math.Abs(c.Blue-expected.Blue) > 1e-9 {
+		t.Errorf("Expected vertex color %v but got %v\n", expected, c)
+	}
+}
+
+func TestTriangleMeshIntersectionMiss(t *testing.T) {
+	tm := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.5,
+			Y: 0.5,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	_, h := tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func BenchmarkTriangleMeshIntersectionMiss(b *testing.B) {
+	tm := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 1.5,
+			Y: 0.5,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	tmHit = h
+}
+
+func TestTriangleMeshCulledBackface(t *testing.T) {
+	tm := Unit(0.0, 0.0, 0.0)
+	tm.IsCulled = true
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.5,
+			Y: 0.25,
+			Z: -1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: 1.0,
+		},
+	}
+	_, h := tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func TestTriangleMeshComputeNormals(t *testing.T) {
+	// two triangles folded along the Y axis
+	tm, err := (&TriangleMesh{
+		Vertices: []geometry.Point{
+			{X: 0.0, Y: 0.0, Z: 0.0},
+			{X: 0.0, Y: 1.0, Z: 0.0},
+			{X: -1.0, Y: 0.0, Z: -1.0},
+			{X: 1.0, Y: 0.0, Z: -1.0},
+		},
+		Indices:        []int{0, 3, 1, 0, 1, 2},
+		ComputeNormals: true,
+	}).Setup()
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	// the shared edge's normal is the average of both faces
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: 0.5,
+			Z: 1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.NormalAtHit.X) > 1e-9 || math.Abs(rh.NormalAtHit.Z-1.0) > 1e-9 {
+		t.Errorf("Expected normal (0, 0, 1) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func TestTriangleMeshIndexOutOfRange(t *testing.T) {
+	_, err := (&TriangleMesh{
+		Vertices: []geometry.Point{
+			{X: 0.0, Y: 0.0, Z: 0.0},
+			{X: 1.0, Y: 0.0, Z: 0.0},
+		},
+		Indices: []int{0, 1, 2},
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
+
+func TestTriangleMeshMatchesBruteForce(t *testing.T) {
+	tm := randomSoup(2000)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		r := geometry.Ray{
+			Origin: geometry.Point{X: rng.Float64(), Y: rng.Float64(), Z: -1.0},
+			Direction: geometry.Vector{
+				X: rng.Float64() - 0.5,
+				Y: rng.Float64() - 0.5,
+				Z: 1.0,
+			}.Unit(),
+		}
+		expectedT, expectedH := 1.797693134862315708145274237317043567981e+308, false
+		for j := 0; j < tm.TriangleCount(); j++ {
+			t, _, _, ok := tm.intersectTriangle(int32(j), r, 1e-7, expectedT)
+			if ok {
+				expectedT, expectedH = t, true
+			}
+		}
+		rh, h := tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+		if h != expectedH {
+			t.Fatalf("Expected %t but got %t\n", expectedH, h)
+		}
+		if h && rh.Time != expectedT {
+			t.Fatalf("Expected time %f but got %f\n", expectedT, rh.Time)
+		}
+	}
+}
+
+func TestTriangleMeshStats(t *testing.T) {
+	// enough triangles for the build to be shared between workers
+	tm := randomSoup(10000)
+	s := tm.Stats()
+	if s.PrimitiveCount != tm.TriangleCount() || s.NodeCount != len(tm.nodes) {
+		t.Errorf("Expected %d triangles in %d nodes but got %d in %d\n",
+			tm.TriangleCount(), len(tm.nodes), s.PrimitiveCount, s.NodeCount)
+	}
+	covered := 0
+	for size, leaves := range s.LeafSizes {
+		if size > maxLeafSize {
+			t.Errorf("Expected leaves of at most %d triangles but got %d of %d\n", maxLeafSize, leaves, size)
+		}
+		covered += size * leaves
+	}
+	if covered != tm.TriangleCount() {
+		t.Errorf("Expected the leaves to cover %d triangles but got %d\n", tm.TriangleCount(), covered)
+	}
+	seen := make([]bool, tm.TriangleCount())
+	for _, triangle := range tm.triangles {
+		if seen[triangle] {
+			t.Fatalf("Expected each triangle in one leaf but got %d twice\n", triangle)
+		}
+		seen[triangle] = true
+	}
+}
+
+func BenchmarkTriangleMeshIntersectionSoup(b *testing.B) {
+	tm := randomSoup(100000)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.5,
+			Y: 0.5,
+			Z: -1.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: 1.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = tm.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	tmHit = h
+}
@@ -0,0 +1,188 @@
+package uncappedcone
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/aabb"
+	"fluorescence/shading/material"
+	"fmt"
+	"math"
+)
+
+// UncappedCone represents the curved side of a cone from a base circle around A to an apex at B
+// a top radius greater than zero truncates the cone, with a top circle around B instead of an apex
+type UncappedCone struct {
+	A                  geometry.Point  `json:"a"`
+	B                  geometry.Point  `json:"b"`
+	Radius             float64         `json:"radius"`
+	TopRadius          float64         `json:"top_radius"`
+	HasInvertedNormals bool            `json:"has_inverted_normals"`
+	axis, u, w         geometry.Vector // orthonormal basis with the axis from A to B
+	height             float64
+	slope              float64 // change in radius per unit of height
+	mat                material.Material
+}
+
+// Setup sets up an uncapped cone's internal fields
+func (uc *UncappedCone) Setup() (*UncappedCone, error) {
+	if uc.A.To(uc.B).Magnitude() == 0.0 {
+		return nil, fmt.Errorf("uncappedCone length is zero vector")
+	}
+	if uc.Radius < 0.0 || uc.TopRadius < 0.0 {
+		return nil, fmt.Errorf("uncappedCone radius is negative")
+	}
+	if uc.Radius == 0.0 && uc.TopRadius == 0.0 {
+		return nil, fmt.Errorf("uncappedCone radius and top radius are both 0")
+	}
+	uc.height = uc.A.To(uc.B).Magnitude()
+	uc.axis = uc.A.To(uc.B).Unit()
+	uc.u, uc.w = uc.axis.Basis()
+	uc.slope = (uc.TopRadius - uc.Radius) / uc.height
+	return uc, nil
+}
+
+// Intersection computer the intersection of this object and a given ray if it exists
+func (uc *UncappedCone) Intersection(ray geometry.Ray, tMin, tMax float64) (*material.RayHit, bool) {
+	var rayHit material.RayHit
+	if !uc.IntersectionInto(ray, tMin, tMax, &rayHit) {
+		return nil, false
+	}
+	hit := rayHit
+	return &hit, true
+}
+
+// IntersectionInto computes the intersection of this object and a given ray, writing it into rayHit if it exists
+func (uc *UncappedCone) IntersectionInto(ray geometry.Ray, tMin, tMax float64, rayHit *material.RayHit) bool {
+	// in the cone's frame, with the axis as Y, the side is x^2 + z^2 = (radius + slope * y)^2
+	o := uc.local(uc.A.To(ray.Origin))
+	d := uc.local(ray.Direction)
+	radiusAtOrigin := uc.Radius + uc.slope*o.Y
+
+	// terms of the quadratic equation we are solving, with b halved
+	a := d.X*d.X + d.Z*d.Z - uc.slope*uc.slope*d.Y*d.Y
+	b := o.X*d.X + o.Z*d.Z - uc.slope*radiusAtOrigin*d.Y
+	c := o.X*o.X + o.Z*o.Z - radiusAtOrigin*radiusAtOrigin
+
+	var times [2]float64
+	if math.Abs(a) < 1e-12 {
+		// the ray is parallel to the side, and crosses it once
+		if b == 0.0 {
+			return false
+		}
+		times[0] = -c / (2.0 * b)
+		times[1] = times[0]
+	} else {
+		preDiscriminant := b*b - a*c
+		if preDiscriminant <= 0.0 {
+			return false
+		}
+		root := math.Sqrt(preDiscriminant)
+		times[0] = (-b - root) / a
+		times[1] = (-b + root) / a
+		if times[0] > times[1] {
+			times[0], times[1] = times[1], times[0]
+		}
+	}
+	for _, t := range times {
+		if t < tMin || t > tMax {
+			continue
+		}
+		// only the part of the double cone between the two ends
+		y := o.Y + t*d.Y
+		if y < 0.0 || y > uc.height {
+			continue
+		}
+		uc.fillRayHit(ray, t, rayHit)
+		return true
+	}
+	return false
+}
+
+// fillRayHit writes the hit at time t into rayHit
+func (uc *UncappedCone) fillRayHit(ray geometry.Ray, t float64, rayHit *material.RayHit) {
+	p := uc.local(uc.A.To(ray.PointAt(t)))
+	// the gradient of the implicit surface
+	n := geometry.Vector{
+		X: p.X,
+		Y: -uc.slope * (uc.Radius + uc.slope*p.Y),
+		Z: p.Z,
+	}
+	normal := uc.u.MultScalar(n.X).Add(uc.axis.MultScalar(n.Y)).Add(uc.w.MultScalar(n.Z)).Unit()
+	if uc.HasInvertedNormals {
+		normal = normal.Negate()
+	}
+	*rayHit = material.RayHit{
+		Ray:         ray,
+		NormalAtHit: normal,
+		Time:        t,
+		U:           (math.Atan2(p.Z, p.X) + math.Pi) / (2 * math.Pi),
+		V:           p.Y / uc.height,
+		Material:    uc.mat,
+	}
+}
+
+// local returns a world space vector in the cone's frame, with the axis as Y
+func (uc *UncappedCone) local(v geometry.Vector) geometry.Vector {
+	return geometry.Vector{
+		X: v.Dot(uc.u),
+		Y: v.Dot(uc.axis),
+		Z: v.Dot(uc.w),
+	}
+}
+
+// BoundingBox returns an AABB of this object
+func (uc *UncappedCone) BoundingBox(t0, t1 float64) (*aabb.AABB, bool) {
+	return aabb.SurroundingBox(circleBox(uc.A, uc.axis, uc.Radius), circleBox(uc.B, uc.axis, uc.TopRadius)), true
+}
+
+// circleBox returns the box around a circle with a unit normal
+func circleBox(center geometry.Point, normal geometry.Vector, radius float64) *aabb.AABB {
+	extent := geometry.Vector{
+		X: radius*math.Sqrt(1.0-normal.X*normal.X) + 1e-7,
+		Y: radius*math.Sqrt(1.0-normal.Y*normal.Y) + 1e-7,
+		Z: radius*math.Sqrt(1.0-normal.Z*normal.Z) + 1e-7,
+	}
+	return &aabb.AABB{
+		A: center.SubVector(extent),
+		B: center.AddVector(extent),
+	}
+}
+
+// SetMaterial sets this object's material
+func (uc *UncappedCone) SetMaterial(m material.Material) {
+	uc.mat = m
+}
+
+// IsInfinite returns whether this object is infinite
+func (uc *UncappedCone) IsInfinite() bool {
+	return false
+}
+
+// IsClosed returns whether this object is closed
+func (uc *UncappedCone) IsClosed() bool {
+	return false
+}
+
+// Copy returns a shallow copy of this object
+func (uc *UncappedCone) Copy() primitive.Primitive {
+	newUC := *uc
+	return &newUC
+}
+
+// Unit returns an uncapped cone with a base of radius 1 at the origin and its apex at (0, 1, 0)
+func Unit(xOffset, yOffset, zOffset float64) *UncappedCone {
+	uc, _ := (&UncappedCone{
+		A: geometry.Point{
+			X: 0.0 + xOffset,
+			Y: 0.0 + yOffset,
+			Z: 0.0 + zOffset,
+		},
+		B: geometry.Point{
+			X: 0.0 + xOffset,
+			Y: 1.0 + yOffset,
+			Z: 0.0 + zOffset,
+		},
+		Radius: 1.0,
+	}).Setup()
+	return uc
+}
@@ -0,0 +1,175 @@
+package uncappedcone
+
+import (
+	"fluorescence/geometry"
+	"math"
+	"testing"
+)
+
+var ucHit bool
+
+func TestUncappedConeIntersectionHit(t *testing.T) {
+	uc := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.5,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := uc.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-4.5) > 1e-9 {
+		t.Errorf("Expected time 4.5 but got %f\n", rh.Time)
+	}
+	if rh.NormalAtHit.Sub(geometry.Vector{X: -1.0, Y: 1.0}.Unit()).Magnitude() > 1e-9 {
+		t.Errorf("Expected normal (-1, 1, 0) / sqrt(2) but got %v\n", rh.NormalAtHit)
+	}
+}
+
+func BenchmarkUncappedConeIntersectionHit(b *testing.B) {
+	uc := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.5,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = uc.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	ucHit = h
+}
+
+func TestUncappedConeIntersectionInsideHit(t *testing.T) {
+	uc := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: -5.0,
+			Z: 0.2,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 1.0,
+			Z: 0.0,
+		},
+	}
+	rh, h := uc.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	// through the open base to the inside of the side
+	if math.Abs(rh.Time-5.8) > 1e-9 {
+		t.Errorf("Expected time 5.8 but got %f\n", rh.Time)
+	}
+}
+
+func BenchmarkUncappedConeIntersectionInsideHit(b *testing.B) {
+	uc := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.0,
+			Y: -5.0,
+			Z: 0.2,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 1.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = uc.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	ucHit = h
+}
+
+func TestUncappedConeIntersectionNearApexMiss(t *testing.T) {
+	uc := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.9,
+			Z: 0.5,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	_, h := uc.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func BenchmarkUncappedConeIntersectionNearApexMiss(b *testing.B) {
+	uc := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 0.9,
+			Z: 0.5,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	var h bool
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h = uc.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	}
+	ucHit = h
+}
+
+func TestUncappedConeIntersectionOtherNappeMiss(t *testing.T) {
+	uc := Unit(0.0, 0.0, 0.0)
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: -5.0,
+			Y: 1.5,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 1.0,
+			Y: 0.0,
+			Z: 0.0,
+		},
+	}
+	_, h := uc.Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if h {
+		t.Errorf("Expected false (miss) but got %t\n", h)
+	}
+}
+
+func TestUncappedConeNoRadius(t *testing.T) {
+	_, err := (&UncappedCone{
+		A: geometry.Point{},
+		B: geometry.Point{Y: 1.0},
+	}).Setup()
+	if err == nil {
+		t.Errorf("Expected error but got nil\n")
+	}
+}
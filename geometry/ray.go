@@ -1,9 +1,24 @@
 package geometry
 
+import "math"
+
 // Ray defines elements of a parametric ray equation
 type Ray struct {
-	Origin    Point  `json:"origin"`
-	Direction Vector `json:"direction"`
+	Origin    Point   `json:"origin"`
+	Direction Vector  `json:"direction"`
+	Time      float64 `json:"time"` // moment within the camera's shutter interval the ray was cast at
+}
+
+// MotionStart and MotionEnd are the ray times at which animated objects are at their start and end keyframes
+// objects stay at the nearest keyframe for times outside of this interval
+const (
+	MotionStart = 0.0
+	MotionEnd   = 1.0
+)
+
+// MotionFraction returns how far between their start and end keyframes animated objects are at a ray time
+func MotionFraction(time float64) float64 {
+	return math.Max(0.0, math.Min(1.0, (time-MotionStart)/(MotionEnd-MotionStart)))
 }
 
 // RayZero defines the zero ray
@@ -151,6 +151,18 @@ func VectorFromColor(c shading.Color) Vector {
 	return Vector{c.Red, c.Green, c.Blue}
 }
 
+// Basis returns two unit vectors perpendicular to the unit vector w and to each other,
+// so that u, v and w form a right handed orthonormal basis
+func (w Vector) Basis() (Vector, Vector) {
+	a := VectorUp
+	if math.Abs(w.Y) > 0.9 {
+		a = VectorRight
+	}
+	u := a.Cross(w).Unit()
+	v := w.Cross(u)
+	return u, v
+}
+
 // Copy returns a new Vector identical to v
 func (v Vector) Copy() Vector {
 	return Vector{v.X, v.Y, v.Z}
@@ -0,0 +1,116 @@
+package gltf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// component types of accessors
+const (
+	componentByte          = 5120
+	componentUnsignedByte  = 5121
+	componentShort         = 5122
+	componentUnsignedShort = 5123
+	componentUnsignedInt   = 5125
+	componentFloat         = 5126
+)
+
+// componentCounts maps accessor types to their number of components
+var componentCounts = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT2":   4,
+	"MAT3":   9,
+	"MAT4":   16,
+}
+
+// readAccessor returns the elements of an accessor flattened into a slice of count * components values
+// normalized integer components are mapped into [0, 1] or [-1, 1]
+func (d *document) readAccessor(buffers [][]byte, index int) ([]float64, int, error) {
+	if index < 0 || index >= len(d.Accessors) {
+		return nil, 0, fmt.Errorf("accessor (%d) out of range", index)
+	}
+	a := d.Accessors[index]
+	components, ok := componentCounts[a.Type]
+	if !ok {
+		return nil, 0, fmt.Errorf("accessor (%d) type (%s) not supported", index, a.Type)
+	}
+	if len(a.Sparse) > 0 {
+		return nil, 0, fmt.Errorf("accessor (%d) is sparse, which is not supported", index)
+	}
+	values := make([]float64, a.Count*components)
+	if a.BufferView == nil {
+		// accessors without a buffer view are all zeros
+		return values, components, nil
+	}
+	if *a.BufferView < 0 || *a.BufferView >= len(d.BufferViews) {
+		return nil, 0, fmt.Errorf("accessor (%d) buffer view out of range", index)
+	}
+	view := d.BufferViews[*a.BufferView]
+	if view.Buffer < 0 || view.Buffer >= len(buffers) {
+		return nil, 0, fmt.Errorf("buffer view (%d) buffer out of range", *a.BufferView)
+	}
+
+	size := 0
+	switch a.ComponentType {
+	case componentByte, componentUnsignedByte:
+		size = 1
+	case componentShort, componentUnsignedShort:
+		size = 2
+	case componentUnsignedInt, componentFloat:
+		size = 4
+	default:
+		return nil, 0, fmt.Errorf("accessor (%d) component type (%d) not supported", index, a.ComponentType)
+	}
+	stride := view.ByteStride
+	if stride == 0 {
+		stride = size * components
+	}
+	start := view.ByteOffset + a.ByteOffset
+	end := view.ByteOffset + view.ByteLength
+	if a.Count > 0 && start+(a.Count-1)*stride+size*components > end {
+		return nil, 0, fmt.Errorf("accessor (%d) overruns its buffer view", index)
+	}
+	if end > len(buffers[view.Buffer]) {
+		return nil, 0, fmt.Errorf("buffer view (%d) overruns its buffer", *a.BufferView)
+	}
+	data := buffers[view.Buffer]
+
+	for i := 0; i < a.Count; i++ {
+		for j := 0; j < components; j++ {
+			b := data[start+i*stride+j*size:]
+			var v float64
+			switch a.ComponentType {
+			case componentByte:
+				v = float64(int8(b[0]))
+				if a.Normalized {
+					v = math.Max(v/127.0, -1.0)
+				}
+			case componentUnsignedByte:
+				v = float64(b[0])
+				if a.Normalized {
+					v /= 255.0
+				}
+			case componentShort:
+				v = float64(int16(binary.LittleEndian.Uint16(b)))
+				if a.Normalized {
+					v = math.Max(v/32767.0, -1.0)
+				}
+			case componentUnsignedShort:
+				v = float64(binary.LittleEndian.Uint16(b))
+				if a.Normalized {
+					v /= 65535.0
+				}
+			case componentUnsignedInt:
+				v = float64(binary.LittleEndian.Uint32(b))
+			case componentFloat:
+				v = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+			}
+			values[i*components+j] = v
+		}
+	}
+	return values, components, nil
+}
@@ -0,0 +1,242 @@
+package gltf
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// document is the subset of the glTF 2.0 JSON schema that we import
+type document struct {
+	Scene       *int           `json:"scene"`
+	Scenes      []scene        `json:"scenes"`
+	Nodes       []node         `json:"nodes"`
+	Meshes      []mesh         `json:"meshes"`
+	Accessors   []accessor     `json:"accessors"`
+	BufferViews []bufferView   `json:"bufferViews"`
+	Buffers     []buffer       `json:"buffers"`
+	Materials   []gltfMaterial `json:"materials"`
+	Textures    []gltfTexture  `json:"textures"`
+	Images      []gltfImage    `json:"images"`
+	Cameras     []camera       `json:"cameras"`
+	Extensions  struct {
+		LightsPunctual struct {
+			Lights []light `json:"lights"`
+		} `json:"KHR_lights_punctual"`
+	} `json:"extensions"`
+}
+
+type scene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type node struct {
+	Name        string    `json:"name"`
+	Children    []int     `json:"children"`
+	Mesh        *int      `json:"mesh"`
+	Camera      *int      `json:"camera"`
+	Matrix      []float64 `json:"matrix"`
+	Translation []float64 `json:"translation"`
+	Rotation    []float64 `json:"rotation"` // quaternion as x, y, z, w
+	Scale       []float64 `json:"scale"`
+	Extensions  struct {
+		LightsPunctual *struct {
+			Light int `json:"light"`
+		} `json:"KHR_lights_punctual"`
+	} `json:"extensions"`
+}
+
+type mesh struct {
+	Name       string          `json:"name"`
+	Primitives []meshPrimitive `json:"primitives"`
+}
+
+type meshPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices"`
+	Material   *int           `json:"material"`
+	Mode       *int           `json:"mode"`
+}
+
+type accessor struct {
+	BufferView    *int            `json:"bufferView"`
+	ByteOffset    int             `json:"byteOffset"`
+	ComponentType int             `json:"componentType"`
+	Normalized    bool            `json:"normalized"`
+	Count         int             `json:"count"`
+	Type          string          `json:"type"`
+	Sparse        json.RawMessage `json:"sparse"`
+}
+
+type bufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type buffer struct {
+	URI        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+}
+
+type textureInfo struct {
+	Index    int `json:"index"`
+	TexCoord int `json:"texCoord"`
+}
+
+type gltfMaterial struct {
+	Name                 string `json:"name"`
+	PBRMetallicRoughness struct {
+		BaseColorFactor          []float64    `json:"baseColorFactor"`
+		BaseColorTexture         *textureInfo `json:"baseColorTexture"`
+		MetallicFactor           *float64     `json:"metallicFactor"`
+		RoughnessFactor          *float64     `json:"roughnessFactor"`
+		MetallicRoughnessTexture *textureInfo `json:"metallicRoughnessTexture"`
+	} `json:"pbrMetallicRoughness"`
+	NormalTexture    *textureInfo `json:"normalTexture"`
+	OcclusionTexture *textureInfo `json:"occlusionTexture"`
+	EmissiveFactor   []float64    `json:"emissiveFactor"`
+	EmissiveTexture  *textureInfo `json:"emissiveTexture"`
+	Extensions       struct {
+		EmissiveStrength *struct {
+			EmissiveStrength float64 `json:"emissiveStrength"`
+		} `json:"KHR_materials_emissive_strength"`
+		Transmission *struct {
+			TransmissionFactor float64 `json:"transmissionFactor"`
+		} `json:"KHR_materials_transmission"`
+		IOR *struct {
+			IOR float64 `json:"ior"`
+		} `json:"KHR_materials_ior"`
+	} `json:"extensions"`
+}
+
+type gltfTexture struct {
+	Source *int `json:"source"`
+}
+
+type gltfImage struct {
+	URI        string `json:"uri"`
+	BufferView *int   `json:"bufferView"`
+	MimeType   string `json:"mimeType"`
+}
+
+type camera struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Perspective *struct {
+		AspectRatio float64 `json:"aspectRatio"`
+		YFOV        float64 `json:"yfov"`
+	} `json:"perspective"`
+}
+
+type light struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Color     []float64 `json:"color"`
+	Intensity *float64  `json:"intensity"`
+}
+
+// glbMagic, glbJSONChunk and glbBINChunk identify the parts of a binary glTF file
+const (
+	glbMagic     = 0x46546c67
+	glbJSONChunk = 0x4e4f534a
+	glbBINChunk  = 0x004e4942
+)
+
+// readDocument parses a .gltf or .glb file and loads all of its buffers
+func readDocument(fileName string) (*document, [][]byte, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jsonData := data
+	var binChunk []byte
+	if len(data) >= 12 && binary.LittleEndian.Uint32(data) == glbMagic {
+		jsonData, binChunk, err = splitGLB(data)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var doc document
+	err = json.Unmarshal(jsonData, &doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	directory := filepath.Dir(fileName)
+	buffers := make([][]byte, len(doc.Buffers))
+	for i, b := range doc.Buffers {
+		if b.URI == "" {
+			// the first buffer of a .glb without a uri refers to the BIN chunk
+			if i != 0 || binChunk == nil {
+				return nil, nil, fmt.Errorf("buffer (%d) has no uri", i)
+			}
+			buffers[i] = binChunk
+		} else {
+			buffers[i], err = readURI(b.URI, directory)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(buffers[i]) < b.ByteLength {
+			return nil, nil, fmt.Errorf("buffer (%d) is shorter than its byteLength", i)
+		}
+	}
+	return &doc, buffers, nil
+}
+
+// splitGLB returns the JSON and BIN chunks of a binary glTF file
+func splitGLB(data []byte) ([]byte, []byte, error) {
+	version := binary.LittleEndian.Uint32(data[4:])
+	if version != 2 {
+		return nil, nil, fmt.Errorf("glb version (%d) not supported", version)
+	}
+	length := int(binary.LittleEndian.Uint32(data[8:]))
+	if length > len(data) {
+		return nil, nil, fmt.Errorf("glb is truncated")
+	}
+	var jsonChunk, binChunk []byte
+	for offset := 12; offset+8 <= length; {
+		chunkLength := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4:])
+		start := offset + 8
+		if start+chunkLength > length {
+			return nil, nil, fmt.Errorf("glb chunk is truncated")
+		}
+		switch chunkType {
+		case glbJSONChunk:
+			jsonChunk = data[start : start+chunkLength]
+		case glbBINChunk:
+			binChunk = data[start : start+chunkLength]
+		}
+		offset = start + chunkLength
+	}
+	if jsonChunk == nil {
+		return nil, nil, fmt.Errorf("glb has no json chunk")
+	}
+	return jsonChunk, binChunk, nil
+}
+
+// readURI reads an embedded base64 data uri or a file relative to directory
+func readURI(uri, directory string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		comma := strings.Index(uri, ",")
+		if comma < 0 || !strings.HasSuffix(uri[:comma], ";base64") {
+			return nil, fmt.Errorf("data uri is not base64")
+		}
+		return base64.StdEncoding.DecodeString(uri[comma+1:])
+	}
+	path, err := url.PathUnescape(uri)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath.Join(directory, filepath.FromSlash(path)))
+}
@@ -0,0 +1,411 @@
+// Package gltf imports glTF 2.0 scenes (.gltf and .glb) as primitives, materials and cameras
+package gltf
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/sphere"
+	"fluorescence/geometry/primitive/trianglemesh"
+	"fluorescence/shading"
+	"fluorescence/shading/material"
+	"fluorescence/shading/texture"
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Options holds information about how a glTF file is imported
+type Options struct {
+	FileName            string  `json:"file_name"`             // path to the .gltf or .glb file
+	TextureGamma        float64 `json:"texture_gamma"`         // counter-gamma correction for color textures
+	LightRadius         float64 `json:"light_radius"`          // radius of the spheres that stand in for punctual lights
+	LightIntensityScale float64 `json:"light_intensity_scale"` // factor converting light intensities from candela into scene units
+}
+
+// Scene is the result of importing a glTF file
+type Scene struct {
+	Objects []primitive.Primitive // every mesh primitive and light, with materials set and node transforms applied
+	Cameras []Camera              // every camera in the node hierarchy
+	Skipped []string              // descriptions of content that could not be imported
+}
+
+// Camera is a perspective camera placed by the node hierarchy
+type Camera struct {
+	Name           string
+	EyeLocation    geometry.Point
+	TargetLocation geometry.Point
+	UpVector       geometry.Vector
+	VerticalFOV    float64 // in degrees
+}
+
+// loader holds the state of a single import
+type loader struct {
+	fileName  string
+	options   Options
+	doc       *document
+	buffers   [][]byte
+	materials map[int]material.Material
+	images    map[int]*texture.Image
+	scene     *Scene
+}
+
+// modes of mesh primitives
+const (
+	modeTriangles     = 4
+	modeTriangleStrip = 5
+	modeTriangleFan   = 6
+)
+
+// Load imports the default scene of a glTF file
+func Load(options Options) (*Scene, error) {
+	if options.TextureGamma == 0.0 {
+		options.TextureGamma = 2.2
+	}
+	if options.LightRadius == 0.0 {
+		options.LightRadius = 0.05
+	}
+	if options.LightIntensityScale == 0.0 {
+		options.LightIntensityScale = 1.0
+	}
+	doc, buffers, err := readDocument(options.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("gltf (%s): %s", options.FileName, err.Error())
+	}
+	l := &loader{
+		fileName:  options.FileName,
+		options:   options,
+		doc:       doc,
+		buffers:   buffers,
+		materials: map[int]material.Material{},
+		images:    map[int]*texture.Image{},
+		scene:     &Scene{},
+	}
+
+	var roots []int
+	if doc.Scene != nil && *doc.Scene >= 0 && *doc.Scene < len(doc.Scenes) {
+		roots = doc.Scenes[*doc.Scene].Nodes
+	} else if len(doc.Scenes) > 0 {
+		roots = doc.Scenes[0].Nodes
+	} else {
+		// without scenes, every node that is nobody's child is a root
+		isChild := make([]bool, len(doc.Nodes))
+		for _, n := range doc.Nodes {
+			for _, c := range n.Children {
+				if c >= 0 && c < len(isChild) {
+					isChild[c] = true
+				}
+			}
+		}
+		for i := range doc.Nodes {
+			if !isChild[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+
+	visited := make([]bool, len(doc.Nodes))
+	for _, root := range roots {
+		err = l.visit(root, mgl64.Ident4(), visited)
+		if err != nil {
+			return nil, fmt.Errorf("gltf (%s): %s", options.FileName, err.Error())
+		}
+	}
+	return l.scene, nil
+}
+
+// visit imports a node and its descendants given the transform of its parent
+func (l *loader) visit(index int, parent mgl64.Mat4, visited []bool) error {
+	if index < 0 || index >= len(l.doc.Nodes) {
+		return fmt.Errorf("node (%d) out of range", index)
+	}
+	if visited[index] {
+		return fmt.Errorf("node (%d) appears more than once in the hierarchy", index)
+	}
+	visited[index] = true
+	n := &l.doc.Nodes[index]
+	transform := parent.Mul4(n.localTransform())
+
+	if n.Mesh != nil {
+		err := l.importMesh(*n.Mesh, transform)
+		if err != nil {
+			return err
+		}
+	}
+	if n.Camera != nil {
+		err := l.importCamera(*n.Camera, n.Name, transform)
+		if err != nil {
+			return err
+		}
+	}
+	if n.Extensions.LightsPunctual != nil {
+		err := l.importLight(n.Extensions.LightsPunctual.Light, transform)
+		if err != nil {
+			return err
+		}
+	}
+	for _, child := range n.Children {
+		err := l.visit(child, transform, visited)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localTransform returns the node's matrix, or its translation * rotation * scale
+func (n *node) localTransform() mgl64.Mat4 {
+	if len(n.Matrix) == 16 {
+		// both glTF and mathgl matrices are column-major
+		var m mgl64.Mat4
+		copy(m[:], n.Matrix)
+		return m
+	}
+	transform := mgl64.Ident4()
+	if len(n.Translation) == 3 {
+		transform = transform.Mul4(mgl64.Translate3D(n.Translation[0], n.Translation[1], n.Translation[2]))
+	}
+	if len(n.Rotation) == 4 {
+		rotation := mgl64.Quat{
+			W: n.Rotation[3],
+			V: mgl64.Vec3{n.Rotation[0], n.Rotation[1], n.Rotation[2]},
+		}
+		transform = transform.Mul4(rotation.Normalize().Mat4())
+	}
+	if len(n.Scale) == 3 {
+		transform = transform.Mul4(mgl64.Scale3D(n.Scale[0], n.Scale[1], n.Scale[2]))
+	}
+	return transform
+}
+
+// importMesh adds a TriangleMesh for each triangle primitive of a mesh, baking the node's transform into its vertices
+func (l *loader) importMesh(meshIndex int, transform mgl64.Mat4) error {
+	if meshIndex < 0 || meshIndex >= len(l.doc.Meshes) {
+		return fmt.Errorf("mesh (%d) out of range", meshIndex)
+	}
+	m := &l.doc.Meshes[meshIndex]
+	normalTransform := transform.Mat3().Inv().Transpose()
+	// mirroring transforms flip the winding of triangles
+	flipWinding := transform.Mat3().Det() < 0.0
+
+	for i, p := range m.Primitives {
+		mode := modeTriangles
+		if p.Mode != nil {
+			mode = *p.Mode
+		}
+		if mode != modeTriangles && mode != modeTriangleStrip && mode != modeTriangleFan {
+			l.scene.Skipped = append(l.scene.Skipped, fmt.Sprintf("mesh (%s) primitive %d: mode %d is not triangles", m.Name, i, mode))
+			continue
+		}
+		positionAccessor, ok := p.Attributes["POSITION"]
+		if !ok {
+			return fmt.Errorf("mesh (%s) primitive %d has no positions", m.Name, i)
+		}
+
+		positions, components, err := l.doc.readAccessor(l.buffers, positionAccessor)
+		if err != nil {
+			return err
+		}
+		if components != 3 {
+			return fmt.Errorf("mesh (%s) primitive %d positions are not 3D", m.Name, i)
+		}
+		tm := &trianglemesh.TriangleMesh{}
+		for j := 0; j < len(positions); j += 3 {
+			v := transform.Mul4x1(mgl64.Vec4{positions[j], positions[j+1], positions[j+2], 1.0})
+			tm.Vertices = append(tm.Vertices, geometry.Point{X: v[0], Y: v[1], Z: v[2]})
+		}
+
+		// without normals glTF asks for flat shading, which is what TriangleMesh does when it has none
+		if normalAccessor, ok := p.Attributes["NORMAL"]; ok {
+			normals, components, err := l.doc.readAccessor(l.buffers, normalAccessor)
+			if err != nil {
+				return err
+			}
+			if components != 3 || len(normals) != len(positions) {
+				return fmt.Errorf("mesh (%s) primitive %d normals do not match positions", m.Name, i)
+			}
+			for j := 0; j < len(normals); j += 3 {
+				n := normalTransform.Mul3x1(mgl64.Vec3{normals[j], normals[j+1], normals[j+2]})
+				normal := geometry.Vector{X: n[0], Y: n[1], Z: n[2]}
+				if normal.Magnitude() > 0.0 {
+					normal = normal.Unit()
+				}
+				tm.Normals = append(tm.Normals, normal)
+			}
+		}
+
+		if uvAccessor, ok := p.Attributes["TEXCOORD_0"]; ok {
+			uvs, components, err := l.doc.readAccessor(l.buffers, uvAccessor)
+			if err != nil {
+				return err
+			}
+			if components != 2 || len(uvs)/2 != len(tm.Vertices) {
+				return fmt.Errorf("mesh (%s) primitive %d texture coordinates do not match positions", m.Name, i)
+			}
+			for j := 0; j < len(uvs); j += 2 {
+				// glTF's texture origin is the top left, while ours is the bottom left
+				tm.UVs = append(tm.UVs, [2]float64{uvs[j], 1.0 - uvs[j+1]})
+			}
+		}
+
+		var indices []int
+		if p.Indices != nil {
+			values, components, err := l.doc.readAccessor(l.buffers, *p.Indices)
+			if err != nil {
+				return err
+			}
+			if components != 1 {
+				return fmt.Errorf("mesh (%s) primitive %d indices are not scalars", m.Name, i)
+			}
+			indices = make([]int, len(values))
+			for j, v := range values {
+				indices[j] = int(v)
+			}
+		} else {
+			indices = make([]int, len(tm.Vertices))
+			for j := range indices {
+				indices[j] = j
+			}
+		}
+		tm.Indices = triangulate(indices, mode, flipWinding)
+		if len(tm.Indices) == 0 {
+			l.scene.Skipped = append(l.scene.Skipped, fmt.Sprintf("mesh (%s) primitive %d has no triangles", m.Name, i))
+			continue
+		}
+
+		tm, err = tm.Setup()
+		if err != nil {
+			return fmt.Errorf("mesh (%s) primitive %d: %s", m.Name, i, err.Error())
+		}
+		mat, err := l.material(p.Material)
+		if err != nil {
+			return err
+		}
+		tm.SetMaterial(mat)
+		l.scene.Objects = append(l.scene.Objects, tm)
+	}
+	return nil
+}
+
+// triangulate converts strip and fan indices into a triangle list, optionally reversing the winding of each triangle
+func triangulate(indices []int, mode int, flipWinding bool) []int {
+	var triangles []int
+	add := func(a, b, c int) {
+		if a == b || b == c || a == c {
+			return
+		}
+		if flipWinding {
+			b, c = c, b
+		}
+		triangles = append(triangles, a, b, c)
+	}
+	switch mode {
+	case modeTriangleStrip:
+		for i := 0; i+2 < len(indices); i++ {
+			if i%2 == 0 {
+				add(indices[i], indices[i+1], indices[i+2])
+			} else {
+				add(indices[i+1], indices[i], indices[i+2])
+			}
+		}
+	case modeTriangleFan:
+		for i := 1; i+1 < len(indices); i++ {
+			add(indices[0], indices[i], indices[i+1])
+		}
+	default:
+		for i := 0; i+2 < len(indices); i += 3 {
+			add(indices[i], indices[i+1], indices[i+2])
+		}
+	}
+	return triangles
+}
+
+// material returns the converted material at index, converting each material once
+func (l *loader) material(index *int) (material.Material, error) {
+	if index == nil {
+		return defaultMaterial(), nil
+	}
+	if m, ok := l.materials[*index]; ok {
+		return m, nil
+	}
+	if *index < 0 || *index >= len(l.doc.Materials) {
+		return nil, fmt.Errorf("material (%d) out of range", *index)
+	}
+	m, err := l.toMaterial(&l.doc.Materials[*index])
+	if err != nil {
+		return nil, fmt.Errorf("material (%s): %s", l.doc.Materials[*index].Name, err.Error())
+	}
+	l.materials[*index] = m
+	return m, nil
+}
+
+// importCamera adds a perspective camera looking down the node's negative Z axis
+func (l *loader) importCamera(cameraIndex int, nodeName string, transform mgl64.Mat4) error {
+	if cameraIndex < 0 || cameraIndex >= len(l.doc.Cameras) {
+		return fmt.Errorf("camera (%d) out of range", cameraIndex)
+	}
+	c := &l.doc.Cameras[cameraIndex]
+	name := c.Name
+	if name == "" {
+		name = nodeName
+	}
+	if c.Type != "perspective" || c.Perspective == nil {
+		l.scene.Skipped = append(l.scene.Skipped, fmt.Sprintf("camera (%s): type %s is not perspective", name, c.Type))
+		return nil
+	}
+	eye := transform.Mul4x1(mgl64.Vec4{0.0, 0.0, 0.0, 1.0})
+	target := transform.Mul4x1(mgl64.Vec4{0.0, 0.0, -1.0, 1.0})
+	up := transform.Mul4x1(mgl64.Vec4{0.0, 1.0, 0.0, 0.0})
+	l.scene.Cameras = append(l.scene.Cameras, Camera{
+		Name:           name,
+		EyeLocation:    geometry.Point{X: eye[0], Y: eye[1], Z: eye[2]},
+		TargetLocation: geometry.Point{X: target[0], Y: target[1], Z: target[2]},
+		UpVector:       geometry.Vector{X: up[0], Y: up[1], Z: up[2]}.Unit(),
+		VerticalFOV:    mgl64.RadToDeg(c.Perspective.YFOV),
+	})
+	return nil
+}
+
+// importLight adds a small emissive sphere in place of a point or spot light
+// spot lights lose their cone, and directional lights cannot be represented by geometry and are skipped
+func (l *loader) importLight(lightIndex int, transform mgl64.Mat4) error {
+	lights := l.doc.Extensions.LightsPunctual.Lights
+	if lightIndex < 0 || lightIndex >= len(lights) {
+		return fmt.Errorf("light (%d) out of range", lightIndex)
+	}
+	li := &lights[lightIndex]
+	if li.Type != "point" && li.Type != "spot" {
+		l.scene.Skipped = append(l.scene.Skipped, fmt.Sprintf("light (%s): type %s is not supported", li.Name, li.Type))
+		return nil
+	}
+	if li.Type == "spot" {
+		l.scene.Skipped = append(l.scene.Skipped, fmt.Sprintf("light (%s): spot cone ignored", li.Name))
+	}
+
+	color := shading.Color{Red: 1.0, Green: 1.0, Blue: 1.0}
+	if len(li.Color) >= 3 {
+		color = shading.Color{Red: li.Color[0], Green: li.Color[1], Blue: li.Color[2]}
+	}
+	intensity := 1.0
+	if li.Intensity != nil {
+		intensity = *li.Intensity
+	}
+	// a sphere of radius r and radiance L has an intensity of L * pi * r^2 in every direction
+	radius := l.options.LightRadius
+	radiance := intensity * l.options.LightIntensityScale / (math.Pi * radius * radius)
+
+	center := transform.Mul4x1(mgl64.Vec4{0.0, 0.0, 0.0, 1.0})
+	s, err := (&sphere.Sphere{
+		Center: geometry.Point{X: center[0], Y: center[1], Z: center[2]},
+		Radius: radius,
+	}).Setup()
+	if err != nil {
+		return err
+	}
+	s.SetMaterial(&material.Lambertian{
+		ReflectanceTexture: &texture.Color{Color: shading.ColorBlack},
+		EmittanceTexture:   &texture.Color{Color: color.MultScalar(radiance)},
+	})
+	l.scene.Objects = append(l.scene.Objects, s)
+	return nil
+}
@@ -0,0 +1,215 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fluorescence/geometry"
+	"fluorescence/shading"
+	"fluorescence/shading/material"
+	"fluorescence/shading/texture"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// triangleGLTF returns a glTF document with a unit right triangle translated by (0, 0, -2),
+// a metallic material, and a camera at the origin
+func triangleGLTF() string {
+	var buffer bytes.Buffer
+	for _, v := range []float32{0, 0, 0, 1, 0, 0, 0, 1, 0} {
+		binary.Write(&buffer, binary.LittleEndian, v)
+	}
+	for _, i := range []uint16{0, 1, 2} {
+		binary.Write(&buffer, binary.LittleEndian, i)
+	}
+	uri := "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes())
+	return fmt.Sprintf(`{
+	"asset": {"version": "2.0"},
+	"scene": 0,
+	"scenes": [{"nodes": [0, 1]}],
+	"nodes": [
+		{"mesh": 0, "translation": [0, 0, -2]},
+		{"camera": 0, "name": "main"}
+	],
+	"meshes": [{"primitives": [{"attributes": {"POSITION": 0}, "indices": 1, "material": 0}]}],
+	"materials": [{"pbrMetallicRoughness": {"baseColorFactor": [0.5, 0.5, 0.5, 1], "metallicFactor": 1, "roughnessFactor": 0.2}}],
+	"cameras": [{"type": "perspective", "perspective": {"yfov": 0.7853981633974483, "znear": 0.01}}],
+	"accessors": [
+		{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+		{"bufferView": 1, "componentType": 5123, "count": 3, "type": "SCALAR"}
+	],
+	"bufferViews": [
+		{"buffer": 0, "byteOffset": 0, "byteLength": 36},
+		{"buffer": 0, "byteOffset": 36, "byteLength": 6}
+	],
+	"buffers": [{"uri": "%s", "byteLength": 42}]
+}`, uri)
+}
+
+func loadTriangle(t *testing.T) *Scene {
+	fileName := filepath.Join(t.TempDir(), "triangle.gltf")
+	err := ioutil.WriteFile(fileName, []byte(triangleGLTF()), 0644)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	s, err := Load(Options{FileName: fileName})
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	return s
+}
+
+func TestLoadAppliesNodeTransform(t *testing.T) {
+	s := loadTriangle(t)
+	if len(s.Objects) != 1 {
+		t.Fatalf("Expected 1 object but got %d\n", len(s.Objects))
+	}
+	r := geometry.Ray{
+		Origin: geometry.Point{
+			X: 0.25,
+			Y: 0.25,
+			Z: 0.0,
+		},
+		Direction: geometry.Vector{
+			X: 0.0,
+			Y: 0.0,
+			Z: -1.0,
+		},
+	}
+	rh, h := s.Objects[0].Intersection(r, 1e-7, 1.797693134862315708145274237317043567981e+308)
+	if !h {
+		t.Fatalf("Expected true (hit) but got %t\n", h)
+	}
+	if math.Abs(rh.Time-2.0) > 1e-9 {
+		t.Errorf("Expected time 2 but got %f\n", rh.Time)
+	}
+	if got := fmt.Sprintf("%T", rh.Material); got != "*material.Metal" {
+		t.Errorf("Expected *material.Metal but got %s\n", got)
+	}
+}
+
+func TestLoadCamera(t *testing.T) {
+	s := loadTriangle(t)
+	if len(s.Cameras) != 1 {
+		t.Fatalf("Expected 1 camera but got %d\n", len(s.Cameras))
+	}
+	c := s.Cameras[0]
+	if c.Name != "main" {
+		t.Errorf("Expected camera name main but got %s\n", c.Name)
+	}
+	if c.TargetLocation != (geometry.Point{X: 0.0, Y: 0.0, Z: -1.0}) {
+		t.Errorf("Expected target (0, 0, -1) but got %v\n", c.TargetLocation)
+	}
+	if math.Abs(c.VerticalFOV-45.0) > 1e-9 {
+		t.Errorf("Expected vertical fov 45 but got %f\n", c.VerticalFOV)
+	}
+}
+
+func TestLoadGLB(t *testing.T) {
+	jsonChunk := []byte(triangleGLTF())
+	for len(jsonChunk)%4 != 0 {
+		jsonChunk = append(jsonChunk, ' ')
+	}
+	var glb bytes.Buffer
+	binary.Write(&glb, binary.LittleEndian, []uint32{glbMagic, 2, uint32(12 + 8 + len(jsonChunk))})
+	binary.Write(&glb, binary.LittleEndian, []uint32{uint32(len(jsonChunk)), glbJSONChunk})
+	glb.Write(jsonChunk)
+
+	fileName := filepath.Join(t.TempDir(), "triangle.glb")
+	err := ioutil.WriteFile(fileName, glb.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	s, err := Load(Options{FileName: fileName})
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	if len(s.Objects) != 1 {
+		t.Errorf("Expected 1 object but got %d\n", len(s.Objects))
+	}
+}
+
+func TestTriangulateStrip(t *testing.T) {
+	triangles := triangulate([]int{0, 1, 2, 3}, modeTriangleStrip, false)
+	expected := []int{0, 1, 2, 2, 1, 3}
+	if fmt.Sprint(triangles) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v but got %v\n", expected, triangles)
+	}
+}
+
+// metallicRoughnessPNG returns a data URI of a 4 by 1 metallic-roughness texture,
+// smooth metal, then rough metal, then two texels of rough dielectric
+func metallicRoughnessPNG(t *testing.T) string {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.NRGBA{G: 0, B: 255, A: 255})
+	img.Set(1, 0, color.NRGBA{G: 255, B: 255, A: 255})
+	img.Set(2, 0, color.NRGBA{G: 255, B: 0, A: 255})
+	img.Set(3, 0, color.NRGBA{G: 255, B: 0, A: 255})
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, img)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes())
+}
+
+func TestMaterialTextures(t *testing.T) {
+	source := 0
+	l := &loader{
+		options: Options{TextureGamma: 2.2},
+		doc: &document{
+			Textures: []gltfTexture{{Source: &source}},
+			Images:   []gltfImage{{URI: metallicRoughnessPNG(t)}},
+		},
+		images: map[int]*texture.Image{},
+		scene:  &Scene{},
+	}
+	var m gltfMaterial
+	m.Name = "rusty"
+	m.PBRMetallicRoughness.RoughnessFactor = new(float64)
+	*m.PBRMetallicRoughness.RoughnessFactor = 0.5
+	m.PBRMetallicRoughness.MetallicRoughnessTexture = &textureInfo{Index: 0}
+	m.NormalTexture = &textureInfo{Index: 0}
+	m.OcclusionTexture = &textureInfo{Index: 0}
+	m.EmissiveFactor = []float64{1.0, 1.0, 1.0}
+	m.EmissiveTexture = &textureInfo{Index: 0, TexCoord: 1}
+
+	mat, err := l.toMaterial(&m)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s\n", err.Error())
+	}
+	// normal and occlusion textures, and textures on a second set of texture coordinates, are reported rather than failing
+	if len(l.scene.Skipped) != 3 {
+		t.Errorf("Expected 3 skipped textures but got %v\n", l.scene.Skipped)
+	}
+	mr, ok := mat.(*metallicRoughness)
+	if !ok {
+		t.Fatalf("Expected *metallicRoughness but got %T\n", mat)
+	}
+	if c := mr.Emittance(material.RayHit{}); c != (shading.Color{Red: 1.0, Green: 1.0, Blue: 1.0}) {
+		t.Errorf("Expected the emissive factor without its texture but got %v\n", c)
+	}
+	for _, c := range []struct {
+		u         float64
+		expected  string
+		fuzziness float64
+	}{
+		{0.1, "material.Metal", 0.0},
+		{0.5, "material.Metal", 0.5},
+		{0.9, "material.Lambertian", 0.0},
+	} {
+		texel := mr.at(c.u, 0.5)
+		if got := fmt.Sprintf("%T", texel); got != c.expected {
+			t.Errorf("Expected %s at u %f but got %s\n", c.expected, c.u, got)
+		}
+		if metal, ok := texel.(material.Metal); ok && math.Abs(metal.Fuzziness-c.fuzziness) > 1e-9 {
+			t.Errorf("Expected fuzziness %f at u %f but got %f\n", c.fuzziness, c.u, metal.Fuzziness)
+		}
+	}
+}
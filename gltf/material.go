@@ -0,0 +1,237 @@
+package gltf
+
+import (
+	"bytes"
+	"fluorescence/geometry"
+	"fluorescence/shading"
+	"fluorescence/shading/material"
+	"fluorescence/shading/texture"
+	"fmt"
+	"image"
+	// register the decoders for the image formats glTF allows
+	_ "image/jpeg"
+	_ "image/png"
+	"math/rand"
+	"path/filepath"
+)
+
+// tinted multiplies the color of a texture by a constant factor, as glTF does with its color factors and textures
+type tinted struct {
+	texture texture.Texture
+	tint    shading.Color
+}
+
+// Value returns the tinted color of the texture at the given texture coordinates
+func (t *tinted) Value(u, v float64) shading.Color {
+	return t.texture.Value(u, v).MultColor(t.tint)
+}
+
+// defaultMaterial is used for primitives without a material
+func defaultMaterial() material.Material {
+	return &material.Lambertian{
+		ReflectanceTexture: &texture.Color{Color: shading.Color{Red: 0.8, Green: 0.8, Blue: 0.8}},
+		EmittanceTexture:   &texture.Color{Color: shading.ColorBlack},
+	}
+}
+
+// metallicRoughness is a material whose metalness and roughness vary over its surface, read from a glTF
+// metallic-roughness texture, scattering like a Metal where it is mostly metallic and like a Lambertian elsewhere
+type metallicRoughness struct {
+	reflectance texture.Texture
+	emittance   texture.Texture
+	texture     texture.Texture // linear texture with roughness in its green channel and metalness in its blue channel
+	metallic    float64         // factors the texture's metalness and roughness are scaled by
+	roughness   float64
+}
+
+// Reflectance returns the reflective color at a hit
+func (mr *metallicRoughness) Reflectance(rayHit material.RayHit) shading.Color {
+	return mr.reflectance.Value(rayHit.U, rayHit.V)
+}
+
+// Emittance returns the emissive color at a hit
+func (mr *metallicRoughness) Emittance(rayHit material.RayHit) shading.Color {
+	return mr.emittance.Value(rayHit.U, rayHit.V)
+}
+
+// IsSpecular returns whether this material is specular in nature (vs. diffuse)
+// This is currently unused and is likely to be deprecated in the future
+func (mr *metallicRoughness) IsSpecular() bool {
+	return false
+}
+
+// Scatter returns an incoming ray given a RayHit representing the outgoing ray
+func (mr *metallicRoughness) Scatter(rayHit material.RayHit, rng *rand.Rand) (geometry.Ray, bool) {
+	return mr.at(rayHit.U, rayHit.V).Scatter(rayHit, rng)
+}
+
+// at returns the material scattering light at texture coordinates (u, v)
+func (mr *metallicRoughness) at(u, v float64) material.Material {
+	c := mr.texture.Value(u, v)
+	if c.Blue*mr.metallic >= 0.5 {
+		return material.Metal{Fuzziness: c.Green * mr.roughness}
+	}
+	return material.Lambertian{}
+}
+
+// toMaterial maps a metallic-roughness material onto the closest of our material types
+// transmissive materials become Dielectrics, mostly metallic materials become Metals with their roughness as fuzziness,
+// and everything else becomes Lambertian
+// a metallic-roughness texture makes that choice, and the fuzziness, at every texel instead
+// normal and occlusion textures are not supported, so they are reported as skipped
+func (l *loader) toMaterial(m *gltfMaterial) (material.Material, error) {
+	if m.NormalTexture != nil {
+		l.skip(m, "normal texture ignored")
+	}
+	if m.OcclusionTexture != nil {
+		l.skip(m, "occlusion texture ignored")
+	}
+	pbr := m.PBRMetallicRoughness
+	baseColor := shading.Color{Red: 1.0, Green: 1.0, Blue: 1.0}
+	if len(pbr.BaseColorFactor) >= 3 {
+		baseColor = shading.Color{Red: pbr.BaseColorFactor[0], Green: pbr.BaseColorFactor[1], Blue: pbr.BaseColorFactor[2]}
+	}
+	reflectance, err := l.texture(m, "base color", baseColor, pbr.BaseColorTexture)
+	if err != nil {
+		return nil, err
+	}
+
+	emissive := shading.ColorBlack
+	if len(m.EmissiveFactor) >= 3 {
+		emissive = shading.Color{Red: m.EmissiveFactor[0], Green: m.EmissiveFactor[1], Blue: m.EmissiveFactor[2]}
+	}
+	if m.Extensions.EmissiveStrength != nil {
+		emissive = emissive.MultScalar(m.Extensions.EmissiveStrength.EmissiveStrength)
+	}
+	emittance, err := l.texture(m, "emissive", emissive, m.EmissiveTexture)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Extensions.Transmission != nil && m.Extensions.Transmission.TransmissionFactor > 0.0 {
+		if pbr.MetallicRoughnessTexture != nil {
+			l.skip(m, "metallic-roughness texture ignored on a transmissive material")
+		}
+		refractiveIndex := 1.5
+		if m.Extensions.IOR != nil && m.Extensions.IOR.IOR > 1.0 {
+			refractiveIndex = m.Extensions.IOR.IOR
+		}
+		return &material.Dielectric{
+			ReflectanceTexture: reflectance,
+			EmittanceTexture:   emittance,
+			RefractiveIndex:    refractiveIndex,
+		}, nil
+	}
+
+	metallic, roughness := 1.0, 1.0
+	if pbr.MetallicFactor != nil {
+		metallic = *pbr.MetallicFactor
+	}
+	if pbr.RoughnessFactor != nil {
+		roughness = *pbr.RoughnessFactor
+	}
+	if info := pbr.MetallicRoughnessTexture; info != nil && l.usable(m, "metallic-roughness", info) {
+		image, err := l.image(info.Index)
+		if err != nil {
+			return nil, err
+		}
+		// metalness and roughness are stored linearly, unlike colors
+		linear := *image
+		linear.Gamma = 1.0
+		return &metallicRoughness{
+			reflectance: reflectance,
+			emittance:   emittance,
+			texture:     &linear,
+			metallic:    metallic,
+			roughness:   roughness,
+		}, nil
+	}
+	if metallic >= 0.5 {
+		return &material.Metal{
+			ReflectanceTexture: reflectance,
+			EmittanceTexture:   emittance,
+			Fuzziness:          roughness,
+		}, nil
+	}
+	return &material.Lambertian{
+		ReflectanceTexture: reflectance,
+		EmittanceTexture:   emittance,
+	}, nil
+}
+
+// texture returns a color texture, or an image texture tinted by the color if a usable texture is referenced
+func (l *loader) texture(m *gltfMaterial, kind string, c shading.Color, info *textureInfo) (texture.Texture, error) {
+	if info == nil || c == shading.ColorBlack || !l.usable(m, kind, info) {
+		return &texture.Color{Color: c}, nil
+	}
+	image, err := l.image(info.Index)
+	if err != nil {
+		return nil, err
+	}
+	if c == (shading.Color{Red: 1.0, Green: 1.0, Blue: 1.0}) {
+		return image, nil
+	}
+	return &tinted{
+		texture: image,
+		tint:    c,
+	}, nil
+}
+
+// usable returns whether a material's texture can be imported, reporting it as skipped if not
+// only the first set of texture coordinates is imported, so textures using another set are left out
+func (l *loader) usable(m *gltfMaterial, kind string, info *textureInfo) bool {
+	if info.TexCoord != 0 {
+		l.skip(m, fmt.Sprintf("%s texture ignored, as it uses texture coordinate set %d", kind, info.TexCoord))
+		return false
+	}
+	return true
+}
+
+// skip reports part of a material as skipped
+func (l *loader) skip(m *gltfMaterial, description string) {
+	l.scene.Skipped = append(l.scene.Skipped, fmt.Sprintf("material (%s): %s", m.Name, description))
+}
+
+// image decodes the image of a texture, caching it so that textures shared between materials are decoded once
+func (l *loader) image(textureIndex int) (*texture.Image, error) {
+	if textureIndex < 0 || textureIndex >= len(l.doc.Textures) || l.doc.Textures[textureIndex].Source == nil {
+		return nil, fmt.Errorf("texture (%d) out of range or has no source", textureIndex)
+	}
+	source := *l.doc.Textures[textureIndex].Source
+	if cached, ok := l.images[source]; ok {
+		return cached, nil
+	}
+	if source < 0 || source >= len(l.doc.Images) {
+		return nil, fmt.Errorf("image (%d) out of range", source)
+	}
+	gltfImage := l.doc.Images[source]
+
+	var data []byte
+	if gltfImage.BufferView != nil {
+		if *gltfImage.BufferView < 0 || *gltfImage.BufferView >= len(l.doc.BufferViews) {
+			return nil, fmt.Errorf("image (%d) buffer view out of range", source)
+		}
+		view := l.doc.BufferViews[*gltfImage.BufferView]
+		if view.Buffer < 0 || view.Buffer >= len(l.buffers) || view.ByteOffset+view.ByteLength > len(l.buffers[view.Buffer]) {
+			return nil, fmt.Errorf("image (%d) buffer view overruns its buffer", source)
+		}
+		data = l.buffers[view.Buffer][view.ByteOffset : view.ByteOffset+view.ByteLength]
+	} else {
+		var err error
+		data, err = readURI(gltfImage.URI, filepath.Dir(l.fileName))
+		if err != nil {
+			return nil, err
+		}
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("image (%d): %s", source, err.Error())
+	}
+	l.images[source] = &texture.Image{
+		FileName:  l.fileName,
+		Gamma:     l.options.TextureGamma,
+		Magnitude: 1.0,
+		Image:     decoded,
+	}
+	return l.images[source], nil
+}
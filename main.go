@@ -1,16 +1,20 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"image"
 	"image/png"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 )
 
 func main() {
+	framesFlag := flag.String("frames", "", "range of animation frames to render, such as 12 or 0-99 (all frames by default)")
+	flag.Parse()
 
 	maxThreads := int64(runtime.NumCPU())
 	fmt.Printf("Max Threads: %d\n", maxThreads)
@@ -30,6 +34,59 @@ func main() {
 		return
 	}
 
+	runtime.LockOSThread()
+
+	// a still scene is rendered to a single image
+	if parameters.Scene.Animation == nil {
+		img := renderImage(parameters, maxThreads)
+		fmt.Printf("Creating image file...\n")
+		file, err := getImageFile(parameters)
+		if err != nil {
+			fmt.Printf("Error creating image file: %s\n", err.Error())
+			return
+		}
+		defer file.Close()
+		err = writeImage(file, img)
+		if err != nil {
+			fmt.Printf("Error encoding to image file: %s\n", err.Error())
+			return
+		}
+		fmt.Printf("Done!\n")
+		return
+	}
+
+	// while an animated one is rendered to a numbered image per frame
+	firstFrame, lastFrame, err := parseFrameRange(*framesFlag, parameters.Scene.Animation.FrameCount)
+	if err != nil {
+		fmt.Printf("Error parsing frame range: %s\n", err.Error())
+		return
+	}
+	for frame := firstFrame; frame <= lastFrame; frame++ {
+		fmt.Printf("Setting up frame %d...\n", frame)
+		err = parameters.Scene.SetFrame(parameters, frame)
+		if err != nil {
+			fmt.Printf("Error setting up frame %d: %s\n", frame, err.Error())
+			return
+		}
+		img := renderImage(parameters, maxThreads)
+		fmt.Printf("Creating image file...\n")
+		file, err := getFrameFile(parameters, frame)
+		if err != nil {
+			fmt.Printf("Error creating image file: %s\n", err.Error())
+			return
+		}
+		err = writeImage(file, img)
+		file.Close()
+		if err != nil {
+			fmt.Printf("Error encoding to image file: %s\n", err.Error())
+			return
+		}
+	}
+	fmt.Printf("Done!\n")
+}
+
+// renderImage traces the scene as it is currently set up into a new image
+func renderImage(parameters *Parameters, maxThreads int64) *image.RGBA64 {
 	// create image
 	fmt.Printf("Creating in-mem image...\n")
 	img := image.NewRGBA64(image.Rect(0, 0, parameters.ImageWidth, parameters.ImageHeight))
@@ -41,8 +98,6 @@ func main() {
 	pixelCount := parameters.ImageWidth * parameters.ImageHeight
 	doneChan := make(chan int, pixelCount)
 
-	runtime.LockOSThread()
-
 	startTime := time.Now()
 	go TraceImage(parameters, img, doneChan, maxThreads)
 
@@ -62,25 +117,36 @@ func main() {
 	// sem.Release(0)
 	totalDuration := time.Since(startTime)
 	fmt.Printf("\tTotal time: %v\n", totalDuration)
+	return img
+}
 
-	// create file
-	fmt.Printf("Creating image file...\n")
-	file, err := getImageFile(parameters)
-	if err != nil {
-		fmt.Printf("Error creating image file: %s\n", err.Error())
-		return
-	}
-	defer file.Close()
-
-	// encode image to file
+// writeImage encodes an image to a file
+func writeImage(file *os.File, img *image.RGBA64) error {
 	fmt.Printf("Writing in-mem image to image file...\n")
-	err = png.Encode(file, img)
+	return png.Encode(file, img)
+}
+
+// parseFrameRange returns the first and last frames of a range such as "12" or "0-99", or every frame if it is empty
+func parseFrameRange(frames string, frameCount int) (int, int, error) {
+	if frames == "" {
+		return 0, frameCount - 1, nil
+	}
+	bounds := strings.SplitN(frames, "-", 2)
+	first, err := strconv.Atoi(bounds[0])
 	if err != nil {
-		fmt.Printf("Error encoding to image file: %s\n", err.Error())
-		return
+		return 0, 0, fmt.Errorf("invalid frame range (%s)", frames)
 	}
-	fmt.Printf("Done!\n")
-	return
+	last := first
+	if len(bounds) == 2 {
+		last, err = strconv.Atoi(bounds[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid frame range (%s)", frames)
+		}
+	}
+	if first < 0 || last >= frameCount || first > last {
+		return 0, 0, fmt.Errorf("frame range (%s) not within animation of %d frames", frames, frameCount)
+	}
+	return first, last, nil
 }
 
 func getImageFile(parameters *Parameters) (*os.File, error) {
@@ -95,3 +161,17 @@ func getImageFile(parameters *Parameters) (*os.File, error) {
 	os.MkdirAll(parameters.FileDirectory, os.ModePerm)
 	return os.Create(filename)
 }
+
+// getFrameFile creates the numbered image file of a frame of an animation
+func getFrameFile(parameters *Parameters, frame int) (*os.File, error) {
+	filename := fmt.Sprintf(
+		"%s%s_v%s_%ds_%04d.%s",
+		parameters.FileDirectory,
+		strings.ReplaceAll(parameters.Scene.Name, " ", "_"),
+		parameters.Version,
+		parameters.SampleCount,
+		frame,
+		parameters.FileType)
+	os.MkdirAll(parameters.FileDirectory, os.ModePerm)
+	return os.Create(filename)
+}
@@ -3,51 +3,74 @@ package main
 import (
 	"encoding/json"
 	"fluorescence/geometry/primitive"
+	"fluorescence/geometry/primitive/bezierpatch"
 	"fluorescence/geometry/primitive/box"
 	"fluorescence/geometry/primitive/bvh"
+	"fluorescence/geometry/primitive/capsule"
+	"fluorescence/geometry/primitive/cone"
+	"fluorescence/geometry/primitive/csg"
+	"fluorescence/geometry/primitive/curve"
 	"fluorescence/geometry/primitive/cylinder"
 	"fluorescence/geometry/primitive/disk"
+	"fluorescence/geometry/primitive/displacement"
+	"fluorescence/geometry/primitive/generator"
+	"fluorescence/geometry/primitive/heightfield"
 	"fluorescence/geometry/primitive/hollowcylinder"
 	"fluorescence/geometry/primitive/hollowdisk"
 	"fluorescence/geometry/primitive/infinitecylinder"
+	"fluorescence/geometry/primitive/instance"
+	"fluorescence/geometry/primitive/mesh"
+	"fluorescence/geometry/primitive/metaball"
+	"fluorescence/geometry/primitive/paraboloid"
 	"fluorescence/geometry/primitive/plane"
 	"fluorescence/geometry/primitive/primitivelist"
 	"fluorescence/geometry/primitive/pyramid"
 	"fluorescence/geometry/primitive/rectangle"
+	"fluorescence/geometry/primitive/sdf"
 	"fluorescence/geometry/primitive/sphere"
+	"fluorescence/geometry/primitive/torus"
+	"fluorescence/geometry/primitive/transform"
 	"fluorescence/geometry/primitive/transform/rotate"
 	"fluorescence/geometry/primitive/transform/translate"
 	"fluorescence/geometry/primitive/triangle"
+	"fluorescence/geometry/primitive/trianglemesh"
+	"fluorescence/geometry/primitive/uncappedcone"
 	"fluorescence/geometry/primitive/uncappedcylinder"
+	"fluorescence/gltf"
 	"fluorescence/shading"
+	"fluorescence/shading/environment"
 	"fluorescence/shading/material"
 	"fluorescence/shading/texture"
 	"fmt"
 	"io/ioutil"
 	"reflect"
+	"strings"
 )
 
 // Parameters holds top-level information about the program's execution and the image's properties
 type Parameters struct {
-	ImageWidth           int           `json:"image_width"`                // width of the image in pixels
-	ImageHeight          int           `json:"image_height"`               // height of the image in pixels
-	FileType             string        `json:"file_type"`                  // image file type (png, jpg, etc.)
-	FileDirectory        string        `json:"file_directory"`             // folder of image to write
-	Version              string        `json:"version"`                    // program version
-	GammaCorrection      float64       `json:"gamma_correction"`           // how much gamma correction to perform on the image
-	TextureGamma         float64       `json:"texture_gamma"`              // how much counter-gamma correction to apply to image textures
-	UseScalingTruncation bool          `json:"use_scaling_truncation"`     // should the program truncate over-magnitude colors by scaling linearly as opposed to clamping?
-	SampleCount          int           `json:"sample_count"`               // amount of samples to write
-	TileWidth            int           `json:"tile_width"`                 // width of a tile in pixels
-	TileHeight           int           `json:"tile_height"`                // height of a tile in pixels
-	MaxBounces           int           `json:"max_bounces"`                // amount of reflections to check before giving up
-	UseBVH               bool          `json:"use_bvh"`                    // should the program generate and use a Bounding Volume Hierarchy?
-	BGColorMagnitude     float64       `json:"background_color_magnitude"` // amount to scale bg color by
-	BackgroundColor      shading.Color `json:"background_color"`           // color to return when nothing is intersected
-	TMin                 float64       `json:"t_min"`                      // minimum ray "time" to count intersection
-	TMax                 float64       `json:"t_max"`                      // maximum ray "time" to count intersection
-	SceneFileName        string        `json:"scene_file_name"`            // file name of scene config file
-	Scene                *Scene        `json:"-"`                          // Scene reference
+	ImageWidth           int                     `json:"image_width"`                // width of the image in pixels
+	ImageHeight          int                     `json:"image_height"`               // height of the image in pixels, or 0 to fit a panoramic camera's projection
+	FileType             string                  `json:"file_type"`                  // image file type (png, jpg, etc.)
+	FileDirectory        string                  `json:"file_directory"`             // folder of image to write
+	Version              string                  `json:"version"`                    // program version
+	GammaCorrection      float64                 `json:"gamma_correction"`           // how much gamma correction to perform on the image
+	TextureGamma         float64                 `json:"texture_gamma"`              // how much counter-gamma correction to apply to image textures
+	UseScalingTruncation bool                    `json:"use_scaling_truncation"`     // should the program truncate over-magnitude colors by scaling linearly as opposed to clamping?
+	SampleCount          int                     `json:"sample_count"`               // amount of samples to write
+	TileWidth            int                     `json:"tile_width"`                 // width of a tile in pixels
+	TileHeight           int                     `json:"tile_height"`                // height of a tile in pixels
+	MaxBounces           int                     `json:"max_bounces"`                // amount of reflections to check before giving up
+	UseBVH               bool                    `json:"use_bvh"`                    // should the program generate and use a Bounding Volume Hierarchy?
+	BVHLeafSize          int                     `json:"bvh_leaf_size"`              // most primitives in a leaf of the Bounding Volume Hierarchy
+	BGColorMagnitude     float64                 `json:"background_color_magnitude"` // amount to scale bg color by
+	BackgroundColor      shading.Color           `json:"background_color"`           // color to return when nothing is intersected
+	EnvironmentData      *EnvironmentData        `json:"environment"`                // optional light surrounding the scene, used in place of the background color
+	Environment          environment.Environment `json:"-"`                          // Environment reference
+	TMin                 float64                 `json:"t_min"`                      // minimum ray "time" to count intersection
+	TMax                 float64                 `json:"t_max"`                      // maximum ray "time" to count intersection
+	SceneFileName        string                  `json:"scene_file_name"`            // file name of scene config file
+	Scene                *Scene                  `json:"-"`                          // Scene reference
 }
 
 // Scene holds information about the pictured scene, such as the objects and camera
@@ -56,13 +79,25 @@ type Scene struct {
 	CameraName      string              `json:"camera_name"` // name of the camera to use
 	Camera          *Camera             `json:"-"`           // Camera reference
 	ObjectMaterials []*ObjectMaterial   `json:"objects"`     // temporary reference to ObjectMaterials to link geometry to materials
+	GLTF            *gltf.Options       `json:"gltf"`        // optional glTF file whose objects, materials and cameras are imported into the scene
+	Animation       *Animation          `json:"animation"`   // optional keyframes, making the scene a sequence of frames
 	Objects         primitive.Primitive `json:"-"`           // reference to Objects in the scene
+
+	boundedObjects   *primitivelist.PrimitiveList // objects the root is built from, kept to rebuild it as objects move
+	unboundedObjects *primitivelist.PrimitiveList
 }
 
 // ObjectMaterial is a temporary holding structure to link together geometry objects and materials
 type ObjectMaterial struct {
-	ObjectName   string `json:"object_name"`
-	MaterialName string `json:"material_name"`
+	ObjectName   string          `json:"object_name"`
+	MaterialName string          `json:"material_name"`
+	Instances    []*InstanceData `json:"instances"` // optional placements sharing a single copy of the object
+}
+
+// InstanceData places an object with its own transform and, optionally, its own material
+type InstanceData struct {
+	MaterialName string `json:"material_name"` // overrides the ObjectMaterial's material if set
+	instance.Instance
 }
 
 // CameraData holds a reference to the Camera struct and name
@@ -94,6 +129,15 @@ type TextureData struct {
 	Data     interface{} `json:"data"`
 }
 
+// EnvironmentData holds information about an environment light
+// Lambertian surfaces also sample the environment directly, weighing those samples against their scattered rays,
+// while all other materials only find it through the rays they scatter, which is slower to converge for small bright
+// lights such as the sun
+type EnvironmentData struct {
+	TypeName string      `json:"type"`
+	Data     interface{} `json:"data"`
+}
+
 // LoadConfigs reads and parses the config files for the program
 func LoadConfigs(
 	parametersFileName,
@@ -114,12 +158,12 @@ func LoadConfigs(
 		return nil, err
 	}
 	fmt.Printf("\tLoading Objects...\n")
-	totalObjects, err := loadObjects(objectsFileName)
+	totalObjects, err := loadObjects(objectsFileName, parameters.TextureGamma)
 	if err != nil {
 		return nil, err
 	}
 	fmt.Printf("\tLoading Textures...\n")
-	totalTextures, err := loadTextures(texturesFileName, parameters.TextureGamma)
+	totalTextures, err := loadTextures(texturesFileName, parameters.TextureGamma, totalObjects)
 	if err != nil {
 		return nil, err
 	}
@@ -137,6 +181,38 @@ func LoadConfigs(
 		return nil, err
 	}
 
+	// import the glTF scene, if any, making its cameras selectable alongside those in the cameras file
+	var gltfScene *gltf.Scene
+	if parameters.Scene.GLTF != nil {
+		fmt.Printf("\tLoading glTF...\n")
+		if parameters.Scene.GLTF.TextureGamma == 0.0 {
+			parameters.Scene.GLTF.TextureGamma = parameters.TextureGamma
+		}
+		gltfScene, err = gltf.Load(*parameters.Scene.GLTF)
+		if err != nil {
+			return nil, err
+		}
+		for _, skipped := range gltfScene.Skipped {
+			fmt.Printf("\t\tSkipped %s\n", skipped)
+		}
+		for i, c := range gltfScene.Cameras {
+			// the first glTF camera is used when the scene does not name one
+			if c.Name != parameters.Scene.CameraName && !(i == 0 && parameters.Scene.CameraName == "") {
+				continue
+			}
+			if _, exists := totalCameras[parameters.Scene.CameraName]; exists {
+				break
+			}
+			totalCameras[parameters.Scene.CameraName] = &Camera{
+				EyeLocation:    c.EyeLocation,
+				TargetLocation: c.TargetLocation,
+				UpVector:       c.UpVector,
+				VerticalFOV:    c.VerticalFOV,
+				FocusDistance:  1.0,
+			}
+		}
+	}
+
 	// select the correct camera and initialize it
 	selectedCamera, exists := totalCameras[parameters.Scene.CameraName]
 	if !exists {
@@ -147,6 +223,15 @@ func LoadConfigs(
 	if err != nil {
 		return nil, err
 	}
+	animation := parameters.Scene.Animation
+	if animation == nil {
+		// a still scene is a single frame with nothing animated
+		animation = &Animation{FrameCount: 1}
+	}
+	err = animation.setup(parameters.Scene.Camera)
+	if err != nil {
+		return nil, err
+	}
 
 	// loop over the loosely connected ObjectMaterials and parse the proper materials into the primitives they represent
 
@@ -156,6 +241,8 @@ func LoadConfigs(
 	// a distinction must be made between these to prevent assembling a BVH or other acceleration structure
 	// without a bounding box around certain primitives
 	unboundedSceneObjects := &primitivelist.PrimitiveList{}
+	// instanced objects are copied once per object and material, and every instance shares that copy
+	sharedObjects := map[[2]string]primitive.Primitive{}
 	for _, om := range parameters.Scene.ObjectMaterials {
 		// grab the labelled objects and materials
 		selectedObject, exists := totalObjects[om.ObjectName]
@@ -167,20 +254,62 @@ func LoadConfigs(
 			return nil, fmt.Errorf("selected Material (%s) not in %s", om.MaterialName, materialsFileName)
 		}
 
-		// this is a check to ensure that materials that have a transmission component (i.e. Dielectrics)
-		// are not attached to "open" geometry, such as single-sided triangles and rectangles, so the
-		// transmission commponent can be reversed
-		// this is an arbitrary restriction that is likely to be removed in the future with the user choosing to self-restrict
-		// themselves in a similar manner
-		if reflect.TypeOf(selectedMaterial) == reflect.TypeOf(&material.Dielectric{}) {
-			if !selectedObject.IsClosed() {
-				return nil, fmt.Errorf("cannot attach refractive or volumetric materials (%s) to non-closed geometry (%s)",
-					om.MaterialName, om.ObjectName)
+		err = checkClosed(selectedObject, selectedMaterial, om.ObjectName, om.MaterialName)
+		if err != nil {
+			return nil, err
+		}
+		if len(om.Instances) > 0 {
+			if selectedObject.IsInfinite() {
+				return nil, fmt.Errorf("cannot instance infinite geometry (%s)", om.ObjectName)
+			}
+			key := [2]string{om.ObjectName, om.MaterialName}
+			shared, exists := sharedObjects[key]
+			if !exists {
+				shared = selectedObject.Copy()
+				shared.SetMaterial(selectedMaterial)
+				err = setGeneratorMaterials(shared, totalMaterials, om.ObjectName, materialsFileName)
+				if err != nil {
+					return nil, err
+				}
+				sharedObjects[key] = shared
 			}
+			for _, id := range om.Instances {
+				newInstance := id.Instance
+				newInstance.Primitive = shared
+				_, err = newInstance.Setup()
+				if err != nil {
+					return nil, fmt.Errorf("instance of (%s): %s", om.ObjectName, err.Error())
+				}
+				if id.MaterialName != "" {
+					instanceMaterial, exists := totalMaterials[id.MaterialName]
+					if !exists {
+						return nil, fmt.Errorf("selected Material (%s) not in %s", id.MaterialName, materialsFileName)
+					}
+					err = checkClosed(selectedObject, instanceMaterial, om.ObjectName, id.MaterialName)
+					if err != nil {
+						return nil, err
+					}
+					newInstance.SetMaterial(instanceMaterial)
+				}
+				animatedInstance, err := animation.wrap(om.ObjectName, &newInstance)
+				if err != nil {
+					return nil, err
+				}
+				boundedSceneObjects.List = append(boundedSceneObjects.List, animatedInstance)
+			}
+			continue
 		}
 		// copy the object so we don't override it's material if it is reused in the scene
 		newPrimitive := selectedObject.Copy()
 		newPrimitive.SetMaterial(selectedMaterial)
+		err = setGeneratorMaterials(newPrimitive, totalMaterials, om.ObjectName, materialsFileName)
+		if err != nil {
+			return nil, err
+		}
+		newPrimitive, err = animation.wrap(om.ObjectName, newPrimitive)
+		if err != nil {
+			return nil, err
+		}
 		// added to the cooresponding list based on type
 		if newPrimitive.IsInfinite() {
 			unboundedSceneObjects.List = append(unboundedSceneObjects.List, newPrimitive)
@@ -189,56 +318,94 @@ func LoadConfigs(
 		}
 	}
 
-	// START MANUAL INSERT
+	// glTF objects come with their materials already set
+	if gltfScene != nil {
+		for _, o := range gltfScene.Objects {
+			if o.IsInfinite() {
+				unboundedSceneObjects.List = append(unboundedSceneObjects.List, o)
+			} else {
+				boundedSceneObjects.List = append(boundedSceneObjects.List, o)
+			}
+		}
+	}
 
-	// for x := 0.5; x < 10.0; x++ {
-	// 	for y := 0.5; y < 10.0; y++ {
-	// 		for z := -0.5; z > -10.0; z-- {
-	// 			newSphere, err := sphere.New(&sphere.Data{
-	// 				Center: geometry.Point{
-	// 					X: x,
-	// 					Y: y,
-	// 					Z: z,
-	// 				},
-	// 				Radius: 0.2,
-	// 			})
-	// 			if err != nil {
-	// 				return nil, err
-	// 			}
-	// 			newSphere.SetMaterial(totalMaterials["glass"])
-	// 			boundedSceneObjects.List = append(boundedSceneObjects.List, newSphere)
-	// 		}
-	// 	}
-	// }
+	parameters.Scene.boundedObjects = boundedSceneObjects
+	parameters.Scene.unboundedObjects = unboundedSceneObjects
+	err = parameters.Scene.buildObjects(parameters)
+	if err != nil {
+		return nil, err
+	}
+	return parameters, nil
+}
 
-	// END MANUAL INSERT
+// buildObjects assembles the root of the scene's objects from its bounded and unbounded objects
+func (s *Scene) buildObjects(parameters *Parameters) error {
+	boundedSceneObjects := s.boundedObjects
+	unboundedSceneObjects := s.unboundedObjects
 
 	// if we are using a BVH ...
 	if parameters.UseBVH {
 		// ... construct it from the bounded objects ..
-		sceneBVH, err := bvh.New(boundedSceneObjects)
+		sceneBVH, err := bvh.NewSAH(boundedSceneObjects, parameters.BVHLeafSize)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		printStats("BVH", sceneBVH.Stats())
 		// ... and set it as the root node if no infinite geometry exists
 		if len(unboundedSceneObjects.List) == 0 {
-			parameters.Scene.Objects = sceneBVH
+			s.Objects = sceneBVH
 		} else {
 			// but if some infinite geometry exists in the scene, we then
 			// establish a new root node as a list of the BVH and the infinite geometry
 			rootNode := &primitivelist.PrimitiveList{
 				List: append(unboundedSceneObjects.List, sceneBVH),
 			}
-			parameters.Scene.Objects = rootNode
+			s.Objects = rootNode
 		}
 	} else {
 		// if we are not using a BVH, combine the lists into a core list and set it as the root node
-		parameters.Scene.Objects = &primitivelist.PrimitiveList{
+		s.Objects = &primitivelist.PrimitiveList{
 			List: append(boundedSceneObjects.List, unboundedSceneObjects.List...),
 		}
 	}
+	return nil
+}
 
-	return parameters, nil
+// checkClosed ensures that materials that have a transmission component (i.e. Dielectrics)
+// are not attached to "open" geometry, such as single-sided triangles and rectangles, so the
+// transmission commponent can be reversed
+// this is an arbitrary restriction that is likely to be removed in the future with the user choosing to self-restrict
+// themselves in a similar manner
+func checkClosed(p primitive.Primitive, m material.Material, objectName, materialName string) error {
+	if reflect.TypeOf(m) == reflect.TypeOf(&material.Dielectric{}) {
+		if !p.IsClosed() {
+			return fmt.Errorf("cannot attach refractive or volumetric materials (%s) to non-closed geometry (%s)",
+				materialName, objectName)
+		}
+	}
+	return nil
+}
+
+// setGeneratorMaterials gives the copies made by a generator the materials it names, if any
+// generators are loaded with the objects, before the materials, so they keep only the names until now
+func setGeneratorMaterials(p primitive.Primitive, totalMaterials map[string]material.Material, objectName, materialsFileName string) error {
+	g, ok := p.(generator.MaterialSetter)
+	if !ok || len(g.NamedMaterials()) == 0 {
+		return nil
+	}
+	materials := make([]material.Material, len(g.NamedMaterials()))
+	for i, name := range g.NamedMaterials() {
+		m, exists := totalMaterials[name]
+		if !exists {
+			return fmt.Errorf("selected Material (%s) not in %s", name, materialsFileName)
+		}
+		err := checkClosed(p, m, objectName, name)
+		if err != nil {
+			return err
+		}
+		materials[i] = m
+	}
+	return g.SetMaterials(materials)
 }
 
 func loadCameras(fileName string) (map[string]*Camera, error) {
@@ -261,7 +428,7 @@ func loadCameras(fileName string) (map[string]*Camera, error) {
 	return camerasMap, nil
 }
 
-func loadObjects(fileName string) (map[string]primitive.Primitive, error) {
+func loadObjects(fileName string, tGamma float64) (map[string]primitive.Primitive, error) {
 	objectsBytes, err := ioutil.ReadFile(fileName)
 	if err != nil {
 		return nil, err
@@ -276,17 +443,41 @@ func loadObjects(fileName string) (map[string]primitive.Primitive, error) {
 		if _, ok := objectsMap[o.Name]; ok {
 			return nil, fmt.Errorf("object (%s) redefined", o.Name)
 		}
-		newPrimitive, err := decodeObject(o.TypeName, o.Data)
+		newPrimitive, err := decodeObject(o.TypeName, o.Data, tGamma)
 		if err != nil {
 			return nil, err
 		}
+		// primitives with their own hierarchy, such as meshes, report it as the scene's BVH does
+		if s, ok := newPrimitive.(interface{ Stats() bvh.Stats }); ok {
+			printStats(fmt.Sprintf("BVH of %s", o.Name), s.Stats())
+		}
 		objectsMap[o.Name] = newPrimitive
 	}
 	return objectsMap, nil
 }
 
-func decodeObject(typeName string, data interface{}) (primitive.Primitive, error) {
+// printStats prints the statistics of a built BVH, indented under the name of what it was built for
+func printStats(name string, stats bvh.Stats) {
+	fmt.Printf("\tBuilt %s:\n", name)
+	for _, line := range strings.Split(stats.String(), "\n") {
+		fmt.Printf("\t\t%s\n", line)
+	}
+}
+
+func decodeObject(typeName string, data interface{}, tGamma float64) (primitive.Primitive, error) {
 	switch typeName {
+	case "BezierPatch":
+		var bp bezierpatch.BezierPatch
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &bp)
+		newBezierPatch, err := bp.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newBezierPatch, nil
 	case "Box":
 		var b box.Box
 		dataBytes, err := json.Marshal(data)
@@ -299,6 +490,30 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		return newBox, nil
+	case "Curve":
+		var c curve.Curve
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &c)
+		newCurve, err := c.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newCurve, nil
+	case "CurveSet":
+		var cs curve.CurveSet
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &cs)
+		newCurveSet, err := cs.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newCurveSet, nil
 	case "Cylinder":
 		var c cylinder.Cylinder
 		dataBytes, err := json.Marshal(data)
@@ -311,6 +526,18 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		return newCylinder, nil
+	case "Heightfield":
+		var h heightfield.Heightfield
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &h)
+		newHeightfield, err := h.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newHeightfield, nil
 	case "HollowCylinder":
 		var hc hollowcylinder.HollowCylinder
 		dataBytes, err := json.Marshal(data)
@@ -347,6 +574,42 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		return newUncappedCylinder, nil
+	case "Cone":
+		var c cone.Cone
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &c)
+		newCone, err := c.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newCone, nil
+	case "UncappedCone":
+		var uc uncappedcone.UncappedCone
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &uc)
+		newUncappedCone, err := uc.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newUncappedCone, nil
+	case "Capsule":
+		var c capsule.Capsule
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &c)
+		newCapsule, err := c.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newCapsule, nil
 	case "Disk":
 		var d disk.Disk
 		dataBytes, err := json.Marshal(data)
@@ -371,6 +634,45 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		return newHollowDisk, nil
+	case "Mesh":
+		var m mesh.Mesh
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &m)
+		if m.TextureGamma == 0.0 {
+			m.TextureGamma = tGamma
+		}
+		newMesh, err := m.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newMesh, nil
+	case "Metaballs":
+		var m metaball.Metaballs
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &m)
+		newMetaballs, err := m.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newMetaballs, nil
+	case "Paraboloid":
+		var p paraboloid.Paraboloid
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &p)
+		newParaboloid, err := p.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newParaboloid, nil
 	case "Plane":
 		var p plane.Plane
 		dataBytes, err := json.Marshal(data)
@@ -407,6 +709,18 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		return newRectangle, nil
+	case "SDF":
+		var s sdf.SDF
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &s)
+		newSDF, err := s.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newSDF, nil
 	case "Sphere":
 		var s sphere.Sphere
 		dataBytes, err := json.Marshal(data)
@@ -419,6 +733,18 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		return newSphere, nil
+	case "Torus":
+		var t torus.Torus
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &t)
+		newTorus, err := t.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newTorus, nil
 	case "Triangle":
 		var t triangle.Triangle
 		dataBytes, err := json.Marshal(data)
@@ -431,6 +757,18 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		return newTriangle, nil
+	case "TriangleMesh":
+		var tm trianglemesh.TriangleMesh
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &tm)
+		newTriangleMesh, err := tm.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newTriangleMesh, nil
 	case "Translation":
 		var t translate.Translation
 		dataBytes, err := json.Marshal(data)
@@ -438,7 +776,7 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		json.Unmarshal(dataBytes, &t)
-		corePrimitive, err := decodeObject(t.TypeName, t.Data)
+		corePrimitive, err := decodeObject(t.TypeName, t.Data, tGamma)
 		if err != nil {
 			return nil, err
 		}
@@ -448,6 +786,132 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		return newTranslation, nil
+	case "Transform":
+		var t transform.Transform
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &t)
+		corePrimitive, err := decodeObject(t.TypeName, t.Data, tGamma)
+		if err != nil {
+			return nil, err
+		}
+		t.Primitive = corePrimitive
+		newTransform, err := (&t).Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newTransform, nil
+	case "CSG":
+		var c csg.CSG
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &c)
+		for _, o := range []*csg.Operand{&c.A, &c.B} {
+			operandPrimitive, err := decodeObject(o.TypeName, o.Data, tGamma)
+			if err != nil {
+				return nil, err
+			}
+			o.Primitive = operandPrimitive
+		}
+		newCSG, err := (&c).Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newCSG, nil
+	case "Displacement":
+		var d displacement.Displacement
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &d)
+		corePrimitive, err := decodeObject(d.TypeName, d.Data, tGamma)
+		if err != nil {
+			return nil, err
+		}
+		d.Primitive = corePrimitive
+		newDisplacement, err := (&d).Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newDisplacement, nil
+	case "LinearArray":
+		var la generator.LinearArray
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &la)
+		corePrimitive, err := decodeObject(la.TypeName, la.Data, tGamma)
+		if err != nil {
+			return nil, err
+		}
+		la.Primitive = corePrimitive
+		newLinearArray, err := (&la).Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newLinearArray, nil
+	case "Grid":
+		var g generator.Grid
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &g)
+		corePrimitive, err := decodeObject(g.TypeName, g.Data, tGamma)
+		if err != nil {
+			return nil, err
+		}
+		g.Primitive = corePrimitive
+		newGrid, err := (&g).Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newGrid, nil
+	case "RadialArray":
+		var ra generator.RadialArray
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &ra)
+		corePrimitive, err := decodeObject(ra.TypeName, ra.Data, tGamma)
+		if err != nil {
+			return nil, err
+		}
+		ra.Primitive = corePrimitive
+		newRadialArray, err := (&ra).Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newRadialArray, nil
+	case "Scatter":
+		var s generator.Scatter
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &s)
+		corePrimitive, err := decodeObject(s.TypeName, s.Data, tGamma)
+		if err != nil {
+			return nil, err
+		}
+		s.Primitive = corePrimitive
+		surfacePrimitive, err := decodeObject(s.SurfaceTypeName, s.SurfaceData, tGamma)
+		if err != nil {
+			return nil, err
+		}
+		s.Surface = surfacePrimitive
+		newScatter, err := (&s).Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newScatter, nil
 	case "RotationX":
 		var rx rotate.RotationX
 		dataBytes, err := json.Marshal(data)
@@ -455,7 +919,7 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		json.Unmarshal(dataBytes, &rx)
-		corePrimitive, err := decodeObject(rx.TypeName, rx.Data)
+		corePrimitive, err := decodeObject(rx.TypeName, rx.Data, tGamma)
 		if err != nil {
 			return nil, err
 		}
@@ -472,7 +936,7 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		json.Unmarshal(dataBytes, &ry)
-		corePrimitive, err := decodeObject(ry.TypeName, ry.Data)
+		corePrimitive, err := decodeObject(ry.TypeName, ry.Data, tGamma)
 		if err != nil {
 			return nil, err
 		}
@@ -489,7 +953,7 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		json.Unmarshal(dataBytes, &rz)
-		corePrimitive, err := decodeObject(rz.TypeName, rz.Data)
+		corePrimitive, err := decodeObject(rz.TypeName, rz.Data, tGamma)
 		if err != nil {
 			return nil, err
 		}
@@ -506,7 +970,7 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 			return nil, err
 		}
 		json.Unmarshal(dataBytes, &q)
-		corePrimitive, err := decodeObject(q.TypeName, q.Data)
+		corePrimitive, err := decodeObject(q.TypeName, q.Data, tGamma)
 		if err != nil {
 			return nil, err
 		}
@@ -521,7 +985,7 @@ func decodeObject(typeName string, data interface{}) (primitive.Primitive, error
 	}
 }
 
-func loadTextures(fileName string, tGamma float64) (map[string]texture.Texture, error) {
+func loadTextures(fileName string, tGamma float64, objectsMap map[string]primitive.Primitive) (map[string]texture.Texture, error) {
 	texturesBytes, err := ioutil.ReadFile(fileName)
 	if err != nil {
 		return nil, err
@@ -563,6 +1027,29 @@ func loadTextures(fileName string, tGamma float64) (map[string]texture.Texture,
 				return nil, err
 			}
 			texturesMap[t.Name] = &i
+		case "VertexColor":
+			var vc texture.VertexColor
+			dataBytes, err := json.Marshal(t.Data)
+			if err != nil {
+				return nil, err
+			}
+			json.Unmarshal(dataBytes, &vc)
+			object, ok := objectsMap[vc.ObjectName]
+			if !ok {
+				return nil, fmt.Errorf("object (%s) referenced by texture (%s) not defined", vc.ObjectName, t.Name)
+			}
+			colored, ok := object.(interface {
+				VertexColors() (*texture.VertexColor, bool)
+			})
+			if !ok {
+				return nil, fmt.Errorf("object (%s) referenced by texture (%s) is not a mesh", vc.ObjectName, t.Name)
+			}
+			meshColors, ok := colored.VertexColors()
+			if !ok {
+				return nil, fmt.Errorf("object (%s) referenced by texture (%s) has no vertex colors", vc.ObjectName, t.Name)
+			}
+			meshColors.ObjectName = vc.ObjectName
+			texturesMap[t.Name] = meshColors
 		default:
 			return nil, fmt.Errorf("type (%s) not a valid texture type", t.TypeName)
 		}
@@ -682,6 +1169,37 @@ func loadMaterials(fileName, texturesFileName string, texturesMap map[string]tex
 				}
 			}
 			materialsMap[m.Name] = &d
+		case "Hair":
+			var h material.Hair
+			dataBytes, err := json.Marshal(m.Data)
+			if err != nil {
+				return nil, err
+			}
+			json.Unmarshal(dataBytes, &h)
+			var ok bool
+			if m.ReflectanceTextureName == "" {
+				h.ReflectanceTexture, ok = texturesMap["default"]
+				if !ok {
+					return nil, fmt.Errorf("selected Texture (%s) not in %s", "default", texturesFileName)
+				}
+			} else {
+				h.ReflectanceTexture, ok = texturesMap[m.ReflectanceTextureName]
+				if !ok {
+					return nil, fmt.Errorf("selected Texture (%s) not in %s", m.ReflectanceTextureName, texturesFileName)
+				}
+			}
+			if m.EmittanceTextureName == "" {
+				h.EmittanceTexture, ok = texturesMap["default"]
+				if !ok {
+					return nil, fmt.Errorf("selected Texture (%s) not in %s", "default", texturesFileName)
+				}
+			} else {
+				h.EmittanceTexture, ok = texturesMap[m.EmittanceTextureName]
+				if !ok {
+					return nil, fmt.Errorf("selected Texture (%s) not in %s", m.EmittanceTextureName, texturesFileName)
+				}
+			}
+			materialsMap[m.Name] = &h
 		default:
 			return nil, fmt.Errorf("type (%s) not a valid material type", m.TypeName)
 		}
@@ -700,9 +1218,67 @@ func loadParameters(fileName string) (*Parameters, error) {
 		return nil, err
 	}
 	parameters.BackgroundColor = parameters.BackgroundColor.MultScalar(parameters.BGColorMagnitude)
+	if parameters.BVHLeafSize == 0 {
+		parameters.BVHLeafSize = bvh.DefaultLeafSize
+	}
+	if parameters.EnvironmentData != nil {
+		parameters.Environment, err = loadEnvironment(parameters.EnvironmentData, parameters.TextureGamma)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return &parameters, nil
 }
 
+func loadEnvironment(ed *EnvironmentData, tGamma float64) (environment.Environment, error) {
+	switch ed.TypeName {
+	case "Image":
+		var i environment.Image
+		dataBytes, err := json.Marshal(ed.Data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &i)
+		if i.Magnitude == 0.0 {
+			i.Magnitude = 1.0
+		}
+		if i.Gamma == 0.0 {
+			i.Gamma = tGamma
+		}
+		err = i.Load()
+		if err != nil {
+			return nil, err
+		}
+		return &i, nil
+	case "Sky":
+		var s environment.Sky
+		dataBytes, err := json.Marshal(ed.Data)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(dataBytes, &s)
+		if s.Turbidity == 0.0 {
+			s.Turbidity = 3.0
+		}
+		if s.Magnitude == 0.0 {
+			s.Magnitude = 0.1
+		}
+		if s.SunIlluminance == 0.0 {
+			s.SunIlluminance = 100.0
+		}
+		if s.SunAngularDiameter == 0.0 {
+			s.SunAngularDiameter = 0.53
+		}
+		newSky, err := s.Setup()
+		if err != nil {
+			return nil, err
+		}
+		return newSky, nil
+	default:
+		return nil, fmt.Errorf("type (%s) not a valid environment type", ed.TypeName)
+	}
+}
+
 func loadScene(fileName string) (*Scene, error) {
 	sceneBytes, err := ioutil.ReadFile(fileName)
 	if err != nil {
@@ -47,6 +47,11 @@ func (c Color) Pow(e float64) Color {
 	return Color{math.Pow(c.Red, e), math.Pow(c.Green, e), math.Pow(c.Blue, e)}
 }
 
+// Luminance returns the perceived brightness of a Color using Rec. 709 weights
+func (c Color) Luminance() float64 {
+	return 0.2126*c.Red + 0.7152*c.Green + 0.0722*c.Blue
+}
+
 // Clamp clamps each component to a specified minimum and maximum
 func (c Color) Clamp(min, max float64) Color {
 	return Color{
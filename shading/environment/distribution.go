@@ -0,0 +1,126 @@
+package environment
+
+import "sort"
+
+// Distribution1D is a piecewise-constant probability distribution over [0, 1)
+type Distribution1D struct {
+	function []float64
+	cdf      []float64
+	integral float64
+}
+
+// NewDistribution1D builds a distribution proportional to the given non-negative function values
+func NewDistribution1D(function []float64) *Distribution1D {
+	n := len(function)
+	d := &Distribution1D{
+		function: make([]float64, n),
+		cdf:      make([]float64, n+1),
+	}
+	copy(d.function, function)
+
+	// integrate the step function
+	for i := 1; i <= n; i++ {
+		d.cdf[i] = d.cdf[i-1] + d.function[i-1]/float64(n)
+	}
+	d.integral = d.cdf[n]
+
+	// normalize, falling back to a uniform distribution if the function is zero everywhere
+	if d.integral == 0.0 {
+		for i := 1; i <= n; i++ {
+			d.cdf[i] = float64(i) / float64(n)
+		}
+	} else {
+		for i := 1; i <= n; i++ {
+			d.cdf[i] /= d.integral
+		}
+	}
+	return d
+}
+
+// Count returns the number of segments in this distribution
+func (d *Distribution1D) Count() int {
+	return len(d.function)
+}
+
+// Integral returns the integral of the function over [0, 1)
+func (d *Distribution1D) Integral() float64 {
+	return d.integral
+}
+
+// SampleContinuous maps a uniform sample u to a value in [0, 1) distributed according to the function
+// it returns the value, the PDF of the value, and the index of the segment it fell into
+func (d *Distribution1D) SampleContinuous(u float64) (float64, float64, int) {
+	// find the last cdf entry less than or equal to u
+	offset := sort.Search(len(d.cdf), func(i int) bool {
+		return d.cdf[i] > u
+	}) - 1
+	if offset < 0 {
+		offset = 0
+	} else if offset > len(d.function)-1 {
+		offset = len(d.function) - 1
+	}
+
+	// find how far into the segment u is
+	du := u - d.cdf[offset]
+	if width := d.cdf[offset+1] - d.cdf[offset]; width > 0.0 {
+		du /= width
+	}
+
+	pdf := 1.0
+	if d.integral > 0.0 {
+		pdf = d.function[offset] / d.integral
+	}
+	return (float64(offset) + du) / float64(d.Count()), pdf, offset
+}
+
+// PDF returns the probability density of sampling x in [0, 1)
+func (d *Distribution1D) PDF(x float64) float64 {
+	if d.integral == 0.0 {
+		return 1.0
+	}
+	return d.function[d.index(x)] / d.integral
+}
+
+// index returns the segment x falls into
+func (d *Distribution1D) index(x float64) int {
+	i := int(x * float64(d.Count()))
+	if i < 0 {
+		return 0
+	} else if i > d.Count()-1 {
+		return d.Count() - 1
+	}
+	return i
+}
+
+// Distribution2D is a piecewise-constant probability distribution over [0, 1)^2
+// stored as a marginal distribution over v and conditional distributions over u for each row
+type Distribution2D struct {
+	conditional []*Distribution1D
+	marginal    *Distribution1D
+}
+
+// NewDistribution2D builds a distribution from a function laid out as function[v][u]
+func NewDistribution2D(function [][]float64) *Distribution2D {
+	d := &Distribution2D{}
+	marginalFunction := make([]float64, len(function))
+	for v, row := range function {
+		d.conditional = append(d.conditional, NewDistribution1D(row))
+		marginalFunction[v] = d.conditional[v].Integral()
+	}
+	d.marginal = NewDistribution1D(marginalFunction)
+	return d
+}
+
+// SampleContinuous maps two uniform samples to a point (u, v) distributed according to the function
+// it returns the point and the PDF of the point
+func (d *Distribution2D) SampleContinuous(u0, u1 float64) (float64, float64, float64) {
+	v, pdfV, row := d.marginal.SampleContinuous(u1)
+	u, pdfU, _ := d.conditional[row].SampleContinuous(u0)
+	return u, v, pdfU * pdfV
+}
+
+// PDF returns the probability density of sampling the point (u, v)
+func (d *Distribution2D) PDF(u, v float64) float64 {
+	row := d.marginal.index(v)
+	return d.conditional[row].PDF(u) * d.marginal.PDF(v)
+}
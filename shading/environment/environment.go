@@ -0,0 +1,38 @@
+package environment
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/shading"
+	"math"
+	"math/rand"
+)
+
+// Environment describes light arriving from infinitely far away, such as a sky
+type Environment interface {
+	Value(direction geometry.Vector) shading.Color
+	Sample(rng *rand.Rand) (geometry.Vector, shading.Color, float64)
+	PDF(direction geometry.Vector) float64
+}
+
+// DirectionToUV maps a direction onto latitude-longitude coordinates in [0, 1)
+// using the same convention as sphere texture coordinates, with v = 1 pointing up (+Y)
+func DirectionToUV(direction geometry.Vector) (float64, float64) {
+	d := direction.Unit()
+	phi := math.Atan2(d.Z, d.X)
+	theta := math.Asin(math.Max(-1.0, math.Min(1.0, d.Y)))
+	u := 1.0 - (phi+math.Pi)/(2.0*math.Pi)
+	v := (theta + math.Pi/2.0) / math.Pi
+	return u, v
+}
+
+// UVToDirection is the inverse of DirectionToUV, returning a unit direction
+func UVToDirection(u, v float64) geometry.Vector {
+	phi := math.Pi - 2.0*math.Pi*u
+	theta := math.Pi * (1.0 - v)
+	sinTheta := math.Sin(theta)
+	return geometry.Vector{
+		X: sinTheta * math.Cos(phi),
+		Y: math.Cos(theta),
+		Z: sinTheta * math.Sin(phi),
+	}
+}
@@ -0,0 +1,305 @@
+package environment
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/shading"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+var environmentSampleSink geometry.Vector
+
+// testImage returns a small environment image lit by a dim gradient and one bright pixel,
+// set up as Load would without reading a file
+func testImage(rotation float64) *Image {
+	ei := &Image{
+		Rotation: rotation,
+		width:    32,
+		height:   16,
+	}
+	ei.pixels = make([]shading.Color, ei.width*ei.height)
+	for y := 0; y < ei.height; y++ {
+		for x := 0; x < ei.width; x++ {
+			ei.pixels[y*ei.width+x] = shading.Color{Red: 0.1, Green: 0.2, Blue: float64(y) / float64(ei.height)}
+		}
+	}
+	ei.pixels[5*ei.width+20] = shading.Color{Red: 500.0, Green: 450.0, Blue: 400.0}
+	theta := rotation * math.Pi / 180.0
+	ei.sinRotation = math.Sin(theta)
+	ei.cosRotation = math.Cos(theta)
+	ei.distribution = NewDistribution2D(ei.weights())
+	return ei
+}
+
+// sphereIntegral returns the integral of f over all directions, by the midpoint rule on a latitude-longitude grid
+func sphereIntegral(f func(geometry.Vector) float64) float64 {
+	const rows, cols = 512, 1024
+	sum := 0.0
+	for row := 0; row < rows; row++ {
+		theta := math.Pi * (float64(row) + 0.5) / rows
+		for col := 0; col < cols; col++ {
+			phi := 2.0 * math.Pi * (float64(col) + 0.5) / cols
+			d := geometry.Vector{
+				X: math.Sin(theta) * math.Cos(phi),
+				Y: math.Cos(theta),
+				Z: math.Sin(theta) * math.Sin(phi),
+			}
+			sum += f(d) * math.Sin(theta)
+		}
+	}
+	return sum * (math.Pi / rows) * (2.0 * math.Pi / cols)
+}
+
+func TestDistribution1DSampleMatchesPDF(t *testing.T) {
+	function := []float64{1.0, 0.0, 3.0, 6.0}
+	d := NewDistribution1D(function)
+	if math.Abs(d.Integral()-2.5) > 1e-12 {
+		t.Errorf("Expected integral 2.5 but got %f\n", d.Integral())
+	}
+	rng := rand.New(rand.NewSource(0))
+	counts := make([]int, len(function))
+	const samples = 100000
+	for i := 0; i < samples; i++ {
+		x, pdf, offset := d.SampleContinuous(rng.Float64())
+		if x < 0.0 || x >= 1.0 {
+			t.Fatalf("Expected a sample in [0, 1) but got %f\n", x)
+		}
+		if math.Abs(pdf-d.PDF(x)) > 1e-12 {
+			t.Fatalf("Expected the sample's PDF %f to match PDF(%f) %f\n", pdf, x, d.PDF(x))
+		}
+		if offset != d.index(x) {
+			t.Fatalf("Expected sample %f in segment %d but got %d\n", x, d.index(x), offset)
+		}
+		counts[offset]++
+	}
+	for i, c := range counts {
+		expected := function[i] / 10.0
+		if math.Abs(float64(c)/samples-expected) > 0.01 {
+			t.Errorf("Expected segment %d sampled %f of the time but got %f\n", i, expected, float64(c)/samples)
+		}
+	}
+}
+
+func TestDistribution1DZero(t *testing.T) {
+	d := NewDistribution1D([]float64{0.0, 0.0})
+	x, pdf, _ := d.SampleContinuous(0.75)
+	if math.Abs(x-0.75) > 1e-12 || pdf != 1.0 {
+		t.Errorf("Expected a uniform sample (0.75, 1) but got (%f, %f)\n", x, pdf)
+	}
+}
+
+func TestDistribution2DSampleMatchesPDF(t *testing.T) {
+	function := [][]float64{
+		{1.0, 2.0, 0.0},
+		{0.0, 0.0, 0.0},
+		{4.0, 1.0, 1.0},
+	}
+	d := NewDistribution2D(function)
+	rng := rand.New(rand.NewSource(0))
+	var counts [3][3]int
+	const samples = 100000
+	for i := 0; i < samples; i++ {
+		u, v, pdf := d.SampleContinuous(rng.Float64(), rng.Float64())
+		if math.Abs(pdf-d.PDF(u, v)) > 1e-12 {
+			t.Fatalf("Expected the sample's PDF %f to match PDF(%f, %f) %f\n", pdf, u, v, d.PDF(u, v))
+		}
+		counts[int(v*3.0)][int(u*3.0)]++
+	}
+	for v := range function {
+		for u := range function[v] {
+			expected := function[v][u] / 9.0
+			if math.Abs(float64(counts[v][u])/samples-expected) > 0.01 {
+				t.Errorf("Expected cell (%d, %d) sampled %f of the time but got %f\n",
+					u, v, expected, float64(counts[v][u])/samples)
+			}
+		}
+	}
+}
+
+func TestUVDirectionRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 1000; i++ {
+		u, v := rng.Float64(), 0.001+0.998*rng.Float64()
+		d := UVToDirection(u, v)
+		if math.Abs(d.Magnitude()-1.0) > 1e-12 {
+			t.Fatalf("Expected a unit direction but got %v\n", d)
+		}
+		u2, v2 := DirectionToUV(d)
+		// u wraps around at 0 and 1
+		du := math.Abs(u - u2)
+		du = math.Min(du, 1.0-du)
+		if du > 1e-9 || math.Abs(v-v2) > 1e-9 {
+			t.Fatalf("Expected (%f, %f) back from %v but got (%f, %f)\n", u, v, d, u2, v2)
+		}
+	}
+	if _, v := DirectionToUV(geometry.Vector{Y: 1.0}); v != 1.0 {
+		t.Errorf("Expected straight up at v 1 but got %f\n", v)
+	}
+}
+
+func TestImagePDFIntegratesToOne(t *testing.T) {
+	for _, rotation := range []float64{0.0, 70.0} {
+		ei := testImage(rotation)
+		integral := sphereIntegral(ei.PDF)
+		if math.Abs(integral-1.0) > 0.01 {
+			t.Errorf("Expected the PDF to integrate to 1 with rotation %f but got %f\n", rotation, integral)
+		}
+	}
+}
+
+func TestImageSampleMatchesPDF(t *testing.T) {
+	ei := testImage(70.0)
+	rng := rand.New(rand.NewSource(0))
+	bright := 0
+	const samples = 10000
+	for i := 0; i < samples; i++ {
+		direction, value, pdf := ei.Sample(rng)
+		if pdf == 0.0 {
+			continue
+		}
+		if math.Abs(pdf-ei.PDF(direction))/pdf > 1e-6 {
+			t.Fatalf("Expected the sample's PDF %f to match PDF %f\n", pdf, ei.PDF(direction))
+		}
+		if value != ei.Value(direction) {
+			t.Fatalf("Expected the sample's value %v to match Value %v\n", value, ei.Value(direction))
+		}
+		if value.Red == 500.0 {
+			bright++
+		}
+	}
+	// the bright pixel holds almost all of the image's luminance
+	if bright < samples*8/10 {
+		t.Errorf("Expected most samples on the bright pixel but got %d of %d\n", bright, samples)
+	}
+}
+
+func BenchmarkImageSample(b *testing.B) {
+	ei := testImage(0.0)
+	rng := rand.New(rand.NewSource(0))
+	var d geometry.Vector
+	for n := 0; n < b.N; n++ {
+		d, _, _ = ei.Sample(rng)
+	}
+	environmentSampleSink = d
+}
+
+// testSky returns a sky set up with the defaults the scene loader gives it
+func testSky(elevation float64) *Sky {
+	s, _ := (&Sky{
+		SunElevation:       elevation,
+		SunAzimuth:         40.0,
+		Turbidity:          3.0,
+		Magnitude:          0.1,
+		SunIlluminance:     100.0,
+		SunAngularDiameter: 0.53,
+	}).Setup()
+	return s
+}
+
+func TestSunPosition(t *testing.T) {
+	// elevations and azimuths from the NOAA solar calculator
+	for _, c := range []struct {
+		dateTime            string
+		latitude, longitude float64
+		elevation, azimuth  float64
+	}{
+		{"2020-06-21T12:00:00Z", 51.4769, 0.0, 61.98, 179.2},      // Greenwich at noon on the June solstice
+		{"2020-06-21T00:00:00Z", 51.4769, 0.0, -15.07, 359.7},     // and at midnight, below the horizon
+		{"2019-01-01T17:00:00Z", 40.7128, -74.0060, 26.25, 180.2}, // New York at noon in winter
+		{"2021-03-20T06:07:00Z", 0.0, 0.0, -0.3, 90.6},            // sunrise on the equator at the equinox
+		{"2021-12-21T01:55:00Z", -33.87, 151.21, 79.53, 357.2},    // Sydney at noon on the December solstice
+	} {
+		dateTime, _ := time.Parse(time.RFC3339, c.dateTime)
+		elevation, azimuth := SunPosition(dateTime, c.latitude, c.longitude)
+		if math.Abs(elevation-c.elevation) > 0.5 || math.Abs(azimuth-c.azimuth) > 0.5 {
+			t.Errorf("Expected the sun at (%f, %f) at %s but got (%f, %f)\n",
+				c.elevation, c.azimuth, c.dateTime, elevation, azimuth)
+		}
+	}
+}
+
+func TestSkyBelowHorizon(t *testing.T) {
+	s, err := (&Sky{
+		DateTime:           "2020-06-21T00:00:00Z",
+		Latitude:           51.4769,
+		Turbidity:          3.0,
+		Magnitude:          0.1,
+		SunIlluminance:     100.0,
+		SunAngularDiameter: 0.53,
+	}).Setup()
+	if err != nil {
+		t.Fatalf("Expected no error with the sun below the horizon but got %s\n", err)
+	}
+	if s.SunElevation >= 0.0 {
+		t.Errorf("Expected the sun below the horizon but got elevation %f\n", s.SunElevation)
+	}
+	if s.sunProbability != 0.0 {
+		t.Errorf("Expected no samples of the sun disk but got probability %f\n", s.sunProbability)
+	}
+	// past twilight the sky is dark, though samples of it are still well formed
+	if up := s.Value(geometry.Vector{Y: 1.0}); up != shading.ColorBlack {
+		t.Errorf("Expected a dark sky overhead at night but got %v\n", up)
+	}
+	direction, value, pdf := s.Sample(rand.New(rand.NewSource(0)))
+	if value != shading.ColorBlack || math.IsNaN(pdf) || math.IsNaN(direction.X) {
+		t.Errorf("Expected a dark, finite sample at night but got %v (%v, %f)\n", direction, value, pdf)
+	}
+	// the sky darkens as the sun sets through twilight
+	previous := math.Inf(1)
+	for _, elevation := range []float64{0.0, -2.0, -4.0, -6.0} {
+		up := testSky(elevation).Value(geometry.Vector{Y: 1.0}).Luminance()
+		if math.IsNaN(up) || up >= previous && up > 0.0 {
+			t.Errorf("Expected the sky overhead to darken at elevation %f but got %f after %f\n", elevation, up, previous)
+		}
+		previous = up
+	}
+	if previous != 0.0 {
+		t.Errorf("Expected a dark sky at the end of twilight but got %f\n", previous)
+	}
+	_, err = (&Sky{SunElevation: -91.0, Turbidity: 3.0, Magnitude: 0.1, SunAngularDiameter: 0.53}).Setup()
+	if err == nil {
+		t.Errorf("Expected an error with an elevation past straight down but got none\n")
+	}
+}
+
+func TestSkyPDFIntegratesToOne(t *testing.T) {
+	s := testSky(30.0)
+	// the midpoint rule misses the tiny sun disk, whose share is checked by sampling it
+	skyIntegral := sphereIntegral(func(d geometry.Vector) float64 {
+		if d.Dot(s.sunDirection) >= s.sunCosMax {
+			return 0.0
+		}
+		return s.PDF(d)
+	})
+	if math.Abs(skyIntegral-(1.0-s.sunProbability)) > 0.01 {
+		t.Errorf("Expected the sky's PDF to integrate to %f but got %f\n", 1.0-s.sunProbability, skyIntegral)
+	}
+}
+
+func TestSkySampleFindsSun(t *testing.T) {
+	s := testSky(30.0)
+	rng := rand.New(rand.NewSource(0))
+	onSun := 0
+	const samples = 10000
+	for i := 0; i < samples; i++ {
+		direction, value, pdf := s.Sample(rng)
+		if pdf == 0.0 {
+			continue
+		}
+		if math.Abs(pdf-s.PDF(direction))/pdf > 1e-9 {
+			t.Fatalf("Expected the sample's PDF %f to match PDF %f\n", pdf, s.PDF(direction))
+		}
+		if value != s.Value(direction) {
+			t.Fatalf("Expected the sample's value %v to match Value %v\n", value, s.Value(direction))
+		}
+		if direction.Dot(s.sunDirection) >= s.sunCosMax {
+			onSun++
+		}
+	}
+	// the sun disk is too small to be sampled by chance, so samples on it come from sampling it directly
+	if math.Abs(float64(onSun)/samples-s.sunProbability) > 0.02 {
+		t.Errorf("Expected %f of the samples on the sun disk but got %f\n", s.sunProbability, float64(onSun)/samples)
+	}
+}
@@ -0,0 +1,136 @@
+package environment
+
+import (
+	"bufio"
+	"fluorescence/shading"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// decodeHDR reads a Radiance RGBE (.hdr) image, returning its width, height and linear pixel colors in row-major order
+// starting at the top-left corner
+func decodeHDR(r io.Reader) (int, int, []shading.Color, error) {
+	reader := bufio.NewReader(r)
+
+	// the header is a list of newline-terminated lines ending with an empty line
+	magic, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if !strings.HasPrefix(magic, "#?") {
+		return 0, 0, nil, fmt.Errorf("hdr image missing magic number")
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return 0, 0, nil, fmt.Errorf("unsupported hdr format (%s)", line)
+		}
+	}
+
+	// the resolution line describes the scanline order, only the standard top-down order is supported
+	resolution, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	var width, height int
+	_, err = fmt.Sscanf(resolution, "-Y %d +X %d", &height, &width)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("unsupported hdr resolution (%s)", strings.TrimSpace(resolution))
+	}
+	if width <= 0 || height <= 0 {
+		return 0, 0, nil, fmt.Errorf("hdr resolution is 0 or negative")
+	}
+
+	pixels := make([]shading.Color, width*height)
+	scanline := make([]byte, width*4)
+	for y := 0; y < height; y++ {
+		err = readScanline(reader, scanline, width)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		for x := 0; x < width; x++ {
+			pixels[y*width+x] = rgbeToColor(scanline[x*4 : x*4+4])
+		}
+	}
+	return width, height, pixels, nil
+}
+
+// readScanline reads one scanline of RGBE pixels, handling both flat and run-length encoded data
+func readScanline(reader *bufio.Reader, scanline []byte, width int) error {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return err
+	}
+
+	// scanlines outside of the encodable range, or without the marker, are stored flat
+	if width < 8 || width > 0x7fff || header[0] != 2 || header[1] != 2 || header[2]&0x80 != 0 {
+		copy(scanline, header)
+		_, err = io.ReadFull(reader, scanline[4:])
+		return err
+	}
+	if int(header[2])<<8|int(header[3]) != width {
+		return fmt.Errorf("hdr scanline width mismatch")
+	}
+
+	// each of the four channels is run-length encoded separately
+	for channel := 0; channel < 4; channel++ {
+		for x := 0; x < width; {
+			count, err := reader.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				// a run of the same value
+				count -= 128
+				if x+int(count) > width {
+					return fmt.Errorf("hdr scanline run overflows width")
+				}
+				value, err := reader.ReadByte()
+				if err != nil {
+					return err
+				}
+				for i := 0; i < int(count); i++ {
+					scanline[(x+i)*4+channel] = value
+				}
+				x += int(count)
+			} else {
+				// a run of literal values
+				if count == 0 || x+int(count) > width {
+					return fmt.Errorf("hdr scanline literal overflows width")
+				}
+				for i := 0; i < int(count); i++ {
+					value, err := reader.ReadByte()
+					if err != nil {
+						return err
+					}
+					scanline[(x+i)*4+channel] = value
+				}
+				x += int(count)
+			}
+		}
+	}
+	return nil
+}
+
+// rgbeToColor converts a shared-exponent RGBE pixel to a linear Color
+func rgbeToColor(rgbe []byte) shading.Color {
+	if rgbe[3] == 0 {
+		return shading.ColorBlack
+	}
+	scale := math.Ldexp(1.0, int(rgbe[3])-(128+8))
+	return shading.Color{
+		Red:   float64(rgbe[0]) * scale,
+		Green: float64(rgbe[1]) * scale,
+		Blue:  float64(rgbe[2]) * scale,
+	}
+}
@@ -0,0 +1,158 @@
+package environment
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/shading"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// Image is an Environment backed by a latitude-longitude (equirectangular) image, such as an HDR sky
+// it is importance sampled by a distribution proportional to the luminance of each pixel
+type Image struct {
+	FileName     string  `json:"image_file_name"`
+	Gamma        float64 `json:"gamma"`     // counter-gamma correction for low dynamic range images
+	Magnitude    float64 `json:"magnitude"` // amount to scale the image's colors by
+	Rotation     float64 `json:"rotation"`  // rotation of the image around the Y axis in degrees
+	width        int
+	height       int
+	pixels       []shading.Color
+	sinRotation  float64
+	cosRotation  float64
+	distribution *Distribution2D
+}
+
+// Load decodes the image from the given filename and builds its sampling distribution
+func (ei *Image) Load() error {
+	imageFile, err := os.Open(ei.FileName)
+	if err != nil {
+		return err
+	}
+	defer imageFile.Close()
+
+	if strings.HasSuffix(ei.FileName, ".hdr") {
+		ei.width, ei.height, ei.pixels, err = decodeHDR(imageFile)
+		if err != nil {
+			return err
+		}
+	} else {
+		var img image.Image
+		if strings.HasSuffix(ei.FileName, ".png") {
+			img, err = png.Decode(imageFile)
+		} else if strings.HasSuffix(ei.FileName, ".jpg") || strings.HasSuffix(ei.FileName, ".jpeg") {
+			img, err = jpeg.Decode(imageFile)
+		} else {
+			return fmt.Errorf("unknown image filetype (%s)", ei.FileName)
+		}
+		if err != nil {
+			return err
+		}
+		bounds := img.Bounds()
+		ei.width = bounds.Dx()
+		ei.height = bounds.Dy()
+		ei.pixels = make([]shading.Color, ei.width*ei.height)
+		for y := 0; y < ei.height; y++ {
+			for x := 0; x < ei.width; x++ {
+				// low dynamic range images are assumed to be gamma-encoded
+				ei.pixels[y*ei.width+x] = shading.MakeColor(img.At(bounds.Min.X+x, bounds.Min.Y+y)).Pow(ei.Gamma)
+			}
+		}
+	}
+	for i := range ei.pixels {
+		ei.pixels[i] = ei.pixels[i].MultScalar(ei.Magnitude)
+	}
+
+	theta := ei.Rotation * math.Pi / 180.0
+	ei.sinRotation = math.Sin(theta)
+	ei.cosRotation = math.Cos(theta)
+
+	ei.distribution = NewDistribution2D(ei.weights())
+	return nil
+}
+
+// Value returns the radiance arriving from the given direction
+func (ei *Image) Value(direction geometry.Vector) shading.Color {
+	u, v := DirectionToUV(ei.toImage(direction))
+	return ei.lookup(u, v)
+}
+
+// Sample picks a direction towards the environment with probability proportional to its brightness
+// it returns the direction, the radiance arriving from it, and its PDF with respect to solid angle
+func (ei *Image) Sample(rng *rand.Rand) (geometry.Vector, shading.Color, float64) {
+	u, v, pdfUV := ei.distribution.SampleContinuous(rng.Float64(), rng.Float64())
+	if pdfUV == 0.0 {
+		return geometry.VectorZero, shading.ColorBlack, 0.0
+	}
+	sinTheta := math.Sin(math.Pi * (1.0 - v))
+	if sinTheta == 0.0 {
+		return geometry.VectorZero, shading.ColorBlack, 0.0
+	}
+	direction := ei.fromImage(UVToDirection(u, v))
+	return direction, ei.lookup(u, v), pdfUV / (2.0 * math.Pi * math.Pi * sinTheta)
+}
+
+// PDF returns the probability density, with respect to solid angle, of Sample returning the given direction
+func (ei *Image) PDF(direction geometry.Vector) float64 {
+	u, v := DirectionToUV(ei.toImage(direction))
+	sinTheta := math.Sin(math.Pi * (1.0 - v))
+	if sinTheta == 0.0 {
+		return 0.0
+	}
+	return ei.distribution.PDF(u, v) / (2.0 * math.Pi * math.Pi * sinTheta)
+}
+
+// weights returns the luminance of each pixel scaled by sin(theta), laid out bottom row first
+// the sin(theta) term compensates for the stretching of rows near the poles
+func (ei *Image) weights() [][]float64 {
+	weights := make([][]float64, ei.height)
+	for row := 0; row < ei.height; row++ {
+		y := ei.height - 1 - row
+		sinTheta := math.Sin(math.Pi * (float64(y) + 0.5) / float64(ei.height))
+		weights[row] = make([]float64, ei.width)
+		for x := 0; x < ei.width; x++ {
+			weights[row][x] = ei.pixels[y*ei.width+x].Luminance() * sinTheta
+		}
+	}
+	return weights
+}
+
+// lookup returns the pixel color at the given latitude-longitude coordinates
+func (ei *Image) lookup(u, v float64) shading.Color {
+	x := int(u * float64(ei.width))
+	y := int((1.0 - v) * float64(ei.height))
+	if x < 0 {
+		x = 0
+	} else if x > ei.width-1 {
+		x = ei.width - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y > ei.height-1 {
+		y = ei.height - 1
+	}
+	return ei.pixels[y*ei.width+x]
+}
+
+// toImage rotates a world direction into the image's frame
+func (ei *Image) toImage(d geometry.Vector) geometry.Vector {
+	return geometry.Vector{
+		X: ei.cosRotation*d.X - ei.sinRotation*d.Z,
+		Y: d.Y,
+		Z: ei.sinRotation*d.X + ei.cosRotation*d.Z,
+	}
+}
+
+// fromImage rotates a direction in the image's frame back into the world
+func (ei *Image) fromImage(d geometry.Vector) geometry.Vector {
+	return geometry.Vector{
+		X: ei.cosRotation*d.X + ei.sinRotation*d.Z,
+		Y: d.Y,
+		Z: -ei.sinRotation*d.X + ei.cosRotation*d.Z,
+	}
+}
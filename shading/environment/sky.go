@@ -0,0 +1,263 @@
+package environment
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/shading"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// skyResolution is the height of the latitude-longitude grid the sky is tabulated on for importance sampling
+const skyResolution = 128
+
+// twilightDepth is how far in degrees the sun sets below the horizon before the sky is dark, the end of civil twilight
+const twilightDepth = 6.0
+
+// Sky is an Environment implementing the Preetham analytic daylight model along with a matching sun disk
+// directions are oriented with +Y up, north towards -Z and east towards +X
+type Sky struct {
+	SunElevation       float64       `json:"sun_elevation"`        // angle of the sun above the horizon in degrees, negative below it
+	SunAzimuth         float64       `json:"sun_azimuth"`          // angle of the sun clockwise from north in degrees
+	DateTime           string        `json:"date_time"`            // optional RFC 3339 time used to compute the sun's position
+	Latitude           float64       `json:"latitude"`             // latitude of the viewer in degrees, used with DateTime
+	Longitude          float64       `json:"longitude"`            // longitude of the viewer in degrees (east positive), used with DateTime
+	Turbidity          float64       `json:"turbidity"`            // haziness of the atmosphere, from 2 (clear) to 10 (hazy)
+	Magnitude          float64       `json:"magnitude"`            // amount to scale the sky's luminance (in kcd/m^2) by
+	GroundColor        shading.Color `json:"ground_color"`         // color returned for directions below the horizon
+	HideSun            bool          `json:"hide_sun"`             // should the sun disk be left out of the sky?
+	SunIlluminance     float64       `json:"sun_illuminance"`      // illuminance of the sun above the atmosphere in klx
+	SunAngularDiameter float64       `json:"sun_angular_diameter"` // apparent diameter of the sun disk in degrees
+
+	sunDirection   geometry.Vector
+	sunTheta       float64 // angle between the sun and the zenith
+	sunHidden      bool    // is the sun disk left out, either by HideSun or by being below the horizon?
+	twilight       float64 // fraction of the sky's light left as the sun sets below the horizon
+	zenith         [3]float64
+	perez          [3][5]float64
+	perezZenith    [3]float64
+	sunCosMax      float64 // cosine of the sun disk's angular radius
+	sunRadiance    shading.Color
+	sunProbability float64 // chance of sampling the sun instead of the sky
+	distribution   *Distribution2D
+}
+
+// Setup fills in the derived fields of the sky model
+func (s *Sky) Setup() (*Sky, error) {
+	if s.Turbidity < 1.0 {
+		return nil, fmt.Errorf("sky turbidity is less than 1")
+	}
+	if s.Magnitude <= 0.0 {
+		return nil, fmt.Errorf("sky magnitude is 0 or negative")
+	}
+	if s.SunAngularDiameter <= 0.0 || s.SunAngularDiameter >= 180.0 {
+		return nil, fmt.Errorf("sun angular diameter is not between 0 and 180 degrees")
+	}
+
+	if s.DateTime != "" {
+		t, err := time.Parse(time.RFC3339, s.DateTime)
+		if err != nil {
+			return nil, err
+		}
+		s.SunElevation, s.SunAzimuth = SunPosition(t, s.Latitude, s.Longitude)
+	}
+	if s.SunElevation < -90.0 || s.SunElevation > 90.0 {
+		return nil, fmt.Errorf("sun elevation (%f) is not between -90 and 90 degrees", s.SunElevation)
+	}
+
+	// the sky model only holds with the sun above the horizon, so a sun below it lights the sky as it would
+	// on the horizon, with no sun disk, fading to black through civil twilight as night falls
+	s.sunHidden = s.HideSun || s.SunElevation < 0.0
+	s.twilight = math.Max(0.0, math.Min(1.0, 1.0+s.SunElevation/twilightDepth))
+	elevation := math.Max(0.0, s.SunElevation) * math.Pi / 180.0
+	azimuth := s.SunAzimuth * math.Pi / 180.0
+	s.sunDirection = geometry.Vector{
+		X: math.Cos(elevation) * math.Sin(azimuth),
+		Y: math.Sin(elevation),
+		Z: -math.Cos(elevation) * math.Cos(azimuth),
+	}
+	s.sunTheta = math.Pi/2.0 - elevation
+
+	s.setupSky()
+	s.setupSun()
+	s.setupDistribution()
+	return s, nil
+}
+
+// Value returns the radiance arriving from the given direction
+func (s *Sky) Value(direction geometry.Vector) shading.Color {
+	d := direction.Unit()
+	c := s.skyValue(d)
+	if !s.sunHidden && d.Dot(s.sunDirection) >= s.sunCosMax {
+		c = c.Add(s.sunRadiance)
+	}
+	return c
+}
+
+// Sample picks a direction towards either the sun or the sky with probability proportional to their brightness
+// it returns the direction, the radiance arriving from it, and its PDF with respect to solid angle
+func (s *Sky) Sample(rng *rand.Rand) (geometry.Vector, shading.Color, float64) {
+	var direction geometry.Vector
+	if rng.Float64() < s.sunProbability {
+		direction = s.sampleSunDisk(rng)
+	} else {
+		u, v, pdfUV := s.distribution.SampleContinuous(rng.Float64(), rng.Float64())
+		if pdfUV == 0.0 {
+			return geometry.VectorZero, shading.ColorBlack, 0.0
+		}
+		direction = UVToDirection(u, v)
+	}
+	pdf := s.PDF(direction)
+	if pdf == 0.0 {
+		return geometry.VectorZero, shading.ColorBlack, 0.0
+	}
+	return direction, s.Value(direction), pdf
+}
+
+// PDF returns the probability density, with respect to solid angle, of Sample returning the given direction
+func (s *Sky) PDF(direction geometry.Vector) float64 {
+	d := direction.Unit()
+	pdf := 0.0
+	if s.sunProbability > 0.0 && d.Dot(s.sunDirection) >= s.sunCosMax {
+		pdf += s.sunProbability / (2.0 * math.Pi * (1.0 - s.sunCosMax))
+	}
+	u, v := DirectionToUV(d)
+	sinTheta := math.Sin(math.Pi * (1.0 - v))
+	if sinTheta > 0.0 {
+		pdf += (1.0 - s.sunProbability) * s.distribution.PDF(u, v) / (2.0 * math.Pi * math.Pi * sinTheta)
+	}
+	return pdf
+}
+
+// setupSky computes the Perez distribution coefficients and zenith values for the current sun and turbidity
+func (s *Sky) setupSky() {
+	t := s.Turbidity
+	// coefficients for luminance Y and chromaticities x and y, in that order
+	s.perez = [3][5]float64{
+		{0.1787*t - 1.4630, -0.3554*t + 0.4275, -0.0227*t + 5.3251, 0.1206*t - 2.5771, -0.0670*t + 0.3703},
+		{-0.0193*t - 0.2592, -0.0665*t + 0.0008, -0.0004*t + 0.2125, -0.0641*t - 0.8989, -0.0033*t + 0.0452},
+		{-0.0167*t - 0.2608, -0.0950*t + 0.0092, -0.0079*t + 0.2102, -0.0441*t - 1.6537, -0.0109*t + 0.0529},
+	}
+
+	theta := s.sunTheta
+	theta2 := theta * theta
+	theta3 := theta2 * theta
+	chi := (4.0/9.0 - t/120.0) * (math.Pi - 2.0*theta)
+	s.zenith[0] = (4.0453*t-4.9710)*math.Tan(chi) - 0.2155*t + 2.4192
+	s.zenith[1] = t*t*(0.00166*theta3-0.00375*theta2+0.00209*theta) +
+		t*(-0.02903*theta3+0.06377*theta2-0.03202*theta+0.00394) +
+		(0.11693*theta3 - 0.21196*theta2 + 0.06052*theta + 0.25886)
+	s.zenith[2] = t*t*(0.00275*theta3-0.00610*theta2+0.00317*theta) +
+		t*(-0.04214*theta3+0.08970*theta2-0.04153*theta+0.00516) +
+		(0.15346*theta3 - 0.26756*theta2 + 0.06670*theta + 0.26688)
+
+	for i := range s.perez {
+		s.perezZenith[i] = perezFunction(s.perez[i], 0.0, theta)
+	}
+}
+
+// setupSun computes the color of the sun disk as attenuated by the atmosphere
+func (s *Sky) setupSun() {
+	s.sunCosMax = math.Cos(s.SunAngularDiameter * math.Pi / 360.0)
+	if s.sunHidden {
+		return
+	}
+
+	// relative optical mass of the air the sunlight passes through
+	thetaDegrees := s.sunTheta * 180.0 / math.Pi
+	opticalMass := 1.0 / (math.Cos(s.sunTheta) + 0.15*math.Pow(93.885-thetaDegrees, -1.253))
+
+	// Rayleigh and aerosol (Angstrom) transmittance at representative red, green, and blue wavelengths (in micrometers)
+	beta := 0.04608*s.Turbidity - 0.04586
+	transmittance := func(lambda float64) float64 {
+		rayleigh := math.Exp(-0.008735 * math.Pow(lambda, -4.08) * opticalMass)
+		aerosol := math.Exp(-beta * math.Pow(lambda, -1.3) * opticalMass)
+		return rayleigh * aerosol
+	}
+
+	solidAngle := 2.0 * math.Pi * (1.0 - s.sunCosMax)
+	s.sunRadiance = shading.Color{
+		Red:   transmittance(0.680),
+		Green: transmittance(0.550),
+		Blue:  transmittance(0.440),
+	}.MultScalar(s.SunIlluminance * s.Magnitude / solidAngle)
+}
+
+// setupDistribution tabulates the sky on a latitude-longitude grid to importance sample it
+func (s *Sky) setupDistribution() {
+	width := 2 * skyResolution
+	height := skyResolution
+	weights := make([][]float64, height)
+	skyPower := 0.0
+	for row := 0; row < height; row++ {
+		v := (float64(row) + 0.5) / float64(height)
+		sinTheta := math.Sin(math.Pi * (1.0 - v))
+		weights[row] = make([]float64, width)
+		for col := 0; col < width; col++ {
+			u := (float64(col) + 0.5) / float64(width)
+			weights[row][col] = s.skyValue(UVToDirection(u, v)).Luminance() * sinTheta
+			skyPower += weights[row][col]
+		}
+	}
+	s.distribution = NewDistribution2D(weights)
+
+	// split samples between the sun and sky based on how much light each delivers,
+	// keeping some samples for each so neither is starved
+	if s.sunHidden {
+		s.sunProbability = 0.0
+		return
+	}
+	skyPower *= 2.0 * math.Pi * math.Pi / float64(width*height)
+	sunPower := s.sunRadiance.Luminance() * 2.0 * math.Pi * (1.0 - s.sunCosMax)
+	s.sunProbability = math.Max(0.1, math.Min(0.9, sunPower/(sunPower+skyPower)))
+}
+
+// skyValue evaluates the sky model, without the sun disk, in a given unit direction
+func (s *Sky) skyValue(d geometry.Vector) shading.Color {
+	if d.Y <= 0.0 {
+		return s.GroundColor
+	}
+	theta := math.Acos(math.Min(1.0, d.Y))
+	gamma := math.Acos(math.Max(-1.0, math.Min(1.0, d.Dot(s.sunDirection))))
+
+	var xyY [3]float64
+	for i := range xyY {
+		xyY[i] = s.zenith[i] * perezFunction(s.perez[i], theta, gamma) / s.perezZenith[i]
+	}
+	return xyYToColor(xyY[1], xyY[2], xyY[0]*s.Magnitude*s.twilight)
+}
+
+// sampleSunDisk returns a uniformly distributed direction within the cone subtended by the sun
+func (s *Sky) sampleSunDisk(rng *rand.Rand) geometry.Vector {
+	cosTheta := 1.0 - rng.Float64()*(1.0-s.sunCosMax)
+	sinTheta := math.Sqrt(math.Max(0.0, 1.0-cosTheta*cosTheta))
+	phi := 2.0 * math.Pi * rng.Float64()
+
+	// build an orthonormal basis around the sun direction
+	w := s.sunDirection
+	u, v := w.Basis()
+	return u.MultScalar(sinTheta * math.Cos(phi)).Add(v.MultScalar(sinTheta * math.Sin(phi))).Add(w.MultScalar(cosTheta))
+}
+
+// perezFunction is the Perez et al. sky luminance distribution for a view angle theta from the zenith
+// and angle gamma from the sun
+func perezFunction(c [5]float64, theta, gamma float64) float64 {
+	cosTheta := math.Max(math.Cos(theta), 1e-3)
+	cosGamma := math.Cos(gamma)
+	return (1.0 + c[0]*math.Exp(c[1]/cosTheta)) * (1.0 + c[2]*math.Exp(c[3]*gamma) + c[4]*cosGamma*cosGamma)
+}
+
+// xyYToColor converts a CIE xyY color to a linear sRGB Color
+func xyYToColor(x, y, luminance float64) shading.Color {
+	if y <= 0.0 {
+		return shading.ColorBlack
+	}
+	bigX := x / y * luminance
+	bigZ := (1.0 - x - y) / y * luminance
+	return shading.Color{
+		Red:   math.Max(0.0, 3.2406*bigX-1.5372*luminance-0.4986*bigZ),
+		Green: math.Max(0.0, -0.9689*bigX+1.8758*luminance+0.0415*bigZ),
+		Blue:  math.Max(0.0, 0.0557*bigX-0.2040*luminance+1.0570*bigZ),
+	}
+}
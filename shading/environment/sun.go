@@ -0,0 +1,38 @@
+package environment
+
+import (
+	"math"
+	"time"
+)
+
+// SunPosition approximates the sun's elevation above the horizon and azimuth clockwise from north, both in degrees,
+// for a given time and a viewer's latitude and longitude (east positive) in degrees
+// it follows the NOAA general solar position equations, which are accurate to within a fraction of a degree
+func SunPosition(t time.Time, latitude, longitude float64) (float64, float64) {
+	t = t.UTC()
+	hours := float64(t.Hour()) + float64(t.Minute())/60.0 + float64(t.Second())/3600.0
+
+	// fractional year in radians
+	gamma := 2.0 * math.Pi / 365.0 * (float64(t.YearDay()-1) + (hours-12.0)/24.0)
+
+	// equation of time in minutes and solar declination in radians
+	equationOfTime := 229.18 * (0.000075 + 0.001868*math.Cos(gamma) - 0.032077*math.Sin(gamma) -
+		0.014615*math.Cos(2.0*gamma) - 0.040849*math.Sin(2.0*gamma))
+	declination := 0.006918 - 0.399912*math.Cos(gamma) + 0.070257*math.Sin(gamma) -
+		0.006758*math.Cos(2.0*gamma) + 0.000907*math.Sin(2.0*gamma) -
+		0.002697*math.Cos(3.0*gamma) + 0.00148*math.Sin(3.0*gamma)
+
+	// true solar time in minutes and the hour angle in radians
+	trueSolarTime := hours*60.0 + equationOfTime + 4.0*longitude
+	hourAngle := (trueSolarTime/4.0 - 180.0) * math.Pi / 180.0
+
+	phi := latitude * math.Pi / 180.0
+	cosZenith := math.Sin(phi)*math.Sin(declination) + math.Cos(phi)*math.Cos(declination)*math.Cos(hourAngle)
+	zenith := math.Acos(math.Max(-1.0, math.Min(1.0, cosZenith)))
+
+	azimuth := math.Atan2(-math.Sin(hourAngle), math.Tan(declination)*math.Cos(phi)-math.Sin(phi)*math.Cos(hourAngle))
+	if azimuth < 0.0 {
+		azimuth += 2.0 * math.Pi
+	}
+	return 90.0 - zenith*180.0/math.Pi, azimuth * 180.0 / math.Pi
+}
@@ -16,14 +16,14 @@ type Dielectric struct {
 	RefractiveIndex    float64         `json:"refractive_index"`
 }
 
-// Reflectance returns the reflective color at texture coordinates (u, v)
-func (d Dielectric) Reflectance(u, v float64) shading.Color {
-	return d.ReflectanceTexture.Value(u, v)
+// Reflectance returns the reflective color at a hit
+func (d Dielectric) Reflectance(rayHit RayHit) shading.Color {
+	return textureValue(d.ReflectanceTexture, rayHit)
 }
 
-// Emittance returns the emissive color at texture coordinates (u, v)
-func (d Dielectric) Emittance(u, v float64) shading.Color {
-	return d.EmittanceTexture.Value(u, v)
+// Emittance returns the emissive color at a hit
+func (d Dielectric) Emittance(rayHit RayHit) shading.Color {
+	return textureValue(d.EmittanceTexture, rayHit)
 }
 
 // IsSpecular returns whether this material is specular in nature (vs. diffuse)
@@ -61,12 +61,14 @@ func (d Dielectric) Scatter(rayHit RayHit, rng *rand.Rand) (geometry.Ray, bool)
 		return geometry.Ray{
 			Origin:    hitPoint,
 			Direction: reflectionVector,
+			Time:      rayHit.Ray.Time,
 		}, true
 	}
 	// fmt.Println("refract!")
 	return geometry.Ray{
 		Origin:    hitPoint,
 		Direction: refractedVector,
+		Time:      rayHit.Ray.Time,
 	}, true
 
 }
@@ -0,0 +1,164 @@
+package material
+
+import (
+	"fluorescence/geometry"
+	"fluorescence/shading"
+	"fluorescence/shading/texture"
+	"math"
+	"math/rand"
+)
+
+// Hair is an implementation of a Material
+// It represents fibers such as hair and fur with a Marschner-style model: light reflects off the surface
+// of the fiber (R), passes through it (TT), or reflects once inside it (TRT), each into a cone around the fiber
+// shifted by the tilt of its cuticle scales and spread around it by the offset across the fiber it hit at
+// the fiber runs along the hit's Tangent, with V running across its width as curves record it
+type Hair struct {
+	ReflectanceTexture    texture.Texture `json:"-"`
+	EmittanceTexture      texture.Texture `json:"-"`
+	RefractiveIndex       float64         `json:"refractive_index"`       // index of refraction of the fiber, 1.55 if unset
+	LongitudinalRoughness float64         `json:"longitudinal_roughness"` // spread of the lobes along the fiber, from 0 to 1
+	AzimuthalRoughness    float64         `json:"azimuthal_roughness"`    // spread of the lobes around the fiber, from 0 to 1
+	ScaleAngle            float64         `json:"scale_angle"`            // tilt of the cuticle scales in degrees, around 2 for human hair
+}
+
+// hairLobes is the number of lobes sampled, R, TT and TRT, followed by one for all longer paths
+const hairLobes = 4
+
+// Reflectance returns the reflective color at a hit
+func (h Hair) Reflectance(rayHit RayHit) shading.Color {
+	return textureValue(h.ReflectanceTexture, rayHit)
+}
+
+// Emittance returns the emissive color at a hit
+func (h Hair) Emittance(rayHit RayHit) shading.Color {
+	return textureValue(h.EmittanceTexture, rayHit)
+}
+
+// IsSpecular returns whether this material is specular in nature (vs. diffuse)
+// This is currently unused and is likely to be deprecated in the future
+func (h Hair) IsSpecular() bool {
+	return false
+}
+
+// Scatter returns an incoming ray given a RayHit representing the outgoing ray
+// a lobe is picked in proportion to the light the fiber's Fresnel reflection sends into it, then the direction is
+// sampled from the lobe's longitudinal and azimuthal distributions as in pbrt's hair BSDF
+func (h Hair) Scatter(rayHit RayHit, rng *rand.Rand) (geometry.Ray, bool) {
+	hitPoint := rayHit.Ray.PointAt(rayHit.Time)
+	wo := rayHit.Ray.Direction.Unit().Negate()
+
+	// frame with x along the fiber, z facing the viewer and y across the fiber
+	tangent := rayHit.Tangent
+	if tangent == geometry.VectorZero {
+		tangent, _ = rayHit.NormalAtHit.Unit().Basis()
+	}
+	tangent = tangent.Unit()
+	facing := wo.Sub(tangent.MultScalar(wo.Dot(tangent)))
+	if facing.Magnitude() == 0.0 {
+		facing, _ = tangent.Basis()
+	}
+	facing = facing.Unit()
+	across := tangent.Cross(facing)
+
+	sinThetaO := math.Max(-1.0, math.Min(1.0, wo.Dot(tangent)))
+	cosThetaO := math.Sqrt(math.Max(0.0, 1.0-sinThetaO*sinThetaO))
+	phiO := math.Atan2(wo.Dot(facing), wo.Dot(across))
+	offset := math.Max(-1.0, math.Min(1.0, 2.0*rayHit.V-1.0))
+	gammaO := math.Asin(offset)
+	eta := h.RefractiveIndex
+	if eta == 0.0 {
+		eta = 1.55
+	}
+
+	// pick a lobe, assuming no absorption so that the fiber's color is left to the reflectance texture
+	f := fresnelDielectric(cosThetaO*math.Cos(gammaO), eta)
+	var weights [hairLobes]float64
+	weights[0] = f
+	weights[1] = (1.0 - f) * (1.0 - f)
+	weights[2] = weights[1] * f
+	if f < 1.0 {
+		weights[3] = weights[2] * f / (1.0 - f)
+	}
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	p := 0
+	for choice := rng.Float64() * total; p < hairLobes-1 && choice >= weights[p]; p++ {
+		choice -= weights[p]
+	}
+
+	// longitudinal variances and azimuthal scale mapped from the roughnesses
+	betaM := math.Max(1e-3, h.LongitudinalRoughness)
+	betaN := math.Max(1e-3, h.AzimuthalRoughness)
+	v := 0.726*betaM + 0.812*betaM*betaM + 3.7*math.Pow(betaM, 20.0)
+	v *= v
+	variances := [hairLobes]float64{v, 0.25 * v, 4.0 * v, 4.0 * v}
+	s := math.Sqrt(math.Pi/8.0) * (0.265*betaN + 1.194*betaN*betaN + 5.372*math.Pow(betaN, 22.0))
+
+	// tilt the outgoing direction by the scales, which shift R down by twice the scale angle, TT up by it,
+	// and TRT up by four times it
+	alpha := h.ScaleAngle * math.Pi / 180.0
+	tilts := [hairLobes]float64{-2.0 * alpha, alpha, 4.0 * alpha, 0.0}
+	sinThetaOp := sinThetaO*math.Cos(tilts[p]) + cosThetaO*math.Sin(tilts[p])
+	cosThetaOp := math.Abs(cosThetaO*math.Cos(tilts[p]) - sinThetaO*math.Sin(tilts[p]))
+
+	// sample the longitudinal lobe for the incoming angle
+	u := math.Max(rng.Float64(), 1e-5)
+	cosTheta := 1.0 + variances[p]*math.Log(u+(1.0-u)*math.Exp(-2.0/variances[p]))
+	sinTheta := math.Sqrt(math.Max(0.0, 1.0-cosTheta*cosTheta))
+	cosPhi := math.Cos(2.0 * math.Pi * rng.Float64())
+	sinThetaI := math.Max(-1.0, math.Min(1.0, -cosTheta*sinThetaOp+sinTheta*cosPhi*cosThetaOp))
+	cosThetaI := math.Sqrt(math.Max(0.0, 1.0-sinThetaI*sinThetaI))
+
+	// sample the azimuthal lobe around the deflection of each path through the fiber
+	var deltaPhi float64
+	if p < hairLobes-1 {
+		etaPerpendicular := math.Sqrt(math.Max(0.0, eta*eta-sinThetaO*sinThetaO)) / math.Max(cosThetaO, 1e-9)
+		gammaT := math.Asin(math.Max(-1.0, math.Min(1.0, offset/etaPerpendicular)))
+		deltaPhi = 2.0*float64(p)*gammaT - 2.0*gammaO + float64(p)*math.Pi
+		deltaPhi += sampleTrimmedLogistic(rng.Float64(), s, -math.Pi, math.Pi)
+	} else {
+		deltaPhi = 2.0 * math.Pi * rng.Float64()
+	}
+	phiI := phiO + deltaPhi
+
+	direction := tangent.MultScalar(sinThetaI).
+		Add(across.MultScalar(cosThetaI * math.Cos(phiI))).
+		Add(facing.MultScalar(cosThetaI * math.Sin(phiI)))
+	return geometry.Ray{
+		Origin:    hitPoint,
+		Direction: direction,
+		Time:      rayHit.Ray.Time,
+	}, true
+}
+
+// fresnelDielectric returns the fraction of unpolarized light reflected at a dielectric boundary
+// the light arrives at an angle with the given cosine from the side with index 1, or from the other side if it is negative
+func fresnelDielectric(cosThetaI, eta float64) float64 {
+	cosThetaI = math.Max(-1.0, math.Min(1.0, cosThetaI))
+	if cosThetaI < 0.0 {
+		eta = 1.0 / eta
+		cosThetaI = -cosThetaI
+	}
+	sin2ThetaT := (1.0 - cosThetaI*cosThetaI) / (eta * eta)
+	if sin2ThetaT >= 1.0 {
+		// total internal reflection
+		return 1.0
+	}
+	cosThetaT := math.Sqrt(1.0 - sin2ThetaT)
+	parallel := (eta*cosThetaI - cosThetaT) / (eta*cosThetaI + cosThetaT)
+	perpendicular := (cosThetaI - eta*cosThetaT) / (cosThetaI + eta*cosThetaT)
+	return (parallel*parallel + perpendicular*perpendicular) / 2.0
+}
+
+// sampleTrimmedLogistic samples a logistic distribution with scale s centered on 0 and restricted to [a, b]
+func sampleTrimmedLogistic(u, s, a, b float64) float64 {
+	cdf := func(x float64) float64 {
+		return 1.0 / (1.0 + math.Exp(-x/s))
+	}
+	k := cdf(b) - cdf(a)
+	x := -s * math.Log(1.0/(u*k+cdf(a))-1.0)
+	return math.Max(a, math.Min(b, x))
+}
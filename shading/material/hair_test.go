@@ -0,0 +1,85 @@
+package material
+
+import (
+	"fluorescence/geometry"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// hairHit returns a hit on a fiber running along the given tangent, seen from the direction wo
+func hairHit(wo, tangent geometry.Vector, v float64) RayHit {
+	return RayHit{
+		Ray: geometry.Ray{
+			Origin:    geometry.Point{}.AddVector(wo),
+			Direction: wo.Negate(),
+		},
+		NormalAtHit: geometry.Vector{Z: 1.0},
+		Tangent:     tangent,
+		Time:        1.0,
+		V:           v,
+	}
+}
+
+// finite returns whether a direction can be followed, with no infinite or NaN components and some length
+func finite(d geometry.Vector) bool {
+	for _, c := range [3]float64{d.X, d.Y, d.Z} {
+		if math.IsNaN(c) || math.IsInf(c, 0) {
+			return false
+		}
+	}
+	return d.Magnitude() > 0.0
+}
+
+func TestHairScatterFinite(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	h := Hair{LongitudinalRoughness: 0.3, AzimuthalRoughness: 0.3, ScaleAngle: 2.0}
+	for i := 0; i < 10000; i++ {
+		wo := geometry.RandomInUnitSphere(rng).Unit()
+		r, ok := h.Scatter(hairHit(wo, geometry.Vector{X: 1.0}, rng.Float64()), rng)
+		if !ok || !finite(r.Direction) {
+			t.Fatalf("Expected a finite direction for wo %v but got %v (%t)\n", wo, r.Direction, ok)
+		}
+	}
+}
+
+func TestHairScatterZeroTangent(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	h := Hair{}
+	// along the normal, and along the tangent the normal falls back to, where the fiber frame has no facing axis
+	tangent, _ := geometry.Vector{Z: 1.0}.Basis()
+	for _, wo := range []geometry.Vector{{Z: 1.0}, tangent, {X: 0.6, Z: 0.8}} {
+		for _, v := range []float64{0.0, 0.5, 1.0} {
+			for i := 0; i < 100; i++ {
+				r, ok := h.Scatter(hairHit(wo, geometry.VectorZero, v), rng)
+				if !ok || !finite(r.Direction) {
+					t.Fatalf("Expected a finite direction for wo %v without a tangent but got %v (%t)\n", wo, r.Direction, ok)
+				}
+			}
+		}
+	}
+}
+
+func TestHairScatterReflectionTilt(t *testing.T) {
+	// a fiber along X seen 30 degrees off perpendicular to it, hit across its middle
+	wo := geometry.Vector{X: math.Sin(math.Pi / 6.0), Z: math.Cos(math.Pi / 6.0)}
+	for _, scaleAngle := range []float64{0.0, 2.0} {
+		rng := rand.New(rand.NewSource(0))
+		// a fiber this dense reflects nearly everything off its surface, leaving only the R lobe,
+		// which smooth fibers keep close to its center
+		h := Hair{RefractiveIndex: 1e6, LongitudinalRoughness: 0.05, AzimuthalRoughness: 0.05, ScaleAngle: scaleAngle}
+		sum := geometry.VectorZero
+		for i := 0; i < 1000; i++ {
+			r, _ := h.Scatter(hairHit(wo, geometry.Vector{X: 1.0}, 0.5), rng)
+			sum = sum.Add(r.Direction.Unit())
+		}
+		// the mirror direction about the fiber, turned toward the root by twice the scale angle
+		theta := -math.Pi/6.0 + 2.0*scaleAngle*math.Pi/180.0
+		expected := geometry.Vector{X: math.Sin(theta), Z: math.Cos(theta)}
+		angle := math.Acos(math.Min(1.0, sum.Unit().Dot(expected))) * 180.0 / math.Pi
+		if angle > 0.5 {
+			t.Errorf("Expected the R lobe with scale angle %f centered on %v but it was %f degrees away at %v\n",
+				scaleAngle, expected, angle, sum.Unit())
+		}
+	}
+}
@@ -14,14 +14,14 @@ type Lambertian struct {
 	EmittanceTexture   texture.Texture `json:"-"`
 }
 
-// Reflectance returns the reflective color at texture coordinates (u, v)
-func (l Lambertian) Reflectance(u, v float64) shading.Color {
-	return l.ReflectanceTexture.Value(u, v)
+// Reflectance returns the reflective color at a hit
+func (l Lambertian) Reflectance(rayHit RayHit) shading.Color {
+	return textureValue(l.ReflectanceTexture, rayHit)
 }
 
-// Emittance returns the emissive color at texture coordinates (u, v)
-func (l Lambertian) Emittance(u, v float64) shading.Color {
-	return l.EmittanceTexture.Value(u, v)
+// Emittance returns the emissive color at a hit
+func (l Lambertian) Emittance(rayHit RayHit) shading.Color {
+	return textureValue(l.EmittanceTexture, rayHit)
 }
 
 // IsSpecular returns whether this material is specular in nature (vs. diffuse)
@@ -31,11 +31,20 @@ func (l Lambertian) IsSpecular() bool {
 }
 
 // Scatter returns an incoming ray given a RayHit representing the outgoing ray
+// offsetting the unit normal by a point on the unit sphere's surface gives directions distributed exactly
+// by the cosine to the normal, matching the PDF the tracer weighs environment samples against
+// (a point inside the sphere, as used before, favours grazing directions less than the cosine does)
 func (l Lambertian) Scatter(rayHit RayHit, rng *rand.Rand) (geometry.Ray, bool) {
 	hitPoint := rayHit.Ray.PointAt(rayHit.Time)
-	target := hitPoint.AddVector(rayHit.NormalAtHit).AddVector(geometry.RandomInUnitSphere(rng))
+	normal := rayHit.NormalAtHit.Unit()
+	direction := normal.Add(geometry.RandomInUnitSphere(rng).Unit())
+	if direction.Magnitude() < 1e-8 {
+		// the point was opposite the normal, leaving no direction to scatter in
+		direction = normal
+	}
 	return geometry.Ray{
 		Origin:    hitPoint,
-		Direction: hitPoint.To(target),
+		Direction: direction,
+		Time:      rayHit.Ray.Time,
 	}, true
 }
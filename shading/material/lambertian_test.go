@@ -0,0 +1,37 @@
+package material
+
+import (
+	"fluorescence/geometry"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestLambertianScatterCosineWeighted(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	rayHit := RayHit{
+		Ray: geometry.Ray{
+			Origin:    geometry.Point{Y: 1.0},
+			Direction: geometry.Vector{Y: -1.0},
+		},
+		NormalAtHit: geometry.Vector{Y: 2.0},
+		Time:        1.0,
+	}
+	const samples = 100000
+	sum := 0.0
+	for i := 0; i < samples; i++ {
+		r, ok := Lambertian{}.Scatter(rayHit, rng)
+		if !ok {
+			t.Fatalf("Expected a scattered ray but got none\n")
+		}
+		cosine := r.Direction.Unit().Y
+		if r.Direction.Magnitude() == 0.0 || math.IsNaN(cosine) || cosine < 0.0 {
+			t.Fatalf("Expected a direction above the surface but got %v\n", r.Direction)
+		}
+		sum += cosine
+	}
+	// directions distributed by the cosine to the normal have a mean cosine of 2/3
+	if math.Abs(sum/samples-2.0/3.0) > 0.005 {
+		t.Errorf("Expected a mean cosine of 2/3 but got %f\n", sum/samples)
+	}
+}
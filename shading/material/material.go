@@ -3,13 +3,14 @@ package material
 import (
 	"fluorescence/geometry"
 	"fluorescence/shading"
+	"fluorescence/shading/texture"
 	"math/rand"
 )
 
 // Material described the implementation of a surface material
 type Material interface {
-	Reflectance(u, v float64) shading.Color
-	Emittance(u, v float64) shading.Color
+	Reflectance(rayHit RayHit) shading.Color
+	Emittance(rayHit RayHit) shading.Color
 	IsSpecular() bool
 	Scatter(RayHit, *rand.Rand) (geometry.Ray, bool)
 }
@@ -18,8 +19,20 @@ type Material interface {
 type RayHit struct {
 	Ray         geometry.Ray
 	NormalAtHit geometry.Vector
+	Tangent     geometry.Vector // direction along fibers such as hair, or zero for surfaces without one
 	Time        float64
-	U           float64 // texture coordinate U
-	V           float64 // texture coordinate V
+	U           float64    // texture coordinate U
+	V           float64    // texture coordinate V
+	Triangle    int        // index of the mesh triangle hit, for textures interpolating the mesh's vertex attributes
+	Barycentric [2]float64 // weights of the triangle's second and third vertices at the hit
 	Material    Material
 }
+
+// textureValue returns the color of a texture at a hit, looked up by its texture coordinates
+// or, for textures interpolating a mesh's vertex attributes, by the triangle hit and where the hit lies within it
+func textureValue(t texture.Texture, rayHit RayHit) shading.Color {
+	if vt, ok := t.(texture.VertexTexture); ok {
+		return vt.VertexValue(rayHit.Triangle, rayHit.Barycentric[0], rayHit.Barycentric[1])
+	}
+	return t.Value(rayHit.U, rayHit.V)
+}
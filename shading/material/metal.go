@@ -15,14 +15,14 @@ type Metal struct {
 	Fuzziness          float64         `json:"fuzziness"`
 }
 
-// Reflectance returns the reflective color at texture coordinates (u, v)
-func (m Metal) Reflectance(u, v float64) shading.Color {
-	return m.ReflectanceTexture.Value(u, v)
+// Reflectance returns the reflective color at a hit
+func (m Metal) Reflectance(rayHit RayHit) shading.Color {
+	return textureValue(m.ReflectanceTexture, rayHit)
 }
 
-// Emittance returns the emissive color at texture coordinates (u, v)
-func (m Metal) Emittance(u, v float64) shading.Color {
-	return m.EmittanceTexture.Value(u, v)
+// Emittance returns the emissive color at a hit
+func (m Metal) Emittance(rayHit RayHit) shading.Color {
+	return textureValue(m.EmittanceTexture, rayHit)
 }
 
 // IsSpecular returns whether this material is specular in nature (vs. diffuse)
@@ -42,6 +42,7 @@ func (m Metal) Scatter(rayHit RayHit, rng *rand.Rand) (geometry.Ray, bool) {
 		return geometry.Ray{
 			Origin:    hitPoint,
 			Direction: reflectionVector,
+			Time:      rayHit.Ray.Time,
 		}, true
 	}
 	return geometry.RayZero, false
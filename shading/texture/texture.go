@@ -6,3 +6,9 @@ import "fluorescence/shading"
 type Texture interface {
 	Value(u, v float64) shading.Color
 }
+
+// VertexTexture is implemented by textures interpolating a mesh's vertex attributes,
+// which look up a hit by the triangle it is on and its barycentric weights rather than by its texture coordinates
+type VertexTexture interface {
+	VertexValue(triangle int, b1, b2 float64) shading.Color
+}
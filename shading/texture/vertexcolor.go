@@ -0,0 +1,41 @@
+package texture
+
+import "fluorescence/shading"
+
+// VertexColor holds information about a texture interpolated from the per-vertex colors of a triangle mesh
+// it is looked up by the triangle hit and the barycentric weights b1 and b2 of the triangle's second and third vertices,
+// which mesh hits carry alongside their texture coordinates
+type VertexColor struct {
+	ObjectName string          `json:"object_name"` // name of the mesh object whose colors are used
+	Colors     []shading.Color `json:"-"`           // per-vertex colors, shared with the mesh
+	Indices    []int           `json:"-"`           // three color indices per triangle, shared with the mesh
+}
+
+// Value returns the average of the vertex colors, as texture coordinates alone do not locate a hit within a triangle
+func (vc *VertexColor) Value(u, v float64) shading.Color {
+	if len(vc.Colors) == 0 {
+		return shading.ColorBlack
+	}
+	sum := shading.ColorBlack
+	for _, c := range vc.Colors {
+		sum = sum.Add(c)
+	}
+	return sum.DivScalar(float64(len(vc.Colors)))
+}
+
+// VertexValue returns the color interpolated from a triangle's vertex colors at the given barycentric weights
+func (vc *VertexColor) VertexValue(triangle int, b1, b2 float64) shading.Color {
+	triangleCount := len(vc.Indices) / 3
+	if triangleCount == 0 {
+		return shading.ColorBlack
+	}
+	if triangle < 0 {
+		triangle = 0
+	} else if triangle > triangleCount-1 {
+		triangle = triangleCount - 1
+	}
+	i := 3 * triangle
+	return vc.Colors[vc.Indices[i]].MultScalar(1.0 - b1 - b2).Add(
+		vc.Colors[vc.Indices[i+1]].MultScalar(b1)).Add(
+		vc.Colors[vc.Indices[i+2]].MultScalar(b2))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fluorescence/geometry"
 	"fluorescence/shading"
+	"fluorescence/shading/material"
 	"image"
 	"math"
 	"math/rand"
@@ -62,7 +63,11 @@ func tracePixel(p *Parameters, x, y int, rng *rand.Rand) shading.Color {
 		u := (float64(x) + rng.Float64()) / float64(p.ImageWidth)
 		v := (float64(y) + rng.Float64()) / float64(p.ImageHeight)
 
-		ray := p.Scene.Camera.GetRay(u, v, rng)
+		ray, ok := p.Scene.Camera.GetRay(u, v, rng)
+		if !ok {
+			// nothing is seen outside of the camera's projection
+			continue
+		}
 
 		tempColor := traceRay(p, ray, rng, 0)
 		pixelColor = pixelColor.Add(tempColor)
@@ -76,6 +81,12 @@ func tracePixel(p *Parameters, x, y int, rng *rand.Rand) shading.Color {
 
 // traceRay casts in individual ray into the scene
 func traceRay(parameters *Parameters, r geometry.Ray, rng *rand.Rand, depth int) shading.Color {
+	return traceScatteredRay(parameters, r, rng, depth, 0.0)
+}
+
+// traceScatteredRay casts a ray into the scene that was scattered off a diffuse surface with PDF scatterPDF,
+// or 0 if it was not, in which case the environment it reaches is not weighed against sampling it directly
+func traceScatteredRay(parameters *Parameters, r geometry.Ray, rng *rand.Rand, depth int, scatterPDF float64) shading.Color {
 
 	// if we've gone too deep...
 	if depth > parameters.MaxBounces {
@@ -86,8 +97,16 @@ func traceRay(parameters *Parameters, r geometry.Ray, rng *rand.Rand, depth int)
 	rayHit, hitSomething := parameters.Scene.Objects.Intersection(r, parameters.TMin, parameters.TMax)
 	// if we did not hit something...
 	if !hitSomething {
-		// ...return the background color
-		// TODO: add support for HDR skymaps
+		// ...return the light arriving from the environment, if there is one...
+		if parameters.Environment != nil {
+			value := parameters.Environment.Value(r.Direction)
+			if scatterPDF > 0.0 {
+				// the surface also sampled the environment directly, so this ray only carries its share of the light
+				return value.MultScalar(powerHeuristic(scatterPDF, parameters.Environment.PDF(r.Direction)))
+			}
+			return value
+		}
+		// ...or the background color
 		return parameters.BackgroundColor
 	}
 
@@ -95,8 +114,8 @@ func traceRay(parameters *Parameters, r geometry.Ray, rng *rand.Rand, depth int)
 
 	// if the surface is BLACK, it's not going to let any incoming light contribute to the outgoing color
 	// so we can safely say no light is reflected and simply return the emittance of the material
-	if mat.Reflectance(rayHit.U, rayHit.V) == shading.ColorBlack {
-		return mat.Emittance(rayHit.U, rayHit.V)
+	if mat.Reflectance(*rayHit) == shading.ColorBlack {
+		return mat.Emittance(*rayHit)
 	}
 
 	// get the reflection incoming ray
@@ -105,10 +124,61 @@ func traceRay(parameters *Parameters, r geometry.Ray, rng *rand.Rand, depth int)
 	if !wasScattered {
 		return shading.ColorBlack
 	}
-	// get the color that came to this point and gave us the outgoing ray
-	incomingColor := traceRay(parameters, scatteredRay, rng, depth+1)
-	// return the (very-roughly approximated) value of the rendering equation
-	return mat.Emittance(rayHit.U, rayHit.V).Add(mat.Reflectance(rayHit.U, rayHit.V).MultColor(incomingColor))
+	if !isDiffuse(mat) || parameters.Environment == nil || depth+1 > parameters.MaxBounces {
+		// get the color that came to this point and gave us the outgoing ray
+		incomingColor := traceRay(parameters, scatteredRay, rng, depth+1)
+		// return the (very-roughly approximated) value of the rendering equation
+		return mat.Emittance(*rayHit).Add(mat.Reflectance(*rayHit).MultColor(incomingColor))
+	}
+
+	// diffuse surfaces also sample the environment directly, which finds small bright lights like the sun far more often
+	// than scattered rays do, and each estimate is weighed against the other by how likely either was to find the light
+	normal := rayHit.NormalAtHit.Unit()
+	cosinePDF := math.Max(0.0, normal.Dot(scatteredRay.Direction.Unit())) / math.Pi
+	incomingColor := traceScatteredRay(parameters, scatteredRay, rng, depth+1, cosinePDF)
+	incomingColor = incomingColor.Add(sampleEnvironment(parameters, *rayHit, normal, rng))
+	return mat.Emittance(*rayHit).Add(mat.Reflectance(*rayHit).MultColor(incomingColor))
+}
+
+// sampleEnvironment returns the light arriving at a diffuse hit from a direction sampled from the environment,
+// scaled so that multiplying by the surface's reflectance gives the light it reflects
+func sampleEnvironment(parameters *Parameters, rayHit material.RayHit, normal geometry.Vector, rng *rand.Rand) shading.Color {
+	direction, value, lightPDF := parameters.Environment.Sample(rng)
+	if lightPDF == 0.0 {
+		return shading.ColorBlack
+	}
+	cosine := normal.Dot(direction)
+	if cosine <= 0.0 {
+		return shading.ColorBlack
+	}
+	shadowRay := geometry.Ray{
+		Origin:    rayHit.Ray.PointAt(rayHit.Time),
+		Direction: direction,
+		Time:      rayHit.Ray.Time,
+	}
+	if _, blocked := parameters.Scene.Objects.Intersection(shadowRay, parameters.TMin, parameters.TMax); blocked {
+		return shading.ColorBlack
+	}
+	// a diffuse surface reflects cosine / pi of the light from each direction, which is also its scattering PDF
+	scatterPDF := cosine / math.Pi
+	return value.MultScalar(scatterPDF / lightPDF * powerHeuristic(lightPDF, scatterPDF))
+}
+
+// isDiffuse returns whether a material scatters light by the cosine to the normal, so its hits sample the environment
+func isDiffuse(mat material.Material) bool {
+	switch mat.(type) {
+	case material.Lambertian, *material.Lambertian:
+		return true
+	}
+	return false
+}
+
+// powerHeuristic returns the weight of a sample taken with PDF f against another technique with PDF g
+func powerHeuristic(f, g float64) float64 {
+	if f == 0.0 && g == 0.0 {
+		return 0.0
+	}
+	return f * f / (f*f + g*g)
 }
 
 // getTiles creates and return a grid of tiles on the image